@@ -0,0 +1,162 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmconfig // import "go.elastic.co/apm/v2/apmconfig"
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.elastic.co/apm/v2/internal/configutil"
+)
+
+// DefaultFileWatchInterval is the default interval at which
+// a FileWatcher polls for changes.
+const DefaultFileWatchInterval = 10 * time.Second
+
+// FileWatcher is a Watcher which polls a local file or directory for
+// agent config, for use when central config via APM Server is unavailable.
+//
+// If the path refers to a file, it must hold a YAML or JSON object mapping
+// config attribute names to values, e.g. "transaction_sample_rate: 0.5".
+//
+// If the path refers to a directory, each regular file in the directory
+// defines a config attribute: the file name is the attribute name, and
+// the file's contents, with leading and trailing whitespace removed, are
+// the value. As for environment variables, the attribute name may have the
+// prefix "ELASTIC_APM_", and is case-insensitive. Hidden files, whose names
+// begin with ".", are ignored. This is the layout of a Kubernetes ConfigMap
+// mounted as a volume.
+//
+// The service name and environment in WatchParams are not used; the
+// config applies to whichever agent is watching the path.
+type FileWatcher struct {
+	path     string
+	interval time.Duration
+}
+
+// NewFileWatcher returns a new FileWatcher which polls path for changes
+// at the given interval. If interval is zero, DefaultFileWatchInterval
+// will be used.
+func NewFileWatcher(path string, interval time.Duration) *FileWatcher {
+	if interval <= 0 {
+		interval = DefaultFileWatchInterval
+	}
+	return &FileWatcher{path: path, interval: interval}
+}
+
+// WatchConfig polls the file or directory for config until ctx is canceled.
+//
+// The current config is reported immediately, and thereafter whenever it
+// changes. Errors reading the config are reported once, until the error
+// changes or the config is successfully read again.
+func (w *FileWatcher) WatchConfig(ctx context.Context, params WatchParams) <-chan Change {
+	changes := make(chan Change)
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		var lastAttrs map[string]string
+		var lastErr string
+		for first := true; ; first = false {
+			if !first {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+			var change Change
+			attrs, err := w.readConfig()
+			if err != nil {
+				if err.Error() == lastErr {
+					continue
+				}
+				lastErr = err.Error()
+				lastAttrs = nil
+				change.Err = err
+			} else {
+				lastErr = ""
+				if lastAttrs != nil && equalAttrs(attrs, lastAttrs) {
+					continue
+				}
+				lastAttrs = attrs
+				change.Attrs = attrs
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case changes <- change:
+			}
+		}
+	}()
+	return changes
+}
+
+func (w *FileWatcher) readConfig() (map[string]string, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return configutil.ReadConfigFile(w.path)
+	}
+	entries, err := os.ReadDir(w.path)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		// Stat the path to follow symlinks, which are used
+		// for the files of Kubernetes ConfigMap volumes.
+		path := filepath.Join(w.path, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name = strings.TrimPrefix(strings.ToLower(name), "elastic_apm_")
+		attrs[name] = strings.TrimSpace(string(data))
+	}
+	return attrs, nil
+}
+
+func equalAttrs(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
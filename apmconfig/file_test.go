@@ -0,0 +1,147 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmconfig_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/v2/apmconfig"
+)
+
+func TestFileWatcherFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "transaction_sample_rate: 0.5\n")
+
+	changes := watchConfig(t, apmconfig.NewFileWatcher(path, time.Millisecond))
+	assert.Equal(t, apmconfig.Change{
+		Attrs: map[string]string{"transaction_sample_rate": "0.5"},
+	}, nextChange(t, changes))
+
+	writeFile(t, path, `{"transaction_sample_rate": 0.5, "recording": false}`)
+	assert.Equal(t, apmconfig.Change{
+		Attrs: map[string]string{"transaction_sample_rate": "0.5", "recording": "false"},
+	}, nextChange(t, changes))
+
+	writeFile(t, path, "recording: [")
+	change := nextChange(t, changes)
+	assert.Error(t, change.Err)
+	assert.Nil(t, change.Attrs)
+
+	writeFile(t, path, "recording: false\n")
+	assert.Equal(t, apmconfig.Change{
+		Attrs: map[string]string{"recording": "false"},
+	}, nextChange(t, changes))
+}
+
+func TestFileWatcherDirectory(t *testing.T) {
+	// Mimic the layout of a Kubernetes ConfigMap volume, where
+	// each key is a symlink into a hidden, versioned directory.
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0755))
+	writeFile(t, filepath.Join(dir, "..data", "transaction_sample_rate"), "0.5\n")
+	require.NoError(t, os.Symlink(
+		filepath.Join("..data", "transaction_sample_rate"),
+		filepath.Join(dir, "transaction_sample_rate"),
+	))
+	writeFile(t, filepath.Join(dir, ".hidden"), "ignored")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0755))
+
+	changes := watchConfig(t, apmconfig.NewFileWatcher(dir, time.Millisecond))
+	assert.Equal(t, apmconfig.Change{
+		Attrs: map[string]string{"transaction_sample_rate": "0.5"},
+	}, nextChange(t, changes))
+
+	writeFile(t, filepath.Join(dir, "ELASTIC_APM_RECORDING"), "false")
+	assert.Equal(t, apmconfig.Change{
+		Attrs: map[string]string{"transaction_sample_rate": "0.5", "recording": "false"},
+	}, nextChange(t, changes))
+}
+
+func TestFileWatcherMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	changes := watchConfig(t, apmconfig.NewFileWatcher(path, time.Millisecond))
+	change := nextChange(t, changes)
+	assert.True(t, os.IsNotExist(change.Err))
+
+	writeFile(t, path, "recording: false\n")
+	assert.Equal(t, apmconfig.Change{
+		Attrs: map[string]string{"recording": "false"},
+	}, nextChange(t, changes))
+}
+
+func TestMergeWatchers(t *testing.T) {
+	first := make(chan apmconfig.Change)
+	second := make(chan apmconfig.Change)
+	changes := watchConfig(t, apmconfig.MergeWatchers(
+		watcherFunc(func() <-chan apmconfig.Change { return first }),
+		watcherFunc(func() <-chan apmconfig.Change { return second }),
+	))
+
+	first <- apmconfig.Change{Attrs: map[string]string{"a": "1", "b": "1"}}
+	assert.Equal(t, map[string]string{"a": "1", "b": "1"}, nextChange(t, changes).Attrs)
+
+	second <- apmconfig.Change{Attrs: map[string]string{"b": "2"}}
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, nextChange(t, changes).Attrs)
+
+	// Errors do not affect the merged config.
+	second <- apmconfig.Change{Err: assert.AnError}
+	assert.Equal(t, apmconfig.Change{Err: assert.AnError}, nextChange(t, changes))
+
+	first <- apmconfig.Change{Attrs: map[string]string{"c": "1"}}
+	assert.Equal(t, map[string]string{"b": "2", "c": "1"}, nextChange(t, changes).Attrs)
+
+	second <- apmconfig.Change{}
+	assert.Equal(t, map[string]string{"c": "1"}, nextChange(t, changes).Attrs)
+}
+
+type watcherFunc func() <-chan apmconfig.Change
+
+func (f watcherFunc) WatchConfig(context.Context, apmconfig.WatchParams) <-chan apmconfig.Change {
+	return f()
+}
+
+func watchConfig(t *testing.T, w apmconfig.Watcher) <-chan apmconfig.Change {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return w.WatchConfig(ctx, apmconfig.WatchParams{})
+}
+
+func nextChange(t *testing.T, changes <-chan apmconfig.Change) apmconfig.Change {
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for config change")
+	}
+	panic("unreachable")
+}
+
+// writeFile writes content to path atomically, so
+// the watcher never observes a partially written file.
+func writeFile(t *testing.T, path, content string) {
+	tmp := filepath.Join(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	require.NoError(t, os.WriteFile(tmp, []byte(content), 0644))
+	require.NoError(t, os.Rename(tmp, path))
+}
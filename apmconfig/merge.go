@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmconfig // import "go.elastic.co/apm/v2/apmconfig"
+
+import (
+	"context"
+	"sync"
+)
+
+// MergeWatchers returns a Watcher which merges the config changes reported
+// by each of the given watchers. Whenever any of the watchers reports a
+// change, the merged config is reported, with attributes reported by later
+// watchers taking precedence over those reported by earlier ones. Errors
+// are reported as they occur.
+//
+// For example, to use a local file for config while still allowing central
+// config to take precedence:
+//
+//	tracer.SetConfigWatcher(apmconfig.MergeWatchers(
+//		apmconfig.NewFileWatcher("/etc/elastic-apm", 0),
+//		transport, // *transport.HTTPTransport
+//	))
+func MergeWatchers(watchers ...Watcher) Watcher {
+	return mergedWatcher(watchers)
+}
+
+type mergedWatcher []Watcher
+
+// WatchConfig watches config with each of the watchers,
+// reporting the merged config whenever any of them change.
+func (watchers mergedWatcher) WatchConfig(ctx context.Context, params WatchParams) <-chan Change {
+	type indexedChange struct {
+		index  int
+		change Change
+	}
+	in := make(chan indexedChange)
+	var wg sync.WaitGroup
+	for i, w := range watchers {
+		wg.Add(1)
+		go func(i int, changes <-chan Change) {
+			defer wg.Done()
+			for change := range changes {
+				select {
+				case <-ctx.Done():
+					return
+				case in <- indexedChange{index: i, change: change}:
+				}
+			}
+		}(i, w.WatchConfig(ctx, params))
+	}
+	go func() {
+		wg.Wait()
+		close(in)
+	}()
+
+	changes := make(chan Change)
+	go func() {
+		defer close(changes)
+		attrs := make([]map[string]string, len(watchers))
+		for in := range in {
+			change := in.change
+			if change.Err == nil {
+				attrs[in.index] = change.Attrs
+				merged := make(map[string]string)
+				for _, attrs := range attrs {
+					for k, v := range attrs {
+						merged[k] = v
+					}
+				}
+				change.Attrs = merged
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case changes <- change:
+			}
+		}
+	}()
+	return changes
+}
@@ -48,7 +48,7 @@ func (g *builtinMetricsGatherer) GatherMetrics(ctx context.Context, m *Metrics)
 	g.gatherSystemMetrics(m)
 	g.gatherMemStatsMetrics(m)
 	g.tracer.breakdownMetrics.gather(m)
-	return nil
+	return g.tracer.durationHistograms.gather(ctx, m)
 }
 
 func (g *builtinMetricsGatherer) gatherSystemMetrics(m *Metrics) {
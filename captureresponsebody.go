@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm // import "go.elastic.co/apm/v2"
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"go.elastic.co/apm/v2/internal/apmstrings"
+	"go.elastic.co/apm/v2/internal/wildcard"
+)
+
+// responseBodyCustomKey is the custom context key
+// under which captured response bodies are recorded.
+const responseBodyCustomKey = "response_body"
+
+var responseBodyCapturerPool = sync.Pool{
+	New: func() interface{} {
+		return &ResponseBodyCapturer{}
+	},
+}
+
+// CaptureHTTPResponseBody returns a possibly nil ResponseBodyCapturer,
+// which should be written to with the HTTP response body as it is sent,
+// and later passed to Context.SetHTTPResponseBody for setting the response
+// body in a transaction or error context. If the tracer is not configured
+// to capture HTTP response bodies, then nil is returned.
+//
+// The ResponseBodyCapturer's Discard method should be called after it is
+// no longer needed, in order to recycle its memory.
+func (t *Tracer) CaptureHTTPResponseBody() *ResponseBodyCapturer {
+	cfg := t.instrumentationConfig()
+	if cfg.captureResponseBody == CaptureBodyOff {
+		return nil
+	}
+	bc := responseBodyCapturerPool.Get().(*ResponseBodyCapturer)
+	bc.captureBody = cfg.captureResponseBody
+	bc.contentTypes = cfg.captureResponseBodyContentTypes
+	bc.statusCodes = cfg.captureResponseBodyStatusCodes
+	bc.buffer.Reset()
+	return bc
+}
+
+// ResponseBodyCapturer is returned by Tracer.CaptureHTTPResponseBody to
+// record the beginning of an HTTP response body, and later be passed to
+// Context.SetHTTPResponseBody.
+//
+// ResponseBodyCapturer records at most enough of the response body to
+// fill the truncation limit; the remainder is discarded.
+type ResponseBodyCapturer struct {
+	captureBody  CaptureBodyMode
+	contentTypes wildcard.Matchers
+	statusCodes  statusCodeMatchers
+
+	mu     sync.RWMutex
+	buffer limitedBuffer
+}
+
+// Write records p as part of the response body. Write never returns
+// an error, and has no effect if bc is nil.
+func (bc *ResponseBodyCapturer) Write(p []byte) (int, error) {
+	if bc == nil {
+		return len(p), nil
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.buffer.Write(p)
+	return len(p), nil
+}
+
+// Discard discards the body capturer, returning it to a pool for reuse.
+// The ResponseBodyCapturer must not be used after calling this.
+//
+// Discard has no effect if bc is nil.
+func (bc *ResponseBodyCapturer) Discard() {
+	if bc == nil {
+		return
+	}
+	responseBodyCapturerPool.Put(bc)
+}
+
+// shouldCapture reports whether the body of a response with the
+// given status code and content type should be captured.
+func (bc *ResponseBodyCapturer) shouldCapture(statusCode int, contentType string) bool {
+	if !bc.statusCodes.match(statusCode) {
+		return false
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	return bc.contentTypes.MatchAny(contentType)
+}
+
+func (bc *ResponseBodyCapturer) getBufferTruncated() string {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	body, _ := apmstrings.Truncate(bc.buffer.String(), stringLengthLimit)
+	return body
+}
+
+// statusCodeMatchers matches HTTP status codes against a list of
+// exact status codes, or status code classes such as "5xx".
+type statusCodeMatchers []statusCodeMatcher
+
+type statusCodeMatcher struct {
+	min, max int
+}
+
+func parseStatusCodeMatchers(value string) (statusCodeMatchers, error) {
+	var matchers statusCodeMatchers
+	for _, field := range strings.Split(value, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		if len(field) == 3 && strings.HasSuffix(field, "xx") && field[0] >= '1' && field[0] <= '5' {
+			class := int(field[0]-'0') * 100
+			matchers = append(matchers, statusCodeMatcher{min: class, max: class + 99})
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, errors.Errorf("invalid status code %q", field)
+		}
+		matchers = append(matchers, statusCodeMatcher{min: code, max: code})
+	}
+	return matchers, nil
+}
+
+func (m statusCodeMatchers) match(statusCode int) bool {
+	for _, m := range m {
+		if statusCode >= m.min && statusCode <= m.max {
+			return true
+		}
+	}
+	return false
+}
+
+func (m statusCodeMatchers) String() string {
+	values := make([]string, len(m))
+	for i, m := range m {
+		if m.min == m.max {
+			values[i] = strconv.Itoa(m.min)
+		} else {
+			values[i] = strconv.Itoa(m.min/100) + "xx"
+		}
+	}
+	return strings.Join(values, ", ")
+}
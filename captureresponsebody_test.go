@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+)
+
+func TestCaptureHTTPResponseBodyOff(t *testing.T) {
+	tracer := apmtest.NewDiscardTracer()
+	defer tracer.Close()
+	assert.Nil(t, tracer.CaptureHTTPResponseBody())
+}
+
+func TestCaptureHTTPResponseBody(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.SetCaptureResponseBody(apm.CaptureBodyTransactions)
+	tracer.SetCaptureResponseBodyContentTypes("application/json")
+	require.NoError(t, tracer.SetCaptureResponseBodyStatusCodes("404", "5xx"))
+
+	sendTransaction := func(statusCode int, contentType, body string) string {
+		tx := tracer.StartTransaction("name", "type")
+		bc := tracer.CaptureHTTPResponseBody()
+		bc.Write([]byte(body))
+		tx.Context.SetHTTPStatusCode(statusCode)
+		tx.Context.SetHTTPResponseBody(bc, statusCode, contentType)
+		bc.Discard()
+		tx.End()
+		tracer.Flush(nil)
+		payloads := tracer.Payloads()
+		tracer.ResetPayloads()
+		return responseBody(payloads.Transactions[0].Context)
+	}
+
+	assert.Equal(t, `{"a":1}`, sendTransaction(404, "application/json", `{"a":1}`))
+	assert.Equal(t, `{"a":1}`, sendTransaction(503, "application/json; charset=utf-8", `{"a":1}`))
+	assert.Equal(t, "", sendTransaction(400, "application/json", `{"a":1}`))
+	assert.Equal(t, "", sendTransaction(500, "text/plain", `{"a":1}`))
+
+	// Bodies are truncated. Without redaction rules, fields are not redacted.
+	body := `{"message":"` + strings.Repeat("x", 1000) + `","secret":"abcdefghijklmnopqrstuvwxyz"}`
+	assert.Equal(t, body[:1024], sendTransaction(500, "application/json", body))
+
+	// With redaction rules, fields are redacted even if truncated.
+	require.NoError(t, tracer.SetRedactionRules(apm.RedactBearerTokens))
+	assert.Equal(t,
+		`{"message":"`+strings.Repeat("x", 1000)+`","secret":"[REDACTED]"`,
+		sendTransaction(500, "application/json", body),
+	)
+}
+
+func TestSetCaptureResponseBodyStatusCodesInvalid(t *testing.T) {
+	tracer := apmtest.NewDiscardTracer()
+	defer tracer.Close()
+	assert.EqualError(t, tracer.SetCaptureResponseBodyStatusCodes("5xx", "600"), `invalid status code "600"`)
+	assert.EqualError(t, tracer.SetCaptureResponseBodyStatusCodes("9xx"), `invalid status code "9xx"`)
+}
+
+func TestCaptureResponseBodyEffectiveConfig(t *testing.T) {
+	t.Setenv("ELASTIC_APM_CAPTURE_RESPONSE_BODY", "errors")
+	t.Setenv("ELASTIC_APM_CAPTURE_RESPONSE_BODY_STATUS_CODES", "5xx,429")
+	tracer := apmtest.NewDiscardTracer()
+	defer tracer.Close()
+
+	settings := effectiveConfig(tracer)
+	assert.Equal(t, "errors", settings["capture_response_body"].Value)
+	assert.Equal(t, "5xx, 429", settings["capture_response_body_status_codes"].Value)
+	assert.Equal(t,
+		"application/json, application/*+json, application/xml, application/*+xml, text/*",
+		settings["capture_response_body_content_types"].Value,
+	)
+}
+
+// responseBody returns the captured response body
+// recorded in the custom context, if any.
+func responseBody(c *model.Context) string {
+	if c == nil {
+		return ""
+	}
+	for _, item := range c.Custom {
+		if item.Key == "response_body" {
+			body, _ := item.Value.(string)
+			return body
+		}
+	}
+	return ""
+}
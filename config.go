@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -34,6 +35,7 @@ import (
 
 	"go.elastic.co/apm/v2/internal/apmlog"
 	"go.elastic.co/apm/v2/internal/configutil"
+	"go.elastic.co/apm/v2/internal/transportutil"
 	"go.elastic.co/apm/v2/internal/wildcard"
 	"go.elastic.co/apm/v2/transport"
 )
@@ -43,8 +45,12 @@ const (
 	envMaxSpans                        = "ELASTIC_APM_TRANSACTION_MAX_SPANS"
 	envTransactionSampleRate           = "ELASTIC_APM_TRANSACTION_SAMPLE_RATE"
 	envSanitizeFieldNames              = "ELASTIC_APM_SANITIZE_FIELD_NAMES"
+	envRedactionRules                  = "ELASTIC_APM_REDACTION_RULES"
 	envCaptureHeaders                  = "ELASTIC_APM_CAPTURE_HEADERS"
 	envCaptureBody                     = "ELASTIC_APM_CAPTURE_BODY"
+	envCaptureResponseBody             = "ELASTIC_APM_CAPTURE_RESPONSE_BODY"
+	envCaptureResponseBodyContentTypes = "ELASTIC_APM_CAPTURE_RESPONSE_BODY_CONTENT_TYPES"
+	envCaptureResponseBodyStatusCodes  = "ELASTIC_APM_CAPTURE_RESPONSE_BODY_STATUS_CODES"
 	envServiceName                     = "ELASTIC_APM_SERVICE_NAME"
 	envServiceVersion                  = "ELASTIC_APM_SERVICE_VERSION"
 	envEnvironment                     = "ELASTIC_APM_ENVIRONMENT"
@@ -59,13 +65,25 @@ const (
 	envDisableMetrics                  = "ELASTIC_APM_DISABLE_METRICS"
 	envIgnoreURLs                      = "ELASTIC_APM_TRANSACTION_IGNORE_URLS"
 	deprecatedEnvIgnoreURLs            = "ELASTIC_APM_IGNORE_URLS"
+	envUsePathAsTransactionName        = "ELASTIC_APM_USE_PATH_AS_TRANSACTION_NAME"
+	envTransactionNameGroups           = "ELASTIC_APM_TRANSACTION_NAME_GROUPS"
+	envTransactionNameIncludeMethod    = "ELASTIC_APM_TRANSACTION_NAME_INCLUDE_METHOD"
 	envGlobalLabels                    = "ELASTIC_APM_GLOBAL_LABELS"
 	envStackTraceLimit                 = "ELASTIC_APM_STACK_TRACE_LIMIT"
+	envSourceLinesErrorAppFrames       = "ELASTIC_APM_SOURCE_LINES_ERROR_APP_FRAMES"
+	envSourceLinesSpanAppFrames        = "ELASTIC_APM_SOURCE_LINES_SPAN_APP_FRAMES"
+	envErrorMessageNormalization       = "ELASTIC_APM_ERROR_MESSAGE_NORMALIZATION"
 	envCentralConfig                   = "ELASTIC_APM_CENTRAL_CONFIG"
 	envBreakdownMetrics                = "ELASTIC_APM_BREAKDOWN_METRICS"
+	envDurationHistograms              = "ELASTIC_APM_DURATION_HISTOGRAMS"
 	envUseElasticTraceparentHeader     = "ELASTIC_APM_USE_ELASTIC_TRACEPARENT_HEADER"
 	envCloudProvider                   = "ELASTIC_APM_CLOUD_PROVIDER"
+	envKubernetesDownwardAPIPath       = "ELASTIC_APM_KUBERNETES_DOWNWARD_API_PATH"
+	envKubernetesAPIDiscovery          = "ELASTIC_APM_KUBERNETES_API_DISCOVERY"
+	envKubernetesPodLabels             = "ELASTIC_APM_KUBERNETES_POD_LABELS"
 	envContinuationStrategy            = "ELASTIC_APM_TRACE_CONTINUATION_STRATEGY"
+	envConfigFile                      = "ELASTIC_APM_CONFIG_FILE"
+	envConfigFileWatchInterval         = "ELASTIC_APM_CONFIG_FILE_WATCH_INTERVAL"
 
 	// span_compression (default `true`)
 	envSpanCompressionEnabled = "ELASTIC_APM_SPAN_COMPRESSION_ENABLED"
@@ -92,10 +110,13 @@ const (
 	defaultMaxSpans                  = 500
 	defaultCaptureHeaders            = true
 	defaultCaptureBody               = CaptureBodyOff
+	defaultCaptureResponseBody       = CaptureBodyOff
 	defaultSpanStackTraceMinDuration = 5 * time.Millisecond
 	defaultStackTraceLimit           = 50
 	defaultContinuationStrategy      = "continue"
 
+	defaultCaptureResponseBodyStatusCodes = "4xx, 5xx"
+
 	defaultExitSpanMinDuration = time.Millisecond
 
 	minAPIBufferSize     = 10 * configutil.KByte
@@ -126,6 +147,14 @@ var (
 		"set-cookie",
 		"*principal*",
 	}, ","))
+
+	defaultCaptureResponseBodyContentTypes = configutil.ParseWildcardPatterns(strings.Join([]string{
+		"application/json",
+		"application/*+json",
+		"application/xml",
+		"application/*+xml",
+		"text/*",
+	}, ","))
 )
 
 // Regular expression matching comment characters to escape in the User-Agent header value.
@@ -133,15 +162,32 @@ var (
 // See https://httpwg.org/specs/rfc7230.html#field.components
 var httpComment = regexp.MustCompile("[^\\t \\x21-\\x27\\x2a-\\x5b\\x5d-\\x7e\\x80-\\xff]")
 
-func initialTransport(serviceName, serviceVersion string) (transport.Transport, error) {
+func initialTransport(env configutil.Env, serviceName, serviceVersion string) (transport.Transport, error) {
 	// User-Agent should be "apm-agent-go/<agent-version> (service-name service-version)".
 	service := serviceName
 	if serviceVersion != "" {
 		service += " " + httpComment.ReplaceAllString(serviceVersion, "_")
 	}
 	userAgent := fmt.Sprintf("%s (%s)", transport.DefaultUserAgent(), service)
+	serverURLs, err := transportutil.ServerURLs(env)
+	if err != nil {
+		return nil, err
+	}
+	tlsClientConfig, err := transportutil.TLSClientConfig(env)
+	if err != nil {
+		return nil, err
+	}
+	serverTimeout, err := env.ParseDurationEnv(transportutil.EnvServerTimeout, 0)
+	if err != nil {
+		return nil, err
+	}
 	httpTransport, err := transport.NewHTTPTransport(transport.HTTPTransportOptions{
-		UserAgent: userAgent,
+		APIKey:          env.Getenv(transportutil.EnvAPIKey),
+		SecretToken:     env.Getenv(transportutil.EnvSecretToken),
+		ServerURLs:      serverURLs,
+		ServerTimeout:   serverTimeout,
+		TLSClientConfig: tlsClientConfig,
+		UserAgent:       userAgent,
 	})
 	if err != nil {
 		return nil, err
@@ -149,16 +195,37 @@ func initialTransport(serviceName, serviceVersion string) (transport.Transport,
 	return httpTransport, nil
 }
 
-func initialRequestDuration() (time.Duration, error) {
-	return configutil.ParseDurationEnv(envAPIRequestTime, defaultAPIRequestTime)
+// initialConfigFile loads the configuration file at path, or if path is
+// empty, the file specified by ELASTIC_APM_CONFIG_FILE, if any. The file's
+// settings are returned along with the file's path.
+func initialConfigFile(path string) (string, map[string]string, error) {
+	if path == "" {
+		path = os.Getenv(envConfigFile)
+		if path == "" {
+			return "", nil, nil
+		}
+	}
+	config, err := configutil.ReadConfigFile(path)
+	if err != nil {
+		return path, nil, err
+	}
+	return path, config, nil
+}
+
+func initialConfigFileWatchInterval(env configutil.Env) (time.Duration, error) {
+	return env.ParseDurationEnv(envConfigFileWatchInterval, 0)
 }
 
-func initialMetricsInterval() (time.Duration, error) {
-	return configutil.ParseDurationEnv(envMetricsInterval, defaultMetricsInterval)
+func initialRequestDuration(env configutil.Env) (time.Duration, error) {
+	return env.ParseDurationEnv(envAPIRequestTime, defaultAPIRequestTime)
 }
 
-func initialMetricsBufferSize() (int, error) {
-	size, err := configutil.ParseSizeEnv(envMetricsBufferSize, defaultMetricsBufferSize)
+func initialMetricsInterval(env configutil.Env) (time.Duration, error) {
+	return env.ParseDurationEnv(envMetricsInterval, defaultMetricsInterval)
+}
+
+func initialMetricsBufferSize(env configutil.Env) (int, error) {
+	size, err := env.ParseSizeEnv(envMetricsBufferSize, defaultMetricsBufferSize)
 	if err != nil {
 		return 0, err
 	}
@@ -171,8 +238,8 @@ func initialMetricsBufferSize() (int, error) {
 	return int(size), nil
 }
 
-func initialAPIBufferSize() (int, error) {
-	size, err := configutil.ParseSizeEnv(envAPIBufferSize, defaultAPIBufferSize)
+func initialAPIBufferSize(env configutil.Env) (int, error) {
+	size, err := env.ParseSizeEnv(envAPIBufferSize, defaultAPIBufferSize)
 	if err != nil {
 		return 0, err
 	}
@@ -185,8 +252,8 @@ func initialAPIBufferSize() (int, error) {
 	return int(size), nil
 }
 
-func initialAPIRequestSize() (int, error) {
-	size, err := configutil.ParseSizeEnv(envAPIRequestSize, defaultAPIRequestSize)
+func initialAPIRequestSize(env configutil.Env) (int, error) {
+	size, err := env.ParseSizeEnv(envAPIRequestSize, defaultAPIRequestSize)
 	if err != nil {
 		return 0, err
 	}
@@ -199,8 +266,8 @@ func initialAPIRequestSize() (int, error) {
 	return int(size), nil
 }
 
-func initialMaxSpans() (int, error) {
-	value := os.Getenv(envMaxSpans)
+func initialMaxSpans(env configutil.Env) (int, error) {
+	value := env.Getenv(envMaxSpans)
 	if value == "" {
 		return defaultMaxSpans, nil
 	}
@@ -212,8 +279,8 @@ func initialMaxSpans() (int, error) {
 }
 
 // initialSampler returns a nil Sampler if all transactions should be sampled.
-func initialSampler() (Sampler, error) {
-	value := os.Getenv(envTransactionSampleRate)
+func initialSampler(env configutil.Env) (Sampler, error) {
+	value := env.Getenv(envTransactionSampleRate)
 	return parseSampleRate(envTransactionSampleRate, value)
 }
 
@@ -235,12 +302,20 @@ func parseSampleRate(name, value string) (Sampler, error) {
 	return NewRatioSampler(ratio), nil
 }
 
-func initialSanitizedFieldNames() wildcard.Matchers {
-	return configutil.ParseWildcardPatternsEnv(envSanitizeFieldNames, defaultSanitizedFieldNames)
+func initialSanitizedFieldNames(env configutil.Env) wildcard.Matchers {
+	return env.ParseWildcardPatternsEnv(envSanitizeFieldNames, defaultSanitizedFieldNames)
 }
 
-func initContinuationStrategy() (string, error) {
-	value := os.Getenv(envContinuationStrategy)
+func initialRedactor(env configutil.Env) (*redactor, error) {
+	rules, err := parseRedactionRules(env.Getenv(envRedactionRules))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", envRedactionRules)
+	}
+	return newRedactor(rules)
+}
+
+func initContinuationStrategy(env configutil.Env) (string, error) {
+	value := env.Getenv(envContinuationStrategy)
 	if value == "" {
 		return defaultContinuationStrategy, nil
 	}
@@ -256,12 +331,12 @@ func validateContinuationStrategy(value string) error {
 	}
 }
 
-func initialCaptureHeaders() (bool, error) {
-	return configutil.ParseBoolEnv(envCaptureHeaders, defaultCaptureHeaders)
+func initialCaptureHeaders(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envCaptureHeaders, defaultCaptureHeaders)
 }
 
-func initialCaptureBody() (CaptureBodyMode, error) {
-	value := os.Getenv(envCaptureBody)
+func initialCaptureBody(env configutil.Env) (CaptureBodyMode, error) {
+	value := env.Getenv(envCaptureBody)
 	if value == "" {
 		return defaultCaptureBody, nil
 	}
@@ -282,10 +357,34 @@ func parseCaptureBody(name, value string) (CaptureBodyMode, error) {
 	return -1, errors.Errorf("invalid %s value %q", name, value)
 }
 
-func initialService() (name, version, environment string) {
-	name = os.Getenv(envServiceName)
-	version = os.Getenv(envServiceVersion)
-	environment = os.Getenv(envEnvironment)
+func initialCaptureResponseBody(env configutil.Env) (CaptureBodyMode, error) {
+	value := env.Getenv(envCaptureResponseBody)
+	if value == "" {
+		return defaultCaptureResponseBody, nil
+	}
+	return parseCaptureBody(envCaptureResponseBody, value)
+}
+
+func initialCaptureResponseBodyContentTypes(env configutil.Env) wildcard.Matchers {
+	return env.ParseWildcardPatternsEnv(envCaptureResponseBodyContentTypes, defaultCaptureResponseBodyContentTypes)
+}
+
+func initialCaptureResponseBodyStatusCodes(env configutil.Env) (statusCodeMatchers, error) {
+	value := env.Getenv(envCaptureResponseBodyStatusCodes)
+	if value == "" {
+		value = defaultCaptureResponseBodyStatusCodes
+	}
+	matchers, err := parseStatusCodeMatchers(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", envCaptureResponseBodyStatusCodes)
+	}
+	return matchers, nil
+}
+
+func initialService(env configutil.Env) (name, version, environment string) {
+	name = env.Getenv(envServiceName)
+	version = env.Getenv(envServiceVersion)
+	environment = env.Getenv(envEnvironment)
 	if name == "" {
 		name = filepath.Base(os.Args[0])
 		if runtime.GOOS == "windows" {
@@ -296,13 +395,13 @@ func initialService() (name, version, environment string) {
 	return name, version, environment
 }
 
-func initialSpanStackTraceMinDuration() (time.Duration, error) {
-	if v, err := configutil.ParseDurationEnv(envSpanStackTraceMinDuration, defaultSpanStackTraceMinDuration); err != nil || v != defaultSpanStackTraceMinDuration {
+func initialSpanStackTraceMinDuration(env configutil.Env) (time.Duration, error) {
+	if v, err := env.ParseDurationEnv(envSpanStackTraceMinDuration, defaultSpanStackTraceMinDuration); err != nil || v != defaultSpanStackTraceMinDuration {
 		// if envSpanStackTraceMinDuration was provided ignore the deprecated option
 		return v, err
 	}
 
-	v, err := configutil.ParseDurationEnv(deprecatedEnvSpanFramesMinDuration, defaultSpanStackTraceMinDuration)
+	v, err := env.ParseDurationEnv(deprecatedEnvSpanFramesMinDuration, defaultSpanStackTraceMinDuration)
 	if err != nil {
 		return v, err
 	}
@@ -319,28 +418,40 @@ func initialSpanStackTraceMinDuration() (time.Duration, error) {
 	return v, nil
 }
 
-func initialActive() (bool, error) {
-	return configutil.ParseBoolEnv(envActive, true)
+func initialActive(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envActive, true)
 }
 
-func initialRecording() (bool, error) {
-	return configutil.ParseBoolEnv(envRecording, true)
+func initialRecording(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envRecording, true)
 }
 
-func initialDisabledMetrics() wildcard.Matchers {
-	return configutil.ParseWildcardPatternsEnv(envDisableMetrics, nil)
+func initialDisabledMetrics(env configutil.Env) wildcard.Matchers {
+	return env.ParseWildcardPatternsEnv(envDisableMetrics, nil)
 }
 
-func initialIgnoreTransactionURLs() wildcard.Matchers {
-	matchers := configutil.ParseWildcardPatternsEnv(envIgnoreURLs, nil)
+func initialIgnoreTransactionURLs(env configutil.Env) wildcard.Matchers {
+	matchers := env.ParseWildcardPatternsEnv(envIgnoreURLs, nil)
 	if len(matchers) == 0 {
-		matchers = configutil.ParseWildcardPatternsEnv(deprecatedEnvIgnoreURLs, nil)
+		matchers = env.ParseWildcardPatternsEnv(deprecatedEnvIgnoreURLs, nil)
 	}
 	return matchers
 }
 
-func initialStackTraceLimit() (int, error) {
-	value := os.Getenv(envStackTraceLimit)
+func initialUsePathAsTransactionName(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envUsePathAsTransactionName, false)
+}
+
+func initialTransactionNameGroups(env configutil.Env) wildcard.Matchers {
+	return env.ParseWildcardPatternsEnv(envTransactionNameGroups, nil)
+}
+
+func initialTransactionNameIncludeMethod(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envTransactionNameIncludeMethod, true)
+}
+
+func initialStackTraceLimit(env configutil.Env) (int, error) {
+	value := env.Getenv(envStackTraceLimit)
 	if value == "" {
 		return defaultStackTraceLimit, nil
 	}
@@ -351,56 +462,81 @@ func initialStackTraceLimit() (int, error) {
 	return limit, nil
 }
 
-func initialCentralConfigEnabled() (bool, error) {
-	return configutil.ParseBoolEnv(envCentralConfig, true)
+// initialSourceLines returns the number of source lines to
+// capture for stack frames, as defined by envKey.
+func initialSourceLines(env configutil.Env, envKey string) (int, error) {
+	value := env.Getenv(envKey)
+	if value == "" {
+		return 0, nil
+	}
+	lines, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", envKey)
+	}
+	if lines < 0 {
+		return 0, errors.Errorf("invalid %s value %d, must be non-negative", envKey, lines)
+	}
+	return lines, nil
+}
+
+func initialCentralConfigEnabled(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envCentralConfig, true)
+}
+
+func initialBreakdownMetricsEnabled(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envBreakdownMetrics, true)
+}
+
+func initialDurationHistogramsEnabled(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envDurationHistograms, false)
 }
 
-func initialBreakdownMetricsEnabled() (bool, error) {
-	return configutil.ParseBoolEnv(envBreakdownMetrics, true)
+func initialErrorMessageNormalization(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envErrorMessageNormalization, false)
 }
 
-func initialUseElasticTraceparentHeader() (bool, error) {
-	return configutil.ParseBoolEnv(envUseElasticTraceparentHeader, true)
+func initialUseElasticTraceparentHeader(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envUseElasticTraceparentHeader, true)
 }
 
-func initialSpanCompressionEnabled() (bool, error) {
-	return configutil.ParseBoolEnv(envSpanCompressionEnabled,
+func initialSpanCompressionEnabled(env configutil.Env) (bool, error) {
+	return env.ParseBoolEnv(envSpanCompressionEnabled,
 		defaultSpanCompressionEnabled,
 	)
 }
 
-func initialSpanCompressionExactMatchMaxDuration() (time.Duration, error) {
-	return configutil.ParseDurationEnv(
+func initialSpanCompressionExactMatchMaxDuration(env configutil.Env) (time.Duration, error) {
+	return env.ParseDurationEnv(
 		envSpanCompressionExactMatchMaxDuration,
 		defaultSpanCompressionExactMatchMaxDuration,
 	)
 }
 
-func initialSpanCompressionSameKindMaxDuration() (time.Duration, error) {
-	return configutil.ParseDurationEnv(
+func initialSpanCompressionSameKindMaxDuration(env configutil.Env) (time.Duration, error) {
+	return env.ParseDurationEnv(
 		envSpanCompressionSameKindMaxDuration,
 		defaultSpanCompressionSameKindMaxDuration,
 	)
 }
 
-func initialCPUProfileIntervalDuration() (time.Duration, time.Duration, error) {
-	interval, err := configutil.ParseDurationEnv(envCPUProfileInterval, 0)
+func initialCPUProfileIntervalDuration(env configutil.Env) (time.Duration, time.Duration, error) {
+	interval, err := env.ParseDurationEnv(envCPUProfileInterval, 0)
 	if err != nil || interval <= 0 {
 		return 0, 0, err
 	}
-	duration, err := configutil.ParseDurationEnv(envCPUProfileDuration, 0)
+	duration, err := env.ParseDurationEnv(envCPUProfileDuration, 0)
 	if err != nil || duration <= 0 {
 		return 0, 0, err
 	}
 	return interval, duration, nil
 }
 
-func initialHeapProfileInterval() (time.Duration, error) {
-	return configutil.ParseDurationEnv(envHeapProfileInterval, 0)
+func initialHeapProfileInterval(env configutil.Env) (time.Duration, error) {
+	return env.ParseDurationEnv(envHeapProfileInterval, 0)
 }
 
-func initialExitSpanMinDuration() (time.Duration, error) {
-	return configutil.ParseDurationEnvOptions(
+func initialExitSpanMinDuration(env configutil.Env) (time.Duration, error) {
+	return env.ParseDurationEnvOptions(
 		envExitSpanMinDuration, defaultExitSpanMinDuration,
 		configutil.DurationOptions{MinimumDurationUnit: time.Microsecond},
 	)
@@ -409,8 +545,12 @@ func initialExitSpanMinDuration() (time.Duration, error) {
 // updateRemoteConfig updates t and cfg with changes held in "attrs", and reverts to local
 // config for config attributes that have been removed (exist in old but not in attrs).
 //
+// Changes to config held in tracerConfig are returned as a tracerConfigCommand, which
+// must be applied by the caller. The names of the applied and rejected config attributes
+// are logged at debug level.
+//
 // On return from updateRemoteConfig, unapplied config will have been removed from attrs.
-func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string) {
+func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string) tracerConfigCommand {
 	warningf := func(string, ...interface{}) {}
 	debugf := func(string, ...interface{}) {}
 	errorf := func(string, ...interface{}) {}
@@ -423,7 +563,25 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 		return "ELASTIC_APM_" + strings.ToUpper(k)
 	}
 
+	var applied []string
+	var rejected map[string]string
+	addRejected := func(k, reason string) {
+		if rejected == nil {
+			rejected = make(map[string]string)
+		}
+		rejected[k] = reason
+		delete(attrs, k)
+	}
+	reject := func(k string, err error) {
+		errorf("central config failure: %s", err)
+		addRejected(k, err.Error())
+	}
+	parseError := func(k string, err error) error {
+		return errors.Errorf("failed to parse %s: %s", k, err)
+	}
+
 	var updates []func(cfg *instrumentationConfig)
+	var tracerUpdates []tracerConfigCommand
 	for k, v := range attrs {
 		if oldv, ok := old[k]; ok && oldv == v {
 			continue
@@ -432,19 +590,26 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 		case envCaptureBody:
 			value, err := parseCaptureBody(k, v)
 			if err != nil {
-				errorf("central config failure: %s", err)
-				delete(attrs, k)
+				reject(k, err)
 				continue
 			} else {
 				updates = append(updates, func(cfg *instrumentationConfig) {
 					cfg.captureBody = value
 				})
 			}
+		case envCaptureHeaders:
+			value, err := strconv.ParseBool(v)
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			updates = append(updates, func(cfg *instrumentationConfig) {
+				cfg.captureHeaders = value
+			})
 		case envMaxSpans:
 			value, err := strconv.Atoi(v)
 			if err != nil {
-				errorf("central config failure: failed to parse %s: %s", k, err)
-				delete(attrs, k)
+				reject(k, parseError(k, err))
 				continue
 			} else {
 				updates = append(updates, func(cfg *instrumentationConfig) {
@@ -456,8 +621,7 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 				MinimumDurationUnit: time.Microsecond,
 			})
 			if err != nil {
-				errorf("central config failure: failed to parse %s: %s", k, err)
-				delete(attrs, k)
+				reject(k, parseError(k, err))
 				continue
 			}
 			updates = append(updates, func(cfg *instrumentationConfig) {
@@ -468,11 +632,33 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 			updates = append(updates, func(cfg *instrumentationConfig) {
 				cfg.ignoreTransactionURLs = matchers
 			})
+		case envUsePathAsTransactionName:
+			value, err := strconv.ParseBool(v)
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			updates = append(updates, func(cfg *instrumentationConfig) {
+				cfg.usePathAsTransactionName = value
+			})
+		case envTransactionNameGroups:
+			matchers := configutil.ParseWildcardPatterns(v)
+			updates = append(updates, func(cfg *instrumentationConfig) {
+				cfg.transactionNameGroups = matchers
+			})
+		case envTransactionNameIncludeMethod:
+			value, err := strconv.ParseBool(v)
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			updates = append(updates, func(cfg *instrumentationConfig) {
+				cfg.transactionNameIncludeMethod = value
+			})
 		case envRecording:
 			recording, err := strconv.ParseBool(v)
 			if err != nil {
-				errorf("central config failure: failed to parse %s: %s", k, err)
-				delete(attrs, k)
+				reject(k, parseError(k, err))
 				continue
 			} else {
 				updates = append(updates, func(cfg *instrumentationConfig) {
@@ -486,18 +672,25 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 			})
 		case envContinuationStrategy:
 			if err := validateContinuationStrategy(v); err != nil {
-				errorf("central config failure: failed to parse %s: %s", k, err)
-				delete(attrs, k)
+				reject(k, parseError(k, err))
 				continue
 			}
 			updates = append(updates, func(cfg *instrumentationConfig) {
 				cfg.continuationStrategy = v
 			})
+		case envUseElasticTraceparentHeader:
+			value, err := strconv.ParseBool(v)
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			updates = append(updates, func(cfg *instrumentationConfig) {
+				cfg.propagateLegacyHeader = value
+			})
 		case envSpanStackTraceMinDuration:
 			duration, err := configutil.ParseDuration(v)
 			if err != nil {
-				errorf("central config failure: failed to parse %s: %s", k, err)
-				delete(attrs, k)
+				reject(k, parseError(k, err))
 				continue
 			} else {
 				updates = append(updates, func(cfg *instrumentationConfig) {
@@ -507,8 +700,7 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 		case envStackTraceLimit:
 			limit, err := strconv.Atoi(v)
 			if err != nil {
-				errorf("central config failure: failed to parse %s: %s", k, err)
-				delete(attrs, k)
+				reject(k, parseError(k, err))
 				continue
 			} else {
 				updates = append(updates, func(cfg *instrumentationConfig) {
@@ -518,8 +710,7 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 		case envTransactionSampleRate:
 			sampler, err := parseSampleRate(k, v)
 			if err != nil {
-				errorf("central config failure: %s", err)
-				delete(attrs, k)
+				reject(k, err)
 				continue
 			} else {
 				updates = append(updates, func(cfg *instrumentationConfig) {
@@ -529,8 +720,7 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 		case apmlog.EnvLogLevel:
 			level, err := apmlog.ParseLogLevel(v)
 			if err != nil {
-				errorf("central config failure: %s", err)
-				delete(attrs, k)
+				reject(k, err)
 				continue
 			}
 			if dl := apmlog.DefaultLogger(); dl != nil && dl == logger {
@@ -539,14 +729,13 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 				})
 			} else {
 				warningf("central config ignored: %s set to %s, but custom logger in use", k, v)
-				delete(attrs, k)
+				addRejected(k, "custom logger in use")
 				continue
 			}
 		case envSpanCompressionEnabled:
 			val, err := strconv.ParseBool(v)
 			if err != nil {
-				errorf("central config failure: failed to parse %s: %s", k, err)
-				delete(attrs, k)
+				reject(k, parseError(k, err))
 				continue
 			}
 			updates = append(updates, func(cfg *instrumentationConfig) {
@@ -555,8 +744,7 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 		case envSpanCompressionExactMatchMaxDuration:
 			duration, err := configutil.ParseDuration(v)
 			if err != nil {
-				errorf("central config failure: failed to parse %s: %s", k, err)
-				delete(attrs, k)
+				reject(k, parseError(k, err))
 				continue
 			}
 			updates = append(updates, func(cfg *instrumentationConfig) {
@@ -565,16 +753,84 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 		case envSpanCompressionSameKindMaxDuration:
 			duration, err := configutil.ParseDuration(v)
 			if err != nil {
-				errorf("central config failure: failed to parse %s: %s", k, err)
-				delete(attrs, k)
+				reject(k, parseError(k, err))
 				continue
 			}
 			updates = append(updates, func(cfg *instrumentationConfig) {
 				cfg.compressionOptions.sameKindMaxDuration = duration
 			})
+		case envMetricsInterval:
+			duration, err := configutil.ParseDuration(v)
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			tracerUpdates = append(tracerUpdates, func(cfg *tracerConfig) {
+				cfg.metricsInterval = duration
+			})
+		case envDisableMetrics:
+			matchers := configutil.ParseWildcardPatterns(v)
+			tracerUpdates = append(tracerUpdates, func(cfg *tracerConfig) {
+				cfg.disabledMetrics = matchers
+			})
+		case envAPIRequestTime:
+			duration, err := configutil.ParseDuration(v)
+			if err == nil && duration <= 0 {
+				err = errors.New("duration must be positive")
+			}
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			tracerUpdates = append(tracerUpdates, func(cfg *tracerConfig) {
+				cfg.requestDuration = duration
+			})
+		case envAPIRequestSize:
+			size, err := configutil.ParseSize(v)
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			if size < minAPIRequestSize || size > maxAPIRequestSize {
+				reject(k, errors.Errorf(
+					"%s must be at least %s and less than %s, got %s",
+					k, minAPIRequestSize, maxAPIRequestSize, size,
+				))
+				continue
+			}
+			tracerUpdates = append(tracerUpdates, func(cfg *tracerConfig) {
+				cfg.requestSize = int(size)
+			})
+		case envCPUProfileInterval:
+			duration, err := configutil.ParseDuration(v)
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			tracerUpdates = append(tracerUpdates, func(cfg *tracerConfig) {
+				cfg.cpuProfileInterval = duration
+			})
+		case envCPUProfileDuration:
+			duration, err := configutil.ParseDuration(v)
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			tracerUpdates = append(tracerUpdates, func(cfg *tracerConfig) {
+				cfg.cpuProfileDuration = duration
+			})
+		case envHeapProfileInterval:
+			duration, err := configutil.ParseDuration(v)
+			if err != nil {
+				reject(k, parseError(k, err))
+				continue
+			}
+			tracerUpdates = append(tracerUpdates, func(cfg *tracerConfig) {
+				cfg.heapProfileInterval = duration
+			})
 		default:
 			warningf("central config failure: unsupported config: %s", k)
-			delete(attrs, k)
+			addRejected(k, "unsupported config")
 			continue
 		}
 		debugf("central config update: updated %s to %s", k, v)
@@ -588,13 +844,21 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 				f(&cfg.instrumentationConfigValues)
 			}
 		})
+		tracerUpdates = append(tracerUpdates, func(cfg *tracerConfig) {
+			if f, ok := cfg.local[envName(k)]; ok {
+				f(cfg)
+			}
+		})
 		debugf("central config update: reverted %s to local config", k)
 	}
+
+	remote := make(map[string]struct{})
+	for k := range attrs {
+		remote[envName(k)] = struct{}{}
+		applied = append(applied, k)
+	}
+	sort.Strings(applied)
 	if updates != nil {
-		remote := make(map[string]struct{})
-		for k := range attrs {
-			remote[envName(k)] = struct{}{}
-		}
 		t.updateInstrumentationConfig(func(cfg *instrumentationConfig) {
 			cfg.remote = remote
 			for _, update := range updates {
@@ -602,6 +866,30 @@ func (t *Tracer) updateRemoteConfig(logger Logger, old, attrs map[string]string)
 			}
 		})
 	}
+	if len(applied) > 0 || len(rejected) > 0 {
+		debugf(
+			"central config result: applied %s; rejected %s",
+			strings.Join(applied, ","), formatRejected(rejected),
+		)
+	}
+	return func(cfg *tracerConfig) {
+		cfg.remote = remote
+		for _, update := range tracerUpdates {
+			update(cfg)
+		}
+		cfg.recording = t.instrumentationConfig().recording
+	}
+}
+
+// formatRejected formats rejected config attributes
+// as sorted, comma-separated "name (reason)" pairs.
+func formatRejected(rejected map[string]string) string {
+	values := make([]string, 0, len(rejected))
+	for k, reason := range rejected {
+		values = append(values, fmt.Sprintf("%s (%s)", k, reason))
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
 }
 
 // instrumentationConfig returns the current instrumentationConfig.
@@ -643,6 +931,46 @@ func (t *Tracer) IgnoredTransactionURL(url *url.URL) bool {
 	return t.instrumentationConfig().ignoreTransactionURLs.MatchAny(url.String())
 }
 
+// HTTPTransactionName returns the name for an HTTP server transaction with
+// the given request method, matched route, and URL path, according to the
+// tracer's transaction naming configuration.
+//
+// The route should be the parametrized route matched by the router, such
+// as "/user/:id", or the URL path if the request was not routed. An empty
+// route means the route could not be determined, and the route is named
+// "unknown route".
+//
+// If the URL path matches one of the transaction name groups, the group's
+// pattern is used in place of the route. Otherwise, if the tracer is
+// configured to use the path as the transaction name, the path is used in
+// place of the route. The name is prefixed with the method, unless the
+// tracer is configured to exclude it.
+func (t *Tracer) HTTPTransactionName(method, route, path string) string {
+	cfg := t.instrumentationConfig()
+	name := route
+	if m := matchTransactionNameGroup(cfg.transactionNameGroups, path); m != nil {
+		name = m.Pattern()
+	} else if cfg.usePathAsTransactionName {
+		name = path
+	}
+	if name == "" {
+		name = "unknown route"
+	}
+	if !cfg.transactionNameIncludeMethod {
+		return name
+	}
+	return method + " " + name
+}
+
+func matchTransactionNameGroup(groups wildcard.Matchers, path string) *wildcard.Matcher {
+	for _, m := range groups {
+		if m.Match(path) {
+			return m
+		}
+	}
+	return nil
+}
+
 // instrumentationConfig holds current configuration values, as well as information
 // required to revert from remote to local configuration.
 type instrumentationConfig struct {
@@ -663,17 +991,25 @@ type instrumentationConfig struct {
 // set the initial entry in instrumentationConfig.local, in order to properly reset
 // to the local value, even if the default is the zero value.
 type instrumentationConfigValues struct {
-	recording                 bool
-	captureBody               CaptureBodyMode
-	captureHeaders            bool
-	maxSpans                  int
-	sampler                   Sampler
-	spanStackTraceMinDuration time.Duration
-	exitSpanMinDuration       time.Duration
-	continuationStrategy      string
-	stackTraceLimit           int
-	propagateLegacyHeader     bool
-	sanitizedFieldNames       wildcard.Matchers
-	ignoreTransactionURLs     wildcard.Matchers
-	compressionOptions        compressionOptions
+	recording                       bool
+	captureBody                     CaptureBodyMode
+	captureHeaders                  bool
+	maxSpans                        int
+	captureResponseBody             CaptureBodyMode
+	captureResponseBodyContentTypes wildcard.Matchers
+	captureResponseBodyStatusCodes  statusCodeMatchers
+	sampler                         Sampler
+	spanStackTraceMinDuration       time.Duration
+	exitSpanMinDuration             time.Duration
+	continuationStrategy            string
+	stackTraceLimit                 int
+	propagateLegacyHeader           bool
+	sanitizedFieldNames             wildcard.Matchers
+	redactor                        *redactor
+	ignoreTransactionURLs           wildcard.Matchers
+	usePathAsTransactionName        bool
+	transactionNameGroups           wildcard.Matchers
+	transactionNameIncludeMethod    bool
+	compressionOptions              compressionOptions
+	errorGroupingKey                ErrorGroupingKeyFunc
 }
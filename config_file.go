@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm // import "go.elastic.co/apm/v2"
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.elastic.co/apm/v2/apmconfig"
+)
+
+// configFileWatcher is an apmconfig.Watcher which polls the configuration
+// file for changes. Changes report the settings whose values differ from
+// those initially loaded from the file; settings which are subsequently
+// removed from the file, or restored to their initial value, revert to
+// local config.
+type configFileWatcher struct {
+	*apmconfig.FileWatcher
+	initial map[string]string
+
+	// attrs holds the most recently reported changes.
+	attrs atomic.Pointer[map[string]string]
+}
+
+func newConfigFileWatcher(path string, initial map[string]string, interval time.Duration) *configFileWatcher {
+	return &configFileWatcher{
+		FileWatcher: apmconfig.NewFileWatcher(path, interval),
+		initial:     initial,
+	}
+}
+
+// WatchConfig polls the configuration file for changes,
+// until ctx is canceled.
+func (w *configFileWatcher) WatchConfig(ctx context.Context, params apmconfig.WatchParams) <-chan apmconfig.Change {
+	in := w.FileWatcher.WatchConfig(ctx, params)
+	changes := make(chan apmconfig.Change)
+	go func() {
+		defer close(changes)
+		for change := range in {
+			if change.Err == nil {
+				attrs := make(map[string]string)
+				for k, v := range change.Attrs {
+					if initial, ok := w.initial[k]; !ok || initial != v {
+						attrs[k] = v
+					}
+				}
+				change.Attrs = attrs
+				w.attrs.Store(&attrs)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case changes <- change:
+			}
+		}
+	}()
+	return changes
+}
+
+// currentAttrs returns the most recently reported changes to the file.
+//
+// The returned map must not be modified.
+func (w *configFileWatcher) currentAttrs() map[string]string {
+	if attrs := w.attrs.Load(); attrs != nil {
+		return *attrs
+	}
+	return nil
+}
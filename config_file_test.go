@@ -0,0 +1,222 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/apmconfig"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+	"go.elastic.co/apm/v2/transport"
+	"go.elastic.co/apm/v2/transport/transporttest"
+)
+
+func TestTracerConfigFile(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+service_name: file_service
+service_version: "1.0"
+ELASTIC_APM_ENVIRONMENT: file_environment
+global_labels:
+  a: b
+  c: d
+`)
+	t.Setenv("ELASTIC_APM_SERVICE_VERSION", "env_version")
+
+	tracer, transport := newConfigFileTracer(t, apm.TracerOptions{ConfigFile: path})
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	_, _, service, labels := transport.Metadata()
+	assert.Equal(t, "file_service", service.Name)
+	assert.Equal(t, "env_version", service.Version) // environment takes precedence
+	assert.Equal(t, "file_environment", service.Environment)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "a", Value: "b"},
+		{Key: "c", Value: "d"},
+	}, labels)
+}
+
+func TestTracerConfigFileEnv(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"service_name": "json_service"}`)
+	t.Setenv("ELASTIC_APM_CONFIG_FILE", path)
+
+	tracer, transport := newConfigFileTracer(t, apm.TracerOptions{})
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	_, _, service, _ := transport.Metadata()
+	assert.Equal(t, "json_service", service.Name)
+}
+
+func TestTracerConfigFileIsolated(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "service_name: file_service\n")
+	t.Setenv("ELASTIC_APM_SERVICE_NAME", "")
+	newConfigFileTracer(t, apm.TracerOptions{ConfigFile: path})
+
+	// The file's settings apply only to the tracer configured with it.
+	tracer, transport := newConfigFileTracer(t, apm.TracerOptions{})
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	_, _, service, _ := transport.Metadata()
+	assert.NotEqual(t, "file_service", service.Name)
+}
+
+func TestTracerConfigFileKubernetes(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte("shop"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "name"), []byte("frontend-1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "labels"), []byte("app=\"frontend\"\ntier=\"web\"\n"), 0644))
+	path := writeConfigFile(t, "config.yaml", "kubernetes_downward_api_path: "+dir+"\nkubernetes_pod_labels: app\n")
+
+	tracer, transport := newConfigFileTracer(t, apm.TracerOptions{ConfigFile: path})
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	system, _, _, labels := transport.Metadata()
+	require.NotNil(t, system.Kubernetes)
+	require.NotNil(t, system.Kubernetes.Pod)
+	assert.Equal(t, "shop", system.Kubernetes.Namespace)
+	assert.Equal(t, "frontend-1", system.Kubernetes.Pod.Name)
+	assert.Equal(t, model.IfaceMap{{Key: "app", Value: "frontend"}}, labels)
+}
+
+func TestTracerConfigFileTransport(t *testing.T) {
+	requests := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests <- req.URL.Path
+	}))
+	defer server.Close()
+	t.Setenv("ELASTIC_APM_SERVER_URL", "")
+	t.Setenv("ELASTIC_APM_SERVER_URLS", "")
+	t.Setenv("ELASTIC_APM_CENTRAL_CONFIG", "false")
+	path := writeConfigFile(t, "config.yaml", "server_url: "+server.URL+"\n")
+
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{ConfigFile: path})
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+	select {
+	case path := <-requests:
+		assert.Equal(t, "/intake/v2/events", path)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for request")
+	}
+}
+
+func TestTracerConfigFileInvalid(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "service_name: [")
+	_, err := apm.NewTracerOptions(apm.TracerOptions{
+		ConfigFile: path,
+		Transport:  transporttest.Discard,
+	})
+	assert.Error(t, err)
+
+	_, err = apm.NewTracerOptions(apm.TracerOptions{
+		ConfigFile: filepath.Join(t.TempDir(), "missing.yaml"),
+		Transport:  transporttest.Discard,
+	})
+	assert.Error(t, err)
+}
+
+func TestTracerConfigFileWatch(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "recording: true\n")
+	tracer, _ := newConfigFileTracer(t, apm.TracerOptions{
+		ConfigFile:              path,
+		ConfigFileWatchInterval: 10 * time.Millisecond,
+	})
+	assert.True(t, tracer.Recording())
+
+	writeConfigFile(t, "config.yaml", "recording: false\n", path)
+	assert.Eventually(t, func() bool { return !tracer.Recording() }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, apm.ConfigSetting{
+		Name:   "recording",
+		Value:  "false",
+		Source: apm.ConfigSourceFile,
+	}, effectiveConfig(tracer)["recording"])
+
+	// Restoring the initial value reverts to local config.
+	writeConfigFile(t, "config.yaml", "recording: true\n", path)
+	assert.Eventually(t, tracer.Recording, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestTracerConfigFileWatchCentralConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "recording: true\n")
+	tracer, _ := newConfigFileTracer(t, apm.TracerOptions{
+		ConfigFile:              path,
+		ConfigFileWatchInterval: 10 * time.Millisecond,
+		Transport: centralConfigTransport{
+			Transport: transporttest.Discard,
+			attrs:     map[string]string{"recording": "true"},
+		},
+	})
+	writeConfigFile(t, "config.yaml", "recording: false\n", path)
+
+	// The file's change should be overridden by central config.
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, tracer.Recording())
+}
+
+type centralConfigTransport struct {
+	transport.Transport
+	attrs map[string]string
+}
+
+func (t centralConfigTransport) WatchConfig(ctx context.Context, params apmconfig.WatchParams) <-chan apmconfig.Change {
+	changes := make(chan apmconfig.Change, 1)
+	changes <- apmconfig.Change{Attrs: t.attrs}
+	return changes
+}
+
+func newConfigFileTracer(t *testing.T, opts apm.TracerOptions) (*apm.Tracer, *transporttest.RecorderTransport) {
+	var recorder transporttest.RecorderTransport
+	if opts.Transport == nil {
+		opts.Transport = &recorder
+	}
+	tracer, err := apm.NewTracerOptions(opts)
+	require.NoError(t, err)
+	t.Cleanup(tracer.Close)
+	tracer.SetLogger(apmtest.NewTestLogger(t))
+	return tracer, &recorder
+}
+
+// writeConfigFile writes content to a file with the given name in a new
+// temporary directory, or to path if specified, returning the file path.
+func writeConfigFile(t *testing.T, name, content string, path ...string) string {
+	filePath := filepath.Join(t.TempDir(), name)
+	if len(path) > 0 {
+		filePath = path[0]
+	}
+	// Write atomically, so the watcher never observes a partially written file.
+	tmp := filePath + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, []byte(content), 0644))
+	require.NoError(t, os.Rename(tmp, filePath))
+	return filePath
+}
@@ -78,9 +78,32 @@ func TestTracerCentralConfigUpdate(t *testing.T) {
 		capturer := tracer.CaptureHTTPRequestBody(req)
 		return capturer != nil
 	})
+	run("capture_headers", "false", func(tracer *apmtest.RecordingTracer) bool {
+		tx := tracer.StartTransaction("name", "type")
+		defer tx.Discard()
+		return !tx.ShouldCaptureHeaders()
+	})
 	run("recording", "false", func(tracer *apmtest.RecordingTracer) bool {
 		return !tracer.Recording()
 	})
+	run("use_elastic_traceparent_header", "false", func(tracer *apmtest.RecordingTracer) bool {
+		return !tracer.ShouldPropagateLegacyHeader()
+	})
+	run("disable_metrics", "*", func(tracer *apmtest.RecordingTracer) bool {
+		tracer.ResetPayloads()
+		// SendMetrics blocks until metrics are sent, which
+		// will never happen if all metrics are disabled.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		tracer.SendMetrics(ctx.Done())
+		tracer.Flush(nil)
+		for _, m := range tracer.Payloads().Metrics {
+			if len(m.Samples) > 0 {
+				return false
+			}
+		}
+		return true
+	})
 	run("span_stack_trace_min_duration", "1ms", func(tracer *apmtest.RecordingTracer) bool {
 		tracer.ResetPayloads()
 
@@ -143,6 +166,15 @@ func TestTracerCentralConfigUpdate(t *testing.T) {
 		require.NoError(t, err)
 		return tracer.IgnoredTransactionURL(u)
 	})
+	run("use_path_as_transaction_name", "true", func(tracer *apmtest.RecordingTracer) bool {
+		return tracer.HTTPTransactionName("GET", "/user/:id", "/user/123") == "GET /user/123"
+	})
+	run("transaction_name_groups", "/user/*", func(tracer *apmtest.RecordingTracer) bool {
+		return tracer.HTTPTransactionName("GET", "/user/123", "/user/123") == "GET /user/*"
+	})
+	run("transaction_name_include_method", "false", func(tracer *apmtest.RecordingTracer) bool {
+		return tracer.HTTPTransactionName("GET", "/", "/") == "/"
+	})
 	run("trace_continuation_strategy", "restart", func(tracer *apmtest.RecordingTracer) bool {
 		tracer.ResetPayloads()
 
@@ -311,6 +343,54 @@ func TestTracerCentralConfigUpdateDisabled(t *testing.T) {
 	}
 }
 
+func TestTracerCentralConfigResult(t *testing.T) {
+	watcherFunc := apmtest.WatchConfigFunc(func(ctx context.Context, params apmconfig.WatchParams) <-chan apmconfig.Change {
+		changes := make(chan apmconfig.Change)
+		go func() {
+			select {
+			case changes <- apmconfig.Change{
+				Attrs: map[string]string{
+					"metrics_interval":      "1s",
+					"api_request_time":      "5s",
+					"api_request_size":      "1b",
+					"heap_profile_interval": "invalid",
+					"unknown":               "value",
+				},
+			}:
+			case <-ctx.Done():
+			}
+		}()
+		return changes
+	})
+	tracer, err := apm.NewTracer("", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+
+	results := make(chan string, 1)
+	tracer.SetLogger(apmtest.NewTestLogger(logfFunc(func(format string, args ...interface{}) {
+		if message := fmt.Sprintf(format, args...); strings.Contains(message, "central config result") {
+			results <- message
+		}
+	})))
+	tracer.SetConfigWatcher(watcherFunc)
+	select {
+	case result := <-results:
+		assert.Equal(t, "[DEBUG] central config result: applied api_request_time,metrics_interval; rejected "+
+			"api_request_size (api_request_size must be at least 1KB and less than 5MB, got 1B),"+
+			"heap_profile_interval (failed to parse heap_profile_interval: invalid duration invalid),"+
+			"unknown (unsupported config)", result)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for config result")
+	}
+}
+
+// logfFunc is an apmtest.LogfLogger which calls the function.
+type logfFunc func(format string, args ...interface{})
+
+func (f logfFunc) Logf(format string, args ...interface{}) {
+	f(format, args...)
+}
+
 func TestTracerSetConfigWatcher(t *testing.T) {
 	watcherClosed := make(chan struct{})
 	watcherFunc := apmtest.WatchConfigFunc(func(ctx context.Context, params apmconfig.WatchParams) <-chan apmconfig.Change {
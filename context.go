@@ -36,16 +36,27 @@ type Context struct {
 	requestBody         model.RequestBody
 	requestSocket       model.RequestSocket
 	response            model.Response
+	responseBody        string
 	user                model.User
 	service             model.Service
 	serviceFramework    model.Framework
 	otel                *model.OTel
 	captureHeaders      bool
+	captureBody         CaptureBodyMode
 	captureBodyMask     CaptureBodyMode
 	sanitizedFieldNames wildcard.Matchers
+	redactor            *redactor
 }
 
 func (c *Context) build() *model.Context {
+	if c.responseBody != "" {
+		body := c.responseBody
+		if c.redactor != nil {
+			body = sanitizeBody(body, c.sanitizedFieldNames, c.redactor)
+		}
+		c.model.Custom = append(c.model.Custom, model.IfaceMapItem{Key: responseBodyCustomKey, Value: body})
+		c.responseBody = ""
+	}
 	switch {
 	case c.model.Request != nil:
 	case c.model.Response != nil:
@@ -56,14 +67,16 @@ func (c *Context) build() *model.Context {
 	default:
 		return nil
 	}
-	if len(c.sanitizedFieldNames) != 0 {
+	if len(c.sanitizedFieldNames) != 0 || c.redactor != nil {
 		if c.model.Request != nil {
-			sanitizeRequest(c.model.Request, c.sanitizedFieldNames)
+			sanitizeRequest(c.model.Request, c.sanitizedFieldNames, c.redactor)
 		}
 		if c.model.Response != nil {
 			sanitizeResponse(c.model.Response, c.sanitizedFieldNames)
 		}
-
+		if c.redactor != nil && len(c.model.Custom) != 0 {
+			sanitizeCustom(c.model.Custom, c.sanitizedFieldNames, c.redactor)
+		}
 	}
 	return &c.model
 }
@@ -236,6 +249,23 @@ func (c *Context) SetHTTPRequestBody(bc *BodyCapturer) {
 	}
 }
 
+// SetRequestBody sets the raw request body in the context, truncating it
+// if it is too long.
+//
+// SetRequestBody is intended for protocols other than HTTP, such as gRPC,
+// where the request body is not read through an http.Request and so cannot
+// be captured with Tracer.CaptureHTTPRequestBody. If the tracer is not
+// configured to capture bodies for the transaction or error, then this
+// is a no-op.
+func (c *Context) SetRequestBody(body string) {
+	if c.captureBody&c.captureBodyMask == 0 || body == "" {
+		return
+	}
+	c.requestBody = model.RequestBody{Raw: truncateString(body)}
+	c.request.Body = &c.requestBody
+	c.model.Request = &c.request
+}
+
 // SetHTTPResponseHeaders sets the HTTP response headers in the context.
 func (c *Context) SetHTTPResponseHeaders(h http.Header) {
 	if !c.captureHeaders {
@@ -251,6 +281,21 @@ func (c *Context) SetHTTPResponseHeaders(h http.Header) {
 	}
 }
 
+// SetHTTPResponseBody sets the response body in context given a (possibly
+// nil) ResponseBodyCapturer returned by Tracer.CaptureHTTPResponseBody, and
+// the response's status code and Content-Type header value. The body is only
+// recorded if the status code and content type match the tracer's
+// configuration.
+//
+// The intake API has no field for the response body, so it is recorded
+// in the custom context with the key "response_body".
+func (c *Context) SetHTTPResponseBody(bc *ResponseBodyCapturer, statusCode int, contentType string) {
+	if bc == nil || bc.captureBody&c.captureBodyMask == 0 || !bc.shouldCapture(statusCode, contentType) {
+		return
+	}
+	c.responseBody = bc.getBufferTruncated()
+}
+
 // SetHTTPStatusCode records the HTTP response status code.
 //
 // If, when the transaction ends, its Outcome field has not
@@ -121,6 +121,53 @@ func TestContextCustom(t *testing.T) {
 	}, tx.Context.Custom)
 }
 
+func TestContextSetRequestBody(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	assert.False(t, tx.ShouldCaptureBody())
+	tx.Context.SetRequestBody("ignored")
+	tx.End()
+
+	tracer.SetCaptureBody(apm.CaptureBodyTransactions)
+	tx = tracer.StartTransaction("name", "type")
+	assert.True(t, tx.ShouldCaptureBody())
+	tx.Context.SetRequestBody(`{"foo":"bar"}`)
+	tx.End()
+
+	tracer.SetCaptureBody(apm.CaptureBodyErrors)
+	tx = tracer.StartTransaction("name", "type")
+	assert.False(t, tx.ShouldCaptureBody())
+	tx.Context.SetRequestBody("ignored")
+	tx.End()
+	tracer.Flush(nil)
+
+	txs := tracer.Payloads().Transactions
+	require.Len(t, txs, 3)
+	assert.Nil(t, txs[0].Context)
+	require.NotNil(t, txs[1].Context)
+	assert.Equal(t, &model.RequestBody{Raw: `{"foo":"bar"}`}, txs[1].Context.Request.Body)
+	assert.Nil(t, txs[2].Context)
+}
+
+func TestTransactionShouldCaptureHeaders(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	assert.True(t, tx.ShouldCaptureHeaders())
+	assert.True(t, tx.IsSanitizedFieldName("Authorization"))
+	assert.False(t, tx.IsSanitizedFieldName("Content-Type"))
+	tx.End()
+	assert.False(t, tx.ShouldCaptureHeaders())
+
+	tracer.SetCaptureHeaders(false)
+	tx = tracer.StartTransaction("name", "type")
+	assert.False(t, tx.ShouldCaptureHeaders())
+	tx.End()
+}
+
 func TestContextSetUsernamePrecedence(t *testing.T) {
 	tx := testSendTransaction(t, func(tx *apm.Transaction) {
 		tx.Context.SetUsername("frieda")
@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm // import "go.elastic.co/apm/v2"
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+// Duration histogram metric names.
+const (
+	transactionDurationHistogramMetricName = "transaction.duration.histogram"
+	spanDurationHistogramMetricName        = "span.duration.histogram"
+)
+
+// Names of the labels with which the duration histograms are recorded in
+// the registry. The labels are moved to the metricsets' transaction and
+// span fields when gathered, and are not reported as labels.
+const (
+	durationHistogramTransactionNameLabel = "transaction.name"
+	durationHistogramTransactionTypeLabel = "transaction.type"
+	durationHistogramSpanTypeLabel        = "span.type"
+	durationHistogramSpanSubtypeLabel     = "span.subtype"
+)
+
+// durationHistogramBuckets holds the upper bounds, in microseconds, of the
+// duration histogram buckets. The buckets cover 10µs to 90s, with at most
+// 25% relative error, so percentiles may be accurately estimated.
+var durationHistogramBuckets = func() []float64 {
+	mantissas := []float64{1, 1.25, 1.5, 1.75, 2, 2.5, 3, 3.5, 4, 4.5, 5, 6, 7, 8, 9}
+	var buckets []float64
+	for exponent := 1; exponent <= 7; exponent++ {
+		for _, m := range mantissas {
+			buckets = append(buckets, m*math.Pow10(exponent))
+		}
+	}
+	return buckets
+}()
+
+// durationHistograms records histograms of transaction durations, per
+// transaction name and type, and of exit span durations, per span type
+// and subtype. Like breakdown metrics, the histograms are reported as
+// metricsets with their transaction or span fields set.
+//
+// The histograms are recorded in a MetricsRegistry, which is replaced
+// each time the histograms are gathered, so that the registry's limit of
+// 1000 label sets per metric applies to the transaction groups and span
+// types of each reporting period.
+//
+// durationHistograms may be written to concurrently by any number of
+// goroutines ending transactions and spans.
+type durationHistograms struct {
+	enabled bool
+
+	// mu is held for reading while recording durations,
+	// and for writing while replacing registry.
+	mu       sync.RWMutex
+	registry *MetricsRegistry
+}
+
+func newDurationHistograms() *durationHistograms {
+	return &durationHistograms{registry: NewMetricsRegistry()}
+}
+
+// recordTransaction records the duration of a transaction.
+func (h *durationHistograms) recordTransaction(td *TransactionData) {
+	if !h.enabled {
+		return
+	}
+	h.record(transactionDurationHistogramMetricName, td.Duration,
+		MetricLabel{Name: durationHistogramTransactionNameLabel, Value: td.Name},
+		MetricLabel{Name: durationHistogramTransactionTypeLabel, Value: td.Type},
+	)
+}
+
+// recordSpan records the duration of an exit span.
+func (h *durationHistograms) recordSpan(sd *SpanData) {
+	if !h.enabled {
+		return
+	}
+	h.record(spanDurationHistogramMetricName, sd.Duration,
+		MetricLabel{Name: durationHistogramSpanSubtypeLabel, Value: sd.Subtype},
+		MetricLabel{Name: durationHistogramSpanTypeLabel, Value: sd.Type},
+	)
+}
+
+func (h *durationHistograms) record(name string, d time.Duration, labels ...MetricLabel) {
+	if d < 0 {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	hist := h.registry.Histogram(name, durationHistogramBuckets)
+	hist.With(labels...).Record(float64(d) / float64(time.Microsecond))
+}
+
+// gather is called by builtinMetricsGatherer to gather duration histograms.
+func (h *durationHistograms) gather(ctx context.Context, out *Metrics) error {
+	if !h.enabled {
+		return nil
+	}
+	h.mu.Lock()
+	registry := h.registry
+	h.registry = NewMetricsRegistry()
+	h.mu.Unlock()
+
+	var gathered Metrics
+	gathered.disabled = out.disabled
+	if err := registry.GatherMetrics(ctx, &gathered); err != nil {
+		return err
+	}
+	for _, m := range gathered.metrics {
+		metrics := &model.Metrics{Samples: m.Samples}
+		for _, label := range m.Labels {
+			switch label.Key {
+			case durationHistogramTransactionNameLabel:
+				metrics.Transaction.Name = label.Value
+			case durationHistogramTransactionTypeLabel:
+				metrics.Transaction.Type = label.Value
+			case durationHistogramSpanTypeLabel:
+				metrics.Span.Type = label.Value
+			case durationHistogramSpanSubtypeLabel:
+				metrics.Span.Subtype = label.Value
+			}
+		}
+		out.transactionGroupMetrics = append(out.transactionGroupMetrics, metrics)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/model"
+	"go.elastic.co/apm/v2/transport/transporttest"
+)
+
+func TestDurationHistograms(t *testing.T) {
+	t.Setenv("ELASTIC_APM_DURATION_HISTOGRAMS", "true")
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	// Unsampled transactions and their spans are recorded.
+	tracer.SetSampler(apm.NewRatioSampler(0))
+
+	for _, d := range []time.Duration{32 * time.Millisecond, 33 * time.Millisecond, 2 * time.Minute} {
+		tx := tracer.StartTransaction("GET /", "request")
+		span := tx.StartSpanOptions("SELECT", "db.mysql", apm.SpanOptions{ExitSpan: true})
+		span.Context.SetDatabase(apm.DatabaseSpanContext{Type: "sql", Instance: "customers"})
+		span.Duration = 12 * time.Millisecond
+		span.End()
+		internal := tx.StartSpan("internal", "app", nil)
+		internal.Duration = time.Millisecond
+		internal.End()
+		tx.Duration = d
+		tx.End()
+	}
+	tx := tracer.StartTransaction("GET /", "request")
+	tx.Duration = 5 * time.Microsecond
+	tx.End()
+
+	tracer.Flush(nil)
+	tracer.SendMetrics(nil)
+
+	assert.Equal(t, []model.Metrics{{
+		Span: model.MetricsSpan{Type: "db", Subtype: "mysql"},
+		Samples: map[string]model.Metric{
+			"span.duration.histogram": {
+				Type:   "histogram",
+				Values: []float64{11250},
+				Counts: []uint64{3},
+			},
+		},
+	}, {
+		Transaction: model.MetricsTransaction{Type: "request", Name: "GET /"},
+		Samples: map[string]model.Metric{
+			"transaction.duration.histogram": {
+				Type:   "histogram",
+				Values: []float64{5, 32500, 9e7},
+				Counts: []uint64{1, 2, 1},
+			},
+		},
+	}}, payloadsDurationHistograms(transport))
+
+	// Histograms are reset after they are gathered.
+	transport.ResetPayloads()
+	tracer.SendMetrics(nil)
+	assert.Empty(t, payloadsDurationHistograms(transport))
+}
+
+func TestDurationHistogramsDisabled(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpanOptions("name", "db", apm.SpanOptions{ExitSpan: true}).End()
+	tx.End()
+	tracer.Flush(nil)
+	tracer.SendMetrics(nil)
+	assert.Empty(t, payloadsDurationHistograms(transport))
+}
+
+func TestDurationHistogramsLimit(t *testing.T) {
+	t.Setenv("ELASTIC_APM_DURATION_HISTOGRAMS", "true")
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	for i := 0; i < 1500; i++ {
+		tx := tracer.StartTransaction(fmt.Sprint(i), "request")
+		tx.End()
+	}
+	tracer.Flush(nil)
+	tracer.SendMetrics(nil)
+	assert.Len(t, payloadsDurationHistograms(transport), 1000)
+}
+
+func payloadsDurationHistograms(t *transporttest.RecorderTransport) []model.Metrics {
+	var out []model.Metrics
+	for _, m := range t.Payloads().Metrics {
+		for name := range m.Samples {
+			if name == "transaction.duration.histogram" || name == "span.duration.histogram" {
+				m.Timestamp = model.Time{}
+				out = append(out, m)
+				break
+			}
+		}
+	}
+	return out
+}
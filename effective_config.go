@@ -0,0 +1,245 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm // import "go.elastic.co/apm/v2"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.elastic.co/apm/v2/internal/apmlog"
+	"go.elastic.co/apm/v2/internal/configutil"
+)
+
+// ConfigSource identifies where the effective value of a configuration
+// setting was defined.
+type ConfigSource string
+
+const (
+	// ConfigSourceDefault indicates that the setting has its default value.
+	ConfigSourceDefault ConfigSource = "default"
+
+	// ConfigSourceEnv indicates that the setting was defined
+	// by an environment variable.
+	ConfigSourceEnv ConfigSource = "env"
+
+	// ConfigSourceFile indicates that the setting was defined by the
+	// configuration file, either initially or by watching it for changes.
+	ConfigSourceFile ConfigSource = "file"
+
+	// ConfigSourceRemote indicates that the setting was defined by central
+	// config, or another config watcher set with Tracer.SetConfigWatcher.
+	ConfigSourceRemote ConfigSource = "remote"
+
+	// ConfigSourceAPI indicates that the setting was defined by calling
+	// one of the Tracer's methods, such as Tracer.SetSampler.
+	ConfigSourceAPI ConfigSource = "api"
+)
+
+// ConfigSetting holds the effective value of a configuration setting.
+type ConfigSetting struct {
+	// Name holds the setting's name, as used for central config,
+	// e.g. "transaction_sample_rate".
+	Name string `json:"name"`
+
+	// Value holds the setting's effective value, formatted as for
+	// the corresponding environment variable.
+	Value string `json:"value"`
+
+	// Source identifies where the effective value was defined.
+	Source ConfigSource `json:"source"`
+}
+
+// EffectiveConfig returns the effective values of the configuration
+// settings which may be changed while the tracer is running, sorted by
+// name, along with the source of each value.
+//
+// Settings which are held by the tracer's background goroutine, such as
+// metrics_interval, are omitted once the tracer has been closed.
+func (t *Tracer) EffectiveConfig() []ConfigSetting {
+	cfg := t.instrumentationConfig()
+	remoteAttrs := t.remoteConfigAttrs()
+	var fileAttrs map[string]string
+	if t.configFileWatcher != nil {
+		fileAttrs = t.configFileWatcher.currentAttrs()
+	}
+	tracerCfg, tracerCfgOK := t.tracerConfig()
+	logger := apmlog.DefaultLogger()
+
+	var settings []ConfigSetting
+	add := func(envKey, value string, deprecatedEnvKeys ...string) {
+		name := strings.ToLower(strings.TrimPrefix(envKey, "ELASTIC_APM_"))
+		setting := ConfigSetting{Name: name, Value: value, Source: ConfigSourceDefault}
+		_, remote := cfg.remote[envKey]
+		if !remote && tracerCfgOK {
+			_, remote = tracerCfg.remote[envKey]
+		}
+		if remote {
+			setting.Source = ConfigSourceRemote
+			if v, ok := fileAttrs[name]; ok && v == remoteAttrs[name] {
+				setting.Source = ConfigSourceFile
+			}
+		} else if _, ok := t.apiConfig.Load(envKey); ok {
+			setting.Source = ConfigSourceAPI
+		} else if envKey == apmlog.EnvLogLevel && logger != nil && logger.LevelFromEnv() {
+			// The default logger's level is defined by the
+			// environment when the logger is initialised.
+			setting.Source = ConfigSourceEnv
+		} else {
+			for _, envKey := range append([]string{envKey}, deprecatedEnvKeys...) {
+				if source := t.configEnv.Source(envKey); source != configutil.SourceNone {
+					setting.Source = ConfigSourceEnv
+					if source == configutil.SourceFile {
+						setting.Source = ConfigSourceFile
+					}
+					break
+				}
+			}
+		}
+		settings = append(settings, setting)
+	}
+
+	add(envRecording, strconv.FormatBool(cfg.recording))
+	add(envCaptureBody, formatCaptureBody(cfg.captureBody))
+	add(envCaptureHeaders, strconv.FormatBool(cfg.captureHeaders))
+	add(envCaptureResponseBody, formatCaptureBody(cfg.captureResponseBody))
+	add(envCaptureResponseBodyContentTypes, cfg.captureResponseBodyContentTypes.String())
+	add(envCaptureResponseBodyStatusCodes, cfg.captureResponseBodyStatusCodes.String())
+	add(envMaxSpans, strconv.Itoa(cfg.maxSpans))
+	add(envTransactionSampleRate, formatSampler(cfg.sampler))
+	add(envSpanStackTraceMinDuration, cfg.spanStackTraceMinDuration.String(), deprecatedEnvSpanFramesMinDuration)
+	add(envExitSpanMinDuration, cfg.exitSpanMinDuration.String())
+	add(envContinuationStrategy, cfg.continuationStrategy)
+	add(envStackTraceLimit, strconv.Itoa(cfg.stackTraceLimit))
+	add(envUseElasticTraceparentHeader, strconv.FormatBool(cfg.propagateLegacyHeader))
+	add(envSanitizeFieldNames, cfg.sanitizedFieldNames.String())
+	add(envRedactionRules, cfg.redactor.String())
+	add(envIgnoreURLs, cfg.ignoreTransactionURLs.String(), deprecatedEnvIgnoreURLs)
+	add(envUsePathAsTransactionName, strconv.FormatBool(cfg.usePathAsTransactionName))
+	add(envTransactionNameGroups, cfg.transactionNameGroups.String())
+	add(envTransactionNameIncludeMethod, strconv.FormatBool(cfg.transactionNameIncludeMethod))
+	add(envSpanCompressionEnabled, strconv.FormatBool(cfg.compressionOptions.enabled))
+	add(envSpanCompressionExactMatchMaxDuration, cfg.compressionOptions.exactMatchMaxDuration.String())
+	add(envSpanCompressionSameKindMaxDuration, cfg.compressionOptions.sameKindMaxDuration.String())
+	if logger != nil {
+		add(apmlog.EnvLogLevel, logger.Level().String())
+	}
+	if tracerCfgOK {
+		add(envMetricsInterval, tracerCfg.metricsInterval.String())
+		add(envDisableMetrics, tracerCfg.disabledMetrics.String())
+		add(envAPIRequestTime, tracerCfg.requestDuration.String())
+		add(envAPIRequestSize, configutil.Size(tracerCfg.requestSize).String())
+		add(envCPUProfileInterval, tracerCfg.cpuProfileInterval.String())
+		add(envCPUProfileDuration, tracerCfg.cpuProfileDuration.String())
+		add(envHeapProfileInterval, tracerCfg.heapProfileInterval.String())
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Name < settings[j].Name
+	})
+	return settings
+}
+
+// tracerConfig returns a copy of the configuration held by the
+// tracer's background goroutine, or false if the tracer is inactive.
+func (t *Tracer) tracerConfig() (tracerConfig, bool) {
+	if !t.Active() {
+		return tracerConfig{}, false
+	}
+	result := make(chan tracerConfig, 1)
+	select {
+	case t.configCommands <- func(cfg *tracerConfig) { result <- *cfg }:
+	case <-t.closing:
+		return tracerConfig{}, false
+	}
+	select {
+	case cfg := <-result:
+		return cfg, true
+	case <-t.closed:
+		return tracerConfig{}, false
+	}
+}
+
+// remoteConfigAttrs returns the most recently applied remote config.
+//
+// The returned map must not be modified.
+func (t *Tracer) remoteConfigAttrs() map[string]string {
+	if attrs := t.remoteConfig.Load(); attrs != nil {
+		return *attrs
+	}
+	return nil
+}
+
+// setAPIInstrumentationConfig is like setLocalInstrumentationConfig,
+// additionally recording that the config was set via the Tracer API.
+func (t *Tracer) setAPIInstrumentationConfig(envKey string, f func(cfg *instrumentationConfigValues)) {
+	t.apiConfig.Store(envKey, struct{}{})
+	t.setLocalInstrumentationConfig(envKey, f)
+}
+
+func formatCaptureBody(mode CaptureBodyMode) string {
+	switch mode {
+	case CaptureBodyAll:
+		return "all"
+	case CaptureBodyErrors:
+		return "errors"
+	case CaptureBodyTransactions:
+		return "transactions"
+	}
+	return "off"
+}
+
+func formatSampler(s Sampler) string {
+	switch s := s.(type) {
+	case nil:
+		return "1"
+	case ratioSampler:
+		return strconv.FormatFloat(s.ratio, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// NewDebugHandler returns an http.Handler which responds with a JSON
+// document describing the tracer's effective configuration, as returned
+// by Tracer.EffectiveConfig, and its statistics, as returned by
+// Tracer.Stats. The handler is intended to be served on a private
+// debugging or operations port, and should not be publicly exposed.
+func NewDebugHandler(t *Tracer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := json.MarshalIndent(struct {
+			Config []ConfigSetting `json:"config"`
+			Stats  TracerStats     `json:"stats"`
+		}{
+			Config: t.EffectiveConfig(),
+			Stats:  t.Stats(),
+		}, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
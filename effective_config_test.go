@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/apmconfig"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/transport/transporttest"
+)
+
+func TestTracerEffectiveConfig(t *testing.T) {
+	t.Setenv("ELASTIC_APM_TRANSACTION_MAX_SPANS", "10")
+	path := writeConfigFile(t, "config.yaml", "stack_trace_limit: 5\n")
+	tracer, _ := newConfigFileTracer(t, apm.TracerOptions{
+		ConfigFile: path,
+		Transport:  transporttest.Discard,
+	})
+	tracer.SetCaptureBody(apm.CaptureBodyAll)
+	tracer.SetSanitizedFieldNames("password", "(?-i)*Secret*")
+	tracer.SetMetricsInterval(time.Minute)
+
+	settings := effectiveConfig(tracer)
+	assert.Equal(t, apm.ConfigSetting{Name: "recording", Value: "true", Source: apm.ConfigSourceDefault}, settings["recording"])
+	assert.Equal(t, apm.ConfigSetting{Name: "transaction_max_spans", Value: "10", Source: apm.ConfigSourceEnv}, settings["transaction_max_spans"])
+	assert.Equal(t, apm.ConfigSetting{Name: "stack_trace_limit", Value: "5", Source: apm.ConfigSourceFile}, settings["stack_trace_limit"])
+	assert.Equal(t, apm.ConfigSetting{Name: "capture_body", Value: "all", Source: apm.ConfigSourceAPI}, settings["capture_body"])
+	assert.Equal(t, apm.ConfigSetting{
+		Name:   "sanitize_field_names",
+		Value:  "password, (?-i)*Secret*",
+		Source: apm.ConfigSourceAPI,
+	}, settings["sanitize_field_names"])
+	assert.Equal(t, apm.ConfigSetting{Name: "metrics_interval", Value: "1m0s", Source: apm.ConfigSourceAPI}, settings["metrics_interval"])
+	assert.Equal(t, apm.ConfigSetting{Name: "api_request_size", Value: "750KB", Source: apm.ConfigSourceDefault}, settings["api_request_size"])
+
+	// The sources are recorded when the settings are initialised,
+	// and are unaffected by later changes to the environment.
+	t.Setenv("ELASTIC_APM_TRANSACTION_MAX_SPANS", "")
+	t.Setenv("ELASTIC_APM_RECORDING", "false")
+	settings = effectiveConfig(tracer)
+	assert.Equal(t, apm.ConfigSetting{Name: "recording", Value: "true", Source: apm.ConfigSourceDefault}, settings["recording"])
+	assert.Equal(t, apm.ConfigSetting{Name: "transaction_max_spans", Value: "10", Source: apm.ConfigSourceEnv}, settings["transaction_max_spans"])
+
+	// The settings are sorted by name.
+	config := tracer.EffectiveConfig()
+	for i := 1; i < len(config); i++ {
+		assert.Less(t, config[i-1].Name, config[i].Name)
+	}
+}
+
+func TestTracerEffectiveConfigRemote(t *testing.T) {
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{Transport: transporttest.Discard})
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.SetLogger(apmtest.NewTestLogger(t))
+
+	// Remote config takes precedence over config set via the API.
+	tracer.SetSampler(apm.NewRatioSampler(1))
+	assert.Equal(t, apm.ConfigSetting{
+		Name:   "transaction_sample_rate",
+		Value:  "1",
+		Source: apm.ConfigSourceAPI,
+	}, effectiveConfig(tracer)["transaction_sample_rate"])
+
+	changes := make(chan apmconfig.Change)
+	tracer.SetConfigWatcher(apmtest.WatchConfigFunc(func(ctx context.Context, params apmconfig.WatchParams) <-chan apmconfig.Change {
+		return changes
+	}))
+	changes <- apmconfig.Change{Attrs: map[string]string{
+		"transaction_sample_rate": "0.5",
+		"api_request_time":        "5s",
+	}}
+	require.Eventually(t, func() bool {
+		return effectiveConfig(tracer)["api_request_time"].Source == apm.ConfigSourceRemote
+	}, 10*time.Second, 10*time.Millisecond)
+
+	settings := effectiveConfig(tracer)
+	assert.Equal(t, apm.ConfigSetting{
+		Name:   "transaction_sample_rate",
+		Value:  "0.5",
+		Source: apm.ConfigSourceRemote,
+	}, settings["transaction_sample_rate"])
+	assert.Equal(t, apm.ConfigSetting{
+		Name:   "api_request_time",
+		Value:  "5s",
+		Source: apm.ConfigSourceRemote,
+	}, settings["api_request_time"])
+}
+
+func TestDebugHandler(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	w := httptest.NewRecorder()
+	apm.NewDebugHandler(tracer.Tracer).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var response struct {
+		Config []apm.ConfigSetting
+		Stats  apm.TracerStats
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, tracer.EffectiveConfig(), response.Config)
+	assert.Equal(t, uint64(1), response.Stats.TransactionsSent)
+
+	w = httptest.NewRecorder()
+	apm.NewDebugHandler(tracer.Tracer).ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+// effectiveConfig returns the tracer's effective config, keyed by name.
+func effectiveConfig(tracer *apm.Tracer) map[string]apm.ConfigSetting {
+	settings := make(map[string]apm.ConfigSetting)
+	for _, setting := range tracer.EffectiveConfig() {
+		settings[setting.Name] = setting
+	}
+	return settings
+}
@@ -153,7 +153,9 @@ func (t *Tracer) newError() *Error {
 	if e.recording {
 		e.Timestamp = time.Now()
 		e.Context.captureHeaders = instrumentationConfig.captureHeaders
+		e.Context.captureBody = instrumentationConfig.captureBody
 		e.Context.sanitizedFieldNames = instrumentationConfig.sanitizedFieldNames
+		e.Context.redactor = instrumentationConfig.redactor
 		e.stackTraceLimit = instrumentationConfig.stackTraceLimit
 	}
 
@@ -217,6 +219,20 @@ type ErrorData struct {
 	// culprit.
 	Culprit string
 
+	// GroupingKey, if non-empty, is used for grouping the error with
+	// similar errors. It is reported as the log's parameterized message,
+	// which APM Server adds to the error's grouping key along with the
+	// exception type and stack frames.
+	//
+	// GroupingKey applies only to errors with a log message, such as
+	// those created with NewErrorLog. It is ignored for other errors,
+	// such as those created with NewError, and a warning is logged.
+	//
+	// This is initially unset; if it remains unset by the time Send is
+	// invoked for an error with a log message, it will be set using the
+	// function registered with Tracer.SetErrorGroupingKeyFunc, if any.
+	GroupingKey string
+
 	// Timestamp records the time at which the error occurred.
 	// This is set when the Error object is created, but may
 	// be overridden any time before the Send method is called.
@@ -343,6 +359,11 @@ func (e *Error) Send() {
 		return
 	}
 	if e.recording {
+		if e.GroupingKey == "" && e.log.Message != "" {
+			if f := e.tracer.instrumentationConfig().errorGroupingKey; f != nil {
+				e.GroupingKey = f(e)
+			}
+		}
 		e.ErrorData.enqueue()
 	} else {
 		e.reset()
@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm // import "go.elastic.co/apm/v2"
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ErrorGroupingKeyFunc is the type of a function for computing the
+// grouping key of an error. See ErrorData.GroupingKey.
+type ErrorGroupingKeyFunc func(*Error) string
+
+// errorMessageParams holds patterns matching the dynamic parts of error
+// messages, such as IDs and numbers, and the placeholders with which
+// they are replaced when normalizing error messages.
+var errorMessageParams = []struct {
+	pattern     string
+	placeholder string
+}{
+	{pattern: `"(?:[^"\\]|\\.)*"`, placeholder: "%q"},
+	{pattern: `'(?:[^'\\]|\\.)*'`, placeholder: "%q"},
+	{pattern: `\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`, placeholder: "%s"},
+	{pattern: `\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`, placeholder: "%s"},
+	{pattern: `\b0[xX][0-9a-fA-F]+\b`, placeholder: "%x"},
+	{pattern: `\b\d+\.\d+\b`, placeholder: "%f"},
+	{pattern: `\b\d+\b`, placeholder: "%d"},
+	{pattern: `\b[0-9a-fA-F]{16,}\b`, placeholder: "%s"},
+}
+
+var errorMessageParamsRegexp = func() *regexp.Regexp {
+	patterns := make([]string, len(errorMessageParams))
+	for i, param := range errorMessageParams {
+		patterns[i] = "(" + param.pattern + ")"
+	}
+	return regexp.MustCompile(strings.Join(patterns, "|"))
+}()
+
+// normalizeErrorMessage returns the error message with dynamic parts,
+// such as quoted strings, UUIDs, IP addresses and numbers, replaced
+// with fmt-style placeholders. For example, "user 123 not found" is
+// normalized to "user %d not found".
+//
+// If the message has no dynamic parts, it is returned unchanged.
+func normalizeErrorMessage(message string) string {
+	matches := errorMessageParamsRegexp.FindAllStringSubmatchIndex(message, -1)
+	if len(matches) == 0 {
+		return message
+	}
+	var b strings.Builder
+	var offset int
+	for _, match := range matches {
+		b.WriteString(message[offset:match[0]])
+		for i, param := range errorMessageParams {
+			if match[2+2*i] >= 0 {
+				b.WriteString(param.placeholder)
+				break
+			}
+		}
+		offset = match[1]
+	}
+	b.WriteString(message[offset:])
+	return b.String()
+}
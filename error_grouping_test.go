@@ -0,0 +1,205 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+	"go.elastic.co/apm/v2/transport/transporttest"
+)
+
+func TestErrorGroupingKey(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	e := tracer.NewErrorLog(apm.ErrorLogRecord{
+		Message: "user 123 not found",
+		Error:   errors.New("not found"),
+	})
+	e.GroupingKey = "user-not-found"
+	e.Send()
+	tracer.Flush(nil)
+
+	errors := recorder.Payloads().Errors
+	require.Len(t, errors, 1)
+	assert.Equal(t, "not found", errors[0].Exception.Message)
+	assert.Equal(t, model.Log{
+		Message:      "user 123 not found",
+		ParamMessage: "user-not-found",
+	}, errors[0].Log)
+}
+
+func TestErrorGroupingKeyNoLog(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var warnings []string
+	tracer.SetLogger(apmtest.NewTestLogger(logfFunc(func(format string, args ...interface{}) {
+		if strings.HasPrefix(format, "[WARNING]") {
+			warnings = append(warnings, fmt.Sprintf(format, args...))
+		}
+	})))
+	var groupingKeyFuncCalls int
+	tracer.SetErrorGroupingKeyFunc(func(e *apm.Error) string {
+		groupingKeyFuncCalls++
+		return "grouping-key-func"
+	})
+
+	// The grouping key is only reported for errors with a log;
+	// a log message is not fabricated from the exception message.
+	for i := 0; i < 2; i++ {
+		e := tracer.NewError(errors.New("user 123 not found"))
+		e.GroupingKey = "user-not-found"
+		e.Send()
+	}
+	tracer.NewError(errors.New("user 456 not found")).Send()
+	tracer.Flush(nil)
+
+	errors := recorder.Payloads().Errors
+	require.Len(t, errors, 3)
+	for _, e := range errors {
+		assert.Zero(t, e.Log)
+	}
+	assert.Equal(t, "user 123 not found", errors[0].Exception.Message)
+	assert.Zero(t, groupingKeyFuncCalls)
+
+	// A warning is logged once for the ignored grouping key.
+	assert.Equal(t, []string{
+		`[WARNING] ignoring grouping key "user-not-found" of error without a log message`,
+	}, warnings)
+}
+
+func TestErrorGroupingKeyFunc(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	errNotFound := errors.New("not found")
+	tracer.SetErrorGroupingKeyFunc(func(e *apm.Error) string {
+		if errors.Is(e.Cause(), errNotFound) {
+			return "not-found"
+		}
+		return ""
+	})
+
+	newErrorLog := func(err error) *apm.Error {
+		return tracer.NewErrorLog(apm.ErrorLogRecord{Message: err.Error(), Error: err})
+	}
+	newErrorLog(fmt.Errorf("user 123: %w", errNotFound)).Send()
+	newErrorLog(errors.New("internal error")).Send()
+	e := newErrorLog(fmt.Errorf("order 456: %w", errNotFound))
+	e.GroupingKey = "order-not-found"
+	e.Send()
+	tracer.Flush(nil)
+
+	errors := recorder.Payloads().Errors
+	require.Len(t, errors, 3)
+	assert.Equal(t, "not-found", errors[0].Log.ParamMessage)
+	assert.Empty(t, errors[1].Log.ParamMessage)
+	assert.Equal(t, "order-not-found", errors[2].Log.ParamMessage)
+}
+
+func TestErrorMessageNormalization(t *testing.T) {
+	t.Setenv("ELASTIC_APM_ERROR_MESSAGE_NORMALIZATION", "true")
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	for _, test := range []struct {
+		message  string
+		expected string
+	}{{
+		message:  "user 123 not found",
+		expected: "user %d not found",
+	}, {
+		message:  "no rows for id 2a6f1d3c-8e4b-4a7e-9c1d-5f0e3b2a1c9d",
+		expected: "no rows for id %s",
+	}, {
+		message:  "dial tcp 10.0.0.1:5432: connect: connection refused",
+		expected: "dial tcp %s: connect: connection refused",
+	}, {
+		message:  `unknown key "foo" at offset 0x1f`,
+		expected: "unknown key %q at offset %x",
+	}, {
+		message:  "object 5d41402abc4b2a76b9719d911017c592 exceeds limit 1.5",
+		expected: "object %s exceeds limit %f",
+	}, {
+		message:  "utf8 decoding failed for user_2",
+		expected: "", // no dynamic parts
+	}} {
+		tracer.NewErrorLog(apm.ErrorLogRecord{Message: test.message}).Send()
+		tracer.Flush(nil)
+
+		errors := recorder.Payloads().Errors
+		require.Len(t, errors, 1)
+		assert.Equal(t, test.message, errors[0].Log.Message)
+		assert.Equal(t, test.expected, errors[0].Log.ParamMessage, test.message)
+		recorder.ResetPayloads()
+	}
+}
+
+func TestErrorMessageNormalizationNoLog(t *testing.T) {
+	t.Setenv("ELASTIC_APM_ERROR_MESSAGE_NORMALIZATION", "true")
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.NewError(errors.New("user 123 not found")).Send()
+	tracer.Flush(nil)
+
+	errors := recorder.Payloads().Errors
+	require.Len(t, errors, 1)
+	assert.Equal(t, "user 123 not found", errors[0].Exception.Message)
+	assert.Zero(t, errors[0].Log)
+}
+
+func TestErrorMessageNormalizationLogRecord(t *testing.T) {
+	t.Setenv("ELASTIC_APM_ERROR_MESSAGE_NORMALIZATION", "true")
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.NewErrorLog(apm.ErrorLogRecord{Message: "retrying in 5 seconds"}).Send()
+	tracer.NewErrorLog(apm.ErrorLogRecord{
+		Message:       "retrying in 5 seconds",
+		MessageFormat: "retrying in %v seconds",
+	}).Send()
+	tracer.Flush(nil)
+
+	errors := recorder.Payloads().Errors
+	require.Len(t, errors, 2)
+	assert.Equal(t, "retrying in %d seconds", errors[0].Log.ParamMessage)
+	assert.Equal(t, "retrying in %v seconds", errors[1].Log.ParamMessage)
+}
+
+func TestErrorMessageNormalizationDisabled(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.NewErrorLog(apm.ErrorLogRecord{Message: "user 123 not found"}).Send()
+	tracer.Flush(nil)
+
+	errors := recorder.Payloads().Errors
+	require.Len(t, errors, 1)
+	assert.Empty(t, errors[0].Log.ParamMessage)
+}
@@ -0,0 +1,89 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm // import "go.elastic.co/apm/v2"
+
+import (
+	"sync"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+// EventProcessor is a function which is called with each event before
+// it is encoded and sent to the APM Server. An EventProcessor may modify
+// the event, and may return false to discard it.
+//
+// Event processors are called sequentially from the tracer's goroutine,
+// in the order in which they were added, and so must not block. Processing
+// stops at the first processor that discards the event. The event, and
+// any values it references, must not be retained after the processor
+// returns.
+type EventProcessor func(*Event) bool
+
+// Event holds an event to be processed by an EventProcessor.
+// Exactly one of the fields will be non-nil.
+type Event struct {
+	// Transaction holds a transaction event.
+	Transaction *model.Transaction
+
+	// Span holds a span event.
+	Span *model.Span
+
+	// Error holds an error event.
+	Error *model.Error
+
+	// Metrics holds a metricset event.
+	Metrics *model.Metrics
+}
+
+// AddEventProcessor adds p to the tracer's event processors, returning a
+// function which may be used to remove it.
+//
+// Events discarded by event processors are counted in TracerStats.
+func (t *Tracer) AddEventProcessor(p EventProcessor) func() {
+	// Wrap p in a pointer-to-struct, so we can safely compare.
+	wrapped := &struct{ EventProcessor }{EventProcessor: p}
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.eventProcessors = append(cfg.eventProcessors, wrapped)
+	})
+	remove := func(cfg *tracerConfig) {
+		for i, p := range cfg.eventProcessors {
+			if p != wrapped {
+				continue
+			}
+			cfg.eventProcessors = append(cfg.eventProcessors[:i], cfg.eventProcessors[i+1:]...)
+			break
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.sendConfigCommand(remove)
+		})
+	}
+}
+
+// processEvent calls each of the event processors with e, returning
+// false if any of them discards the event.
+func processEvent(processors []*struct{ EventProcessor }, e *Event) bool {
+	for _, p := range processors {
+		if !p.EventProcessor(e) {
+			return false
+		}
+	}
+	return true
+}
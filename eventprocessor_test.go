@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/transport/transporttest"
+)
+
+func TestEventProcessorModify(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.AddEventProcessor(func(e *apm.Event) bool {
+		switch {
+		case e.Transaction != nil:
+			e.Transaction.Name = "modified transaction"
+		case e.Span != nil:
+			e.Span.Name = "modified span"
+		case e.Error != nil:
+			e.Error.Culprit = "modified culprit"
+		}
+		return true
+	})
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("name", "type", nil).End()
+	tracer.NewError(errors.New("boom")).Send()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Spans, 1)
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, "modified transaction", payloads.Transactions[0].Name)
+	assert.Equal(t, "modified span", payloads.Spans[0].Name)
+	assert.Equal(t, "modified culprit", payloads.Errors[0].Culprit)
+}
+
+func TestEventProcessorDiscard(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var calls []string
+	tracer.AddEventProcessor(func(e *apm.Event) bool {
+		calls = append(calls, "first")
+		return e.Span == nil || e.Span.Name != "GET /healthz"
+	})
+	tracer.AddEventProcessor(func(e *apm.Event) bool {
+		calls = append(calls, "second")
+		return e.Error == nil && e.Metrics == nil
+	})
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("GET /healthz", "external.http", nil).End()
+	tx.StartSpan("GET /", "external.http", nil).End()
+	tracer.NewError(errors.New("boom")).Send()
+	tx.End()
+	tracer.Flush(nil)
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	assert.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Spans, 1)
+	assert.Equal(t, "GET /", payloads.Spans[0].Name)
+	assert.Empty(t, payloads.Errors)
+	assert.Empty(t, payloads.Metrics)
+
+	// The second processor is not called for the discarded span.
+	assert.Equal(t, []string{"first", "first", "second"}, calls[:3])
+
+	stats := tracer.Stats()
+	assert.Equal(t, uint64(0), stats.TransactionsFiltered)
+	assert.Equal(t, uint64(1), stats.SpansFiltered)
+	assert.Equal(t, uint64(1), stats.ErrorsFiltered)
+	assert.NotZero(t, stats.MetricsetsFiltered)
+}
+
+func TestEventProcessorRemove(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	remove := tracer.AddEventProcessor(func(e *apm.Event) bool { return false })
+	tracer.StartTransaction("dropped", "type").End()
+	tracer.Flush(nil)
+	remove()
+	remove() // idempotent
+	tracer.StartTransaction("sent", "type").End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, "sent", payloads.Transactions[0].Name)
+	assert.Equal(t, uint64(1), tracer.Stats().TransactionsFiltered)
+}
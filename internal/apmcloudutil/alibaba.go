@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+const (
+	alibabaTokenURL    = "http://100.100.100.200/latest/api/token"
+	alibabaMetadataURL = "http://100.100.100.200/latest/meta-data/"
+)
+
+// See: https://www.alibabacloud.com/help/en/ecs/user-guide/view-instance-metadata
+func getAlibabaCloudMetadata(ctx context.Context, client *http.Client, out *model.Cloud) error {
+	header := make(map[string]string)
+	if token := getAlibabaToken(ctx, client); token != "" {
+		header["X-aliyun-ecs-metadata-token"] = token
+	}
+	get := func(name string) (string, error) {
+		body, err := getMetadata(ctx, client, alibabaMetadataURL+name, header)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(body)), nil
+	}
+
+	// The instance ID is required; the other
+	// metadata is recorded if available.
+	instanceID, err := get("instance-id")
+	if err != nil {
+		return err
+	}
+	out.Instance = &model.CloudInstance{ID: instanceID}
+	if name, err := get("hostname"); err == nil {
+		out.Instance.Name = name
+	}
+	if region, err := get("region-id"); err == nil {
+		out.Region = region
+	}
+	if zone, err := get("zone-id"); err == nil {
+		out.AvailabilityZone = zone
+	}
+	if instanceType, err := get("instance/instance-type"); err == nil && instanceType != "" {
+		out.Machine = &model.CloudMachine{Type: instanceType}
+	}
+	if accountID, err := get("owner-account-id"); err == nil && accountID != "" {
+		out.Account = &model.CloudAccount{ID: accountID}
+	}
+	return nil
+}
+
+// getAlibabaToken returns a token for accessing instance metadata in
+// security hardening mode, or an empty string if a token could not be
+// obtained, in which case metadata is requested without a token.
+func getAlibabaToken(ctx context.Context, client *http.Client) string {
+	req, err := http.NewRequest("PUT", alibabaTokenURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("X-aliyun-ecs-metadata-token-ttl-seconds", "300")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	token, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ""
+	}
+	return string(token)
+}
@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+func TestAlibabaCloudMetadata(t *testing.T) {
+	srv, client := newAlibabaMetadataServer()
+	defer srv.Close()
+
+	for _, provider := range []Provider{Auto, Alibaba} {
+		var out model.Cloud
+		var logger testLogger
+		assert.True(t, provider.getCloudMetadata(context.Background(), client, &logger, &out))
+		assert.Zero(t, logger)
+		assert.Equal(t, model.Cloud{
+			Provider:         "alibaba",
+			Region:           "cn-hangzhou",
+			AvailabilityZone: "cn-hangzhou-i",
+			Instance: &model.CloudInstance{
+				ID:   "i-bp13znx0m0dkiqwe9ucr",
+				Name: "iZbp13znx0m0dkiqwe9ucrZ",
+			},
+			Machine: &model.CloudMachine{
+				Type: "ecs.g6.large",
+			},
+			Account: &model.CloudAccount{
+				ID: "1609927151214571",
+			},
+		}, out)
+	}
+}
+
+func newAlibabaMetadataServer() (*httptest.Server, *http.Client) {
+	metadata := map[string]string{
+		"instance-id":            "i-bp13znx0m0dkiqwe9ucr",
+		"hostname":               "iZbp13znx0m0dkiqwe9ucrZ",
+		"region-id":              "cn-hangzhou",
+		"zone-id":                "cn-hangzhou-i",
+		"instance/instance-type": "ecs.g6.large",
+		"owner-account-id":       "1609927151214571",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && r.URL.Path == "/latest/api/token" {
+			w.Write([]byte("topsecret"))
+			return
+		}
+		value, ok := metadata[strings.TrimPrefix(r.URL.Path, "/latest/meta-data/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("X-Aliyun-Ecs-Metadata-Token") != "topsecret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(value))
+	}))
+
+	client := &http.Client{Transport: newTargetedRoundTripper("100.100.100.200", srv.Listener.Addr().String())}
+	return srv, client
+}
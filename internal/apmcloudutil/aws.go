@@ -21,8 +21,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 
 	"go.elastic.co/apm/v2/model"
 )
@@ -34,6 +37,25 @@ const (
 
 // See: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/configuring-instance-metadata-service.html
 func getAWSCloudMetadata(ctx context.Context, client *http.Client, out *model.Cloud) error {
+	// First check for the ECS task metadata endpoint, which is
+	// defined by the ECS container agent for each container.
+	// If the ECS task metadata cannot be fetched, fall back to the
+	// EC2 instance metadata, which is available to tasks using the
+	// EC2 launch type.
+	if uri := os.Getenv("ECS_CONTAINER_METADATA_URI_V4"); uri != "" {
+		ecsErr := getAWSECSCloudMetadata(ctx, client, uri, out)
+		if ecsErr == nil {
+			return nil
+		}
+		if err := getAWSEC2CloudMetadata(ctx, client, out); err != nil {
+			return fmt.Errorf("failed to fetch ECS task metadata (%s) and EC2 instance metadata (%w)", ecsErr, err)
+		}
+		return nil
+	}
+	return getAWSEC2CloudMetadata(ctx, client, out)
+}
+
+func getAWSEC2CloudMetadata(ctx context.Context, client *http.Client, out *model.Cloud) error {
 	token, err := getAWSToken(ctx, client)
 	if err != nil {
 		return err
@@ -98,3 +120,28 @@ func getAWSToken(ctx context.Context, client *http.Client) (string, error) {
 	}
 	return string(token), nil
 }
+
+// See: https://docs.aws.amazon.com/AmazonECS/latest/developerguide/task-metadata-endpoint-v4.html
+func getAWSECSCloudMetadata(ctx context.Context, client *http.Client, uri string, out *model.Cloud) error {
+	var ecsMetadata struct {
+		AvailabilityZone string `json:"AvailabilityZone"`
+		TaskARN          string `json:"TaskARN"`
+	}
+	if err := getMetadataJSON(ctx, client, strings.TrimSuffix(uri, "/")+"/task", nil, &ecsMetadata); err != nil {
+		return err
+	}
+
+	// Task ARNs have the format:
+	//     arn:aws:ecs:{region}:{account id}:task/{cluster}/{task id}
+	arn := strings.SplitN(ecsMetadata.TaskARN, ":", 6)
+	if len(arn) != 6 || arn[0] != "arn" {
+		return errors.New("invalid task ARN in ECS task metadata")
+	}
+	out.Region = arn[3]
+	out.AvailabilityZone = ecsMetadata.AvailabilityZone
+	if arn[4] != "" {
+		out.Account = &model.CloudAccount{ID: arn[4]}
+	}
+	out.Service = &model.CloudService{Name: "ecs"}
+	return nil
+}
@@ -54,6 +54,63 @@ func TestAWSCloudMetadata(t *testing.T) {
 	}
 }
 
+func TestAWSECSCloudMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v4/0123456789/task" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{
+    "Cluster": "arn:aws:ecs:us-west-2:111122223333:cluster/default",
+    "TaskARN": "arn:aws:ecs:us-west-2:111122223333:task/default/158d1c8083dd49d6b527399fd6414f5c",
+    "Family": "curltest",
+    "Revision": "26",
+    "DesiredStatus": "RUNNING",
+    "KnownStatus": "RUNNING",
+    "AvailabilityZone": "us-west-2d",
+    "LaunchType": "FARGATE"
+}`))
+	}))
+	defer srv.Close()
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", srv.URL+"/v4/0123456789")
+
+	client := &http.Client{Transport: newTargetedRoundTripper(srv.Listener.Addr().String(), srv.Listener.Addr().String())}
+	for _, provider := range []Provider{Auto, AWS} {
+		var out model.Cloud
+		var logger testLogger
+		assert.True(t, provider.getCloudMetadata(context.Background(), client, &logger, &out))
+		assert.Zero(t, logger)
+		assert.Equal(t, model.Cloud{
+			Provider:         "aws",
+			Region:           "us-west-2",
+			AvailabilityZone: "us-west-2d",
+			Account: &model.CloudAccount{
+				ID: "111122223333",
+			},
+			Service: &model.CloudService{
+				Name: "ecs",
+			},
+		}, out)
+	}
+}
+
+func TestAWSECSCloudMetadataFallback(t *testing.T) {
+	srv, client := newAWSMetadataServer()
+	defer srv.Close()
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", "http://ecs.invalid/v4/0123456789")
+
+	for _, provider := range []Provider{Auto, AWS} {
+		var out model.Cloud
+		var logger testLogger
+		assert.True(t, provider.getCloudMetadata(context.Background(), client, &logger, &out))
+		assert.Zero(t, logger)
+		assert.Equal(t, "aws", out.Provider)
+		assert.Equal(t, "us-east-2", out.Region)
+		assert.Equal(t, &model.CloudInstance{ID: "i-0ae894a7c1c4f2a75"}, out.Instance)
+		assert.Nil(t, out.Service)
+	}
+}
+
 func newAWSMetadataServer() (*httptest.Server, *http.Client) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
@@ -0,0 +1,53 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+const (
+	digitalOceanMetadataURL = "http://169.254.169.254/metadata/v1.json"
+)
+
+// See: https://docs.digitalocean.com/reference/api/metadata-api/
+func getDigitalOceanCloudMetadata(ctx context.Context, client *http.Client, out *model.Cloud) error {
+	var digitalOceanMetadata struct {
+		DropletID interface{} `json:"droplet_id"`
+		Hostname  string      `json:"hostname"`
+		Region    string      `json:"region"`
+	}
+	if err := getMetadataJSON(ctx, client, digitalOceanMetadataURL, nil, &digitalOceanMetadata); err != nil {
+		return err
+	}
+	if digitalOceanMetadata.DropletID == nil {
+		return errors.New("droplet_id missing from metadata")
+	}
+
+	out.Region = digitalOceanMetadata.Region
+	out.Instance = &model.CloudInstance{
+		ID:   fmt.Sprint(digitalOceanMetadata.DropletID),
+		Name: digitalOceanMetadata.Hostname,
+	}
+	return nil
+}
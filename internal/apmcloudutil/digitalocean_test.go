@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+func TestDigitalOceanCloudMetadata(t *testing.T) {
+	srv, client := newDigitalOceanMetadataServer()
+	defer srv.Close()
+
+	for _, provider := range []Provider{Auto, DigitalOcean} {
+		var out model.Cloud
+		var logger testLogger
+		assert.True(t, provider.getCloudMetadata(context.Background(), client, &logger, &out))
+		assert.Zero(t, logger)
+		assert.Equal(t, model.Cloud{
+			Provider: "digitalocean",
+			Region:   "nyc3",
+			Instance: &model.CloudInstance{
+				ID:   "2756294",
+				Name: "sample-droplet",
+			},
+		}, out)
+	}
+}
+
+func newDigitalOceanMetadataServer() (*httptest.Server, *http.Client) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata/v1.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{
+    "droplet_id": 2756294,
+    "hostname": "sample-droplet",
+    "vendor_data": "#cloud-config\ndisable_root: false",
+    "public_keys": [],
+    "auth_key": "88888888888888888888888888888888",
+    "region": "nyc3",
+    "interfaces": {},
+    "floating_ip": {"ipv4": {"active": false}},
+    "dns": {"nameservers": ["2001:4860:4860::8844", "8.8.8.8"]},
+    "features": {"dhcp_enabled": false}
+}`))
+	}))
+
+	client := &http.Client{Transport: newTargetedRoundTripper("169.254.169.254", srv.Listener.Addr().String())}
+	return srv, client
+}
@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"path"
 	"strings"
 
@@ -83,9 +84,29 @@ func getGCPCloudMetadata(ctx context.Context, client *http.Client, out *model.Cl
 	if gcpMetadata.Project.ProjectID != "" {
 		out.Project = &model.CloudProject{ID: gcpMetadata.Project.ProjectID}
 	}
+	if service := getGCPServiceName(); service != "" {
+		out.Service = &model.CloudService{Name: service}
+	}
 	return nil
 }
 
+// getGCPServiceName returns the name of the serverless Google Cloud
+// service in which the process is running, based on the environment
+// variables defined by the service, or an empty string if the process
+// is not running in Cloud Run or Cloud Functions.
+//
+// See: https://cloud.google.com/run/docs/container-contract#env-vars
+// and https://cloud.google.com/functions/docs/configuring/env-var#runtime_environment_variables_set_automatically
+func getGCPServiceName() string {
+	switch {
+	case os.Getenv("FUNCTION_TARGET") != "", os.Getenv("FUNCTION_NAME") != "":
+		return "functions"
+	case os.Getenv("K_SERVICE") != "", os.Getenv("CLOUD_RUN_JOB") != "":
+		return "run"
+	}
+	return ""
+}
+
 func splitGCPZone(s string) (region, zone string) {
 	// Format: "projects/projectnum/zones/zone"
 	zone = path.Base(s)
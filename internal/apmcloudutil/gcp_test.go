@@ -76,6 +76,37 @@ func TestGCPCloudMetadata(t *testing.T) {
 			},
 		}, out)
 	})
+
+	for _, test := range []struct {
+		env     map[string]string
+		service string
+	}{{
+		env:     map[string]string{"K_SERVICE": "hello", "K_REVISION": "hello-00001"},
+		service: "run",
+	}, {
+		env:     map[string]string{"CLOUD_RUN_JOB": "batch"},
+		service: "run",
+	}, {
+		env:     map[string]string{"K_SERVICE": "hello", "FUNCTION_TARGET": "HelloWorld"},
+		service: "functions",
+	}, {
+		env:     map[string]string{"FUNCTION_NAME": "hello"},
+		service: "functions",
+	}} {
+		t.Run("service_"+test.service, func(t *testing.T) {
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			srv, client := newGoogleCloudRunMetadataServer()
+			defer srv.Close()
+
+			var out model.Cloud
+			var logger testLogger
+			assert.True(t, GCP.getCloudMetadata(context.Background(), client, &logger, &out))
+			assert.Zero(t, logger)
+			assert.Equal(t, &model.CloudService{Name: test.service}, out.Service)
+		})
+	}
 }
 
 func newGCEMetadataServer() (*httptest.Server, *http.Client) {
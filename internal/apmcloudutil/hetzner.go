@@ -0,0 +1,59 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+const (
+	hetznerMetadataURL = "http://169.254.169.254/hetzner/v1/metadata/"
+)
+
+// See: https://docs.hetzner.cloud/#server-metadata
+func getHetznerCloudMetadata(ctx context.Context, client *http.Client, out *model.Cloud) error {
+	get := func(name string) (string, error) {
+		body, err := getMetadata(ctx, client, hetznerMetadataURL+name, nil)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(body)), nil
+	}
+
+	// The instance ID is required; the other
+	// metadata is recorded if available.
+	instanceID, err := get("instance-id")
+	if err != nil {
+		return err
+	}
+	out.Instance = &model.CloudInstance{ID: instanceID}
+	if hostname, err := get("hostname"); err == nil {
+		out.Instance.Name = hostname
+	}
+	if region, err := get("region"); err == nil {
+		out.Region = region
+	}
+	if zone, err := get("availability-zone"); err == nil {
+		out.AvailabilityZone = zone
+	}
+	return nil
+}
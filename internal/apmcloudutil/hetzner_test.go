@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+func TestHetznerCloudMetadata(t *testing.T) {
+	srv, client := newHetznerMetadataServer()
+	defer srv.Close()
+
+	for _, provider := range []Provider{Auto, Hetzner} {
+		var out model.Cloud
+		var logger testLogger
+		assert.True(t, provider.getCloudMetadata(context.Background(), client, &logger, &out))
+		assert.Zero(t, logger)
+		assert.Equal(t, model.Cloud{
+			Provider:         "hetzner",
+			Region:           "eu-central",
+			AvailabilityZone: "fsn1-dc14",
+			Instance: &model.CloudInstance{
+				ID:   "42",
+				Name: "my-server",
+			},
+		}, out)
+	}
+}
+
+func newHetznerMetadataServer() (*httptest.Server, *http.Client) {
+	metadata := map[string]string{
+		"instance-id":       "42",
+		"hostname":          "my-server",
+		"region":            "eu-central",
+		"availability-zone": "fsn1-dc14",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := metadata[strings.TrimPrefix(r.URL.Path, "/hetzner/v1/metadata/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(value))
+	}))
+
+	client := &http.Client{Transport: newTargetedRoundTripper("169.254.169.254", srv.Listener.Addr().String())}
+	return srv, client
+}
@@ -0,0 +1,53 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+const (
+	openStackMetadataURL = "http://169.254.169.254/openstack/latest/meta_data.json"
+)
+
+// See: https://docs.openstack.org/nova/latest/user/metadata.html
+func getOpenStackCloudMetadata(ctx context.Context, client *http.Client, out *model.Cloud) error {
+	var openStackMetadata struct {
+		UUID             string `json:"uuid"`
+		Name             string `json:"name"`
+		AvailabilityZone string `json:"availability_zone"`
+		ProjectID        string `json:"project_id"`
+	}
+	if err := getMetadataJSON(ctx, client, openStackMetadataURL, nil, &openStackMetadata); err != nil {
+		return err
+	}
+	if openStackMetadata.UUID == "" {
+		return errors.New("uuid missing from metadata")
+	}
+
+	out.AvailabilityZone = openStackMetadata.AvailabilityZone
+	out.Instance = &model.CloudInstance{ID: openStackMetadata.UUID, Name: openStackMetadata.Name}
+	if openStackMetadata.ProjectID != "" {
+		out.Project = &model.CloudProject{ID: openStackMetadata.ProjectID}
+	}
+	return nil
+}
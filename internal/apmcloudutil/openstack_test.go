@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+func TestOpenStackCloudMetadata(t *testing.T) {
+	srv, client := newOpenStackMetadataServer()
+	defer srv.Close()
+
+	for _, provider := range []Provider{Auto, OpenStack} {
+		var out model.Cloud
+		var logger testLogger
+		assert.True(t, provider.getCloudMetadata(context.Background(), client, &logger, &out))
+		assert.Zero(t, logger)
+		assert.Equal(t, model.Cloud{
+			Provider:         "openstack",
+			AvailabilityZone: "nova",
+			Instance: &model.CloudInstance{
+				ID:   "d8e02d56-2648-49a3-bf97-6be8f1204f38",
+				Name: "test",
+			},
+			Project: &model.CloudProject{
+				ID: "039d104b7a5c4631b4ba6524d0b9e981",
+			},
+		}, out)
+	}
+}
+
+func newOpenStackMetadataServer() (*httptest.Server, *http.Client) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openstack/latest/meta_data.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{
+    "random_seed": "yu5ZnkqF2CqnDZVAfZgarG...",
+    "availability_zone": "nova",
+    "keys": [],
+    "hostname": "test.novalocal",
+    "launch_index": 0,
+    "meta": {"priority": "low", "role": "webserver"},
+    "devices": [],
+    "project_id": "039d104b7a5c4631b4ba6524d0b9e981",
+    "public_keys": {},
+    "name": "test",
+    "uuid": "d8e02d56-2648-49a3-bf97-6be8f1204f38"
+}`))
+	}))
+
+	client := &http.Client{Transport: newTargetedRoundTripper("169.254.169.254", srv.Listener.Addr().String())}
+	return srv, client
+}
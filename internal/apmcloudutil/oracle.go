@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"net/http"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+const (
+	oracleMetadataURL = "http://169.254.169.254/opc/v2/instance/"
+)
+
+// See: https://docs.oracle.com/en-us/iaas/Content/Compute/Tasks/gettingmetadata.htm
+func getOracleCloudMetadata(ctx context.Context, client *http.Client, out *model.Cloud) error {
+	var oracleMetadata struct {
+		AvailabilityDomain  string `json:"availabilityDomain"`
+		CanonicalRegionName string `json:"canonicalRegionName"`
+		CompartmentID       string `json:"compartmentId"`
+		DisplayName         string `json:"displayName"`
+		ID                  string `json:"id"`
+		Region              string `json:"region"`
+		Shape               string `json:"shape"`
+		TenantID            string `json:"tenantId"`
+	}
+	header := map[string]string{"Authorization": "Bearer Oracle"}
+	if err := getMetadataJSON(ctx, client, oracleMetadataURL, header, &oracleMetadata); err != nil {
+		return err
+	}
+
+	out.Region = oracleMetadata.CanonicalRegionName
+	if out.Region == "" {
+		out.Region = oracleMetadata.Region
+	}
+	out.AvailabilityZone = oracleMetadata.AvailabilityDomain
+	if oracleMetadata.ID != "" || oracleMetadata.DisplayName != "" {
+		out.Instance = &model.CloudInstance{ID: oracleMetadata.ID, Name: oracleMetadata.DisplayName}
+	}
+	if oracleMetadata.Shape != "" {
+		out.Machine = &model.CloudMachine{Type: oracleMetadata.Shape}
+	}
+	if oracleMetadata.CompartmentID != "" {
+		out.Project = &model.CloudProject{ID: oracleMetadata.CompartmentID}
+	}
+	if oracleMetadata.TenantID != "" {
+		out.Account = &model.CloudAccount{ID: oracleMetadata.TenantID}
+	}
+	return nil
+}
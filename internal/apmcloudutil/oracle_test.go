@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmcloudutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.elastic.co/apm/v2/model"
+)
+
+func TestOracleCloudMetadata(t *testing.T) {
+	srv, client := newOracleMetadataServer()
+	defer srv.Close()
+
+	for _, provider := range []Provider{Auto, Oracle} {
+		var out model.Cloud
+		var logger testLogger
+		assert.True(t, provider.getCloudMetadata(context.Background(), client, &logger, &out))
+		assert.Zero(t, logger)
+		assert.Equal(t, model.Cloud{
+			Provider:         "oracle",
+			Region:           "us-phoenix-1",
+			AvailabilityZone: "EMIr:PHX-AD-1",
+			Instance: &model.CloudInstance{
+				ID:   "ocid1.instance.oc1.phx.exampleuniqueid",
+				Name: "my-example-instance",
+			},
+			Machine: &model.CloudMachine{
+				Type: "VM.Standard.E4.Flex",
+			},
+			Project: &model.CloudProject{
+				ID: "ocid1.compartment.oc1..exampleuniqueid",
+			},
+		}, out)
+	}
+}
+
+func newOracleMetadataServer() (*httptest.Server, *http.Client) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/opc/v2/instance/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer Oracle" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{
+    "availabilityDomain": "EMIr:PHX-AD-1",
+    "faultDomain": "FAULT-DOMAIN-3",
+    "compartmentId": "ocid1.compartment.oc1..exampleuniqueid",
+    "displayName": "my-example-instance",
+    "hostname": "my-hostname",
+    "id": "ocid1.instance.oc1.phx.exampleuniqueid",
+    "image": "ocid1.image.oc1.phx.exampleuniqueid",
+    "region": "phx",
+    "canonicalRegionName": "us-phoenix-1",
+    "ociAdName": "phx-ad-1",
+    "shape": "VM.Standard.E4.Flex",
+    "state": "Running",
+    "timeCreated": 1600381928581
+}`))
+	}))
+
+	client := &http.Client{Transport: newTargetedRoundTripper("169.254.169.254", srv.Listener.Addr().String())}
+	return srv, client
+}
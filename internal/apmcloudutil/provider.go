@@ -18,8 +18,12 @@
 package apmcloudutil
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"time"
@@ -49,8 +53,9 @@ const (
 	// cloud metadata.
 	None Provider = "none"
 
-	// Auto is a pseudo cloud provider which uses trial-and-error to
-	// fetch cloud metadata from all supported clouds.
+	// Auto is a pseudo cloud provider which fetches cloud metadata
+	// from all supported clouds concurrently, using the first in
+	// order of precedence that succeeds.
 	Auto Provider = "auto"
 
 	// AWS represents the Amazon Web Services (EC2) cloud provider.
@@ -61,14 +66,35 @@ const (
 
 	// GCP represents the Google Cloud Platform cloud provider.
 	GCP Provider = "gcp"
+
+	// Oracle represents the Oracle Cloud Infrastructure cloud provider.
+	Oracle Provider = "oracle"
+
+	// Alibaba represents the Alibaba Cloud (ECS) cloud provider.
+	Alibaba Provider = "alibaba"
+
+	// DigitalOcean represents the DigitalOcean cloud provider.
+	DigitalOcean Provider = "digitalocean"
+
+	// Hetzner represents the Hetzner Cloud cloud provider.
+	Hetzner Provider = "hetzner"
+
+	// OpenStack represents OpenStack-based cloud providers.
+	OpenStack Provider = "openstack"
 )
 
+// autoProviders holds the providers tried by Auto, in order of precedence.
+//
+// OpenStack has the lowest precedence, as other providers may be OpenStack-based
+// and offer more specific metadata.
+var autoProviders = []Provider{AWS, Azure, GCP, Oracle, Alibaba, DigitalOcean, Hetzner, OpenStack}
+
 // ParseProvider parses the provider name "s", returning the relevant Provider.
 //
 // If the provider name is unknown, None will be returned with an error.
 func ParseProvider(s string) (Provider, error) {
 	switch Provider(s) {
-	case Auto, AWS, Azure, GCP, None:
+	case Auto, AWS, Azure, GCP, Oracle, Alibaba, DigitalOcean, Hetzner, OpenStack, None:
 		return Provider(s), nil
 	}
 	return None, fmt.Errorf("unknown cloud provider %q", s)
@@ -85,38 +111,116 @@ func (p Provider) GetCloudMetadata(ctx context.Context, logger Logger, out *mode
 }
 
 func (p Provider) getCloudMetadata(ctx context.Context, client *http.Client, logger Logger, out *model.Cloud) bool {
-	if p == None {
+	switch p {
+	case None:
 		return false
+	case Auto:
+		return getAutoCloudMetadata(ctx, client, out)
 	}
-	// Rather than switching on p, we loop through all providers
-	// to support "auto". If and only if p == Auto, we'll loop back
-	// around on errors.
-	for _, provider := range []Provider{AWS, Azure, GCP} {
-		if p != Auto && p != provider {
-			continue
+	if err := p.fetchCloudMetadata(ctx, client, out); err != nil {
+		if logger != nil {
+			logger.Warningf("cloud provider %q specified, but cloud metadata could not be retrieved: %s", p, err)
 		}
-		var err error
-		switch provider {
-		case AWS:
-			err = getAWSCloudMetadata(ctx, client, out)
-		case Azure:
-			err = getAzureCloudMetadata(ctx, client, out)
-		case GCP:
-			err = getGCPCloudMetadata(ctx, client, out)
-		}
-		if err == nil {
-			out.Provider = string(provider)
-			return true
-		} else if p != Auto {
-			if logger != nil {
-				logger.Warningf("cloud provider %q specified, but cloud metadata could not be retrieved: %s", p, err)
+		return false
+	}
+	out.Provider = string(p)
+	return true
+}
+
+// getAutoCloudMetadata fetches cloud metadata from all of autoProviders
+// concurrently, storing the metadata of the first provider in the list
+// that succeeds into out. Metadata is stored as soon as the providers
+// preceding it have failed, without waiting for those that follow.
+func getAutoCloudMetadata(ctx context.Context, client *http.Client, out *model.Cloud) bool {
+	type result struct {
+		index int
+		cloud model.Cloud
+		err   error
+	}
+	results := make(chan result, len(autoProviders))
+	for i, provider := range autoProviders {
+		go func() {
+			var cloud model.Cloud
+			err := provider.fetchCloudMetadata(ctx, client, &cloud)
+			results <- result{index: i, cloud: cloud, err: err}
+		}()
+	}
+
+	done := make([]*result, len(autoProviders))
+	for range autoProviders {
+		r := <-results
+		done[r.index] = &r
+		for i, d := range done {
+			if d == nil {
+				// Wait for the preceding provider.
+				break
+			}
+			if d.err == nil {
+				*out = d.cloud
+				out.Provider = string(autoProviders[i])
+				return true
 			}
-			return false
 		}
 	}
 	return false
 }
 
+// fetchCloudMetadata fetches cloud metadata for the concrete provider p.
+func (p Provider) fetchCloudMetadata(ctx context.Context, client *http.Client, out *model.Cloud) error {
+	switch p {
+	case AWS:
+		return getAWSCloudMetadata(ctx, client, out)
+	case Azure:
+		return getAzureCloudMetadata(ctx, client, out)
+	case GCP:
+		return getGCPCloudMetadata(ctx, client, out)
+	case Oracle:
+		return getOracleCloudMetadata(ctx, client, out)
+	case Alibaba:
+		return getAlibabaCloudMetadata(ctx, client, out)
+	case DigitalOcean:
+		return getDigitalOceanCloudMetadata(ctx, client, out)
+	case Hetzner:
+		return getHetznerCloudMetadata(ctx, client, out)
+	case OpenStack:
+		return getOpenStackCloudMetadata(ctx, client, out)
+	}
+	return fmt.Errorf("unknown cloud provider %q", p)
+}
+
+// getMetadata performs a GET request for url with the given headers,
+// returning the response body if the response status is 200 (OK).
+func getMetadata(ctx context.Context, client *http.Client, url string, header map[string]string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// getMetadataJSON is like getMetadata, additionally
+// decoding the response body as JSON into out.
+func getMetadataJSON(ctx context.Context, client *http.Client, url string, header map[string]string, out interface{}) error {
+	body, err := getMetadata(ctx, client, url, header)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(out)
+}
+
 // Logger defines the interface for logging while fetching cloud metadata.
 type Logger interface {
 	Warningf(format string, args ...interface{})
@@ -24,10 +24,16 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"go.elastic.co/apm/v2/model"
 )
@@ -40,6 +46,42 @@ func TestAutoProviderAllFail(t *testing.T) {
 	assert.Zero(t, logger)
 }
 
+func TestAutoProviderPrecedence(t *testing.T) {
+	awsServer, _ := newAWSMetadataServer()
+	defer awsServer.Close()
+	openStackServer, _ := newOpenStackMetadataServer()
+	defer openStackServer.Close()
+
+	// Respond to OpenStack metadata requests immediately, and to AWS
+	// metadata requests after a delay. The AWS metadata should still
+	// be used, as AWS takes precedence over OpenStack.
+	awsProxy := httputil.NewSingleHostReverseProxy(mustParseURL(t, awsServer.URL))
+	openStackProxy := httputil.NewSingleHostReverseProxy(mustParseURL(t, openStackServer.URL))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/openstack/") {
+			openStackProxy.ServeHTTP(w, r)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		awsProxy.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	var out model.Cloud
+	var logger testLogger
+	client := &http.Client{Transport: newTargetedRoundTripper("169.254.169.254", srv.Listener.Addr().String())}
+	assert.True(t, Auto.getCloudMetadata(context.Background(), client, &logger, &out))
+	assert.Zero(t, logger)
+	assert.Equal(t, "aws", out.Provider)
+	assert.Equal(t, "us-east-2", out.Region)
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	require.NoError(t, err)
+	return u
+}
+
 func TestNone(t *testing.T) {
 	type wrappedRoundTripper struct {
 		http.RoundTripper
@@ -53,6 +95,21 @@ func TestNone(t *testing.T) {
 
 // newTargetedRoundTripper returns a net/http.RoundTripper which wraps net/http.DefaultTransport,
 // rewriting requests for host to be sent to target, and causing all other requests to fail.
+func TestParseProvider(t *testing.T) {
+	for _, name := range []string{
+		"none", "auto", "aws", "azure", "gcp",
+		"oracle", "alibaba", "digitalocean", "hetzner", "openstack",
+	} {
+		provider, err := ParseProvider(name)
+		assert.NoError(t, err)
+		assert.Equal(t, Provider(name), provider)
+	}
+
+	provider, err := ParseProvider("ibm")
+	assert.EqualError(t, err, `unknown cloud provider "ibm"`)
+	assert.Equal(t, None, provider)
+}
+
 func newTargetedRoundTripper(host, target string) http.RoundTripper {
 	return &targetedRoundTripper{
 		Transport: http.DefaultTransport.(*http.Transport),
@@ -44,6 +44,11 @@ var (
 			`(?:kubepods[^/]*-pod([^/]+)\.slice)`,
 	)
 
+	mountinfoContainerIDRegexp = regexp.MustCompile(`/containers/([[:xdigit:]]{64})/`)
+	mountinfoPodUIDRegexp      = regexp.MustCompile(
+		`/pods/([[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12})/`,
+	)
+
 	containerIDRegexp = regexp.MustCompile(
 		"" +
 			"^[[:xdigit:]]{64}$|" +
@@ -54,6 +59,9 @@ var (
 
 func containerInfo() (*model.Container, error) {
 	container, _, err := cgroupContainerInfo()
+	if err == nil && container == nil {
+		return nil, errors.New("could not determine container info")
+	}
 	return container, err
 }
 
@@ -78,8 +86,23 @@ func cgroupContainerInfo() (*model.Container, *model.Kubernetes, error) {
 			if err != nil {
 				return err
 			}
-			if c == nil {
-				return errors.New("could not determine container info")
+			if c == nil || k == nil {
+				// With cgroup v2 and cgroup namespaces, the cgroup path
+				// is "/", so fall back to looking for the container ID
+				// and pod UID in the mounts created by the container
+				// runtime and kubelet.
+				if f, err := os.Open("/proc/self/mountinfo"); err == nil {
+					defer f.Close()
+					mc, mk, err := readMountinfoContainerInfo(f)
+					if err == nil {
+						if c == nil {
+							c = mc
+						}
+						if k == nil {
+							k = mk
+						}
+					}
+				}
 			}
 			container = c
 			kubernetes = k
@@ -119,11 +142,15 @@ func readCgroupContainerInfo(r io.Reader) (*model.Container, *model.Kubernetes,
 
 		// If the basename ends with ".scope", check for a hyphen and remove everything up to
 		// and including that. This allows us to match .../docker-<container-id>.scope as well
-		// as .../<container-id>.
+		// as .../<container-id>. The runtime prefix may itself contain hyphens, as in
+		// .../cri-containerd-<container-id>.scope, so first check if the text following the
+		// last hyphen is a container ID.
 		if strings.HasSuffix(basename, ".scope") {
 			basename = strings.TrimSuffix(basename, ".scope")
 
-			if hyphen := strings.Index(basename, "-"); hyphen != -1 {
+			if hyphen := strings.LastIndex(basename, "-"); hyphen != -1 && containerIDRegexp.MatchString(basename[hyphen+1:]) {
+				basename = basename[hyphen+1:]
+			} else if hyphen := strings.Index(basename, "-"); hyphen != -1 {
 				basename = basename[hyphen+1:]
 			}
 		}
@@ -158,3 +185,43 @@ func readCgroupContainerInfo(r io.Reader) (*model.Container, *model.Kubernetes,
 	}
 	return container, kubernetes, nil
 }
+
+// readMountinfoContainerInfo reads the container ID and Kubernetes pod UID
+// from /proc/self/mountinfo. Docker bind-mounts /etc/hostname from the
+// container's directory, /var/lib/docker/containers/<container-id>, and
+// kubelet bind-mounts /etc/hosts and volumes from the pod's directory,
+// /var/lib/kubelet/pods/<pod-uid>.
+func readMountinfoContainerInfo(r io.Reader) (*model.Container, *model.Kubernetes, error) {
+	var container *model.Container
+	var kubernetes *model.Kubernetes
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		// split the line according to the format
+		// "mount-ID parent-ID major:minor root mount-point ..."
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		root, mountPoint := fields[3], fields[4]
+		if container == nil && mountPoint == "/etc/hostname" {
+			if match := mountinfoContainerIDRegexp.FindStringSubmatch(root); match != nil {
+				container = &model.Container{ID: match[1]}
+			}
+		}
+		if kubernetes == nil {
+			if match := mountinfoPodUIDRegexp.FindStringSubmatch(root); match != nil {
+				hostname, _ := os.Hostname()
+				kubernetes = &model.Kubernetes{
+					Pod: &model.KubernetesPod{
+						Name: hostname,
+						UID:  match[1],
+					},
+				}
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+	return container, kubernetes, nil
+}
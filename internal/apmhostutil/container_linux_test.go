@@ -164,6 +164,21 @@ func TestCgroupContainerInfoKubernetes(t *testing.T) {
 		input:            "10:cpuset:/kubepods/pod5eadac96-ab58-11ea-b82b-0242ac110009/7fe41c8a2d1da09420117894f11dd91f6c3a44dfeb7d125dc594bd53468861df",
 		containerID:      "7fe41c8a2d1da09420117894f11dd91f6c3a44dfeb7d125dc594bd53468861df",
 		kubernetesPodUID: "5eadac96-ab58-11ea-b82b-0242ac110009",
+	}, {
+		// cgroup v2, containerd with the systemd cgroup driver.
+		input:            "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod7c9fd8a4_4b7a_4dd4_8c5c_57f1e5a1e0a5.slice/cri-containerd-9e2e6b0f6a1d1f0ed1b3bd8d4c9c1f4a2ec3b2d4f07e2d7dcb0a6f7bd6aef4a1.scope",
+		containerID:      "9e2e6b0f6a1d1f0ed1b3bd8d4c9c1f4a2ec3b2d4f07e2d7dcb0a6f7bd6aef4a1",
+		kubernetesPodUID: "7c9fd8a4-4b7a-4dd4-8c5c-57f1e5a1e0a5",
+	}, {
+		// cgroup v2, CRI-O with the systemd cgroup driver.
+		input:            "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod2f0e6bf7_84a4_4d1c_9a0e_bf7b9b5bc2a4.slice/crio-5f1d0c1c6a3f6e8e5b8f9d0c3e2a1b4c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a.scope",
+		containerID:      "5f1d0c1c6a3f6e8e5b8f9d0c3e2a1b4c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a",
+		kubernetesPodUID: "2f0e6bf7-84a4-4d1c-9a0e-bf7b9b5bc2a4",
+	}, {
+		// cgroup v2, cgroupfs cgroup driver.
+		input:            "0::/kubepods/burstable/pod3d5c7a9e-1f2b-4c6d-8e0a-9b7c5d3e1f2a/0c8f9a6b5e4d3c2b1a0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b",
+		containerID:      "0c8f9a6b5e4d3c2b1a0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b",
+		kubernetesPodUID: "3d5c7a9e-1f2b-4c6d-8e0a-9b7c5d3e1f2a",
 	}}
 
 	hostname, err := os.Hostname()
@@ -181,3 +196,47 @@ func TestCgroupContainerInfoKubernetes(t *testing.T) {
 		}, kubernetes)
 	}
 }
+
+func TestCgroupContainerInfoCgroupV2Docker(t *testing.T) {
+	container, kubernetes, err := readCgroupContainerInfo(strings.NewReader(`
+0::/system.slice/docker-cde7c2bab394630a42d73dc610b9c57415dced996106665d427f6d0566594411.scope
+`[1:]))
+
+	assert.NoError(t, err)
+	assert.Nil(t, kubernetes)
+	assert.Equal(t, &model.Container{ID: "cde7c2bab394630a42d73dc610b9c57415dced996106665d427f6d0566594411"}, container)
+}
+
+func TestMountinfoContainerInfoDocker(t *testing.T) {
+	container, kubernetes, err := readMountinfoContainerInfo(strings.NewReader(`
+1267 1238 0:126 / / rw,relatime master:329 - overlay overlay rw,lowerdir=/var/lib/docker/overlay2/l/X:/var/lib/docker/overlay2/l/Y
+1268 1267 0:129 / /proc rw,nosuid,nodev,noexec,relatime - proc proc rw
+1278 1267 259:2 /var/lib/docker/containers/6548c6863fb748e72d1e2a4f824fde92f720952d062dede1318c2d6219a672d6/resolv.conf /etc/resolv.conf rw,relatime - ext4 /dev/nvme0n1p2 rw
+1279 1267 259:2 /var/lib/docker/containers/6548c6863fb748e72d1e2a4f824fde92f720952d062dede1318c2d6219a672d6/hostname /etc/hostname rw,relatime - ext4 /dev/nvme0n1p2 rw
+1280 1267 259:2 /var/lib/docker/containers/6548c6863fb748e72d1e2a4f824fde92f720952d062dede1318c2d6219a672d6/hosts /etc/hosts rw,relatime - ext4 /dev/nvme0n1p2 rw
+`[1:]))
+
+	assert.NoError(t, err)
+	assert.Nil(t, kubernetes)
+	assert.Equal(t, &model.Container{ID: "6548c6863fb748e72d1e2a4f824fde92f720952d062dede1318c2d6219a672d6"}, container)
+}
+
+func TestMountinfoContainerInfoKubernetes(t *testing.T) {
+	container, kubernetes, err := readMountinfoContainerInfo(strings.NewReader(`
+2113 2018 0:374 / / rw,relatime master:585 - overlay overlay rw,lowerdir=/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs/snapshots/1/fs
+2131 2113 259:1 /var/lib/kubelet/pods/e9b90526-f47d-11e8-b2a5-080027b9f4fb/etc-hosts /etc/hosts rw,relatime - ext4 /dev/root rw
+2132 2113 259:1 /var/lib/kubelet/pods/e9b90526-f47d-11e8-b2a5-080027b9f4fb/containers/app/5b4e3a1f /dev/termination-log rw,relatime - ext4 /dev/root rw
+2133 2113 259:1 /var/lib/containerd/io.containerd.grpc.v1.cri/sandboxes/a0c4b8f9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1/hostname /etc/hostname rw,relatime - ext4 /dev/root rw
+`[1:]))
+	assert.NoError(t, err)
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	assert.Nil(t, container) // the sandbox ID is not the container ID
+	assert.Equal(t, &model.Kubernetes{
+		Pod: &model.KubernetesPod{
+			UID:  "e9b90526-f47d-11e8-b2a5-080027b9f4fb",
+			Name: hostname,
+		},
+	}, kubernetes)
+}
@@ -0,0 +1,241 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhostutil
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// kubernetesServiceAccountDir is the directory in which Kubernetes
+// mounts the pod's service account token, CA certificate, and namespace.
+var kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesPod holds metadata about a Kubernetes pod, discovered
+// using the downward API or the Kubernetes API.
+type KubernetesPod struct {
+	// Namespace holds the pod's namespace.
+	Namespace string
+
+	// Name holds the pod's name.
+	Name string
+
+	// UID holds the pod's UID.
+	UID string
+
+	// NodeName holds the name of the node to which the pod is scheduled.
+	NodeName string
+
+	// Labels holds the pod's labels.
+	Labels map[string]string
+
+	// Owner holds the pod's controller, if any. Pods created by
+	// a Deployment are reported as owned by the Deployment,
+	// rather than by the intermediate ReplicaSet.
+	Owner *KubernetesOwner
+}
+
+// KubernetesOwner identifies the controller of a Kubernetes pod.
+type KubernetesOwner struct {
+	// Kind holds the controller's kind, e.g. Deployment or StatefulSet.
+	Kind string
+
+	// Name holds the controller's name.
+	Name string
+}
+
+// ReadKubernetesDownwardAPI reads pod metadata from the files of a
+// downward API volume mounted at dir. The files "namespace", "name",
+// "uid", and "labels" are read if they exist, and should be mapped
+// to the pod's metadata.namespace, metadata.name, metadata.uid, and
+// metadata.labels fields respectively.
+//
+// ReadKubernetesDownwardAPI returns an error if dir does not exist.
+func ReadKubernetesDownwardAPI(dir string) (*KubernetesPod, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	read := func(name string) (string, error) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return "", nil
+			}
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	var pod KubernetesPod
+	var err error
+	if pod.Namespace, err = read("namespace"); err != nil {
+		return nil, err
+	}
+	if pod.Name, err = read("name"); err != nil {
+		return nil, err
+	}
+	if pod.UID, err = read("uid"); err != nil {
+		return nil, err
+	}
+	labels, err := read("labels")
+	if err != nil {
+		return nil, err
+	}
+	if pod.Labels, err = parseDownwardAPILabels(labels); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, "labels"), err)
+	}
+	return &pod, nil
+}
+
+// parseDownwardAPILabels parses labels in the format written by the
+// downward API: one label per line, in the form key="quoted value".
+func parseDownwardAPILabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		eq := strings.IndexRune(line, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid label %q", line)
+		}
+		value, err := strconv.Unquote(line[eq+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid label %q: %w", line, err)
+		}
+		labels[line[:eq]] = value
+	}
+	return labels, scanner.Err()
+}
+
+// GetKubernetesPod fetches metadata for the pod with the given namespace
+// and name from the Kubernetes API, using the pod's service account. If
+// namespace is empty, the service account's namespace is used.
+//
+// The service account must be permitted to get pods in the namespace.
+func GetKubernetesPod(ctx context.Context, namespace, name string) (*KubernetesPod, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT not defined")
+	}
+	if namespace == "" {
+		data, err := os.ReadFile(filepath.Join(kubernetesServiceAccountDir, "namespace"))
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	token, err := os.ReadFile(filepath.Join(kubernetesServiceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := os.ReadFile(filepath.Join(kubernetesServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("failed to parse Kubernetes CA certificate")
+	}
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: rootCAs},
+	}}
+	defer client.CloseIdleConnections()
+
+	u := url.URL{
+		Scheme: "https",
+		Host:   net.JoinHostPort(host, port),
+		Path:   fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", namespace, name),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get pod %s/%s: %s", namespace, name, resp.Status)
+	}
+
+	var apiPod struct {
+		Metadata struct {
+			Namespace       string            `json:"namespace"`
+			Name            string            `json:"name"`
+			UID             string            `json:"uid"`
+			Labels          map[string]string `json:"labels"`
+			OwnerReferences []struct {
+				Kind       string `json:"kind"`
+				Name       string `json:"name"`
+				Controller bool   `json:"controller"`
+			} `json:"ownerReferences"`
+		} `json:"metadata"`
+		Spec struct {
+			NodeName string `json:"nodeName"`
+		} `json:"spec"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiPod); err != nil {
+		return nil, err
+	}
+
+	pod := &KubernetesPod{
+		Namespace: apiPod.Metadata.Namespace,
+		Name:      apiPod.Metadata.Name,
+		UID:       apiPod.Metadata.UID,
+		NodeName:  apiPod.Spec.NodeName,
+		Labels:    apiPod.Metadata.Labels,
+	}
+	for _, ref := range apiPod.Metadata.OwnerReferences {
+		if !ref.Controller {
+			continue
+		}
+		pod.Owner = &KubernetesOwner{Kind: ref.Kind, Name: ref.Name}
+		// ReplicaSets created by a Deployment are named after the
+		// Deployment, with a suffix matching the pod-template-hash
+		// label. Report the Deployment rather than the ReplicaSet,
+		// as getting the ReplicaSet would require more permissions.
+		if hash := pod.Labels["pod-template-hash"]; ref.Kind == "ReplicaSet" && hash != "" {
+			if deployment := strings.TrimSuffix(ref.Name, "-"+hash); deployment != ref.Name {
+				pod.Owner = &KubernetesOwner{Kind: "Deployment", Name: deployment}
+			}
+		}
+		break
+	}
+	return pod, nil
+}
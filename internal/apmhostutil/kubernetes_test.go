@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhostutil
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadKubernetesDownwardAPI(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	writeFile("namespace", "default\n")
+	writeFile("name", "frontend-7d4b9c8f6-x2x9z")
+	writeFile("labels", `app="frontend"
+app.kubernetes.io/version="1.2.3"
+pod-template-hash="7d4b9c8f6"
+quoted="a \"b\" c"`)
+
+	pod, err := ReadKubernetesDownwardAPI(dir)
+	require.NoError(t, err)
+	assert.Equal(t, &KubernetesPod{
+		Namespace: "default",
+		Name:      "frontend-7d4b9c8f6-x2x9z",
+		Labels: map[string]string{
+			"app":                       "frontend",
+			"app.kubernetes.io/version": "1.2.3",
+			"pod-template-hash":         "7d4b9c8f6",
+			"quoted":                    `a "b" c`,
+		},
+	}, pod)
+
+	writeFile("labels", "app=frontend")
+	_, err = ReadKubernetesDownwardAPI(dir)
+	assert.Error(t, err)
+
+	_, err = ReadKubernetesDownwardAPI(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGetKubernetesPod(t *testing.T) {
+	var requests []*http.Request
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.URL.Path != "/api/v1/namespaces/shop/pods/frontend-7d4b9c8f6-x2x9z" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{
+  "kind": "Pod",
+  "apiVersion": "v1",
+  "metadata": {
+    "name": "frontend-7d4b9c8f6-x2x9z",
+    "namespace": "shop",
+    "uid": "8d0d4e5c-3c1b-4b7e-9f0a-6a8e2f1c7b3d",
+    "labels": {"app": "frontend", "pod-template-hash": "7d4b9c8f6"},
+    "ownerReferences": [{
+      "apiVersion": "apps/v1",
+      "kind": "ReplicaSet",
+      "name": "frontend-7d4b9c8f6",
+      "uid": "0f4d8e1a-2b3c-4d5e-6f7a-8b9c0d1e2f3a",
+      "controller": true,
+      "blockOwnerDeletion": true
+    }]
+  },
+  "spec": {"nodeName": "node-1"}
+}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), certPEM, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("topsecret\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte("shop"), 0644))
+	defer func(orig string) { kubernetesServiceAccountDir = orig }(kubernetesServiceAccountDir)
+	kubernetesServiceAccountDir = dir
+
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	pod, err := GetKubernetesPod(context.Background(), "", "frontend-7d4b9c8f6-x2x9z")
+	require.NoError(t, err)
+	assert.Equal(t, &KubernetesPod{
+		Namespace: "shop",
+		Name:      "frontend-7d4b9c8f6-x2x9z",
+		UID:       "8d0d4e5c-3c1b-4b7e-9f0a-6a8e2f1c7b3d",
+		NodeName:  "node-1",
+		Labels:    map[string]string{"app": "frontend", "pod-template-hash": "7d4b9c8f6"},
+		Owner:     &KubernetesOwner{Kind: "Deployment", Name: "frontend"},
+	}, pod)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "Bearer topsecret", requests[0].Header.Get("Authorization"))
+
+	_, err = GetKubernetesPod(context.Background(), "shop", "unknown")
+	assert.EqualError(t, err, "failed to get pod shop/unknown: 404 Not Found")
+}
+
+func TestGetKubernetesPodNotInCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	_, err := GetKubernetesPod(context.Background(), "default", "name")
+	assert.Error(t, err)
+}
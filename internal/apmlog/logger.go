@@ -94,15 +94,17 @@ func DefaultLogger() *LevelLogger {
 	}
 
 	logLevel := DefaultLevel
+	var levelFromEnv bool
 	if levelStr := strings.TrimSpace(os.Getenv(EnvLogLevel)); levelStr != "" {
 		level, err := ParseLogLevel(levelStr)
 		if err != nil {
 			log.Printf("invalid %s %q, falling back to %q", EnvLogLevel, levelStr, logLevel)
 		} else {
 			logLevel = level
+			levelFromEnv = true
 		}
 	}
-	defaultLogger = &LevelLogger{w: logWriter, level: logLevel}
+	defaultLogger = &LevelLogger{w: logWriter, level: logLevel, levelFromEnv: levelFromEnv}
 
 	return defaultLogger
 }
@@ -175,8 +177,9 @@ func ParseLogLevel(s string) (Level, error) {
 // LevelLogger is a level logging implementation that will log to a file,
 // stdout, or stderr. The level may be updated dynamically via SetLevel.
 type LevelLogger struct {
-	level Level // should be accessed with sync/atomic
-	w     io.Writer
+	level        Level // should be accessed with sync/atomic
+	w            io.Writer
+	levelFromEnv bool
 }
 
 // Level returns the current logging level.
@@ -184,6 +187,12 @@ func (l *LevelLogger) Level() Level {
 	return Level(atomic.LoadUint32((*uint32)(&l.level)))
 }
 
+// LevelFromEnv reports whether the initial logging level
+// was defined by the environment variable EnvLogLevel.
+func (l *LevelLogger) LevelFromEnv() bool {
+	return l.levelFromEnv
+}
+
 // SetLevel sets level as the minimum logging level.
 func (l *LevelLogger) SetLevel(level Level) {
 	atomic.StoreUint32((*uint32)(&l.level), uint32(level))
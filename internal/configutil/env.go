@@ -20,6 +20,7 @@ package configutil
 import (
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -27,11 +28,127 @@ import (
 	"go.elastic.co/apm/v2/internal/wildcard"
 )
 
+// Source identifies where a configuration value was found.
+type Source int
+
+// Source values.
+const (
+	// SourceNone indicates that no value was found.
+	SourceNone Source = iota
+
+	// SourceEnv indicates that the value was found in the environment.
+	SourceEnv
+
+	// SourceFile indicates that the value was found in
+	// the settings of a configuration file.
+	SourceFile
+)
+
+// Env looks up configuration by environment variable name, falling back
+// to the settings loaded from a configuration file for environment
+// variables which are unset or empty. The zero value looks up
+// environment variables only.
+//
+// An Env returned by NewEnv records the source of each value when it
+// is first looked up, which may later be obtained with Source.
+type Env struct {
+	// file holds the configuration file settings,
+	// keyed by environment variable name.
+	file map[string]string
+
+	// sources holds the Source of each looked up value,
+	// keyed by environment variable name.
+	sources *sync.Map
+}
+
+// NewEnv returns an Env which falls back to fileConfig, the settings
+// of a configuration file keyed by name as returned by ParseConfigFile,
+// e.g. "service_name".
+func NewEnv(fileConfig map[string]string) Env {
+	var file map[string]string
+	if len(fileConfig) != 0 {
+		file = make(map[string]string, len(fileConfig))
+		for k, v := range fileConfig {
+			file[EnvName(k)] = v
+		}
+	}
+	return Env{file: file, sources: &sync.Map{}}
+}
+
+// Getenv returns the value of the environment variable key or, if it
+// is unset or empty, the value of the corresponding file setting.
+func (e Env) Getenv(key string) string {
+	value, _ := e.LookupEnv(key)
+	return value
+}
+
+// LookupEnv is like Getenv, but additionally returns
+// the source of the value.
+func (e Env) LookupEnv(key string) (string, Source) {
+	value, source := e.lookupEnv(key)
+	if e.sources != nil {
+		e.sources.LoadOrStore(key, source)
+	}
+	return value, source
+}
+
+func (e Env) lookupEnv(key string) (string, Source) {
+	if value := os.Getenv(key); value != "" {
+		return value, SourceEnv
+	}
+	if value := e.file[key]; value != "" {
+		return value, SourceFile
+	}
+	return "", SourceNone
+}
+
+// Source returns the source of the value of key recorded when it was
+// first looked up, or SourceNone if key has not been looked up. Later
+// changes to the environment are not reflected.
+func (e Env) Source(key string) Source {
+	if e.sources != nil {
+		if source, ok := e.sources.Load(key); ok {
+			return source.(Source)
+		}
+	}
+	return SourceNone
+}
+
+// ParseDurationEnv calls Env{}.ParseDurationEnv.
+func ParseDurationEnv(envKey string, defaultDuration time.Duration) (time.Duration, error) {
+	return Env{}.ParseDurationEnv(envKey, defaultDuration)
+}
+
+// ParseDurationEnvOptions calls Env{}.ParseDurationEnvOptions.
+func ParseDurationEnvOptions(envKey string, defaultDuration time.Duration, opts DurationOptions) (time.Duration, error) {
+	return Env{}.ParseDurationEnvOptions(envKey, defaultDuration, opts)
+}
+
+// ParseSizeEnv calls Env{}.ParseSizeEnv.
+func ParseSizeEnv(envKey string, defaultSize Size) (Size, error) {
+	return Env{}.ParseSizeEnv(envKey, defaultSize)
+}
+
+// ParseBoolEnv calls Env{}.ParseBoolEnv.
+func ParseBoolEnv(envKey string, defaultValue bool) (bool, error) {
+	return Env{}.ParseBoolEnv(envKey, defaultValue)
+}
+
+// ParseListEnv calls Env{}.ParseListEnv.
+func ParseListEnv(envKey, sep string, defaultValue []string) []string {
+	return Env{}.ParseListEnv(envKey, sep, defaultValue)
+}
+
+// ParseWildcardPatternsEnv calls Env{}.ParseWildcardPatternsEnv.
+func ParseWildcardPatternsEnv(envKey string, defaultValue wildcard.Matchers) wildcard.Matchers {
+	return Env{}.ParseWildcardPatternsEnv(envKey, defaultValue)
+}
+
 // ParseDurationEnv gets the value of the environment variable envKey
 // and, if set, parses it as a duration. If the environment variable
 // is unset, defaultDuration is returned.
-func ParseDurationEnv(envKey string, defaultDuration time.Duration) (time.Duration, error) {
-	return ParseDurationEnvOptions(envKey, defaultDuration, DurationOptions{
+func (e Env) ParseDurationEnv(envKey string, defaultDuration time.Duration) (time.Duration, error) {
+	return e.ParseDurationEnvOptions(envKey, defaultDuration, DurationOptions{
 		MinimumDurationUnit: time.Millisecond,
 	})
 }
@@ -39,8 +156,8 @@ func ParseDurationEnv(envKey string, defaultDuration time.Duration) (time.Durati
 // ParseDurationEnvOptions gets the value of the environment variable envKey
 // and, if set, parses it as a duration. If the environment variable is unset,
 // defaultDuration is returned.
-func ParseDurationEnvOptions(envKey string, defaultDuration time.Duration, opts DurationOptions) (time.Duration, error) {
-	value := os.Getenv(envKey)
+func (e Env) ParseDurationEnvOptions(envKey string, defaultDuration time.Duration, opts DurationOptions) (time.Duration, error) {
+	value := e.Getenv(envKey)
 	if value == "" {
 		return defaultDuration, nil
 	}
@@ -54,8 +171,8 @@ func ParseDurationEnvOptions(envKey string, defaultDuration time.Duration, opts
 // ParseSizeEnv gets the value of the environment variable envKey
 // and, if set, parses it as a size. If the environment variable
 // is unset, defaultSize is returned.
-func ParseSizeEnv(envKey string, defaultSize Size) (Size, error) {
-	value := os.Getenv(envKey)
+func (e Env) ParseSizeEnv(envKey string, defaultSize Size) (Size, error) {
+	value := e.Getenv(envKey)
 	if value == "" {
 		return defaultSize, nil
 	}
@@ -69,8 +186,8 @@ func ParseSizeEnv(envKey string, defaultSize Size) (Size, error) {
 // ParseBoolEnv gets the value of the environment variable envKey
 // and, if set, parses it as a boolean. If the environment variable
 // is unset, defaultValue is returned.
-func ParseBoolEnv(envKey string, defaultValue bool) (bool, error) {
-	value := os.Getenv(envKey)
+func (e Env) ParseBoolEnv(envKey string, defaultValue bool) (bool, error) {
+	value := e.Getenv(envKey)
 	if value == "" {
 		return defaultValue, nil
 	}
@@ -84,8 +201,8 @@ func ParseBoolEnv(envKey string, defaultValue bool) (bool, error) {
 // ParseListEnv gets the value of the environment variable envKey
 // and, if set, parses it as a list separated by sep. If the environment
 // variable is unset, defaultValue is returned.
-func ParseListEnv(envKey, sep string, defaultValue []string) []string {
-	value := os.Getenv(envKey)
+func (e Env) ParseListEnv(envKey, sep string, defaultValue []string) []string {
+	value := e.Getenv(envKey)
 	if value == "" {
 		return defaultValue
 	}
@@ -95,8 +212,8 @@ func ParseListEnv(envKey, sep string, defaultValue []string) []string {
 // ParseWildcardPatternsEnv gets the value of the environment variable envKey
 // and, if set, parses it as a list of wildcard patterns. If the environment
 // variable is unset, defaultValue is returned.
-func ParseWildcardPatternsEnv(envKey string, defaultValue wildcard.Matchers) wildcard.Matchers {
-	value := os.Getenv(envKey)
+func (e Env) ParseWildcardPatternsEnv(envKey string, defaultValue wildcard.Matchers) wildcard.Matchers {
+	value := e.Getenv(envKey)
 	if value == "" {
 		return defaultValue
 	}
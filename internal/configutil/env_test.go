@@ -248,3 +248,23 @@ func TestParseWildcardPatternsEnv(t *testing.T) {
 	matchers = configutil.ParseWildcardPatternsEnv(envKey, defaultMatchers)
 	assert.Equal(t, expected, matchers)
 }
+
+func TestEnvSource(t *testing.T) {
+	t.Setenv("ELASTIC_APM_TEST_ENV", "env")
+	t.Setenv("ELASTIC_APM_TEST_FILE", "")
+	env := configutil.NewEnv(map[string]string{"test_file": "file"})
+
+	assert.Equal(t, configutil.SourceNone, env.Source("ELASTIC_APM_TEST_ENV"))
+	assert.Equal(t, "env", env.Getenv("ELASTIC_APM_TEST_ENV"))
+	assert.Equal(t, "file", env.Getenv("ELASTIC_APM_TEST_FILE"))
+	assert.Equal(t, "", env.Getenv("ELASTIC_APM_TEST_UNSET"))
+
+	// The source recorded by the first lookup is
+	// unaffected by later changes to the environment.
+	os.Unsetenv("ELASTIC_APM_TEST_ENV")
+	os.Setenv("ELASTIC_APM_TEST_FILE", "env")
+	os.Setenv("ELASTIC_APM_TEST_UNSET", "env")
+	assert.Equal(t, configutil.SourceEnv, env.Source("ELASTIC_APM_TEST_ENV"))
+	assert.Equal(t, configutil.SourceFile, env.Source("ELASTIC_APM_TEST_FILE"))
+	assert.Equal(t, configutil.SourceNone, env.Source("ELASTIC_APM_TEST_UNSET"))
+}
@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package configutil
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "ELASTIC_APM_"
+
+// EnvName returns the name of the environment variable
+// corresponding to the configuration setting name.
+func EnvName(name string) string {
+	return envPrefix + strings.ToUpper(name)
+}
+
+// ReadConfigFile reads and parses the YAML or JSON configuration file
+// at path, as described by ParseConfigFile.
+func ReadConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfigFile(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse config file %s", path)
+	}
+	return config, nil
+}
+
+// ParseConfigFile parses data as a YAML or JSON object mapping setting
+// names to values, returning the settings with lower-case names. The
+// names may optionally have the environment variable prefix, such that
+// "service_name" and "ELASTIC_APM_SERVICE_NAME" are equivalent.
+//
+// Values are converted to the string form used for environment variables:
+// sequences are joined with commas, and mappings are formatted as sorted,
+// comma-separated key=value pairs.
+func ParseConfigFile(data []byte) (map[string]string, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	config := make(map[string]string, len(raw))
+	for k, v := range raw {
+		name := strings.ToLower(k)
+		name = strings.TrimPrefix(name, strings.ToLower(envPrefix))
+		value, err := formatConfigValue(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for %s", k)
+		}
+		config[name] = value
+	}
+	return config, nil
+}
+
+func formatConfigValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, v := range v {
+			value, err := formatConfigValue(v)
+			if err != nil {
+				return "", err
+			}
+			values[i] = value
+		}
+		return strings.Join(values, ","), nil
+	case map[string]interface{}:
+		values := make([]string, 0, len(v))
+		for k, v := range v {
+			value, err := formatConfigValue(v)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, k+"="+value)
+		}
+		sort.Strings(values)
+		return strings.Join(values, ","), nil
+	case string, bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", errors.Errorf("unsupported type %T", v)
+}
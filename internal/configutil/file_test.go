@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package configutil_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/v2/internal/configutil"
+)
+
+func TestParseConfigFileYAML(t *testing.T) {
+	config, err := configutil.ParseConfigFile([]byte(`
+service_name: foo
+ELASTIC_APM_TRANSACTION_SAMPLE_RATE: 0.5
+recording: false
+transaction_max_spans: 100
+sanitize_field_names: [password, "*token*"]
+global_labels:
+  b: 2
+  a: 1
+log_file:
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"service_name":            "foo",
+		"transaction_sample_rate": "0.5",
+		"recording":               "false",
+		"transaction_max_spans":   "100",
+		"sanitize_field_names":    "password,*token*",
+		"global_labels":           "a=1,b=2",
+		"log_file":                "",
+	}, config)
+}
+
+func TestParseConfigFileJSON(t *testing.T) {
+	config, err := configutil.ParseConfigFile([]byte(`{"service_name": "foo", "capture_headers": true}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"service_name":    "foo",
+		"capture_headers": "true",
+	}, config)
+}
+
+func TestParseConfigFileInvalid(t *testing.T) {
+	_, err := configutil.ParseConfigFile([]byte(`[1, 2, 3]`))
+	assert.Error(t, err)
+
+	_, err = configutil.ParseConfigFile([]byte(`service_version: 2001-12-14`)) // timestamps must be quoted
+	assert.Error(t, err)
+}
+
+func TestEnvFileConfig(t *testing.T) {
+	const envKey = "ELASTIC_APM_TEST_FILE_CONFIG"
+	env := configutil.NewEnv(map[string]string{"test_file_config": "file"})
+
+	t.Setenv(envKey, "")
+	assert.Equal(t, "file", env.Getenv(envKey))
+	value, source := env.LookupEnv(envKey)
+	assert.Equal(t, "file", value)
+	assert.Equal(t, configutil.SourceFile, source)
+
+	t.Setenv(envKey, "env")
+	assert.Equal(t, "env", env.Getenv(envKey))
+	value, source = env.LookupEnv(envKey)
+	assert.Equal(t, "env", value)
+	assert.Equal(t, configutil.SourceEnv, source)
+
+	// The zero Env looks up environment variables only.
+	t.Setenv(envKey, "")
+	assert.Equal(t, "", configutil.Env{}.Getenv(envKey))
+	_, source = configutil.Env{}.LookupEnv(envKey)
+	assert.Equal(t, configutil.SourceNone, source)
+}
@@ -15,28 +15,80 @@
 // specific language governing permissions and limitations
 // under the License.
 
-package transport // import "go.elastic.co/apm/v2/transport"
+// Package transportutil provides utilities for configuring the HTTP
+// transport with environment variables and configuration files.
+package transportutil // import "go.elastic.co/apm/v2/internal/transportutil"
 
 import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 
 	"go.elastic.co/apm/v2/internal/configutil"
 )
 
-const envVerifyServerCert = "ELASTIC_APM_VERIFY_SERVER_CERT"
+// Environment variables for configuring the HTTP transport.
+const (
+	EnvAPIKey           = "ELASTIC_APM_API_KEY"
+	EnvSecretToken      = "ELASTIC_APM_SECRET_TOKEN"
+	EnvServerURLs       = "ELASTIC_APM_SERVER_URLS"
+	EnvServerURL        = "ELASTIC_APM_SERVER_URL"
+	EnvServerTimeout    = "ELASTIC_APM_SERVER_TIMEOUT"
+	EnvServerCert       = "ELASTIC_APM_SERVER_CERT"
+	EnvServerCACert     = "ELASTIC_APM_SERVER_CA_CERT_FILE"
+	EnvVerifyServerCert = "ELASTIC_APM_VERIFY_SERVER_CERT"
+)
+
+// ServerURLs parses ELASTIC_APM_SERVER_URLS if specified,
+// otherwise parses ELASTIC_APM_SERVER_URL if specified. If
+// neither are specified, then nil is returned.
+func ServerURLs(env configutil.Env) ([]*url.URL, error) {
+	key := EnvServerURLs
+	value := env.Getenv(key)
+	if value == "" {
+		key = EnvServerURL
+		value = env.Getenv(key)
+	}
+	var urls []*url.URL
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		u, err := url.Parse(field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", key)
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
 
-func checkVerifyServerCert() (bool, error) {
-	return configutil.ParseBoolEnv(envVerifyServerCert, true)
+// TLSClientConfig returns a TLS client configuration constructed from
+// ELASTIC_APM_VERIFY_SERVER_CERT, ELASTIC_APM_SERVER_CERT and
+// ELASTIC_APM_SERVER_CA_CERT_FILE.
+func TLSClientConfig(env configutil.Env) (*tls.Config, error) {
+	verifyServerCert, err := env.ParseBoolEnv(EnvVerifyServerCert, true)
+	if err != nil {
+		return nil, err
+	}
+	tlsClientConfig := &tls.Config{InsecureSkipVerify: !verifyServerCert}
+
+	err = addCertPath(env, tlsClientConfig)
+	if err != nil {
+		return nil, err
+	}
+	return tlsClientConfig, nil
 }
 
-func addCertPath(tlsClientConfig *tls.Config) error {
-	if serverCertPath := os.Getenv(envServerCert); serverCertPath != "" {
+func addCertPath(env configutil.Env, tlsClientConfig *tls.Config) error {
+	if serverCertPath := env.Getenv(EnvServerCert); serverCertPath != "" {
 		serverCert, err := loadCertificate(serverCertPath)
 		if err != nil {
 			return errors.Wrapf(err, "failed to load certificate from %s", serverCertPath)
@@ -48,7 +100,7 @@ func addCertPath(tlsClientConfig *tls.Config) error {
 			return verifyPeerCertificate(rawCerts, serverCert)
 		}
 	}
-	if serverCACertPath := os.Getenv(envServerCACert); serverCACertPath != "" {
+	if serverCACertPath := env.Getenv(EnvServerCACert); serverCACertPath != "" {
 		rootCAs := x509.NewCertPool()
 		additionalCerts, err := os.ReadFile(serverCACertPath)
 		if err != nil {
@@ -39,6 +39,7 @@ const (
 func NewMatcher(p string, caseSensitive CaseSensitivity) *Matcher {
 	parts := strings.Split(p, "*")
 	m := &Matcher{
+		pattern:       p,
 		wildcardBegin: strings.HasPrefix(p, "*"),
 		wildcardEnd:   strings.HasSuffix(p, "*"),
 		caseSensitive: caseSensitive,
@@ -57,12 +58,27 @@ func NewMatcher(p string, caseSensitive CaseSensitivity) *Matcher {
 
 // Matcher matches strings against a wildcard pattern with configurable case sensitivity.
 type Matcher struct {
+	pattern       string
 	parts         []string
 	wildcardBegin bool
 	wildcardEnd   bool
 	caseSensitive CaseSensitivity
 }
 
+// String returns m's wildcard pattern, prefixed with "(?-i)"
+// if matching is case sensitive.
+func (m *Matcher) String() string {
+	if m.caseSensitive {
+		return "(?-i)" + m.pattern
+	}
+	return m.pattern
+}
+
+// Pattern returns m's wildcard pattern.
+func (m *Matcher) Pattern() string {
+	return m.pattern
+}
+
 // Match reports whether s matches m's wildcard pattern.
 func (m *Matcher) Match(s string) bool {
 	if len(m.parts) == 0 && !m.wildcardBegin && !m.wildcardEnd {
@@ -203,3 +203,13 @@ func benchmarkMatch(b *testing.B, match func(s string) bool) {
 		bytes = 0
 	}
 }
+
+func TestWildcardString(t *testing.T) {
+	matchers := Matchers{
+		NewMatcher("Foo*", CaseInsensitive),
+		NewMatcher("*Bar", CaseSensitive),
+	}
+	assert.Equal(t, "Foo*", matchers[0].String())
+	assert.Equal(t, "(?-i)*Bar", matchers[1].String())
+	assert.Equal(t, "Foo*, (?-i)*Bar", matchers.String())
+}
@@ -17,6 +17,8 @@
 
 package wildcard
 
+import "strings"
+
 // Matchers is a slice of Matcher, matching any of the contained matchers.
 type Matchers []*Matcher
 
@@ -29,3 +31,12 @@ func (m Matchers) MatchAny(s string) bool {
 	}
 	return false
 }
+
+// String returns the matchers' wildcard patterns, separated by commas.
+func (m Matchers) String() string {
+	patterns := make([]string, len(m))
+	for i, m := range m {
+		patterns[i] = m.String()
+	}
+	return strings.Join(patterns, ", ")
+}
@@ -0,0 +1,396 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm // import "go.elastic.co/apm/v2"
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxMetricSeries is the maximum number of label sets recorded for each
+// metric in a MetricsRegistry. Label sets beyond this limit are ignored.
+const maxMetricSeries = 1000
+
+// defaultHistogramBuckets holds the default histogram bucket upper bounds,
+// suitable for measuring durations in seconds.
+var defaultHistogramBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// MetricsRegistry holds application-defined metrics: counters, gauges,
+// and histograms. MetricsRegistry implements MetricsGatherer.
+//
+// Each Tracer has a registry, returned by Tracer.MetricsRegistry, which
+// is gathered automatically at the interval defined by
+// ELASTIC_APM_METRICS_INTERVAL. Metrics whose names match the patterns
+// in ELASTIC_APM_DISABLE_METRICS are not reported.
+//
+// Metrics are concurrency-safe. Metric values may have labels: each
+// distinct set of labels is recorded separately. To avoid allocations
+// in hot paths, obtain a labeled metric once with the With method and
+// reuse it. At most 1000 label sets are recorded for each metric.
+type MetricsRegistry struct {
+	mu      sync.RWMutex
+	metrics map[string]registeredMetric
+}
+
+type registeredMetric interface {
+	gather(m *Metrics)
+}
+
+// NewMetricsRegistry returns a new, empty MetricsRegistry. The registry
+// must be registered with a tracer, using Tracer.RegisterMetricsGatherer,
+// for its metrics to be reported. Most applications should instead use
+// the registry returned by Tracer.MetricsRegistry.
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{metrics: make(map[string]registeredMetric)}
+}
+
+// Counter returns the counter with the given name, creating it if it
+// does not already exist. Counters report their cumulative total.
+//
+// Counter panics if the name is registered for another type of metric.
+func (r *MetricsRegistry) Counter(name string) *Counter {
+	return getOrRegisterMetric(r, name, func() *Counter {
+		c := &Counter{series: newMetricSeries[Counter](name)}
+		c.series.root = c
+		return c
+	})
+}
+
+// Gauge returns the gauge with the given name, creating it if it
+// does not already exist. Gauges report their most recent value.
+//
+// Gauge panics if the name is registered for another type of metric.
+func (r *MetricsRegistry) Gauge(name string) *Gauge {
+	return getOrRegisterMetric(r, name, func() *Gauge {
+		g := &Gauge{series: newMetricSeries[Gauge](name)}
+		g.series.root = g
+		return g
+	})
+}
+
+// Histogram returns the histogram with the given name, creating it if it
+// does not already exist. Histograms report the distribution of values
+// recorded since they were last gathered.
+//
+// The buckets define the ascending upper bounds of the histogram buckets,
+// and are only used when the histogram is created. If buckets is empty,
+// default buckets suitable for durations in seconds, ranging from 5ms to
+// 10s, are used.
+//
+// Histogram panics if the name is registered for another type of metric,
+// or if buckets are not in ascending order.
+func (r *MetricsRegistry) Histogram(name string, buckets []float64) *Histogram {
+	return getOrRegisterMetric(r, name, func() *Histogram {
+		if len(buckets) == 0 {
+			buckets = defaultHistogramBuckets
+		}
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i] <= buckets[i-1] {
+				panic(fmt.Sprintf("histogram %q buckets are not in ascending order", name))
+			}
+		}
+		h := &Histogram{
+			series:  newMetricSeries[Histogram](name),
+			buckets: append([]float64(nil), buckets...),
+		}
+		h.counts = make([]atomic.Uint64, len(h.buckets)+1)
+		h.series.root = h
+		return h
+	})
+}
+
+// GatherMetrics adds the registry's metrics to m.
+func (r *MetricsRegistry) GatherMetrics(ctx context.Context, m *Metrics) error {
+	r.mu.RLock()
+	metrics := make([]registeredMetric, 0, len(r.metrics))
+	for _, metric := range r.metrics {
+		metrics = append(metrics, metric)
+	}
+	r.mu.RUnlock()
+	for _, metric := range metrics {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		metric.gather(m)
+	}
+	return nil
+}
+
+func getOrRegisterMetric[T registeredMetric](r *MetricsRegistry, name string, newMetric func() T) T {
+	r.mu.RLock()
+	metric, ok := r.metrics[name]
+	r.mu.RUnlock()
+	if !ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if metric, ok = r.metrics[name]; !ok {
+			metric = newMetric()
+			r.metrics[name] = metric
+		}
+	}
+	typed, ok := metric.(T)
+	if !ok {
+		var want T
+		panic(fmt.Sprintf("metric %q is registered as %T, not %T", name, metric, want))
+	}
+	return typed
+}
+
+// Counter is a metric holding a cumulative total.
+type Counter struct {
+	series  *metricSeries[Counter]
+	labels  []MetricLabel
+	value   atomicFloat64
+	touched atomic.Bool
+}
+
+// With returns the counter with the given labels, in addition to
+// any labels the counter already has.
+func (c *Counter) With(labels ...MetricLabel) *Counter {
+	return c.series.with(c.labels, labels, func(labels []MetricLabel) *Counter {
+		return &Counter{series: c.series, labels: labels}
+	})
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds delta to the counter. Negative deltas are ignored.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 || math.IsNaN(delta) {
+		return
+	}
+	c.value.add(delta)
+	c.touched.Store(true)
+}
+
+func (c *Counter) gather(m *Metrics) {
+	c.series.each(func(c *Counter) {
+		if c.touched.Load() {
+			m.Add(c.series.name, c.labels, c.value.load())
+		}
+	})
+}
+
+// Gauge is a metric holding a value which may go up and down.
+type Gauge struct {
+	series  *metricSeries[Gauge]
+	labels  []MetricLabel
+	value   atomicFloat64
+	touched atomic.Bool
+}
+
+// With returns the gauge with the given labels, in addition to
+// any labels the gauge already has.
+func (g *Gauge) With(labels ...MetricLabel) *Gauge {
+	return g.series.with(g.labels, labels, func(labels []MetricLabel) *Gauge {
+		return &Gauge{series: g.series, labels: labels}
+	})
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.value.store(v)
+	g.touched.Store(true)
+}
+
+// Add adds delta, which may be negative, to the gauge.
+func (g *Gauge) Add(delta float64) {
+	g.value.add(delta)
+	g.touched.Store(true)
+}
+
+func (g *Gauge) gather(m *Metrics) {
+	g.series.each(func(g *Gauge) {
+		if g.touched.Load() {
+			m.Add(g.series.name, g.labels, g.value.load())
+		}
+	})
+}
+
+// Histogram is a metric recording the distribution of values
+// in fixed buckets.
+type Histogram struct {
+	series  *metricSeries[Histogram]
+	labels  []MetricLabel
+	buckets []float64
+
+	// counts holds the count for each bucket, with
+	// a final bucket for values exceeding the last
+	// bucket's upper bound.
+	counts []atomic.Uint64
+}
+
+// With returns the histogram with the given labels, in addition to
+// any labels the histogram already has.
+func (h *Histogram) With(labels ...MetricLabel) *Histogram {
+	return h.series.with(h.labels, labels, func(labels []MetricLabel) *Histogram {
+		return &Histogram{
+			series:  h.series,
+			labels:  labels,
+			buckets: h.buckets,
+			counts:  make([]atomic.Uint64, len(h.counts)),
+		}
+	})
+}
+
+// Record records v in the histogram.
+func (h *Histogram) Record(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	h.counts[sort.SearchFloat64s(h.buckets, v)].Add(1)
+}
+
+func (h *Histogram) gather(m *Metrics) {
+	h.series.each(func(h *Histogram) {
+		var values []float64
+		var counts []uint64
+		for i := range h.counts {
+			count := h.counts[i].Swap(0)
+			if count == 0 {
+				continue
+			}
+			// Report each bucket using its midpoint, except for the
+			// overflow bucket, which is reported using the upper
+			// bound of the final defined bucket.
+			var value float64
+			switch i {
+			case 0:
+				value = h.buckets[0] / 2
+			case len(h.buckets):
+				value = h.buckets[i-1]
+			default:
+				lower := h.buckets[i-1]
+				value = lower + (h.buckets[i]-lower)/2
+			}
+			values = append(values, value)
+			counts = append(counts, count)
+		}
+		if len(counts) > 0 {
+			m.AddHistogram(h.series.name, h.labels, values, counts)
+		}
+	})
+}
+
+// metricSeries holds the label sets of a metric.
+type metricSeries[T any] struct {
+	name string
+	root *T
+
+	mu      sync.RWMutex
+	labeled map[string]*T
+}
+
+func newMetricSeries[T any](name string) *metricSeries[T] {
+	return &metricSeries[T]{name: name, labeled: make(map[string]*T)}
+}
+
+// with returns the metric with the combined labels, creating
+// it with newMetric if it does not already exist. If the metric
+// does not exist and the series limit has been reached, a new
+// metric is returned but will never be gathered.
+func (s *metricSeries[T]) with(base, labels []MetricLabel, newMetric func([]MetricLabel) *T) *T {
+	if len(labels) == 0 {
+		if len(base) == 0 {
+			return s.root
+		}
+		labels = base
+	} else if len(base) != 0 {
+		labels = append(append(make([]MetricLabel, 0, len(base)+len(labels)), base...), labels...)
+	}
+	if !sort.SliceIsSorted(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name }) {
+		labels = append([]MetricLabel(nil), labels...)
+		sort.SliceStable(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	}
+	key := metricLabelsKey(labels)
+
+	s.mu.RLock()
+	metric, ok := s.labeled[key]
+	s.mu.RUnlock()
+	if ok {
+		return metric
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if metric, ok := s.labeled[key]; ok {
+		return metric
+	}
+	metric = newMetric(append([]MetricLabel(nil), labels...))
+	if len(s.labeled) < maxMetricSeries {
+		s.labeled[key] = metric
+	}
+	return metric
+}
+
+// each calls f for the metric without labels, and for each labeled metric.
+func (s *metricSeries[T]) each(f func(*T)) {
+	f(s.root)
+	s.mu.RLock()
+	labeled := make([]*T, 0, len(s.labeled))
+	for _, metric := range s.labeled {
+		labeled = append(labeled, metric)
+	}
+	s.mu.RUnlock()
+	for _, metric := range labeled {
+		f(metric)
+	}
+}
+
+func metricLabelsKey(labels []MetricLabel) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// atomicFloat64 is a float64 which may be updated atomically.
+type atomicFloat64 struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat64) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+func (f *atomicFloat64) store(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *atomicFloat64) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if f.bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/model"
+	"go.elastic.co/apm/v2/transport/transporttest"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	registry := tracer.MetricsRegistry()
+	requests := registry.Counter("app.requests")
+	assert.Same(t, requests, registry.Counter("app.requests"))
+	requests.Inc()
+	requests.With(apm.MetricLabel{Name: "status", Value: "200"}).Add(2)
+	requests.With(apm.MetricLabel{Name: "status", Value: "200"}).Add(-1) // ignored
+
+	// Labels may be specified in any order, and added incrementally.
+	requests.With(
+		apm.MetricLabel{Name: "status", Value: "500"},
+		apm.MetricLabel{Name: "method", Value: "GET"},
+	).Inc()
+	requests.With(apm.MetricLabel{Name: "method", Value: "GET"}).With(
+		apm.MetricLabel{Name: "status", Value: "500"},
+	).Inc()
+
+	queue := registry.Gauge("app.queue.length")
+	queue.Set(10)
+	queue.Add(-3)
+	registry.Gauge("app.unused") // not reported until set
+
+	latency := registry.Histogram("app.latency", []float64{1, 2, 4})
+	for _, v := range []float64{0.5, 1, 1.5, 3, 5, 6} {
+		latency.Record(v)
+	}
+
+	tracer.SendMetrics(nil)
+	metrics := transport.Payloads().Metrics
+	assert.Equal(t, map[string]model.Metric{
+		"app.requests":     {Value: 1},
+		"app.queue.length": {Value: 7},
+		"app.latency": {
+			Type:   "histogram",
+			Values: []float64{0.5, 1.5, 3, 4},
+			Counts: []uint64{2, 1, 1, 2},
+		},
+	}, customMetricSamples(metrics[0]))
+	assert.Equal(t, model.StringMap{
+		{Key: "method", Value: "GET"},
+		{Key: "status", Value: "500"},
+	}, metrics[1].Labels)
+	assert.Equal(t, map[string]model.Metric{"app.requests": {Value: 2}}, metrics[1].Samples)
+	assert.Equal(t, model.StringMap{{Key: "status", Value: "200"}}, metrics[2].Labels)
+	assert.Equal(t, map[string]model.Metric{"app.requests": {Value: 2}}, metrics[2].Samples)
+
+	// Counters and gauges report their current values, while
+	// histograms report the values recorded since last gathered.
+	transport.ResetPayloads()
+	tracer.SendMetrics(nil)
+	metrics = transport.Payloads().Metrics
+	assert.Equal(t, map[string]model.Metric{
+		"app.requests":     {Value: 1},
+		"app.queue.length": {Value: 7},
+	}, customMetricSamples(metrics[0]))
+}
+
+func TestMetricsRegistryDisableMetrics(t *testing.T) {
+	t.Setenv("ELASTIC_APM_DISABLE_METRICS", "app.secret.*")
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.MetricsRegistry().Counter("app.secret.count").Inc()
+	tracer.MetricsRegistry().Counter("app.public.count").Inc()
+	tracer.SendMetrics(nil)
+
+	samples := customMetricSamples(transport.Payloads().Metrics[0])
+	assert.Equal(t, map[string]model.Metric{"app.public.count": {Value: 1}}, samples)
+}
+
+func TestMetricsRegistryTypeMismatch(t *testing.T) {
+	registry := apm.NewMetricsRegistry()
+	registry.Counter("name")
+	assert.Panics(t, func() { registry.Gauge("name") })
+	assert.Panics(t, func() { registry.Histogram("invalid", []float64{2, 1}) })
+}
+
+func TestMetricsRegistryConcurrency(t *testing.T) {
+	registry := apm.NewMetricsRegistry()
+	counter := registry.Counter("counter")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			labeled := counter.With(apm.MetricLabel{Name: "k", Value: "v"})
+			for j := 0; j < 1000; j++ {
+				labeled.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.RegisterMetricsGatherer(registry)
+	tracer.SendMetrics(nil)
+	assert.Equal(t, map[string]model.Metric{"counter": {Value: 10000}}, transport.Payloads().Metrics[1].Samples)
+}
+
+func TestMetricsRegistryAllocations(t *testing.T) {
+	registry := apm.NewMetricsRegistry()
+	counter := registry.Counter("counter").With(apm.MetricLabel{Name: "k", Value: "v"})
+	gauge := registry.Gauge("gauge").With(apm.MetricLabel{Name: "k", Value: "v"})
+	histogram := registry.Histogram("histogram", nil).With(apm.MetricLabel{Name: "k", Value: "v"})
+	allocs := testing.AllocsPerRun(100, func() {
+		counter.Inc()
+		gauge.Set(1)
+		histogram.Record(0.1)
+	})
+	assert.Zero(t, allocs)
+}
+
+// customMetricSamples returns the samples in m,
+// excluding the tracer's builtin metrics.
+func customMetricSamples(m model.Metrics) map[string]model.Metric {
+	samples := make(map[string]model.Metric)
+	for name, sample := range m.Samples {
+		if strings.HasPrefix(name, "app.") {
+			samples[name] = sample
+		}
+	}
+	return samples
+}
@@ -394,6 +394,12 @@ func (v *Cloud) MarshalFastJSON(w *fastjson.Writer) error {
 		w.RawString(",\"region\":")
 		w.String(v.Region)
 	}
+	if v.Service != nil {
+		w.RawString(",\"service\":")
+		if err := v.Service.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
 	w.RawByte('}')
 	return firstErr
 }
@@ -489,6 +495,16 @@ func (v *CloudProject) MarshalFastJSON(w *fastjson.Writer) error {
 	return nil
 }
 
+func (v *CloudService) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	if v.Name != "" {
+		w.RawString("\"name\":")
+		w.String(v.Name)
+	}
+	w.RawByte('}')
+	return nil
+}
+
 func (v *Transaction) MarshalFastJSON(w *fastjson.Writer) error {
 	var firstErr error
 	w.RawByte('{')
@@ -187,6 +187,9 @@ type Cloud struct {
 
 	// Project holds information about the cloud project.
 	Project *CloudProject `json:"project,omitempty"`
+
+	// Service holds information about the cloud service.
+	Service *CloudService `json:"service,omitempty"`
 }
 
 // CloudInstance holds information about a cloud instance (virtual machine).
@@ -222,6 +225,12 @@ type CloudProject struct {
 	Name string `json:"name,omitempty"`
 }
 
+// CloudService holds information about a cloud service.
+type CloudService struct {
+	// Name holds the cloud service name, e.g. ecs, run, functions.
+	Name string `json:"name,omitempty"`
+}
+
 // Transaction represents a transaction handled by the service.
 type Transaction struct {
 	// ID holds the 64-bit hex-encoded transaction ID.
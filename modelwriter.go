@@ -22,6 +22,7 @@ import (
 
 	"go.elastic.co/apm/v2/internal/ringbuffer"
 	"go.elastic.co/apm/v2/model"
+	"go.elastic.co/apm/v2/stacktrace"
 	"go.elastic.co/fastjson"
 )
 
@@ -43,12 +44,22 @@ type modelWriter struct {
 	stats           *TracerStats
 	json            fastjson.Writer
 	modelStacktrace []model.StacktraceFrame
+	sourceContext   sourceContextCache
+
+	// groupingKeyWarningLogged records whether a warning has been
+	// logged for an error with a grouping key and no log message.
+	groupingKeyWarningLogged bool
 }
 
 // writeTransaction encodes tx as JSON to the buffer, and then resets tx.
 func (w *modelWriter) writeTransaction(tx *Transaction, td *TransactionData) {
 	var modelTx model.Transaction
 	w.buildModelTransaction(&modelTx, tx, td)
+	if len(w.cfg.eventProcessors) > 0 && !processEvent(w.cfg.eventProcessors, &Event{Transaction: &modelTx}) {
+		w.stats.TransactionsFiltered++
+		td.reset(tx.tracer)
+		return
+	}
 	w.json.RawString(`{"transaction":`)
 	modelTx.MarshalFastJSON(&w.json)
 	w.json.RawByte('}')
@@ -61,6 +72,11 @@ func (w *modelWriter) writeTransaction(tx *Transaction, td *TransactionData) {
 func (w *modelWriter) writeSpan(s *Span, sd *SpanData) {
 	var modelSpan model.Span
 	w.buildModelSpan(&modelSpan, s, sd)
+	if len(w.cfg.eventProcessors) > 0 && !processEvent(w.cfg.eventProcessors, &Event{Span: &modelSpan}) {
+		w.stats.SpansFiltered++
+		sd.reset(s.tracer)
+		return
+	}
 	w.json.RawString(`{"span":`)
 	modelSpan.MarshalFastJSON(&w.json)
 	w.json.RawByte('}')
@@ -73,6 +89,11 @@ func (w *modelWriter) writeSpan(s *Span, sd *SpanData) {
 func (w *modelWriter) writeError(e *ErrorData) {
 	var modelError model.Error
 	w.buildModelError(&modelError, e)
+	if len(w.cfg.eventProcessors) > 0 && !processEvent(w.cfg.eventProcessors, &Event{Error: &modelError}) {
+		w.stats.ErrorsFiltered++
+		e.reset()
+		return
+	}
 	w.json.RawString(`{"error":`)
 	modelError.MarshalFastJSON(&w.json)
 	w.json.RawByte('}')
@@ -87,6 +108,10 @@ func (w *modelWriter) writeError(e *ErrorData) {
 // periodic metrics would be evicted by transactions/spans in a busy system.
 func (w *modelWriter) writeMetrics(m *Metrics) {
 	for _, m := range m.transactionGroupMetrics {
+		if len(w.cfg.eventProcessors) > 0 && !processEvent(w.cfg.eventProcessors, &Event{Metrics: m}) {
+			w.stats.MetricsetsFiltered++
+			continue
+		}
 		w.json.RawString(`{"metricset":`)
 		m.MarshalFastJSON(&w.json)
 		w.json.RawString("}")
@@ -94,6 +119,10 @@ func (w *modelWriter) writeMetrics(m *Metrics) {
 		w.json.Reset()
 	}
 	for _, m := range m.metrics {
+		if len(w.cfg.eventProcessors) > 0 && !processEvent(w.cfg.eventProcessors, &Event{Metrics: m}) {
+			w.stats.MetricsetsFiltered++
+			continue
+		}
 		w.json.RawString(`{"metricset":`)
 		m.MarshalFastJSON(&w.json)
 		w.json.RawString("}")
@@ -167,7 +196,7 @@ func (w *modelWriter) buildModelSpan(out *model.Span, span *Span, sd *SpanData)
 		out.Context.Destination.Service.Type = out.Type
 	}
 
-	w.modelStacktrace = appendModelStacktraceFrames(w.modelStacktrace, sd.stacktrace)
+	w.appendModelStacktraceFrames(sd.stacktrace, w.cfg.sourceLinesSpanAppFrames)
 	out.Stacktrace = w.modelStacktrace
 }
 
@@ -193,7 +222,7 @@ func (w *modelWriter) buildModelError(out *model.Error, e *ErrorData) {
 	var appendModelErrorStacktraceFrames func(exception *exceptionData)
 	appendModelErrorStacktraceFrames = func(exception *exceptionData) {
 		if len(exception.stacktrace) != 0 {
-			w.modelStacktrace = appendModelStacktraceFrames(w.modelStacktrace, exception.stacktrace)
+			w.appendModelStacktraceFrames(exception.stacktrace, w.cfg.sourceLinesErrorAppFrames)
 		}
 		for _, cause := range exception.cause {
 			appendModelErrorStacktraceFrames(&cause)
@@ -201,7 +230,7 @@ func (w *modelWriter) buildModelError(out *model.Error, e *ErrorData) {
 	}
 	appendModelErrorStacktraceFrames(&e.exception)
 	if len(e.logStacktrace) != 0 {
-		w.modelStacktrace = appendModelStacktraceFrames(w.modelStacktrace, e.logStacktrace)
+		w.appendModelStacktraceFrames(e.logStacktrace, w.cfg.sourceLinesErrorAppFrames)
 	}
 
 	var modelStacktraceOffset int
@@ -255,6 +284,25 @@ func (w *modelWriter) buildModelError(out *model.Error, e *ErrorData) {
 			}
 		}
 	}
+
+	// Set the log's parameterized message, which APM Server adds to the
+	// error's grouping key along with the exception type and stack frames,
+	// preferring the explicit grouping key, then the log message format,
+	// and finally the normalized log message. Errors without a log have
+	// no parameterized message, so their grouping key is ignored.
+	if out.Log.Message != "" {
+		if e.GroupingKey != "" {
+			out.Log.ParamMessage = truncateString(e.GroupingKey)
+		} else if out.Log.ParamMessage == "" && w.cfg.errorMessageNormalization {
+			message := out.Log.Message
+			if normalized := normalizeErrorMessage(message); normalized != message {
+				out.Log.ParamMessage = normalized
+			}
+		}
+	} else if e.GroupingKey != "" && !w.groupingKeyWarningLogged && w.cfg.logger != nil {
+		w.cfg.logger.Warningf("ignoring grouping key %q of error without a log message", e.GroupingKey)
+		w.groupingKeyWarningLogged = true
+	}
 	out.Culprit = truncateString(out.Culprit)
 }
 
@@ -296,3 +344,19 @@ func buildDroppedSpansStats(dss droppedSpanTimingsMap) []model.DroppedSpansStats
 	}
 	return out
 }
+
+// appendModelStacktraceFrames appends model stacktrace frames for in to
+// w.modelStacktrace, recording sourceLines lines of source context for
+// application (non-library) frames.
+func (w *modelWriter) appendModelStacktraceFrames(in []stacktrace.Frame, sourceLines int) {
+	n := len(w.modelStacktrace)
+	w.modelStacktrace = appendModelStacktraceFrames(w.modelStacktrace, in)
+	if sourceLines <= 0 {
+		return
+	}
+	for i, f := range in {
+		if frame := &w.modelStacktrace[n+i]; !frame.LibraryFrame {
+			w.sourceContext.setContext(frame, f, sourceLines, w.cfg.sourceFS)
+		}
+	}
+}
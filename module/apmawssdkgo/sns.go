@@ -121,13 +121,6 @@ func addMessageAttributesSNS(req *request.Request, span *apm.Span, propagateLega
 		return
 	}
 
-	traceContext := span.TraceContext()
-	msgAttr := &sns.MessageAttributeValue{
-		DataType:    aws.String("String"),
-		StringValue: aws.String(apmhttp.FormatTraceparentHeader(traceContext)),
-	}
-	tracestate := traceContext.State.String()
-
 	input, ok := req.Params.(*sns.PublishInput)
 	if !ok {
 		return
@@ -136,15 +129,27 @@ func addMessageAttributesSNS(req *request.Request, span *apm.Span, propagateLega
 	if input.MessageAttributes == nil {
 		input.MessageAttributes = make(map[string]*sns.MessageAttributeValue)
 	}
-	input.MessageAttributes[apmhttp.W3CTraceparentHeader] = msgAttr
-	if propagateLegacyHeader {
-		input.MessageAttributes[apmhttp.ElasticTraceparentHeader] = msgAttr
+	apmhttp.DefaultPropagator().Inject(
+		snsAttributesCarrier(input.MessageAttributes),
+		span.TraceContext(),
+		apmhttp.InjectOptions{PropagateLegacyHeader: propagateLegacyHeader},
+	)
+}
+
+// snsAttributesCarrier is an apmhttp.Carrier for SNS message attributes.
+type snsAttributesCarrier map[string]*sns.MessageAttributeValue
+
+func (c snsAttributesCarrier) Get(key string) []string {
+	if attr, ok := c[key]; ok && attr.StringValue != nil {
+		return []string{*attr.StringValue}
 	}
-	if tracestate != "" {
-		input.MessageAttributes[apmhttp.TracestateHeader] = &sns.MessageAttributeValue{
-			DataType:    aws.String("String"),
-			StringValue: aws.String(tracestate),
-		}
+	return nil
+}
+
+func (c snsAttributesCarrier) Set(key, value string) {
+	c[key] = &sns.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
 	}
 }
 
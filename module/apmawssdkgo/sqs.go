@@ -95,43 +95,45 @@ func addMessageAttributesSQS(req *request.Request, span *apm.Span, propagateLega
 	}
 
 	traceContext := span.TraceContext()
-	msgAttr := &sqs.MessageAttributeValue{
-		DataType:    aws.String("String"),
-		StringValue: aws.String(apmhttp.FormatTraceparentHeader(traceContext)),
-	}
-	tracestate := traceContext.State.String()
+	propagator := apmhttp.DefaultPropagator()
+	injectOptions := apmhttp.InjectOptions{PropagateLegacyHeader: propagateLegacyHeader}
 	if req.Operation.Name == "SendMessage" {
 		input, ok := req.Params.(*sqs.SendMessageInput)
 		if !ok {
 			return
 		}
-		setTracingAttributes(input.MessageAttributes, msgAttr, tracestate, propagateLegacyHeader)
+		if input.MessageAttributes == nil {
+			input.MessageAttributes = make(map[string]*sqs.MessageAttributeValue)
+		}
+		propagator.Inject(sqsAttributesCarrier(input.MessageAttributes), traceContext, injectOptions)
 	} else if req.Operation.Name == "SendMessageBatch" {
 		input, ok := req.Params.(*sqs.SendMessageBatchInput)
 		if !ok {
 			return
 		}
 		for _, entry := range input.Entries {
-			setTracingAttributes(entry.MessageAttributes, msgAttr, tracestate, propagateLegacyHeader)
+			if entry.MessageAttributes == nil {
+				entry.MessageAttributes = make(map[string]*sqs.MessageAttributeValue)
+			}
+			propagator.Inject(sqsAttributesCarrier(entry.MessageAttributes), traceContext, injectOptions)
 		}
 	}
 }
 
-func setTracingAttributes(
-	attrs map[string]*sqs.MessageAttributeValue,
-	value *sqs.MessageAttributeValue,
-	tracestate string,
-	propagateLegacyHeader bool,
-) {
-	attrs[apmhttp.W3CTraceparentHeader] = value
-	if propagateLegacyHeader {
-		attrs[apmhttp.ElasticTraceparentHeader] = value
+// sqsAttributesCarrier is an apmhttp.Carrier for SQS message attributes.
+type sqsAttributesCarrier map[string]*sqs.MessageAttributeValue
+
+func (c sqsAttributesCarrier) Get(key string) []string {
+	if attr, ok := c[key]; ok && attr.StringValue != nil {
+		return []string{*attr.StringValue}
 	}
-	if tracestate != "" {
-		attrs[apmhttp.TracestateHeader] = &sqs.MessageAttributeValue{
-			DataType:    aws.String("String"),
-			StringValue: aws.String(tracestate),
-		}
+	return nil
+}
+
+func (c sqsAttributesCarrier) Set(key, value string) {
+	c[key] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
 	}
 }
 
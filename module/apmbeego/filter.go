@@ -52,12 +52,14 @@ func Middleware(o ...Option) func(http.Handler) http.Handler {
 			tx := apm.TransactionFromContext(req.Context())
 			if tx != nil {
 				state := &beegoFilterState{}
-				defer setTransactionContext(tx, state)
+				defer setTransactionContext(opts.tracer, tx, state)
 				ctx := context.WithValue(req.Context(), beegoFilterStateKey{}, state)
 				req = apmhttp.RequestWithContext(ctx, req)
 			}
 			h.ServeHTTP(w, req)
-		}), apmhttp.WithTracer(opts.tracer), apmhttp.WithServerRequestName(apmhttp.UnknownRouteRequestName))
+		}), apmhttp.WithTracer(opts.tracer), apmhttp.WithServerRequestName(func(req *http.Request) string {
+			return apmhttp.ServerTransactionName(opts.tracer, req, "")
+		}))
 	}
 }
 
@@ -90,11 +92,11 @@ func beforeStatic(context *beegocontext.Context) {
 	}
 }
 
-func setTransactionContext(tx *apm.Transaction, state *beegoFilterState) {
+func setTransactionContext(tracer *apm.Tracer, tx *apm.Transaction, state *beegoFilterState) {
 	tx.Context.SetFramework("beego", beego.VERSION)
 	if state.context != nil {
 		if route, ok := state.context.Input.GetData("RouterPattern").(string); ok {
-			tx.Name = state.context.Request.Method + " " + route
+			tx.Name = apmhttp.ServerTransactionName(tracer, state.context.Request, route)
 		}
 	}
 }
@@ -47,7 +47,7 @@ func Middleware(o ...Option) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		serverOpts := []apmhttp.ServerOption{
 			apmhttp.WithTracer(opts.tracer),
-			apmhttp.WithServerRequestName(routeRequestName),
+			apmhttp.WithServerRequestName(routeRequestName(opts.tracer)),
 			apmhttp.WithServerRequestIgnorer(opts.requestIgnorer),
 		}
 		if opts.panicPropagation {
@@ -60,11 +60,11 @@ func Middleware(o ...Option) func(http.Handler) http.Handler {
 	}
 }
 
-func routeRequestName(r *http.Request) string {
-	if routePattern, ok := getRoutePattern(r); ok {
-		return r.Method + " " + routePattern
+func routeRequestName(tracer *apm.Tracer) apmhttp.RequestNameFunc {
+	return func(r *http.Request) string {
+		routePattern, _ := getRoutePattern(r)
+		return apmhttp.ServerTransactionName(tracer, r, routePattern)
 	}
-	return apmhttp.UnknownRouteRequestName(r)
 }
 
 func getRoutePattern(r *http.Request) (string, bool) {
@@ -0,0 +1,349 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmconnect // import "go.elastic.co/apm/module/apmconnect/v2"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"connectrpc.com/connect"
+
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/stacktrace"
+)
+
+const (
+	messagesSentLabel     = "connect_stream_messages_sent"
+	messagesReceivedLabel = "connect_stream_messages_received"
+)
+
+func init() {
+	stacktrace.RegisterLibraryPackage("connectrpc.com/connect")
+}
+
+// NewInterceptor returns a connect.Interceptor that traces unary and
+// streaming RPCs with the given options. The interceptor may be used
+// with both clients and handlers, by passing it to connect.WithInterceptors.
+//
+// For handlers, the interceptor will trace a transaction with the "request"
+// type for each incoming RPC, named after the procedure, such as
+// "/acme.foo.v1.FooService/Bar". If the handler is wrapped with apmhttp,
+// the transaction started by apmhttp is renamed instead. The transaction
+// will be added to the context, so handlers can use apm.StartSpan with the
+// provided context.
+//
+// For clients, the interceptor will trace spans with the "external.connect"
+// type for each RPC made with a context containing a sampled
+// apm.Transaction, and propagate the trace context in the request headers.
+// Streaming RPC spans are ended when the response is closed, or when
+// Receive returns an error.
+//
+// The number of messages sent and received on streams are recorded as
+// the labels "connect_stream_messages_sent" and
+// "connect_stream_messages_received".
+//
+// By default, the interceptor will trace with apm.DefaultTracer(). Use
+// WithTracer to specify an alternative tracer.
+func NewInterceptor(o ...Option) connect.Interceptor {
+	opts := options{
+		tracer: apm.DefaultTracer(),
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+	return &interceptor{opts: opts}
+}
+
+type interceptor struct {
+	opts options
+}
+
+func (i *interceptor) propagator() apmhttp.Propagator {
+	if i.opts.propagator != nil {
+		return i.opts.propagator
+	}
+	return apmhttp.DefaultPropagator()
+}
+
+// WrapUnary traces unary RPCs.
+func (i *interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			span, ctx := i.startSpan(ctx, req.Spec(), req.Peer(), req.Header())
+			resp, err := next(ctx, req)
+			if span != nil {
+				setSpanOutcome(span, err)
+				span.End()
+			}
+			return resp, err
+		}
+		tx, ctx, ended := i.startTransaction(ctx, req.Spec(), req.Peer(), req.Header(), req.HTTPMethod())
+		if tx == nil {
+			return next(ctx, req)
+		}
+		resp, err := next(ctx, req)
+		setTransactionResult(tx, err)
+		ended()
+		return resp, err
+	}
+}
+
+// WrapStreamingClient traces client streaming RPCs.
+func (i *interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		tx := apm.TransactionFromContext(ctx)
+		if tx == nil {
+			return next(ctx, spec)
+		}
+		var span *apm.Span
+		traceContext := tx.TraceContext()
+		if traceContext.Options.Recorded() {
+			span = tx.StartExitSpan(spec.Procedure, "external.connect", apm.SpanFromContext(ctx))
+			if !span.Dropped() {
+				traceContext = span.TraceContext()
+				ctx = apm.ContextWithSpan(ctx, span)
+			}
+		}
+		conn := next(ctx, spec)
+		i.propagator().Inject(apmhttp.HeaderCarrier(conn.RequestHeader()), traceContext, apmhttp.InjectOptions{
+			PropagateLegacyHeader: tx.ShouldPropagateLegacyHeader(),
+		})
+		if span == nil {
+			return conn
+		}
+		setSpanDestination(span, conn.Peer())
+		return &clientConn{StreamingClientConn: conn, span: span}
+	}
+}
+
+// WrapStreamingHandler traces handler streaming RPCs.
+func (i *interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		tx, ctx, ended := i.startTransaction(ctx, conn.Spec(), conn.Peer(), conn.RequestHeader(), http.MethodPost)
+		if tx == nil {
+			return next(ctx, conn)
+		}
+		wrapped := &handlerConn{StreamingHandlerConn: conn}
+		err := next(ctx, wrapped)
+		if tx.Sampled() {
+			tx.Context.SetLabel(messagesSentLabel, wrapped.counts.sent.Load())
+			tx.Context.SetLabel(messagesReceivedLabel, wrapped.counts.received.Load())
+		}
+		setTransactionResult(tx, err)
+		ended()
+		return err
+	}
+}
+
+// startTransaction starts a transaction for an incoming RPC, returning
+// the transaction, the context containing it, and a function to call
+// when the RPC completes. If the context already contains a transaction,
+// such as one started by apmhttp, it is renamed and returned instead,
+// and it is left to its creator to end.
+func (i *interceptor) startTransaction(
+	ctx context.Context,
+	spec connect.Spec,
+	peer connect.Peer,
+	header http.Header,
+	method string,
+) (*apm.Transaction, context.Context, func()) {
+	if tx := apm.TransactionFromContext(ctx); tx != nil {
+		tx.Name = spec.Procedure
+		tx.Context.SetFramework("connect", connect.Version)
+		return tx, ctx, func() {}
+	}
+	if !i.opts.tracer.Recording() {
+		return nil, ctx, nil
+	}
+	var txOpts apm.TransactionOptions
+	txOpts.TraceContext, _ = i.propagator().Extract(apmhttp.HeaderCarrier(header))
+	tx := i.opts.tracer.StartTransactionOptions(spec.Procedure, "request", txOpts)
+	tx.Context.SetFramework("connect", connect.Version)
+	tx.Context.SetHTTPRequest(&http.Request{
+		URL:        &url.URL{Scheme: "http", Path: spec.Procedure},
+		Method:     method,
+		Header:     header,
+		RemoteAddr: peer.Addr,
+	})
+	return tx, apm.ContextWithTransaction(ctx, tx), tx.End
+}
+
+func (i *interceptor) startSpan(
+	ctx context.Context,
+	spec connect.Spec,
+	peer connect.Peer,
+	header http.Header,
+) (*apm.Span, context.Context) {
+	tx := apm.TransactionFromContext(ctx)
+	if tx == nil {
+		return nil, ctx
+	}
+	injectOptions := apmhttp.InjectOptions{PropagateLegacyHeader: tx.ShouldPropagateLegacyHeader()}
+	traceContext := tx.TraceContext()
+	if !traceContext.Options.Recorded() {
+		i.propagator().Inject(apmhttp.HeaderCarrier(header), traceContext, injectOptions)
+		return nil, ctx
+	}
+	span := tx.StartExitSpan(spec.Procedure, "external.connect", apm.SpanFromContext(ctx))
+	if !span.Dropped() {
+		traceContext = span.TraceContext()
+		ctx = apm.ContextWithSpan(ctx, span)
+		setSpanDestination(span, peer)
+	}
+	i.propagator().Inject(apmhttp.HeaderCarrier(header), traceContext, injectOptions)
+	return span, ctx
+}
+
+func setSpanDestination(span *apm.Span, peer connect.Peer) {
+	if span.Dropped() {
+		return
+	}
+	if peer.Addr != "" {
+		span.Context.SetDestinationService(apm.DestinationServiceSpanContext{
+			Name:     peer.Addr,
+			Resource: peer.Addr,
+		})
+	}
+	span.Context.SetServiceTarget(apm.ServiceTargetSpanContext{
+		Name: peer.Addr,
+	})
+}
+
+// resultFromError returns the transaction result for an RPC error:
+// "ok" if err is nil, and the Connect error code otherwise.
+func resultFromError(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return connect.CodeOf(err).String()
+}
+
+func setTransactionResult(tx *apm.Transaction, err error) {
+	tx.Result = resultFromError(err)
+
+	// For servers, the transaction outcome is generally "success",
+	// except for codes which are not subject to client interpretation.
+	if tx.Outcome == "" {
+		tx.Outcome = "success"
+		if err != nil {
+			switch connect.CodeOf(err) {
+			case connect.CodeUnknown,
+				connect.CodeDeadlineExceeded,
+				connect.CodeResourceExhausted,
+				connect.CodeFailedPrecondition,
+				connect.CodeAborted,
+				connect.CodeInternal,
+				connect.CodeUnavailable,
+				connect.CodeDataLoss:
+				tx.Outcome = "failure"
+			}
+		}
+	}
+}
+
+func setSpanOutcome(span *apm.Span, err error) {
+	// On the client side, all errors are treated as failures by default,
+	// and can be overridden by setting the Outcome explicitly.
+	if span.Outcome == "" {
+		if err == nil {
+			span.Outcome = "success"
+		} else {
+			span.Outcome = "failure"
+		}
+	}
+}
+
+type streamMessageCounts struct {
+	sent, received atomic.Int64
+}
+
+// handlerConn wraps connect.StreamingHandlerConn to count
+// the messages sent and received.
+type handlerConn struct {
+	connect.StreamingHandlerConn
+	counts streamMessageCounts
+}
+
+func (c *handlerConn) Send(m any) error {
+	err := c.StreamingHandlerConn.Send(m)
+	if err == nil {
+		c.counts.sent.Add(1)
+	}
+	return err
+}
+
+func (c *handlerConn) Receive(m any) error {
+	err := c.StreamingHandlerConn.Receive(m)
+	if err == nil {
+		c.counts.received.Add(1)
+	}
+	return err
+}
+
+// clientConn wraps connect.StreamingClientConn to count the messages
+// sent and received, and to end the span when the stream is done.
+type clientConn struct {
+	connect.StreamingClientConn
+	span   *apm.Span
+	counts streamMessageCounts
+	once   sync.Once
+}
+
+func (c *clientConn) Send(m any) error {
+	err := c.StreamingClientConn.Send(m)
+	if err == nil {
+		c.counts.sent.Add(1)
+	}
+	return err
+}
+
+func (c *clientConn) Receive(m any) error {
+	err := c.StreamingClientConn.Receive(m)
+	switch {
+	case err == nil:
+		c.counts.received.Add(1)
+	case errors.Is(err, io.EOF):
+		c.endSpan(nil)
+	default:
+		c.endSpan(err)
+	}
+	return err
+}
+
+func (c *clientConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.endSpan(nil)
+	return err
+}
+
+func (c *clientConn) endSpan(err error) {
+	c.once.Do(func() {
+		if !c.span.Dropped() {
+			c.span.Context.SetLabel(messagesSentLabel, c.counts.sent.Load())
+			c.span.Context.SetLabel(messagesReceivedLabel, c.counts.received.Load())
+		}
+		setSpanOutcome(c.span, err)
+		c.span.End()
+	})
+}
@@ -0,0 +1,216 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmconnect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"go.elastic.co/apm/module/apmconnect/v2"
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+)
+
+const (
+	greetProcedure = "/test.v1.GreetService/Greet"
+	countProcedure = "/test.v1.GreetService/Count"
+)
+
+func newServer(t *testing.T, tracer *apm.Tracer, wrap bool) *httptest.Server {
+	interceptors := connect.WithInterceptors(apmconnect.NewInterceptor(apmconnect.WithTracer(tracer)))
+	mux := http.NewServeMux()
+	mux.Handle(greetProcedure, connect.NewUnaryHandler(
+		greetProcedure,
+		func(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[wrapperspb.StringValue], error) {
+			if apm.TransactionFromContext(ctx) == nil {
+				return nil, errors.New("no transaction in context")
+			}
+			if req.Msg.Value == "" {
+				return nil, connect.NewError(connect.CodeUnavailable, errors.New("no name"))
+			}
+			return connect.NewResponse(wrapperspb.String("hello, " + req.Msg.Value)), nil
+		},
+		interceptors,
+	))
+	mux.Handle(countProcedure, connect.NewServerStreamHandler(
+		countProcedure,
+		func(ctx context.Context, req *connect.Request[wrapperspb.Int32Value], stream *connect.ServerStream[wrapperspb.Int32Value]) error {
+			for i := int32(0); i < req.Msg.Value; i++ {
+				if err := stream.Send(wrapperspb.Int32(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		interceptors,
+	))
+	var handler http.Handler = mux
+	if wrap {
+		handler = apmhttp.Wrap(handler, apmhttp.WithTracer(tracer))
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUnary(t *testing.T) {
+	serverTracer := apmtest.NewRecordingTracer()
+	defer serverTracer.Close()
+	server := newServer(t, serverTracer.Tracer, false)
+
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+		server.Client(), server.URL+greetProcedure,
+		connect.WithInterceptors(apmconnect.NewInterceptor()),
+	)
+	clientTracer := apmtest.NewRecordingTracer()
+	defer clientTracer.Close()
+	tx, spans, _ := clientTracer.WithTransaction(func(ctx context.Context) {
+		resp, err := client.CallUnary(ctx, connect.NewRequest(wrapperspb.String("world")))
+		require.NoError(t, err)
+		assert.Equal(t, "hello, world", resp.Msg.Value)
+	})
+
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, greetProcedure, span.Name)
+	assert.Equal(t, "external", span.Type)
+	assert.Equal(t, "connect", span.Subtype)
+	assert.Equal(t, "success", span.Outcome)
+	assert.Equal(t, tx.ID, span.ParentID)
+	serverAddr := server.Listener.Addr().String()
+	assert.Equal(t, &model.DestinationSpanContext{
+		Service: &model.DestinationServiceSpanContext{
+			Type:     "external",
+			Name:     serverAddr,
+			Resource: serverAddr,
+		},
+	}, span.Context.Destination)
+
+	serverTracer.Flush(nil)
+	transactions := serverTracer.Payloads().Transactions
+	require.Len(t, transactions, 1)
+	serverTx := transactions[0]
+	assert.Equal(t, greetProcedure, serverTx.Name)
+	assert.Equal(t, "request", serverTx.Type)
+	assert.Equal(t, "ok", serverTx.Result)
+	assert.Equal(t, "success", serverTx.Outcome)
+	assert.Equal(t, tx.TraceID, serverTx.TraceID)
+	assert.Equal(t, span.ID, serverTx.ParentID)
+	assert.Equal(t, &model.Framework{Name: "connect", Version: connect.Version}, serverTx.Context.Service.Framework)
+	assert.Equal(t, "POST", serverTx.Context.Request.Method)
+	assert.Equal(t, greetProcedure, serverTx.Context.Request.URL.Path)
+}
+
+func TestUnaryError(t *testing.T) {
+	serverTracer := apmtest.NewRecordingTracer()
+	defer serverTracer.Close()
+	server := newServer(t, serverTracer.Tracer, false)
+
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+		server.Client(), server.URL+greetProcedure,
+		connect.WithInterceptors(apmconnect.NewInterceptor()),
+	)
+	clientTracer := apmtest.NewRecordingTracer()
+	defer clientTracer.Close()
+	_, spans, _ := clientTracer.WithTransaction(func(ctx context.Context) {
+		_, err := client.CallUnary(ctx, connect.NewRequest(wrapperspb.String("")))
+		assert.Equal(t, connect.CodeUnavailable, connect.CodeOf(err))
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, "failure", spans[0].Outcome)
+
+	serverTracer.Flush(nil)
+	transactions := serverTracer.Payloads().Transactions
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "unavailable", transactions[0].Result)
+	assert.Equal(t, "failure", transactions[0].Outcome)
+}
+
+func TestServerStream(t *testing.T) {
+	serverTracer := apmtest.NewRecordingTracer()
+	defer serverTracer.Close()
+	server := newServer(t, serverTracer.Tracer, false)
+
+	client := connect.NewClient[wrapperspb.Int32Value, wrapperspb.Int32Value](
+		server.Client(), server.URL+countProcedure,
+		connect.WithInterceptors(apmconnect.NewInterceptor()),
+	)
+	clientTracer := apmtest.NewRecordingTracer()
+	defer clientTracer.Close()
+	tx, spans, _ := clientTracer.WithTransaction(func(ctx context.Context) {
+		stream, err := client.CallServerStream(ctx, connect.NewRequest(wrapperspb.Int32(3)))
+		require.NoError(t, err)
+		var n int
+		for stream.Receive() {
+			n++
+		}
+		assert.NoError(t, stream.Err())
+		assert.Equal(t, 3, n)
+		assert.NoError(t, stream.Close())
+	})
+
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, countProcedure, span.Name)
+	assert.Equal(t, "success", span.Outcome)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "connect_stream_messages_received", Value: float64(3)},
+		{Key: "connect_stream_messages_sent", Value: float64(1)},
+	}, span.Context.Tags)
+
+	serverTracer.Flush(nil)
+	transactions := serverTracer.Payloads().Transactions
+	require.Len(t, transactions, 1)
+	serverTx := transactions[0]
+	assert.Equal(t, countProcedure, serverTx.Name)
+	assert.Equal(t, "ok", serverTx.Result)
+	assert.Equal(t, tx.TraceID, serverTx.TraceID)
+	assert.Equal(t, span.ID, serverTx.ParentID)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "connect_stream_messages_received", Value: float64(1)},
+		{Key: "connect_stream_messages_sent", Value: float64(3)},
+	}, serverTx.Context.Tags)
+}
+
+func TestHandlerWrapped(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	server := newServer(t, tracer.Tracer, true)
+
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](server.Client(), server.URL+greetProcedure)
+	_, err := client.CallUnary(context.Background(), connect.NewRequest(wrapperspb.String("")))
+	assert.Error(t, err)
+
+	tracer.Flush(nil)
+	transactions := tracer.Payloads().Transactions
+	require.Len(t, transactions, 1)
+	assert.Equal(t, greetProcedure, transactions[0].Name)
+	assert.Equal(t, "HTTP 5xx", transactions[0].Result)
+	assert.Equal(t, "failure", transactions[0].Outcome)
+	assert.Equal(t, &model.Framework{Name: "connect", Version: connect.Version}, transactions[0].Context.Service.Framework)
+}
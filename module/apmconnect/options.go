@@ -0,0 +1,54 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmconnect // import "go.elastic.co/apm/module/apmconnect/v2"
+
+import (
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+)
+
+type options struct {
+	tracer     *apm.Tracer
+	propagator apmhttp.Propagator
+}
+
+// Option sets options for tracing Connect RPCs.
+type Option func(*options)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing handler RPCs.
+func WithTracer(t *apm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
+// WithPropagator returns an Option which sets p as the propagator used
+// for extracting and injecting trace context in request headers. By
+// default, apmhttp.DefaultPropagator() is used.
+func WithPropagator(p apmhttp.Propagator) Option {
+	if p == nil {
+		panic("p == nil")
+	}
+	return func(o *options) {
+		o.propagator = p
+	}
+}
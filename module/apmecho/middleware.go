@@ -69,7 +69,7 @@ func (m *middleware) handle(c echo.Context) error {
 	if !m.tracer.Recording() || m.requestIgnorer(req) {
 		return m.handler(c)
 	}
-	name := req.Method + " " + c.Path()
+	name := apmhttp.ServerTransactionName(m.tracer, req, c.Path())
 	tx, body, req := apmhttp.StartTransactionWithBody(m.tracer, name, req)
 	defer tx.End()
 	c.SetRequest(req)
@@ -130,7 +130,7 @@ func (m *middleware) handle(c echo.Context) error {
 					unknownRoute = isMethodNotAllowedHandler(c.Handler())
 				}
 				if unknownRoute {
-					tx.Name = apmhttp.UnknownRouteRequestName(req)
+					tx.Name = apmhttp.ServerTransactionName(m.tracer, req, "")
 				}
 			}
 		}
@@ -18,8 +18,10 @@
 package apmechov4 // import "go.elastic.co/apm/module/apmechov4/v2"
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"reflect"
 	"runtime"
@@ -49,8 +51,9 @@ func Middleware(o ...Option) echo.MiddlewareFunc {
 		opts.requestIgnorer = apmhttp.NewDynamicServerRequestIgnorer(opts.tracer)
 	}
 	if opts.requestName == nil {
+		tracer := opts.tracer
 		opts.requestName = func(c echo.Context) string {
-			return c.Request().Method + " " + c.Path()
+			return apmhttp.ServerTransactionName(tracer, c.Request(), c.Path())
 		}
 	}
 	return func(h echo.HandlerFunc) echo.HandlerFunc {
@@ -85,6 +88,10 @@ func (m *middleware) handle(c echo.Context) error {
 	c.SetRequest(req)
 
 	resp := c.Response()
+	responseBody := m.tracer.CaptureHTTPResponseBody()
+	if responseBody != nil {
+		resp.Writer = &responseBodyWriter{ResponseWriter: resp.Writer, body: responseBody}
+	}
 	var handlerErr error
 	defer func() {
 		if v := recover(); v != nil {
@@ -96,24 +103,34 @@ func (m *middleware) handle(c echo.Context) error {
 
 			e := m.tracer.Recovered(v)
 			e.SetTransaction(tx)
-			setContext(&e.Context, req, resp, body)
+			setContext(&e.Context, req, resp, body, responseBody)
 			e.Send()
 		}
 		if handlerErr != nil {
 			e := m.tracer.NewError(handlerErr)
-			setContext(&e.Context, req, resp, body)
+			setContext(&e.Context, req, resp, body, responseBody)
 			e.SetTransaction(tx)
 			e.Handled = true
 			e.Send()
 		}
 		tx.Result = apmhttp.StatusCodeResult(resp.Status)
 		if tx.Sampled() {
-			setContext(&tx.Context, req, resp, body)
+			setContext(&tx.Context, req, resp, body, responseBody)
 		}
 		body.Discard()
+		responseBody.Discard()
 	}()
 
 	handlerErr = m.handler(c)
+	var errorHandled bool
+	if handlerErr != nil && responseBody != nil && !resp.Committed {
+		// Invoke the error handler now, rather than after the
+		// middleware returns, so the error response body can be
+		// captured. The error is not returned below, so that the
+		// error handler is not invoked a second time.
+		c.Error(handlerErr)
+		errorHandled = true
+	}
 	if handlerErr != nil {
 		resp.Status = http.StatusInternalServerError
 		if handlerErr, ok := handlerErr.(*echo.HTTPError); ok {
@@ -140,22 +157,61 @@ func (m *middleware) handle(c echo.Context) error {
 					unknownRoute = isMethodNotAllowedHandler(c.Handler())
 				}
 				if unknownRoute {
-					tx.Name = apmhttp.UnknownRouteRequestName(req)
+					tx.Name = apmhttp.ServerTransactionName(m.tracer, req, "")
 				}
 			}
 		}
 	} else if !resp.Committed {
 		resp.WriteHeader(http.StatusOK)
 	}
+	if errorHandled {
+		return nil
+	}
 	return handlerErr
 }
 
-func setContext(ctx *apm.Context, req *http.Request, resp *echo.Response, body *apm.BodyCapturer) {
+func setContext(ctx *apm.Context, req *http.Request, resp *echo.Response, body *apm.BodyCapturer, responseBody *apm.ResponseBodyCapturer) {
 	ctx.SetFramework("echo", echo.Version)
 	ctx.SetHTTPRequest(req)
 	ctx.SetHTTPRequestBody(body)
 	ctx.SetHTTPStatusCode(resp.Status)
 	ctx.SetHTTPResponseHeaders(resp.Header())
+	ctx.SetHTTPResponseBody(responseBody, resp.Status, resp.Header().Get(echo.HeaderContentType))
+}
+
+// responseBodyWriter wraps an http.ResponseWriter, recording
+// the response body written through it.
+type responseBodyWriter struct {
+	http.ResponseWriter
+	body *apm.ResponseBodyCapturer
+}
+
+func (w *responseBodyWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.body.Write(data[:n])
+	return n, err
+}
+
+// Flush calls w.ResponseWriter's Flush method if implemented,
+// otherwise it does nothing.
+func (w *responseBodyWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack calls w.ResponseWriter's Hijack method if implemented,
+// otherwise it returns http.ErrNotSupported.
+func (w *responseBodyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *responseBodyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 type options struct {
@@ -151,6 +151,26 @@ func TestEchoMiddlewareUnknownRoute(t *testing.T) {
 	}
 }
 
+func TestEchoMiddlewareTransactionNaming(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetUsePathAsTransactionName(true)
+	tracer.SetTransactionNameIncludeMethod(false)
+
+	e := echo.New()
+	e.Use(apmecho.Middleware(apmecho.WithTracer(tracer)))
+	e.GET("/hello/:name", func(c echo.Context) error { return nil })
+
+	doRequest(e, "GET", "http://server.testing/hello/foo")
+	doRequest(e, "GET", "http://server.testing/ahoy/thar")
+
+	tracer.Flush(nil)
+	transactions := transport.Payloads().Transactions
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "/hello/foo", transactions[0].Name)
+	assert.Equal(t, "/ahoy/thar", transactions[1].Name)
+}
+
 func TestEchoMiddlewarePanic(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -193,6 +213,37 @@ func TestEchoMiddlewareError(t *testing.T) {
 	assertError(t, transport.Payloads(), "handleError", "wot", true)
 }
 
+func TestEchoMiddlewareCaptureResponseBody(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureResponseBody(apm.CaptureBodyAll)
+
+	e := echo.New()
+	var errorHandlerCalls int
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		errorHandlerCalls++
+		e.DefaultHTTPErrorHandler(err, c)
+	}
+	e.Use(apmecho.Middleware(apmecho.WithTracer(tracer)))
+	e.GET("/error", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusConflict, "already exists")
+	})
+
+	w := doRequest(e, "GET", "http://server.testing/error")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, 1, errorHandlerCalls)
+	tracer.Flush(nil)
+
+	// The error handler is invoked by the middleware,
+	// so the error response body is captured.
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, w.Body.String(), responseBody(payloads.Transactions[0].Context))
+	assert.Equal(t, w.Body.String(), responseBody(payloads.Errors[0].Context))
+	assert.Contains(t, w.Body.String(), "already exists")
+}
+
 func assertError(t *testing.T, payloads transporttest.Payloads, culprit, message string, handled bool) model.Error {
 	error0 := payloads.Errors[0]
 
@@ -230,3 +281,18 @@ func doRequest(e *echo.Echo, method, url string) *httptest.ResponseRecorder {
 	e.ServeHTTP(w, req)
 	return w
 }
+
+// responseBody returns the captured response body
+// recorded in the custom context, if any.
+func responseBody(c *model.Context) string {
+	if c == nil {
+		return ""
+	}
+	for _, item := range c.Custom {
+		if item.Key == "response_body" {
+			body, _ := item.Value.(string)
+			return body
+		}
+	}
+	return ""
+}
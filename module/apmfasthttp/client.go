@@ -0,0 +1,203 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmfasthttp // import "go.elastic.co/apm/module/apmfasthttp/v2"
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+)
+
+// Doer is the interface implemented by fasthttp.Client, fasthttp.HostClient,
+// fasthttp.PipelineClient and fasthttp.LBClient.
+type Doer interface {
+	Do(req *fasthttp.Request, resp *fasthttp.Response) error
+	DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error
+	DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error
+}
+
+// Client wraps a Doer, reporting client requests as spans to Elastic APM
+// if the context passed to its methods contains a sampled transaction.
+//
+// The trace context is injected into the request headers, so the trace
+// may be continued by the server.
+type Client struct {
+	doer           Doer
+	requestName    ClientRequestNameFunc
+	requestIgnorer ClientRequestIgnorerFunc
+	spanType       string
+	propagator     apmhttp.Propagator
+}
+
+// WrapClient returns a new Client wrapping c, such that client requests are
+// reported as spans to Elastic APM.
+//
+// Spans are started just before the request is sent, and ended when the
+// response has been read, or the request fails.
+func WrapClient(c Doer, o ...ClientOption) *Client {
+	if c == nil {
+		panic("c == nil")
+	}
+	client := &Client{
+		doer:           c,
+		requestName:    ClientRequestName,
+		requestIgnorer: func(*fasthttp.Request) bool { return false },
+		spanType:       "external.http",
+	}
+	for _, o := range o {
+		o(client)
+	}
+	return client
+}
+
+// Do performs the given request, reporting it as a span if ctx contains
+// a transaction. The context may be the *fasthttp.RequestCtx of a request
+// being handled by a server wrapped with Wrap.
+//
+// See fasthttp.Client.Do for details of the request and response handling.
+func (c *Client) Do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	return c.do(ctx, req, resp, func() error {
+		return c.doer.Do(req, resp)
+	})
+}
+
+// DoTimeout performs the given request, waiting for a response for at most
+// the given timeout, and reporting it as a span if ctx contains a transaction.
+//
+// See fasthttp.Client.DoTimeout for details of the request and response handling.
+func (c *Client) DoTimeout(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	return c.do(ctx, req, resp, func() error {
+		return c.doer.DoTimeout(req, resp, timeout)
+	})
+}
+
+// DoDeadline performs the given request, waiting for a response until the
+// given deadline, and reporting it as a span if ctx contains a transaction.
+//
+// See fasthttp.Client.DoDeadline for details of the request and response handling.
+func (c *Client) DoDeadline(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	return c.do(ctx, req, resp, func() error {
+		return c.doer.DoDeadline(req, resp, deadline)
+	})
+}
+
+func (c *Client) do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response, do func() error) error {
+	if c.requestIgnorer(req) {
+		return do()
+	}
+	tx := apm.TransactionFromContext(ctx)
+	if tx == nil {
+		return do()
+	}
+
+	propagator := c.propagator
+	if propagator == nil {
+		propagator = apmhttp.DefaultPropagator()
+	}
+	carrier := requestHeaderCarrier{header: &req.Header}
+	injectOptions := apmhttp.InjectOptions{PropagateLegacyHeader: tx.ShouldPropagateLegacyHeader()}
+	traceContext := tx.TraceContext()
+	if !traceContext.Options.Recorded() {
+		propagator.Inject(carrier, traceContext, injectOptions)
+		return do()
+	}
+
+	span := tx.StartExitSpan(c.requestName(req), c.spanType, apm.SpanFromContext(ctx))
+	if span.Dropped() {
+		span.End()
+		propagator.Inject(carrier, traceContext, injectOptions)
+		return do()
+	}
+	defer span.End()
+	if u, err := url.Parse(string(req.URI().FullURI())); err == nil {
+		span.Context.SetHTTPRequest(&http.Request{Method: string(req.Header.Method()), URL: u})
+	}
+	propagator.Inject(carrier, span.TraceContext(), injectOptions)
+
+	if err := do(); err != nil {
+		span.Outcome = "failure"
+		return err
+	}
+	span.Context.SetHTTPStatusCode(resp.StatusCode())
+	return nil
+}
+
+// ClientRequestName returns the span name for the client request, req.
+func ClientRequestName(req *fasthttp.Request) string {
+	return string(req.Header.Method()) + " " + string(req.URI().Host())
+}
+
+// ClientRequestNameFunc is the type of a function for use in
+// WithClientRequestName.
+type ClientRequestNameFunc func(*fasthttp.Request) string
+
+// ClientRequestIgnorerFunc is the type of a function for use in
+// WithClientRequestIgnorer.
+type ClientRequestIgnorerFunc func(*fasthttp.Request) bool
+
+// ClientOption sets options for tracing client requests.
+type ClientOption func(*Client)
+
+// WithClientRequestName returns a ClientOption which sets fn as the function
+// to use to obtain the span name for the given client request.
+func WithClientRequestName(fn ClientRequestNameFunc) ClientOption {
+	if fn == nil {
+		panic("fn == nil")
+	}
+	return func(c *Client) {
+		c.requestName = fn
+	}
+}
+
+// WithClientRequestIgnorer returns a ClientOption which sets fn as the
+// function to use to determine whether or not a client request should
+// be ignored. If fn is nil, all requests will be reported.
+func WithClientRequestIgnorer(fn ClientRequestIgnorerFunc) ClientOption {
+	if fn == nil {
+		fn = func(*fasthttp.Request) bool { return false }
+	}
+	return func(c *Client) {
+		c.requestIgnorer = fn
+	}
+}
+
+// WithClientSpanType returns a ClientOption which sets the span type
+// for client requests. Defaults to "external.http".
+func WithClientSpanType(spanType string) ClientOption {
+	return func(c *Client) {
+		c.spanType = spanType
+	}
+}
+
+// WithClientPropagator returns a ClientOption which sets p as the
+// propagator to use for injecting trace context into client requests.
+// By default, the propagator returned by apmhttp.DefaultPropagator is used.
+func WithClientPropagator(p apmhttp.Propagator) ClientOption {
+	if p == nil {
+		panic("p == nil")
+	}
+	return func(c *Client) {
+		c.propagator = p
+	}
+}
@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmfasthttp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	"go.elastic.co/apm/module/apmfasthttp/v2"
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+)
+
+func TestClient(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("Traceparent")
+		code, _ := strconv.Atoi(req.URL.Query().Get("code"))
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	client := apmfasthttp.WrapClient(&fasthttp.Client{})
+	tx, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		for _, code := range []int{200, 503} {
+			req := fasthttp.AcquireRequest()
+			resp := fasthttp.AcquireResponse()
+			req.SetRequestURI(server.URL + "/path?code=" + strconv.Itoa(code))
+			require.NoError(t, client.Do(ctx, req, resp))
+			assert.Equal(t, code, resp.StatusCode())
+			fasthttp.ReleaseRequest(req)
+			fasthttp.ReleaseResponse(resp)
+		}
+	})
+	require.Len(t, spans, 2)
+
+	span := spans[0]
+	assert.Equal(t, "GET "+serverURL.Host, span.Name)
+	assert.Equal(t, "external", span.Type)
+	assert.Equal(t, "http", span.Subtype)
+	assert.Equal(t, "success", span.Outcome)
+	assert.Equal(t, &model.SpanContext{
+		HTTP: &model.HTTPSpanContext{
+			URL:        mustParseURL(t, server.URL+"/path?code=200"),
+			StatusCode: 200,
+		},
+		Destination: &model.DestinationSpanContext{
+			Address: serverURL.Hostname(),
+			Port:    port,
+			Service: &model.DestinationServiceSpanContext{
+				Type:     "external",
+				Name:     server.URL,
+				Resource: serverURL.Host,
+			},
+		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{
+				Type: "http",
+				Name: serverURL.Host,
+			},
+		},
+	}, span.Context)
+	assert.Equal(t, "failure", spans[1].Outcome)
+
+	// The trace context of the last span is propagated.
+	traceContext, err := apmhttp.ParseTraceparentHeader(traceparent)
+	require.NoError(t, err)
+	assert.Equal(t, apm.TraceID(tx.TraceID), traceContext.Trace)
+	assert.Equal(t, apm.SpanID(spans[1].ID), traceContext.Span)
+}
+
+func TestClientError(t *testing.T) {
+	client := apmfasthttp.WrapClient(&fasthttp.Client{})
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI("http://127.0.0.1:1")
+		assert.Error(t, client.DoTimeout(ctx, req, resp, time.Second))
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, "failure", spans[0].Outcome)
+}
+
+func TestClientNoTransaction(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("Traceparent")
+	}))
+	defer server.Close()
+
+	client := apmfasthttp.WrapClient(&fasthttp.HostClient{Addr: server.Listener.Addr().String()})
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(server.URL)
+	require.NoError(t, client.DoDeadline(context.Background(), req, resp, time.Now().Add(time.Second)))
+	assert.Empty(t, traceparent)
+}
+
+func TestClientRequestIgnorer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	client := apmfasthttp.WrapClient(&fasthttp.Client{}, apmfasthttp.WithClientRequestIgnorer(
+		func(*fasthttp.Request) bool { return true },
+	))
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(server.URL)
+		require.NoError(t, client.Do(ctx, req, resp))
+	})
+	assert.Empty(t, spans)
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	require.NoError(t, err)
+	return u
+}
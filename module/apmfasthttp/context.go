@@ -20,7 +20,6 @@ package apmfasthttp // import "go.elastic.co/apm/module/apmfasthttp/v2"
 import (
 	"context"
 	"net/http"
-	"strings"
 
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/fasthttpadaptor"
@@ -83,22 +82,21 @@ func setResponseContext(ctx *fasthttp.RequestCtx, tx *apm.Transaction, bc *apm.B
 }
 
 // StartTransactionWithBody returns a new Transaction with name,
-// created with tracer, and taking trace context from ctx.
+// created with tracer, and taking trace context from ctx using
+// apmhttp.DefaultPropagator.
 //
 // If the transaction is not ignored, the request and the request body
 // capturer will be returned with the transaction added to its context.
 func StartTransactionWithBody(
 	ctx *fasthttp.RequestCtx, tracer *apm.Tracer, name string,
 ) (*apm.Transaction, *apm.BodyCapturer, error) {
-	traceContext, ok := getRequestTraceparent(ctx, apmhttp.W3CTraceparentHeader)
-	if !ok {
-		traceContext, ok = getRequestTraceparent(ctx, apmhttp.ElasticTraceparentHeader)
-	}
+	return startTransactionWithBody(ctx, tracer, name, apmhttp.DefaultPropagator())
+}
 
-	if ok {
-		tracestateHeader := string(ctx.Request.Header.Peek(apmhttp.TracestateHeader))
-		traceContext.State, _ = apmhttp.ParseTracestateHeader(strings.Split(tracestateHeader, ",")...)
-	}
+func startTransactionWithBody(
+	ctx *fasthttp.RequestCtx, tracer *apm.Tracer, name string, propagator apmhttp.Propagator,
+) (*apm.Transaction, *apm.BodyCapturer, error) {
+	traceContext, _ := propagator.Extract(requestHeaderCarrier{header: &ctx.Request.Header})
 
 	tx := tracer.StartTransactionOptions(name, "request", apm.TransactionOptions{TraceContext: traceContext})
 
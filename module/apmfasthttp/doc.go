@@ -16,5 +16,5 @@
 // under the License.
 
 // Package apmfasthttp provides a tracing middleware fasthttp.RequestHandler for
-// servers.
+// servers, and a wrapper for tracing fasthttp clients.
 package apmfasthttp // import "go.elastic.co/apm/module/apmfasthttp/v2"
@@ -20,6 +20,7 @@ package apmfasthttp // import "go.elastic.co/apm/module/apmfasthttp/v2"
 import (
 	"github.com/valyala/fasthttp"
 
+	"go.elastic.co/apm/module/apmhttp/v2"
 	"go.elastic.co/apm/v2"
 )
 
@@ -45,7 +46,10 @@ func Wrap(handler fasthttp.RequestHandler, options ...ServerOption) fasthttp.Req
 	}
 
 	if h.requestName == nil {
-		h.requestName = ServerRequestName
+		tracer := h.tracer
+		h.requestName = func(ctx *fasthttp.RequestCtx) string {
+			return ServerTransactionName(tracer, ctx, string(ctx.Request.URI().Path()))
+		}
 	}
 
 	if h.requestIgnorer == nil {
@@ -65,7 +69,12 @@ func (h *apmHandler) handler(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	tx, bc, err := StartTransactionWithBody(ctx, h.tracer, h.requestName(ctx))
+	propagator := h.propagator
+	if propagator == nil {
+		propagator = apmhttp.DefaultPropagator()
+	}
+
+	tx, bc, err := startTransactionWithBody(ctx, h.tracer, h.requestName(ctx), propagator)
 	if err != nil {
 		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
 		return
@@ -146,3 +155,16 @@ func WithPanicPropagation() ServerOption {
 		h.panicPropagation = true
 	}
 }
+
+// WithServerPropagator returns a ServerOption which sets p as the
+// propagator to use for extracting trace context from server requests.
+// By default, the propagator returned by apmhttp.DefaultPropagator is used.
+func WithServerPropagator(p apmhttp.Propagator) ServerOption {
+	if p == nil {
+		panic("p == nil")
+	}
+
+	return func(h *apmHandler) {
+		h.propagator = p
+	}
+}
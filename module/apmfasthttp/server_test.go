@@ -32,6 +32,7 @@ import (
 	"github.com/valyala/fasthttp"
 
 	"go.elastic.co/apm/module/apmfasthttp/v2"
+	"go.elastic.co/apm/module/apmhttp/v2"
 	"go.elastic.co/apm/v2/model"
 	"go.elastic.co/apm/v2/transport/transporttest"
 )
@@ -189,3 +190,38 @@ func TestServerHTTPResponseHijack(t *testing.T) {
 
 	testServer(t, s, wg, assertFn)
 }
+
+func TestServerPropagator(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	s := &fasthttp.Server{
+		Handler: apmfasthttp.Wrap(
+			func(ctx *fasthttp.RequestCtx) {},
+			apmfasthttp.WithTracer(tracer),
+			apmfasthttp.WithServerPropagator(apmhttp.JaegerPropagator{}),
+		),
+	}
+	go s.Serve(ln)
+
+	req, err := http.NewRequest("GET", "http://"+ln.Addr().String(), nil)
+	require.NoError(t, err)
+	req.Header.Set("Uber-Trace-Id", "0af7651916cd43dd8448eb211c80319c:b7ad6b7169203331:0:1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	var transactions []model.Transaction
+	require.Eventually(t, func() bool {
+		tracer.Flush(nil)
+		transactions = transport.Payloads().Transactions
+		return len(transactions) > 0
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, model.TraceID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c}, transactions[0].TraceID)
+	assert.Equal(t, model.SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31}, transactions[0].ParentID)
+}
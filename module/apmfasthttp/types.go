@@ -20,6 +20,7 @@ package apmfasthttp // import "go.elastic.co/apm/module/apmfasthttp/v2"
 import (
 	"github.com/valyala/fasthttp"
 
+	"go.elastic.co/apm/module/apmhttp/v2"
 	"go.elastic.co/apm/v2"
 )
 
@@ -30,6 +31,7 @@ type apmHandler struct {
 	requestIgnorer   RequestIgnorerFunc
 	recovery         RecoveryFunc
 	panicPropagation bool
+	propagator       apmhttp.Propagator
 }
 
 // txCloser wraps the APM transaction to implement
@@ -23,18 +23,24 @@ import (
 	"github.com/valyala/bytebufferpool"
 	"github.com/valyala/fasthttp"
 
-	"go.elastic.co/apm/module/apmhttp/v2"
 	"go.elastic.co/apm/v2"
 )
 
-func getRequestTraceparent(ctx *fasthttp.RequestCtx, header string) (apm.TraceContext, bool) {
-	if value := ctx.Request.Header.Peek(header); len(value) > 0 {
-		if c, err := apmhttp.ParseTraceparentHeader(string(value)); err == nil {
-			return c, true
-		}
+// requestHeaderCarrier is an apmhttp.Carrier for fasthttp request headers.
+type requestHeaderCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (c requestHeaderCarrier) Get(key string) []string {
+	if value := c.header.Peek(key); len(value) > 0 {
+		return []string{string(value)}
 	}
 
-	return apm.TraceContext{}, false
+	return nil
+}
+
+func (c requestHeaderCarrier) Set(key, value string) {
+	c.header.Set(key, value)
 }
 
 // NewDynamicServerRequestIgnorer returns the RequestIgnorer to use in
@@ -63,3 +69,14 @@ func ServerRequestName(ctx *fasthttp.RequestCtx) string {
 
 	return b.String()
 }
+
+// ServerTransactionName returns the transaction name for the server request
+// context, ctx, matched to route, according to the tracer's transaction
+// naming configuration. If route is empty, the route is considered unknown.
+//
+// See apm.Tracer.HTTPTransactionName for details.
+func ServerTransactionName(tracer *apm.Tracer, ctx *fasthttp.RequestCtx, route string) string {
+	return tracer.HTTPTransactionName(
+		string(ctx.Request.Header.Method()), route, string(ctx.Request.URI().Path()),
+	)
+}
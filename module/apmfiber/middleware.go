@@ -63,7 +63,7 @@ func (m *middleware) handle(c *fiber.Ctx) (result error) {
 		return c.Next()
 	}
 
-	name := string(reqCtx.Method()) + " " + c.Path()
+	name := apmfasthttp.ServerTransactionName(m.tracer, reqCtx, c.Path())
 	tx, body, err := apmfasthttp.StartTransactionWithBody(reqCtx, m.tracer, name)
 	if err != nil {
 		reqCtx.Error(err.Error(), http.StatusInternalServerError)
@@ -71,16 +71,17 @@ func (m *middleware) handle(c *fiber.Ctx) (result error) {
 		return err
 	}
 
+	responseBody := m.tracer.CaptureHTTPResponseBody()
 	defer func() {
 		resp := c.Response()
 		route := c.Route()
 
 		var fiberErr *fiber.Error
 		if route.Path == "/" && errors.As(result, &fiberErr) && fiberErr.Code == http.StatusNotFound {
-			tx.Name = string(reqCtx.Method()) + " unknown route"
+			tx.Name = apmfasthttp.ServerTransactionName(m.tracer, reqCtx, "")
 		} else {
 			// Workaround for set tx.Name as template path, not absolute
-			tx.Name = string(reqCtx.Method()) + " " + route.Path
+			tx.Name = apmfasthttp.ServerTransactionName(m.tracer, reqCtx, route.Path)
 		}
 
 		if v := recover(); v != nil {
@@ -88,9 +89,10 @@ func (m *middleware) handle(c *fiber.Ctx) (result error) {
 				defer panic(v)
 			}
 
+			captureResponseBody(responseBody, resp)
 			e := m.tracer.Recovered(v)
 			e.SetTransaction(tx)
-			setContext(&e.Context, resp)
+			setContext(&e.Context, resp, responseBody)
 			e.Send()
 
 			c.Status(http.StatusInternalServerError)
@@ -100,25 +102,35 @@ func (m *middleware) handle(c *fiber.Ctx) (result error) {
 
 		tx.Result = apmhttp.StatusCodeResult(statusCode)
 		if tx.Sampled() {
-			setContext(&tx.Context, resp)
+			setContext(&tx.Context, resp, responseBody)
 		}
 
 		body.Discard()
+		responseBody.Discard()
 	}()
 
 	result = c.Next()
+	captureResponseBody(responseBody, c.Response())
 	if result != nil {
 		resp := c.Response()
 		e := m.tracer.NewError(result)
 		e.Handled = true
 		e.SetTransaction(tx)
-		setContext(&e.Context, resp)
+		setContext(&e.Context, resp, responseBody)
 		e.Send()
 	}
 	return result
 }
 
-func setContext(ctx *apm.Context, resp *fiber.Response) {
+// captureResponseBody records the response body in bc,
+// unless the response body is streamed.
+func captureResponseBody(bc *apm.ResponseBodyCapturer, resp *fiber.Response) {
+	if bc != nil && !resp.IsBodyStream() {
+		bc.Write(resp.Body())
+	}
+}
+
+func setContext(ctx *apm.Context, resp *fiber.Response, responseBody *apm.ResponseBodyCapturer) {
 	ctx.SetFramework("fiber", fiber.Version)
 	ctx.SetHTTPStatusCode(resp.StatusCode())
 
@@ -131,6 +143,7 @@ func setContext(ctx *apm.Context, resp *fiber.Response) {
 	})
 
 	ctx.SetHTTPResponseHeaders(headers)
+	ctx.SetHTTPResponseBody(responseBody, resp.StatusCode(), string(resp.Header.ContentType()))
 }
 
 // Option sets options for tracing.
@@ -33,6 +33,7 @@ import (
 	"github.com/valyala/fasthttp"
 
 	"go.elastic.co/apm/module/apmfiber/v2"
+	"go.elastic.co/apm/v2"
 	"go.elastic.co/apm/v2/apmtest"
 	"go.elastic.co/apm/v2/model"
 	"go.elastic.co/apm/v2/transport/transporttest"
@@ -208,6 +209,32 @@ func TestMiddlewareError(t *testing.T) {
 	assertError(t, tracer.Payloads(), "wot", true)
 }
 
+func TestMiddlewareCaptureResponseBody(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.SetCaptureResponseBody(apm.CaptureBodyTransactions)
+	// Field names are only sanitized when redaction rules are configured.
+	require.NoError(t, tracer.SetRedactionRules(apm.RedactBearerTokens))
+
+	e := fiber.New()
+	e.Use(apmfiber.Middleware(apmfiber.WithTracer(tracer.Tracer)))
+	e.Get("/json", func(c *fiber.Ctx) error {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "bad", "password": "hunter2"})
+	})
+
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, "http://server.testing/json", nil)
+	assert.Nil(t, err)
+
+	resp, err := e.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	tracer.Flush(nil)
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, `{"error":"bad","password":"[REDACTED]"}`, responseBody(payloads.Transactions[0].Context))
+}
+
 func TestMiddlewarePanic(t *testing.T) {
 	debugOutput.Reset()
 	tracer := apmtest.NewRecordingTracer()
@@ -311,3 +338,18 @@ func handleError(c *fiber.Ctx) error {
 func handleHello(c *fiber.Ctx) error {
 	return c.Status(http.StatusOK).SendString(fmt.Sprintf("Hello, %s!", c.Params("name")))
 }
+
+// responseBody returns the captured response body
+// recorded in the custom context, if any.
+func responseBody(c *model.Context) string {
+	if c == nil {
+		return ""
+	}
+	for _, item := range c.Custom {
+		if item.Key == "response_body" {
+			body, _ := item.Value.(string)
+			return body
+		}
+	}
+	return ""
+}
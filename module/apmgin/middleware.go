@@ -75,6 +75,11 @@ func (m *middleware) handle(c *gin.Context) {
 	defer tx.End()
 	c.Request = req
 
+	responseBody := m.tracer.CaptureHTTPResponseBody()
+	if responseBody != nil {
+		c.Writer = &responseBodyWriter{ResponseWriter: c.Writer, body: responseBody}
+	}
+
 	defer func() {
 		if v := recover(); v != nil {
 			if m.panicPropagation {
@@ -88,40 +93,58 @@ func (m *middleware) handle(c *gin.Context) {
 			}
 			e := m.tracer.Recovered(v)
 			e.SetTransaction(tx)
-			setContext(&e.Context, c, body)
+			setContext(&e.Context, c, body, responseBody)
 			e.Send()
 		}
 		tx.Result = apmhttp.StatusCodeResult(c.Writer.Status())
 
 		if tx.Sampled() {
-			setContext(&tx.Context, c, body)
+			setContext(&tx.Context, c, body, responseBody)
 		}
 
 		for _, err := range c.Errors {
 			e := m.tracer.NewError(err.Err)
 			e.SetTransaction(tx)
-			setContext(&e.Context, c, body)
+			setContext(&e.Context, c, body, responseBody)
 			e.Handled = true
 			e.Send()
 		}
 		body.Discard()
+		responseBody.Discard()
 	}()
 	c.Next()
 }
 
 func (m *middleware) getRequestName(c *gin.Context) string {
-	if fullPath := c.FullPath(); fullPath != "" {
-		return c.Request.Method + " " + fullPath
-	}
-	return apmhttp.UnknownRouteRequestName(c.Request)
+	return apmhttp.ServerTransactionName(m.tracer, c.Request, c.FullPath())
 }
 
-func setContext(ctx *apm.Context, c *gin.Context, body *apm.BodyCapturer) {
+func setContext(ctx *apm.Context, c *gin.Context, body *apm.BodyCapturer, responseBody *apm.ResponseBodyCapturer) {
 	ctx.SetFramework("gin", gin.Version)
 	ctx.SetHTTPRequest(c.Request)
 	ctx.SetHTTPRequestBody(body)
 	ctx.SetHTTPStatusCode(c.Writer.Status())
 	ctx.SetHTTPResponseHeaders(c.Writer.Header())
+	ctx.SetHTTPResponseBody(responseBody, c.Writer.Status(), c.Writer.Header().Get("Content-Type"))
+}
+
+// responseBodyWriter wraps a gin.ResponseWriter, recording
+// the response body written through it.
+type responseBodyWriter struct {
+	gin.ResponseWriter
+	body *apm.ResponseBodyCapturer
+}
+
+func (w *responseBodyWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.body.Write(data[:n])
+	return n, err
+}
+
+func (w *responseBodyWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.body.Write([]byte(s[:n]))
+	return n, err
 }
 
 // Option sets options for tracing.
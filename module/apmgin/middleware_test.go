@@ -185,6 +185,30 @@ func TestMiddlewareUnknownRoute(t *testing.T) {
 	assert.Equal(t, "PUT unknown route", transaction.Name)
 }
 
+func TestMiddlewareTransactionNaming(t *testing.T) {
+	debugOutput.Reset()
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetUsePathAsTransactionName(true)
+	tracer.SetTransactionNameGroups("/user/*/cart")
+
+	e := gin.New()
+	e.Use(apmgin.Middleware(e, apmgin.WithTracer(tracer)))
+	e.GET("/user/:id", func(c *gin.Context) {})
+	e.GET("/user/:id/cart", func(c *gin.Context) {})
+
+	doRequest(e, "GET", "http://server.testing/user/123")
+	doRequest(e, "GET", "http://server.testing/user/123/cart")
+	doRequest(e, "GET", "http://server.testing/foo")
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads().Transactions
+	require.Len(t, transactions, 3)
+	assert.Equal(t, "GET /user/123", transactions[0].Name)
+	assert.Equal(t, "GET /user/*/cart", transactions[1].Name)
+	assert.Equal(t, "GET /foo", transactions[2].Name)
+}
+
 func TestMiddlewarePanic(t *testing.T) {
 	debugOutput.Reset()
 	tracer, transport := transporttest.NewRecorderTracer()
@@ -253,6 +277,32 @@ func TestMiddlewareError(t *testing.T) {
 	assertError(t, transport.Payloads(), "handleError", "wot", true)
 }
 
+func TestMiddlewareCaptureResponseBody(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureResponseBody(apm.CaptureBodyAll)
+	// Field names are only sanitized when redaction rules are configured.
+	require.NoError(t, tracer.SetRedactionRules(apm.RedactBearerTokens))
+
+	e := gin.New()
+	e.Use(apmgin.Middleware(e, apmgin.WithTracer(tracer)))
+	e.GET("/json", func(c *gin.Context) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid", "token": "abc"})
+		c.Error(errors.New("invalid"))
+	})
+
+	w := doRequest(e, "GET", "http://server.testing/json")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"invalid","token":"abc"}`, w.Body.String())
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, `{"error":"invalid","token":"[REDACTED]"}`, responseBody(payloads.Transactions[0].Context))
+	assert.Equal(t, `{"error":"invalid","token":"[REDACTED]"}`, responseBody(payloads.Errors[0].Context))
+}
+
 func assertError(t *testing.T, payloads transporttest.Payloads, culprit, message string, handled bool) model.Error {
 	error0 := payloads.Errors[0]
 
@@ -286,3 +336,18 @@ func doRequest(e *gin.Engine, method, url string) *httptest.ResponseRecorder {
 	e.ServeHTTP(w, req)
 	return w
 }
+
+// responseBody returns the captured response body
+// recorded in the custom context, if any.
+func responseBody(c *model.Context) string {
+	if c == nil {
+		return ""
+	}
+	for _, item := range c.Custom {
+		if item.Key == "response_body" {
+			body, _ := item.Value.(string)
+			return body
+		}
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgoredisv9 // import "go.elastic.co/apm/module/apmgoredisv9/v2"
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+
+	"go.elastic.co/apm/v2"
+)
+
+// hook is an implementation of redis.Hook that reports cmds as spans to Elastic APM.
+type hook struct {
+	// addr holds the address of the redis server, if known.
+	addr string
+}
+
+// NewHook returns a redis.Hook that reports cmds as spans to Elastic APM.
+//
+// The returned hook does not know which server commands are sent to,
+// so spans will not have destination address information. Use Instrument
+// to add hooks which record the address of each server, including each
+// node of a cluster or ring.
+func NewHook() redis.Hook {
+	return &hook{}
+}
+
+// Instrument adds hooks to client that report cmds as spans to Elastic APM.
+//
+// For *redis.Client, a hook is added to the client itself. For
+// *redis.ClusterClient and *redis.Ring, hooks are added to each
+// node client, so that spans record the address of the node that
+// commands and pipelines are sent to. Pipelines which are split
+// across multiple nodes will be reported as one span per node.
+// Hooks are added to existing nodes, so Instrument may be called
+// after the client has been used, and to nodes created later.
+func Instrument(client redis.UniversalClient) {
+	switch client := client.(type) {
+	case *redis.Client:
+		client.AddHook(&hook{addr: client.Options().Addr})
+	case *redis.ClusterClient:
+		client.OnNewNode(addNodeHook)
+	case *redis.Ring:
+		client.OnNewNode(addNodeHook)
+		client.ForEachShard(context.Background(), func(ctx context.Context, client *redis.Client) error {
+			addNodeHook(client)
+			return nil
+		})
+	default:
+		client.AddHook(NewHook())
+	}
+}
+
+func addNodeHook(client *redis.Client) {
+	client.AddHook(&hook{addr: client.Options().Addr})
+}
+
+// DialHook returns a redis.DialHook that reports connection establishment as spans.
+func (h *hook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		span, ctx := apm.StartSpanOptions(ctx, "connect", "db.redis.connect", apm.SpanOptions{
+			ExitSpan: true,
+		})
+		defer span.End()
+		if !span.Dropped() {
+			setDestination(span, addr)
+		}
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			span.Outcome = "failure"
+		}
+		return conn, err
+	}
+}
+
+// ProcessHook returns a redis.ProcessHook that reports cmds as spans.
+func (h *hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		span, ctx := h.startSpan(ctx, getCmdName(cmd), "")
+		defer span.End()
+		err := next(ctx, cmd)
+		setOutcome(span, err)
+		return err
+	}
+}
+
+// ProcessPipelineHook returns a redis.ProcessPipelineHook that reports
+// pipelines as spans, with the pipelined command names as the statement.
+func (h *hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		var statement strings.Builder
+		for i, cmd := range cmds {
+			if i != 0 {
+				statement.WriteByte('\n')
+			}
+			statement.WriteString(getCmdName(cmd))
+		}
+		span, ctx := h.startSpan(ctx, "PIPELINE", statement.String())
+		defer span.End()
+		err := next(ctx, cmds)
+		setOutcome(span, err)
+		return err
+	}
+}
+
+func (h *hook) startSpan(ctx context.Context, name, statement string) (*apm.Span, context.Context) {
+	span, ctx := apm.StartSpanOptions(ctx, name, "db.redis", apm.SpanOptions{
+		ExitSpan: true,
+	})
+	if !span.Dropped() {
+		if h.addr != "" {
+			setDestination(span, h.addr)
+		}
+		if statement != "" {
+			span.Context.SetDatabase(apm.DatabaseSpanContext{
+				Type:      "redis",
+				Statement: statement,
+			})
+		}
+	}
+	return span, ctx
+}
+
+func setDestination(span *apm.Span, addr string) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	port, _ := strconv.Atoi(portStr)
+	span.Context.SetDestinationAddress(host, port)
+}
+
+func setOutcome(span *apm.Span, err error) {
+	// redis.Nil is returned for missing keys,
+	// which is not considered a failure.
+	if err != nil && !errors.Is(err, redis.Nil) {
+		span.Outcome = "failure"
+	}
+}
+
+func getCmdName(cmd redis.Cmder) string {
+	cmdName := strings.ToUpper(cmd.Name())
+	if cmdName == "" {
+		cmdName = "(empty command)"
+	}
+	return cmdName
+}
@@ -0,0 +1,254 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgoredisv9_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/module/apmgoredisv9/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+)
+
+func TestHook(t *testing.T) {
+	addr := newFakeRedisServer(t)
+	client := redis.NewClient(&redis.Options{Addr: addr, Protocol: 2})
+	defer client.Close()
+	client.AddHook(apmgoredisv9.NewHook())
+	require.NoError(t, client.Ping(context.Background()).Err()) // connect
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		client.Ping(ctx)
+		client.Get(ctx, "key")
+		client.Do(ctx, "")
+	})
+	require.Len(t, spans, 3)
+	assert.Equal(t, "PING", spans[0].Name)
+	assert.Equal(t, "GET", spans[1].Name)
+	assert.Equal(t, "(empty command)", spans[2].Name)
+	for _, span := range spans {
+		assert.Equal(t, "db", span.Type)
+		assert.Equal(t, "redis", span.Subtype)
+		assert.Equal(t, "redis", span.Context.Destination.Service.Resource)
+		assert.Empty(t, span.Context.Destination.Address)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	addr := newFakeRedisServer(t)
+	client := redis.NewClient(&redis.Options{Addr: addr, Protocol: 2})
+	defer client.Close()
+	apmgoredisv9.Instrument(client)
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		client.Set(ctx, "key", "value", 0)
+	})
+	require.NotEmpty(t, spans)
+
+	// The connect span is the parent of any commands
+	// sent during connection initialisation.
+	assert.Equal(t, "connect", spans[0].Name)
+	assert.Equal(t, "db", spans[0].Type)
+	assert.Equal(t, "redis", spans[0].Subtype)
+	assert.Equal(t, "connect", spans[0].Action)
+	assertDestination(t, addr, spans[0].Context.Destination)
+
+	set := spans[len(spans)-1]
+	assert.Equal(t, "SET", set.Name)
+	assertDestination(t, addr, set.Context.Destination)
+}
+
+func TestInstrumentPipeline(t *testing.T) {
+	addr := newFakeRedisServer(t)
+	client := redis.NewClient(&redis.Options{Addr: addr, Protocol: 2})
+	defer client.Close()
+	apmgoredisv9.Instrument(client)
+	require.NoError(t, client.Ping(context.Background()).Err()) // connect
+
+	_, spans, _ := apmtest.WithUncompressedTransaction(func(ctx context.Context) {
+		pipe := client.Pipeline()
+		pipe.Get(ctx, "key")
+		pipe.Set(ctx, "key", "value", 0)
+		pipe.Get(ctx, "key")
+		_, _ = pipe.Exec(ctx)
+
+		pipe = client.TxPipeline()
+		pipe.Get(ctx, "key")
+		_, _ = pipe.Exec(ctx)
+	})
+	require.Len(t, spans, 2)
+	assert.Equal(t, "PIPELINE", spans[0].Name)
+	assert.Equal(t, "db", spans[0].Type)
+	assert.Equal(t, "redis", spans[0].Subtype)
+	assert.Equal(t, &model.DatabaseSpanContext{
+		Type:      "redis",
+		Statement: "GET\nSET\nGET",
+	}, spans[0].Context.Database)
+	assertDestination(t, addr, spans[0].Context.Destination)
+
+	assert.Equal(t, "PIPELINE", spans[1].Name)
+	assert.Equal(t, "MULTI\nGET\nEXEC", spans[1].Context.Database.Statement)
+}
+
+func TestInstrumentCluster(t *testing.T) {
+	addr := newFakeRedisServer(t)
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{addr}, Protocol: 2})
+	defer client.Close()
+	apmgoredisv9.Instrument(client)
+	require.NoError(t, client.Ping(context.Background()).Err()) // connect
+
+	_, spans, _ := apmtest.WithUncompressedTransaction(func(ctx context.Context) {
+		client.Get(ctx, "key")
+		pipe := client.Pipeline()
+		pipe.Get(ctx, "key")
+		pipe.Set(ctx, "key", "value", 0)
+		_, _ = pipe.Exec(ctx)
+	})
+	require.Len(t, spans, 2)
+	assert.Equal(t, "GET", spans[0].Name)
+	assertDestination(t, addr, spans[0].Context.Destination)
+	assert.Equal(t, "PIPELINE", spans[1].Name)
+	assert.Equal(t, "GET\nSET", spans[1].Context.Database.Statement)
+	assertDestination(t, addr, spans[1].Context.Destination)
+}
+
+func TestInstrumentRing(t *testing.T) {
+	addr := newFakeRedisServer(t)
+	client := redis.NewRing(&redis.RingOptions{Addrs: map[string]string{"shard": addr}, Protocol: 2})
+	defer client.Close()
+	apmgoredisv9.Instrument(client)
+	require.NoError(t, client.Ping(context.Background()).Err()) // connect
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		client.Get(ctx, "key")
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET", spans[0].Name)
+	assertDestination(t, addr, spans[0].Context.Destination)
+}
+
+func TestHookFailure(t *testing.T) {
+	addr := newFakeRedisServer(t)
+	client := redis.NewClient(&redis.Options{Addr: addr, Protocol: 2})
+	defer client.Close()
+	apmgoredisv9.Instrument(client)
+	require.NoError(t, client.Ping(context.Background()).Err()) // connect
+
+	_, spans, _ := apmtest.WithUncompressedTransaction(func(ctx context.Context) {
+		client.Get(ctx, "missing")
+		client.Do(ctx, "fail")
+	})
+	require.Len(t, spans, 2)
+	assert.Equal(t, "success", spans[0].Outcome)
+	assert.Equal(t, "failure", spans[1].Outcome)
+}
+
+func assertDestination(t *testing.T, addr string, destination *model.DestinationSpanContext) {
+	host, portStr, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+	require.NotNil(t, destination)
+	assert.Equal(t, host, destination.Address)
+	assert.Equal(t, port, destination.Port)
+}
+
+// newFakeRedisServer starts a minimal RESP2 server which responds to
+// all commands, and describes itself as a single-node cluster.
+func newFakeRedisServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	clusterSlots := fmt.Sprintf("*1\r\n*3\r\n:0\r\n:16383\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n", len(host), host, port)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					var reply string
+					switch strings.ToUpper(args[0]) {
+					case "HELLO", "FAIL":
+						reply = "-ERR unknown command\r\n"
+					case "PING":
+						reply = "+PONG\r\n"
+					case "CLUSTER":
+						reply = clusterSlots
+					case "GET":
+						reply = "$-1\r\n"
+					case "EXEC":
+						reply = "*1\r\n$-1\r\n"
+					default:
+						reply = "+OK\r\n"
+					}
+					if _, err := io.WriteString(conn, reply); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	return args, nil
+}
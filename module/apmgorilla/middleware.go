@@ -86,7 +86,7 @@ func Middleware(o ...Option) mux.MiddlewareFunc {
 	}
 	apmhttpOptions := []apmhttp.ServerOption{
 		apmhttp.WithTracer(opts.tracer),
-		apmhttp.WithServerRequestName(routeRequestName),
+		apmhttp.WithServerRequestName(routeRequestName(opts.tracer)),
 		apmhttp.WithServerRequestIgnorer(opts.requestIgnorer),
 	}
 	if opts.panicPropagation {
@@ -97,14 +97,16 @@ func Middleware(o ...Option) mux.MiddlewareFunc {
 	}
 }
 
-func routeRequestName(req *http.Request) string {
-	if route := mux.CurrentRoute(req); route != nil {
-		tpl, err := route.GetPathTemplate()
-		if err == nil {
-			return req.Method + " " + massageTemplate(tpl)
+func routeRequestName(tracer *apm.Tracer) apmhttp.RequestNameFunc {
+	return func(req *http.Request) string {
+		var routeTemplate string
+		if route := mux.CurrentRoute(req); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				routeTemplate = massageTemplate(tpl)
+			}
 		}
+		return apmhttp.ServerTransactionName(tracer, req, routeTemplate)
 	}
-	return apmhttp.UnknownRouteRequestName(req)
 }
 
 type options struct {
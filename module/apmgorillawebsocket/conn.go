@@ -0,0 +1,357 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgorillawebsocket // import "go.elastic.co/apm/module/apmgorillawebsocket/v2"
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/stacktrace"
+)
+
+const (
+	// TransactionType is the type of transactions created for
+	// inbound WebSocket messages.
+	TransactionType = "websocket"
+
+	messagesReceivedMetric     = "websocket.messages.received"
+	messagesSentMetric         = "websocket.messages.sent"
+	messagesReceivedSizeMetric = "websocket.messages.received.size"
+	messagesSentSizeMetric     = "websocket.messages.sent.size"
+)
+
+// messageSizeBuckets holds the histogram bucket upper bounds,
+// in bytes, used for recording message sizes.
+var messageSizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+func init() {
+	stacktrace.RegisterLibraryPackage("github.com/gorilla/websocket")
+}
+
+// Upgrade upgrades the HTTP server connection to the WebSocket protocol
+// using upgrader, returning a *Conn which traces inbound messages.
+//
+// If req's context holds a transaction, such as one started by
+// apmhttp.Wrap, that transaction is considered the handshake: it is
+// ended as soon as the connection is upgraded, rather than when the
+// handler returns. Each message subsequently read from the connection
+// is traced as a new transaction, linked to the handshake transaction.
+//
+// By default, Upgrade will use apm.DefaultTracer(). Use WithTracer
+// to specify an alternative tracer.
+func Upgrade(
+	upgrader *websocket.Upgrader,
+	w http.ResponseWriter,
+	req *http.Request,
+	responseHeader http.Header,
+	o ...Option,
+) (*Conn, error) {
+	conn, err := upgrader.Upgrade(w, req, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(conn, req, o...), nil
+}
+
+// WrapConn wraps conn, an already-upgraded server connection, such that
+// inbound messages are traced. req must be the request that was upgraded.
+// See Upgrade for details.
+func WrapConn(conn *websocket.Conn, req *http.Request, o ...Option) *Conn {
+	return newConn(conn, req, o...)
+}
+
+func newConn(conn *websocket.Conn, req *http.Request, o ...Option) *Conn {
+	c := &Conn{
+		Conn:   conn,
+		tracer: apm.DefaultTracer(),
+	}
+	for _, o := range o {
+		o(c)
+	}
+
+	route := req.URL.Path
+	if req.Pattern != "" {
+		route = apmhttp.ServeMuxPatternRoute(req.Pattern)
+	}
+	if tx := apm.TransactionFromContext(req.Context()); tx != nil {
+		c.links = []apm.SpanLink{{
+			Trace: tx.TraceContext().Trace,
+			Span:  tx.TraceContext().Span,
+		}}
+		if !tx.Ended() {
+			apmhttp.SetTransactionContext(tx, req, &apmhttp.Response{
+				StatusCode: http.StatusSwitchingProtocols,
+			}, nil)
+		}
+		tx.End()
+	}
+	if c.messageName == "" {
+		c.messageName = "WS " + route
+	}
+
+	registry := c.tracer.MetricsRegistry()
+	c.received = newMessageMetrics(registry, messagesReceivedMetric, messagesReceivedSizeMetric, c.messageName)
+	c.sent = newMessageMetrics(registry, messagesSentMetric, messagesSentSizeMetric, c.messageName)
+	return c
+}
+
+// Conn wraps a *websocket.Conn, tracing each inbound message as a
+// transaction, and recording the number and size of messages received
+// and sent in metrics.
+//
+// The transaction for an inbound message is started by NextReader,
+// ReadMessage, or ReadJSON, and ended when the next message is read or
+// the connection is closed. The transaction can be obtained with the
+// Transaction method, or from the context returned by Context, so that
+// the message's processing can be traced with spans.
+//
+// Messages written with WritePreparedMessage are not recorded.
+type Conn struct {
+	*websocket.Conn
+	tracer      *apm.Tracer
+	messageName string
+	links       []apm.SpanLink
+	received    messageMetrics
+	sent        messageMetrics
+
+	mu sync.Mutex
+	tx *apm.Transaction
+}
+
+// Transaction returns the transaction for the message most recently
+// read from the connection, or nil if there is none.
+func (c *Conn) Transaction() *apm.Transaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tx
+}
+
+// NextReader returns the next data message received from the peer,
+// starting a transaction for the message. The transaction for the
+// previous message, if any, is ended.
+func (c *Conn) NextReader() (messageType int, r io.Reader, err error) {
+	c.endTransaction()
+	messageType, r, err = c.Conn.NextReader()
+	if err != nil {
+		return messageType, r, err
+	}
+	c.startTransaction(messageType)
+	return messageType, &messageReader{
+		Reader:  r,
+		metrics: c.received.with(messageType),
+	}, nil
+}
+
+// ReadMessage is a helper method for getting a reader using NextReader
+// and reading from that reader to a buffer.
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	var r io.Reader
+	messageType, r, err = c.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+	p, err = io.ReadAll(r)
+	return messageType, p, err
+}
+
+// ReadJSON reads the next JSON-encoded message from the connection and
+// stores it in the value pointed to by v.
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, r, err := c.NextReader()
+	if err != nil {
+		return err
+	}
+	err = json.NewDecoder(r).Decode(v)
+	if err == io.EOF {
+		// One value is expected in the message.
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// NextWriter returns a writer for the next message to send. The size
+// of the message is recorded when the writer is closed.
+func (c *Conn) NextWriter(messageType int) (io.WriteCloser, error) {
+	w, err := c.Conn.NextWriter(messageType)
+	if err != nil {
+		return nil, err
+	}
+	return &messageWriter{WriteCloser: w, metrics: c.sent.with(messageType)}, nil
+}
+
+// WriteMessage is a helper method for getting a writer using NextWriter,
+// writing the message and closing the writer.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if err := c.Conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	if m := c.sent.with(messageType); m != nil {
+		m.record(len(data))
+	}
+	return nil
+}
+
+// WriteJSON writes the JSON encoding of v as a message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	w, err := c.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	err1 := json.NewEncoder(w).Encode(v)
+	err2 := w.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// Close closes the underlying network connection, and ends the
+// transaction for the most recently read message, if any.
+func (c *Conn) Close() error {
+	c.endTransaction()
+	return c.Conn.Close()
+}
+
+func (c *Conn) startTransaction(messageType int) {
+	if !c.tracer.Recording() {
+		return
+	}
+	tx := c.tracer.StartTransactionOptions(c.messageName, TransactionType, apm.TransactionOptions{
+		Links: c.links,
+	})
+	if tx.Sampled() {
+		tx.Context.SetLabel("websocket_message_type", messageTypeString(messageType))
+	}
+	c.mu.Lock()
+	c.tx = tx
+	c.mu.Unlock()
+}
+
+func (c *Conn) endTransaction() {
+	c.mu.Lock()
+	tx := c.tx
+	c.tx = nil
+	c.mu.Unlock()
+	if tx != nil {
+		tx.End()
+	}
+}
+
+type messageMetrics struct {
+	text, binary *messageTypeMetrics
+}
+
+func newMessageMetrics(registry *apm.MetricsRegistry, countName, sizeName, transactionName string) messageMetrics {
+	count := registry.Counter(countName)
+	size := registry.Histogram(sizeName, messageSizeBuckets)
+	newMetrics := func(messageType int) *messageTypeMetrics {
+		labels := []apm.MetricLabel{
+			{Name: "transaction_name", Value: transactionName},
+			{Name: "message_type", Value: messageTypeString(messageType)},
+		}
+		return &messageTypeMetrics{
+			count: count.With(labels...),
+			size:  size.With(labels...),
+		}
+	}
+	return messageMetrics{
+		text:   newMetrics(websocket.TextMessage),
+		binary: newMetrics(websocket.BinaryMessage),
+	}
+}
+
+// with returns the metrics for the given message type, or nil if the
+// message type is not a data message type.
+func (m messageMetrics) with(messageType int) *messageTypeMetrics {
+	switch messageType {
+	case websocket.TextMessage:
+		return m.text
+	case websocket.BinaryMessage:
+		return m.binary
+	}
+	return nil
+}
+
+type messageTypeMetrics struct {
+	count *apm.Counter
+	size  *apm.Histogram
+}
+
+func (m *messageTypeMetrics) record(size int) {
+	m.count.Inc()
+	m.size.Record(float64(size))
+}
+
+// messageReader records the size of an inbound message
+// once it has been read in full.
+type messageReader struct {
+	io.Reader
+	metrics  *messageTypeMetrics
+	size     int
+	recorded bool
+}
+
+func (r *messageReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.size += n
+	if err == io.EOF && !r.recorded && r.metrics != nil {
+		r.recorded = true
+		r.metrics.record(r.size)
+	}
+	return n, err
+}
+
+// messageWriter records the size of an outbound message
+// when it is closed.
+type messageWriter struct {
+	io.WriteCloser
+	metrics *messageTypeMetrics
+	size    int
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.size += n
+	return n, err
+}
+
+func (w *messageWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	if w.metrics != nil {
+		w.metrics.record(w.size)
+	}
+	return nil
+}
+
+func messageTypeString(messageType int) string {
+	switch messageType {
+	case websocket.TextMessage:
+		return "text"
+	case websocket.BinaryMessage:
+		return "binary"
+	}
+	return "unknown"
+}
@@ -0,0 +1,199 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgorillawebsocket_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/module/apmgorillawebsocket/v2"
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+	"go.elastic.co/apm/v2/transport/transporttest"
+)
+
+func TestUpgrade(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	done := make(chan struct{})
+	var upgrader websocket.Upgrader
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chat/{room}", func(w http.ResponseWriter, req *http.Request) {
+		defer close(done)
+		conn, err := apmgorillawebsocket.Upgrade(&upgrader, w, req, nil, apmgorillawebsocket.WithTracer(tracer))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			assert.NotNil(t, conn.Transaction())
+			if err := conn.WriteMessage(messageType, p); err != nil {
+				return
+			}
+		}
+	})
+	server := httptest.NewServer(apmhttp.Wrap(mux, apmhttp.WithTracer(tracer)))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/chat/lobby"
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	for _, msg := range []struct {
+		messageType int
+		data        string
+	}{
+		{websocket.TextMessage, "hello"},
+		{websocket.BinaryMessage, "world!"},
+	} {
+		require.NoError(t, client.WriteMessage(msg.messageType, []byte(msg.data)))
+		messageType, p, err := client.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, msg.messageType, messageType)
+		assert.Equal(t, msg.data, string(p))
+	}
+	client.Close()
+	<-done
+
+	tracer.Flush(nil)
+	transactions := transport.Payloads().Transactions
+	require.Len(t, transactions, 3)
+
+	handshake := transactions[0]
+	assert.Equal(t, "GET /chat/lobby", handshake.Name)
+	assert.Equal(t, "request", handshake.Type)
+	assert.Equal(t, "HTTP 1xx", handshake.Result)
+	assert.Equal(t, 101, handshake.Context.Response.StatusCode)
+
+	for i, messageType := range []string{"text", "binary"} {
+		tx := transactions[i+1]
+		assert.Equal(t, "WS /chat/{room}", tx.Name)
+		assert.Equal(t, "websocket", tx.Type)
+		assert.Equal(t, []model.SpanLink{{
+			TraceID: handshake.TraceID,
+			SpanID:  handshake.ID,
+		}}, tx.Links)
+		assert.NotEqual(t, handshake.TraceID, tx.TraceID)
+		assert.Equal(t, model.IfaceMapItem{
+			Key:   "websocket_message_type",
+			Value: messageType,
+		}, tx.Context.Tags[0])
+	}
+
+	tracer.SendMetrics(nil)
+	metrics := make(map[string]model.Metric)
+	for _, m := range transport.Payloads().Metrics {
+		if len(m.Labels) == 0 || m.Labels[0].Key != "message_type" {
+			continue
+		}
+		for name, metric := range m.Samples {
+			metrics[name+" "+m.Labels[0].Value] = metric
+		}
+	}
+	assert.Equal(t, map[string]model.Metric{
+		"websocket.messages.received text":   {Value: 1},
+		"websocket.messages.received binary": {Value: 1},
+		"websocket.messages.sent text":       {Value: 1},
+		"websocket.messages.sent binary":     {Value: 1},
+		"websocket.messages.received.size text": {
+			Type: "histogram", Values: []float64{32}, Counts: []uint64{1},
+		},
+		"websocket.messages.received.size binary": {
+			Type: "histogram", Values: []float64{32}, Counts: []uint64{1},
+		},
+		"websocket.messages.sent.size text": {
+			Type: "histogram", Values: []float64{32}, Counts: []uint64{1},
+		},
+		"websocket.messages.sent.size binary": {
+			Type: "histogram", Values: []float64{32}, Counts: []uint64{1},
+		},
+	}, metrics)
+}
+
+func TestUpgradeNoHandshakeTransaction(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	done := make(chan struct{})
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer close(done)
+		conn, err := apmgorillawebsocket.Upgrade(
+			&upgrader, w, req, nil,
+			apmgorillawebsocket.WithTracer(tracer.Tracer),
+			apmgorillawebsocket.WithMessageTransactionName("chat message"),
+		)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		var v map[string]string
+		assert.NoError(t, conn.ReadJSON(&v))
+		assert.Equal(t, map[string]string{"hello": "world"}, v)
+		assert.NoError(t, conn.WriteJSON(v))
+		conn.ReadMessage() // wait for close
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	require.NoError(t, client.WriteJSON(map[string]string{"hello": "world"}))
+	var v map[string]string
+	require.NoError(t, client.ReadJSON(&v))
+	client.Close()
+	<-done
+
+	tracer.Flush(nil)
+	transactions := tracer.Payloads().Transactions
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "chat message", transactions[0].Name)
+	assert.Empty(t, transactions[0].Links)
+}
+
+func TestUpgradeError(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(apmhttp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, err := apmgorillawebsocket.Upgrade(&upgrader, w, req, nil, apmgorillawebsocket.WithTracer(tracer.Tracer))
+		assert.Error(t, err)
+	}), apmhttp.WithTracer(tracer.Tracer)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	tracer.Flush(nil)
+	transactions := tracer.Payloads().Transactions
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "HTTP 4xx", transactions[0].Result)
+}
@@ -0,0 +1,48 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgorillawebsocket // import "go.elastic.co/apm/module/apmgorillawebsocket/v2"
+
+import (
+	"go.elastic.co/apm/v2"
+)
+
+// Option sets options for tracing WebSocket connections.
+type Option func(*Conn)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing inbound messages.
+func WithTracer(t *apm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(c *Conn) {
+		c.tracer = t
+	}
+}
+
+// WithMessageTransactionName returns an Option which sets the name of
+// transactions created for inbound messages. By default, the name is
+// "WS " followed by the path of the http.ServeMux pattern matched by the
+// upgraded request or, if the request was not routed by http.ServeMux,
+// the request path. When using another router, specify a name which
+// does not include path parameters to avoid high cardinality names.
+func WithMessageTransactionName(name string) Option {
+	return func(c *Conn) {
+		c.messageName = name
+	}
+}
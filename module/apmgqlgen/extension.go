@@ -0,0 +1,172 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgqlgen // import "go.elastic.co/apm/module/apmgqlgen/v2"
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/stacktrace"
+)
+
+const (
+	// ResolverSpanType is the type of spans created for resolvers.
+	ResolverSpanType = "graphql.resolve"
+
+	defaultResolverSpanThreshold = 5 * time.Millisecond
+)
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = (*Extension)(nil)
+
+func init() {
+	stacktrace.RegisterLibraryPackage(
+		"github.com/99designs/gqlgen",
+		"github.com/vektah/gqlparser",
+	)
+}
+
+// Extension is a gqlgen handler extension which names the transaction
+// in the request context after the GraphQL operation, reports resolvers
+// taking longer than a threshold as spans, and reports GraphQL errors.
+//
+// Extension relies on the request context holding a transaction, such
+// as one started by apmhttp.Wrap for the GraphQL endpoint. Operations
+// whose context holds no transaction are not traced.
+type Extension struct {
+	tracer                *apm.Tracer
+	resolverSpanThreshold time.Duration
+}
+
+// NewExtension returns a new Extension, for adding to a gqlgen
+// server with its Use method.
+//
+// By default, resolvers which take 5ms or longer are reported as spans.
+// Use WithResolverSpanThreshold to specify an alternative threshold.
+//
+// By default, errors are reported with apm.DefaultTracer(). Use
+// WithTracer to specify an alternative tracer.
+func NewExtension(o ...Option) *Extension {
+	e := &Extension{
+		tracer:                apm.DefaultTracer(),
+		resolverSpanThreshold: defaultResolverSpanThreshold,
+	}
+	for _, o := range o {
+		o(e)
+	}
+	return e
+}
+
+// ExtensionName returns the name of the extension.
+func (e *Extension) ExtensionName() string {
+	return "ElasticAPM"
+}
+
+// Validate is a no-op; the extension is valid for any schema.
+func (e *Extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse names the transaction in ctx after the operation,
+// and reports any errors in the response.
+func (e *Extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	tx := apm.TransactionFromContext(ctx)
+	if tx == nil || !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+	if op := graphql.GetOperationContext(ctx).Operation; op != nil {
+		operationType := string(op.Operation)
+		tx.Name = OperationTransactionName(operationType, op.Name)
+		if tx.Sampled() {
+			tx.Context.SetLabel("graphql_operation_type", operationType)
+			if op.Name != "" {
+				tx.Context.SetLabel("graphql_operation_name", op.Name)
+			}
+		}
+	}
+	resp := next(ctx)
+	if resp != nil {
+		for _, gqlerr := range resp.Errors {
+			var err error = gqlerr
+			if gqlerr.Err != nil {
+				err = gqlerr.Err
+			}
+			apmErr := e.tracer.NewError(err)
+			apmErr.SetTransaction(tx)
+			apmErr.Handled = true
+			if len(gqlerr.Path) > 0 {
+				path := gqlerr.Path.String()
+				apmErr.Culprit = path
+				apmErr.Context.SetLabel("graphql_path", path)
+			}
+			apmErr.Send()
+		}
+	}
+	return resp
+}
+
+// InterceptField reports a span for resolvers which take at least
+// the configured threshold to complete.
+//
+// Because the duration of the resolver is not known until it completes,
+// the span is created afterwards, and so any spans started by the
+// resolver are not its children.
+func (e *Extension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	tx := apm.TransactionFromContext(ctx)
+	fc := graphql.GetFieldContext(ctx)
+	if tx == nil || !tx.Sampled() || fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+	var parent apm.TraceContext
+	if span := apm.SpanFromContext(ctx); span != nil {
+		parent = span.TraceContext()
+	}
+	start := time.Now()
+	res, err := next(ctx)
+	if duration := time.Since(start); duration >= e.resolverSpanThreshold {
+		span := tx.StartSpanOptions(fc.Object+"."+fc.Field.Name, ResolverSpanType, apm.SpanOptions{
+			Parent: parent,
+			Start:  start,
+		})
+		span.Duration = duration
+		if !span.Dropped() {
+			span.Context.SetLabel("graphql_path", fc.Path().String())
+		}
+		if err != nil {
+			span.Outcome = "failure"
+		}
+		span.End()
+	}
+	return res, err
+}
+
+// OperationTransactionName returns the transaction name for a GraphQL
+// operation with the given type and name, such as "query GetUser".
+// If the operation is anonymous, the name is just the operation type.
+func OperationTransactionName(operationType, operationName string) string {
+	if operationName == "" {
+		return operationType
+	}
+	return operationType + " " + operationName
+}
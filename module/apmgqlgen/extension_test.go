@@ -0,0 +1,186 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgqlgen_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/testserver"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+
+	"go.elastic.co/apm/module/apmgqlgen/v2"
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+)
+
+func newServer(t *testing.T, tracer *apmtest.RecordingTracer, srv *testserver.TestServer) *httptest.Server {
+	srv.AddTransport(transport.POST{})
+	srv.Use(apmgqlgen.NewExtension(apmgqlgen.WithTracer(tracer.Tracer)))
+	server := httptest.NewServer(apmhttp.Wrap(srv, apmhttp.WithTracer(tracer.Tracer)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func doQuery(t *testing.T, server *httptest.Server, body string) {
+	resp, err := http.Post(server.URL+"/query", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestExtensionTransactionName(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	server := newServer(t, tracer, testserver.New())
+
+	doQuery(t, server, `{"query": "query GetName { name }"}`)
+	doQuery(t, server, `{"query": "{ name }"}`)
+	tracer.Flush(nil)
+
+	transactions := tracer.Payloads().Transactions
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "query GetName", transactions[0].Name)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "graphql_operation_name", Value: "GetName"},
+		{Key: "graphql_operation_type", Value: "query"},
+	}, transactions[0].Context.Tags)
+	assert.Equal(t, "query", transactions[1].Name)
+}
+
+func TestExtensionErrors(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	server := newServer(t, tracer, testserver.New())
+
+	doQuery(t, server, `{"query": "{ nonexistent }"}`)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Errors, 1)
+	assert.Contains(t, payloads.Errors[0].Exception.Message, "nonexistent")
+	assert.Equal(t, payloads.Transactions[0].ID, payloads.Errors[0].ParentID)
+}
+
+func TestExtensionResolverErrors(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	server := newServer(t, tracer, testserver.NewError())
+
+	doQuery(t, server, `{"query": "{ name }"}`)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, "resolver error", payloads.Errors[0].Exception.Message)
+	assert.Equal(t, payloads.Transactions[0].ID, payloads.Errors[0].ParentID)
+}
+
+func TestExtensionResolverSpans(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		type Query {
+			fast: String!
+			slow: String!
+		}
+	`})
+	srv := handler.New(&graphql.ExecutableSchemaMock{
+		ExecFunc: func(ctx context.Context) graphql.ResponseHandler {
+			ran := false
+			return func(ctx context.Context) *graphql.Response {
+				if ran {
+					return nil
+				}
+				ran = true
+				// Simulate the field execution of generated code.
+				for _, field := range []string{"fast", "slow"} {
+					fieldCtx := graphql.WithFieldContext(ctx, &graphql.FieldContext{
+						Object:     "Query",
+						IsResolver: true,
+						Field: graphql.CollectedField{
+							Field: &ast.Field{
+								Name:       field,
+								Alias:      field,
+								Definition: schema.Types["Query"].Fields.ForName(field),
+							},
+						},
+					})
+					graphql.GetOperationContext(ctx).ResolverMiddleware(fieldCtx, func(ctx context.Context) (interface{}, error) {
+						if field == "slow" {
+							time.Sleep(10 * time.Millisecond)
+							graphql.AddError(ctx, errors.New("too slow"))
+							return nil, errors.New("too slow")
+						}
+						return "ok", nil
+					})
+				}
+				return &graphql.Response{Data: []byte(`{"fast":"ok","slow":null}`)}
+			}
+		},
+		SchemaFunc: func() *ast.Schema {
+			return schema
+		},
+		ComplexityFunc: func(ctx context.Context, typeName string, fieldName string, childComplexity int, args map[string]interface{}) (int, bool) {
+			return 0, true
+		},
+	})
+	srv.AddTransport(transport.POST{})
+	srv.Use(apmgqlgen.NewExtension(apmgqlgen.WithTracer(tracer.Tracer)))
+	server := httptest.NewServer(apmhttp.Wrap(srv, apmhttp.WithTracer(tracer.Tracer)))
+	defer server.Close()
+
+	doQuery(t, server, `{"query": "query Both { fast slow }"}`)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Spans, 1)
+	span := payloads.Spans[0]
+	assert.Equal(t, "Query.slow", span.Name)
+	assert.Equal(t, "graphql", span.Type)
+	assert.Equal(t, "resolve", span.Subtype)
+	assert.Equal(t, "failure", span.Outcome)
+	assert.Equal(t, payloads.Transactions[0].ID, span.ParentID)
+	assert.GreaterOrEqual(t, span.Duration, 10.0)
+	assert.Equal(t, model.IfaceMap{{Key: "graphql_path", Value: "slow"}}, span.Context.Tags)
+
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, "too slow", payloads.Errors[0].Exception.Message)
+	assert.Equal(t, "slow", payloads.Errors[0].Culprit)
+	assert.Equal(t, model.IfaceMap{{Key: "graphql_path", Value: "slow"}}, payloads.Errors[0].Context.Tags)
+}
+
+func TestOperationTransactionName(t *testing.T) {
+	assert.Equal(t, "mutation SetName", apmgqlgen.OperationTransactionName("mutation", "SetName"))
+	assert.Equal(t, "query", apmgqlgen.OperationTransactionName("query", ""))
+}
@@ -0,0 +1,54 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgraphqlgo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryOperationType(t *testing.T) {
+	for _, test := range []struct {
+		query         string
+		operationName string
+		expected      string
+	}{
+		{query: "{ hello }", expected: "query"},
+		{query: "query { hello }", expected: "query"},
+		{query: "mutation M($name: String!) { setName(name: $name) }", expected: "mutation"},
+		{query: "mutation @audit { setName(name: \"x\") }", expected: "mutation"},
+		{query: "subscription($a: Int = 1) { events }", expected: "subscription"},
+		{query: "fragment F on Mutation { setName } mutation { ...F }", expected: "mutation"},
+		{query: "# mutation\nquery { hello }", expected: "query"},
+		{query: "query A { hello } mutation B { setName }", operationName: "B", expected: "mutation"},
+		{query: "query A { hello } mutation B { setName }", operationName: "C", expected: "query"},
+		{query: "mutation A { setName } query Aa { hello }", operationName: "Aa", expected: "query"},
+		{query: "query query { hello } mutation mutation { setName }", operationName: "mutation", expected: "mutation"},
+
+		// Keywords and comment markers within strings and selection sets are ignored.
+		{query: "{ search(text: \"} mutation B {\") }", expected: "query"},
+		{query: "query A { search(text: \"# x\") } mutation B { setName }", operationName: "B", expected: "mutation"},
+		{query: "query A { search(text: \"\\\" mutation B {\") } mutation B { setName }", operationName: "B", expected: "mutation"},
+		{query: "query A { search(text: \"\"\"\nmutation B { \\\"\"\" }\n\"\"\") } mutation B { x }", operationName: "B", expected: "mutation"},
+		{query: "query A { mutation { x } subscription }", expected: "query"},
+		{query: "", expected: "query"},
+	} {
+		assert.Equal(t, test.expected, queryOperationType(test.query, test.operationName), test.query)
+	}
+}
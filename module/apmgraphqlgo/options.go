@@ -0,0 +1,47 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgraphqlgo // import "go.elastic.co/apm/module/apmgraphqlgo/v2"
+
+import (
+	"time"
+
+	"go.elastic.co/apm/v2"
+)
+
+// Option sets options for tracing GraphQL queries.
+type Option func(*Tracer)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for reporting errors.
+func WithTracer(t *apm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(tracer *Tracer) {
+		tracer.tracer = t
+	}
+}
+
+// WithResolverSpanThreshold returns an Option which sets the minimum
+// duration of resolvers reported as spans. If d is zero, all non-trivial
+// resolvers are reported.
+func WithResolverSpanThreshold(d time.Duration) Option {
+	return func(t *Tracer) {
+		t.resolverSpanThreshold = d
+	}
+}
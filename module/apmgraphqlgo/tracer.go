@@ -0,0 +1,325 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgraphqlgo // import "go.elastic.co/apm/module/apmgraphqlgo/v2"
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/graph-gophers/graphql-go/trace/tracer"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/stacktrace"
+)
+
+const (
+	// ResolverSpanType is the type of spans created for resolvers.
+	ResolverSpanType = "graphql.resolve"
+
+	defaultResolverSpanThreshold = 5 * time.Millisecond
+)
+
+var (
+	_ tracer.Tracer           = (*Tracer)(nil)
+	_ tracer.ValidationTracer = (*Tracer)(nil)
+)
+
+func init() {
+	stacktrace.RegisterLibraryPackage("github.com/graph-gophers/graphql-go")
+}
+
+// Tracer is a graphql-go tracer which names the transaction in the
+// query's context after the GraphQL operation, reports resolvers taking
+// longer than a threshold as spans, and reports GraphQL errors.
+//
+// Tracer relies on the query's context holding a transaction, such as
+// one started by apmhttp.Wrap for the GraphQL endpoint. Queries whose
+// context holds no transaction are not traced.
+type Tracer struct {
+	tracer                *apm.Tracer
+	resolverSpanThreshold time.Duration
+}
+
+// NewTracer returns a new Tracer, for passing to graphql.Tracer
+// when parsing the schema.
+//
+// By default, resolvers which take 5ms or longer are reported as spans.
+// Use WithResolverSpanThreshold to specify an alternative threshold.
+//
+// By default, errors are reported with apm.DefaultTracer(). Use
+// WithTracer to specify an alternative tracer.
+func NewTracer(o ...Option) *Tracer {
+	t := &Tracer{
+		tracer:                apm.DefaultTracer(),
+		resolverSpanThreshold: defaultResolverSpanThreshold,
+	}
+	for _, o := range o {
+		o(t)
+	}
+	return t
+}
+
+// TraceQuery names the transaction in ctx after the operation, and
+// reports any errors resulting from its execution.
+func (t *Tracer) TraceQuery(
+	ctx context.Context,
+	queryString, operationName string,
+	variables map[string]interface{},
+	varTypes map[string]*introspection.Type,
+) (context.Context, tracer.QueryFinishFunc) {
+	tx := apm.TransactionFromContext(ctx)
+	if tx == nil {
+		return ctx, func([]*errors.QueryError) {}
+	}
+	operationType := queryOperationType(queryString, operationName)
+	tx.Name = OperationTransactionName(operationType, operationName)
+	if tx.Sampled() {
+		tx.Context.SetLabel("graphql_operation_type", operationType)
+		if operationName != "" {
+			tx.Context.SetLabel("graphql_operation_name", operationName)
+		}
+	}
+	return ctx, func(errs []*errors.QueryError) {
+		t.reportErrors(ctx, errs)
+	}
+}
+
+// TraceField reports a span for non-trivial resolvers which take
+// at least the configured threshold to complete.
+//
+// Because the duration of the resolver is not known until it completes,
+// the span is created afterwards, and so any spans started by the
+// resolver are not its children.
+func (t *Tracer) TraceField(
+	ctx context.Context,
+	label, typeName, fieldName string,
+	trivial bool,
+	args map[string]interface{},
+) (context.Context, tracer.FieldFinishFunc) {
+	tx := apm.TransactionFromContext(ctx)
+	if trivial || tx == nil || !tx.Sampled() {
+		return ctx, func(*errors.QueryError) {}
+	}
+	var parent apm.TraceContext
+	if span := apm.SpanFromContext(ctx); span != nil {
+		parent = span.TraceContext()
+	}
+	start := time.Now()
+	return ctx, func(err *errors.QueryError) {
+		duration := time.Since(start)
+		if duration < t.resolverSpanThreshold {
+			return
+		}
+		span := tx.StartSpanOptions(typeName+"."+fieldName, ResolverSpanType, apm.SpanOptions{
+			Parent: parent,
+			Start:  start,
+		})
+		span.Duration = duration
+		if err != nil {
+			span.Outcome = "failure"
+		}
+		span.End()
+	}
+}
+
+// TraceValidation reports any errors resulting from
+// validation of the query.
+func (t *Tracer) TraceValidation(ctx context.Context) tracer.ValidationFinishFunc {
+	return func(errs []*errors.QueryError) {
+		t.reportErrors(ctx, errs)
+	}
+}
+
+func (t *Tracer) reportErrors(ctx context.Context, errs []*errors.QueryError) {
+	if len(errs) == 0 {
+		return
+	}
+	tx := apm.TransactionFromContext(ctx)
+	if tx == nil {
+		return
+	}
+	for _, qerr := range errs {
+		var err error = qerr
+		if qerr.ResolverError != nil {
+			err = qerr.ResolverError
+		} else if qerr.Err != nil {
+			err = qerr.Err
+		}
+		e := t.tracer.NewError(err)
+		e.SetTransaction(tx)
+		e.Handled = true
+		if path := errorPath(qerr.Path); path != "" {
+			e.Culprit = path
+			e.Context.SetLabel("graphql_path", path)
+		}
+		e.Send()
+	}
+}
+
+// OperationTransactionName returns the transaction name for a GraphQL
+// operation with the given type and name, such as "query GetUser".
+// If the operation is anonymous, the name is just the operation type.
+func OperationTransactionName(operationType, operationName string) string {
+	if operationName == "" {
+		return operationType
+	}
+	return operationType + " " + operationName
+}
+
+// queryOperationType returns the type of the operation with the given
+// name in the query document, or of the document's first operation if
+// name is empty or not found. If no operation is found, or the operation
+// is written in the shorthand form, "query" is returned.
+//
+// The document is scanned for top-level definitions, skipping comments,
+// strings, and nested selection sets and arguments.
+func queryOperationType(query, operationName string) string {
+	var firstType string
+	var depth int
+	var headerType string // type of the operation whose header is being scanned
+	var inHeader bool     // scanning an operation or fragment header
+	var expectName bool   // the previous token was an operation type
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '#':
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+			continue
+		case c == '"':
+			i = skipString(query, i)
+			continue
+		case c == '(' || c == '[':
+			depth++
+			expectName = false
+		case c == ')' || c == ']' || c == '}':
+			if depth > 0 {
+				depth--
+			}
+		case c == '{':
+			if depth == 0 {
+				operationType := headerType
+				if !inHeader {
+					// Shorthand query.
+					operationType = "query"
+				}
+				if operationType != "" {
+					if operationName == "" {
+						return operationType
+					}
+					if firstType == "" {
+						firstType = operationType
+					}
+				}
+				headerType, inHeader, expectName = "", false, false
+			}
+			depth++
+		case isNameStart(c):
+			start := i
+			for i < len(query) && isNameContinue(query[i]) {
+				i++
+			}
+			if depth != 0 {
+				continue
+			}
+			name := query[start:i]
+			if expectName {
+				expectName = false
+				if operationName != "" && name == operationName {
+					return headerType
+				}
+				continue
+			}
+			if !inHeader {
+				switch name {
+				case "query", "mutation", "subscription":
+					headerType, inHeader, expectName = name, true, true
+				case "fragment":
+					inHeader = true
+				}
+			}
+			continue
+		default:
+			if expectName && c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+				// Anonymous operation with variables or directives.
+				expectName = false
+			}
+		}
+		i++
+	}
+	if firstType != "" {
+		return firstType
+	}
+	return "query"
+}
+
+// skipString returns the index following the string
+// or block string starting at query[i].
+func skipString(query string, i int) int {
+	if strings.HasPrefix(query[i:], `"""`) {
+		for i += 3; i < len(query); i++ {
+			switch {
+			case strings.HasPrefix(query[i:], `\"""`):
+				i += 3
+			case strings.HasPrefix(query[i:], `"""`):
+				return i + 3
+			}
+		}
+		return i
+	}
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case '"', '\n', '\r':
+			return i + 1
+		}
+	}
+	return i
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
+
+// errorPath returns the response path of a GraphQL error,
+// formatted like "user.friends[0].name".
+func errorPath(path []interface{}) string {
+	var sb strings.Builder
+	for _, elem := range path {
+		switch elem := elem.(type) {
+		case int:
+			fmt.Fprintf(&sb, "[%d]", elem)
+		default:
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+			fmt.Fprint(&sb, elem)
+		}
+	}
+	return sb.String()
+}
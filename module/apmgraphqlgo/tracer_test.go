@@ -0,0 +1,180 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgraphqlgo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/module/apmgraphqlgo/v2"
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+)
+
+const schema = `
+type Query {
+	hello: String!
+	slow: String!
+	broken: String
+	user: User!
+}
+
+type Mutation {
+	setName(name: String!): String!
+}
+
+type User {
+	name: String!
+	email: String
+}
+`
+
+type resolver struct{}
+
+func (*resolver) Hello() string { return "world" }
+
+func (*resolver) Slow(ctx context.Context) string {
+	time.Sleep(10 * time.Millisecond)
+	return "done"
+}
+
+func (*resolver) Broken() (*string, error) { return nil, errors.New("kaboom") }
+
+func (*resolver) User() *userResolver { return &userResolver{} }
+
+func (*resolver) SetName(args struct{ Name string }) string { return args.Name }
+
+type userResolver struct{}
+
+func (*userResolver) Name() string { return "Tom" }
+
+func (*userResolver) Email(ctx context.Context) (*string, error) {
+	return nil, errors.New("no email")
+}
+
+func newServer(t *testing.T, tracer *apmtest.RecordingTracer, o ...apmgraphqlgo.Option) *httptest.Server {
+	o = append([]apmgraphqlgo.Option{apmgraphqlgo.WithTracer(tracer.Tracer)}, o...)
+	s := graphql.MustParseSchema(schema, &resolver{}, graphql.Tracer(apmgraphqlgo.NewTracer(o...)))
+	handler := apmhttp.Wrap(&relay.Handler{Schema: s}, apmhttp.WithTracer(tracer.Tracer))
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func doQuery(t *testing.T, server *httptest.Server, body string) {
+	resp, err := http.Post(server.URL+"/query", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestTracerTransactionName(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	server := newServer(t, tracer)
+
+	doQuery(t, server, `{"query": "query GetHello { hello }"}`)
+	doQuery(t, server, `{"query": "{ hello }"}`)
+	doQuery(t, server, `{"query": "# mutation\nquery A { hello } mutation B { setName(name: \"x\") }", "operationName": "B"}`)
+	tracer.Flush(nil)
+
+	transactions := tracer.Payloads().Transactions
+	require.Len(t, transactions, 3)
+	assert.Equal(t, "query GetHello", transactions[0].Name)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "graphql_operation_name", Value: "GetHello"},
+		{Key: "graphql_operation_type", Value: "query"},
+	}, transactions[0].Context.Tags)
+	assert.Equal(t, "query", transactions[1].Name)
+	assert.Equal(t, "mutation B", transactions[2].Name)
+}
+
+func TestTracerResolverSpans(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	server := newServer(t, tracer)
+
+	doQuery(t, server, `{"query": "{ hello slow }"}`)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Spans, 1)
+	span := payloads.Spans[0]
+	assert.Equal(t, "Query.slow", span.Name)
+	assert.Equal(t, "graphql", span.Type)
+	assert.Equal(t, "resolve", span.Subtype)
+	assert.Equal(t, payloads.Transactions[0].ID, span.ParentID)
+	assert.GreaterOrEqual(t, span.Duration, 10.0)
+}
+
+func TestTracerResolverSpansThreshold(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	server := newServer(t, tracer, apmgraphqlgo.WithResolverSpanThreshold(0))
+
+	doQuery(t, server, `{"query": "{ hello slow user { name email } }"}`)
+	tracer.Flush(nil)
+
+	// Trivial field resolvers, which take no context or arguments,
+	// return no error, and have no non-trivial fields selected,
+	// are never reported.
+	var names []string
+	for _, span := range tracer.Payloads().Spans {
+		names = append(names, span.Name)
+	}
+	assert.ElementsMatch(t, []string{"Query.slow", "Query.user", "User.email"}, names)
+}
+
+func TestTracerErrors(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	server := newServer(t, tracer)
+
+	doQuery(t, server, `{"query": "{ broken user { email } }"}`)
+	doQuery(t, server, `{"query": "{ nonexistent }"}`)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	require.Len(t, payloads.Errors, 3)
+
+	errorsByCulprit := make(map[string]model.Error)
+	for _, e := range payloads.Errors {
+		errorsByCulprit[e.Culprit] = e
+	}
+	broken := errorsByCulprit["broken"]
+	assert.Equal(t, "kaboom", broken.Exception.Message)
+	assert.Equal(t, payloads.Transactions[0].ID, broken.ParentID)
+	assert.Equal(t, model.IfaceMap{{Key: "graphql_path", Value: "broken"}}, broken.Context.Tags)
+	assert.Equal(t, "no email", errorsByCulprit["user.email"].Exception.Message)
+
+	validation := errorsByCulprit[""]
+	assert.Contains(t, validation.Exception.Message, "nonexistent")
+	assert.Equal(t, payloads.Transactions[1].ID, validation.ParentID)
+}
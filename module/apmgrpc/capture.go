@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgrpc // import "go.elastic.co/apm/module/apmgrpc/v2"
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+)
+
+const (
+	// maxCapturedMessageSize is the maximum encoded size of a
+	// message that will be marshalled to JSON for capturing.
+	// Larger messages are not captured at all, to avoid the
+	// cost of marshalling them only to be truncated.
+	maxCapturedMessageSize = 64 * 1024
+
+	// requestBodyKey and responseBodyKey are the keys with which
+	// messages are recorded in client span labels and, for
+	// responseBodyKey, the server transaction's custom context.
+	requestBodyKey  = "grpc_request_body"
+	responseBodyKey = "grpc_response_body"
+
+	redacted = "[REDACTED]"
+)
+
+// marshalMessage returns the JSON encoding of m if it is a protobuf
+// message no larger than maxCapturedMessageSize; otherwise it returns
+// the empty string.
+func marshalMessage(m interface{}) string {
+	msg, ok := m.(proto.Message)
+	if !ok || proto.Size(msg) > maxCapturedMessageSize {
+		return ""
+	}
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// setSpanMetadataLabels records md as labels on span, with the given
+// label key prefix. Values of keys matching the configured sanitized
+// field names are redacted, and binary metadata and the trace context
+// fields of propagator are ignored.
+func setSpanMetadataLabels(
+	span *apm.Span,
+	tx *apm.Transaction,
+	propagator apmhttp.Propagator,
+	prefix string,
+	md metadata.MD,
+) {
+	for k, values := range md {
+		if strings.HasSuffix(k, "-bin") || isPropagatorField(propagator, k) {
+			continue
+		}
+		value := strings.Join(values, ", ")
+		if tx.IsSanitizedFieldName(k) {
+			value = redacted
+		}
+		span.Context.SetLabel(prefix+k, value)
+	}
+}
+
+// isPropagatorField reports whether k, a lower-case metadata key,
+// is one of the fields used by propagator.
+func isPropagatorField(propagator apmhttp.Propagator, k string) bool {
+	for _, field := range propagator.Fields() {
+		if strings.EqualFold(field, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -40,10 +41,17 @@ import (
 // The interceptor will trace spans with the "external.grpc" type for each
 // request made, for any client method presented with a context containing
 // a sampled apm.Transaction.
+//
+// If the transaction is configured to capture headers, the request and
+// response metadata are recorded as span labels prefixed with
+// "grpc_request_metadata_" and "grpc_response_metadata_". If it is
+// configured to capture the body, the request and response messages are
+// recorded in their protobuf JSON encoding as the "grpc_request_body" and
+// "grpc_response_body" span labels, which are truncated.
 func NewUnaryClientInterceptor(o ...ClientOption) grpc.UnaryClientInterceptor {
-	opts := clientOptions{}
+	clientOpts := clientOptions{}
 	for _, o := range o {
-		o(&opts)
+		o(&clientOpts)
 	}
 	return func(
 		ctx context.Context,
@@ -55,7 +63,8 @@ func NewUnaryClientInterceptor(o ...ClientOption) grpc.UnaryClientInterceptor {
 	) error {
 		var peer peer.Peer     // maybe set after call if span != nil
 		var header metadata.MD // maybe set after call if span != nil
-		span, ctx := startSpan(ctx, method)
+		requestMetadata, _ := metadata.FromOutgoingContext(ctx)
+		span, ctx := startSpan(ctx, method, clientOpts.propagator)
 		if span != nil {
 			defer span.End()
 			opts = append(opts, grpc.Peer(&peer), grpc.Header(&header))
@@ -86,6 +95,11 @@ func NewUnaryClientInterceptor(o ...ClientOption) grpc.UnaryClientInterceptor {
 			span.Context.SetServiceTarget(apm.ServiceTargetSpanContext{
 				Name: url.Host,
 			})
+			setSpanMetadata(ctx, span, clientOpts, requestMetadata, header)
+			if err != nil {
+				resp = nil
+			}
+			setSpanMessages(ctx, span, req, resp)
 		}
 		return err
 	}
@@ -101,10 +115,18 @@ func NewUnaryClientInterceptor(o ...ClientOption) grpc.UnaryClientInterceptor {
 // Spans are ended when the stream is closed, which can happen in various
 // ways: the initial stream setup request fails, Header, SendMsg or RecvMsg
 // return with an error, or RecvMsg returns for a non-streaming server.
+//
+// Request metadata is recorded as for NewUnaryClientInterceptor, but
+// stream messages are not captured.
+//
+// The number of messages sent and received on the stream are recorded as
+// the span labels "grpc_stream_messages_sent" and
+// "grpc_stream_messages_received". Use WithClientStreamMessageSpans to
+// additionally report a child span for each message.
 func NewStreamClientInterceptor(o ...ClientOption) grpc.StreamClientInterceptor {
-	opts := clientOptions{}
+	clientOpts := clientOptions{}
 	for _, o := range o {
-		o(&opts)
+		o(&clientOpts)
 	}
 	return func(
 		ctx context.Context,
@@ -115,9 +137,14 @@ func NewStreamClientInterceptor(o ...ClientOption) grpc.StreamClientInterceptor
 		opts ...grpc.CallOption,
 	) (grpc.ClientStream, error) {
 		var peer peer.Peer
-		span, ctx := startSpan(ctx, method)
+		requestMetadata, _ := metadata.FromOutgoingContext(ctx)
+		span, ctx := startSpan(ctx, method, clientOpts.propagator)
 		if span != nil {
 			opts = append(opts, grpc.Peer(&peer))
+			// Only the request metadata is captured for streams,
+			// as the response metadata may not be available until
+			// after the transaction has ended.
+			setSpanMetadata(ctx, span, clientOpts, requestMetadata, nil)
 		}
 		stream, err := streamer(ctx, desc, cc, method, opts...)
 		if span != nil {
@@ -126,7 +153,10 @@ func NewStreamClientInterceptor(o ...ClientOption) grpc.StreamClientInterceptor
 				setSpanContext(span, peer)
 				span.End()
 			} else if stream != nil {
-				wrapped := &clientStream{ClientStream: stream}
+				wrapped := &clientStream{ClientStream: stream, method: method}
+				if clientOpts.streamMessageSpans && !span.Dropped() {
+					wrapped.spanContext = ctx
+				}
 				go func(stream grpc.ClientStream) {
 					defer span.End()
 					// Header blocks until headers are available
@@ -137,6 +167,10 @@ func NewStreamClientInterceptor(o ...ClientOption) grpc.StreamClientInterceptor
 					err := wrapped.getError()
 					setSpanOutcome(span, err)
 					setSpanContext(span, peer)
+					if !span.Dropped() {
+						span.Context.SetLabel(messagesSentLabel, wrapped.counts.sent.Load())
+						span.Context.SetLabel(messagesReceivedLabel, wrapped.counts.received.Load())
+					}
 				}(stream)
 				stream = wrapped
 			}
@@ -145,9 +179,17 @@ func NewStreamClientInterceptor(o ...ClientOption) grpc.StreamClientInterceptor
 	}
 }
 
-// clientStream wraps grpc.ClientStream to intercept errors.
+// clientStream wraps grpc.ClientStream to intercept errors,
+// and to trace the messages sent and received.
 type clientStream struct {
 	grpc.ClientStream
+	method string
+	counts streamMessageCounts
+
+	// spanContext holds the context containing the stream's span,
+	// if spans should be reported for each message.
+	spanContext context.Context
+
 	mu  sync.RWMutex
 	err error
 }
@@ -165,14 +207,24 @@ func (s *clientStream) Header() (metadata.MD, error) {
 }
 
 func (s *clientStream) SendMsg(m interface{}) error {
+	start := time.Now()
 	err := s.ClientStream.SendMsg(m)
 	s.setError(err)
+	s.counts.recordSend(err)
+	if s.spanContext != nil {
+		reportMessageSpan(s.spanContext, s.method+" SendMsg", "external.grpc.send", start, m, err)
+	}
 	return err
 }
 
 func (s *clientStream) RecvMsg(m interface{}) error {
+	start := time.Now()
 	err := s.ClientStream.RecvMsg(m)
 	s.setError(err)
+	s.counts.recordRecv(err)
+	if s.spanContext != nil {
+		reportMessageSpan(s.spanContext, s.method+" RecvMsg", "external.grpc.receive", start, m, err)
+	}
 	return err
 }
 
@@ -190,22 +242,62 @@ func (s *clientStream) setError(err error) {
 	}
 }
 
-func startSpan(ctx context.Context, name string) (*apm.Span, context.Context) {
+func startSpan(ctx context.Context, name string, propagator apmhttp.Propagator) (*apm.Span, context.Context) {
 	tx := apm.TransactionFromContext(ctx)
 	if tx == nil {
 		return nil, ctx
 	}
+	if propagator == nil {
+		propagator = apmhttp.DefaultPropagator()
+	}
 	traceContext := tx.TraceContext()
-	propagateLegacyHeader := tx.ShouldPropagateLegacyHeader()
+	injectOptions := apmhttp.InjectOptions{PropagateLegacyHeader: tx.ShouldPropagateLegacyHeader()}
 	if !traceContext.Options.Recorded() {
-		return nil, outgoingContextWithTraceContext(ctx, traceContext, propagateLegacyHeader)
+		return nil, outgoingContextWithTraceContext(ctx, traceContext, propagator, injectOptions)
 	}
 	span := tx.StartExitSpan(name, "external.grpc", apm.SpanFromContext(ctx))
 	if !span.Dropped() {
 		traceContext = span.TraceContext()
 		ctx = apm.ContextWithSpan(ctx, span)
 	}
-	return span, outgoingContextWithTraceContext(ctx, traceContext, propagateLegacyHeader)
+	return span, outgoingContextWithTraceContext(ctx, traceContext, propagator, injectOptions)
+}
+
+// setSpanMetadata records the request and response metadata as labels
+// on span, if the transaction in ctx is configured to capture headers.
+func setSpanMetadata(
+	ctx context.Context,
+	span *apm.Span,
+	opts clientOptions,
+	requestMetadata, responseMetadata metadata.MD,
+) {
+	if span.Dropped() {
+		return
+	}
+	tx := apm.TransactionFromContext(ctx)
+	if !tx.ShouldCaptureHeaders() {
+		return
+	}
+	propagator := opts.propagator
+	if propagator == nil {
+		propagator = apmhttp.DefaultPropagator()
+	}
+	setSpanMetadataLabels(span, tx, propagator, "grpc_request_metadata_", requestMetadata)
+	setSpanMetadataLabels(span, tx, propagator, "grpc_response_metadata_", responseMetadata)
+}
+
+// setSpanMessages records the request and response messages as labels
+// on span, if the transaction in ctx is configured to capture the body.
+func setSpanMessages(ctx context.Context, span *apm.Span, req, resp interface{}) {
+	if span.Dropped() || !apm.TransactionFromContext(ctx).ShouldCaptureBody() {
+		return
+	}
+	if body := marshalMessage(req); body != "" {
+		span.Context.SetLabel(requestBodyKey, body)
+	}
+	if body := marshalMessage(resp); body != "" {
+		span.Context.SetLabel(responseBodyKey, body)
+	}
 }
 
 func setSpanContext(span *apm.Span, peer peer.Peer) {
@@ -224,22 +316,16 @@ func setSpanContext(span *apm.Span, peer peer.Peer) {
 func outgoingContextWithTraceContext(
 	ctx context.Context,
 	traceContext apm.TraceContext,
-	propagateLegacyHeader bool,
+	propagator apmhttp.Propagator,
+	injectOptions apmhttp.InjectOptions,
 ) context.Context {
-	traceparentValue := apmhttp.FormatTraceparentHeader(traceContext)
 	md, ok := metadata.FromOutgoingContext(ctx)
 	if !ok {
-		md = metadata.Pairs(w3cTraceparentHeader, traceparentValue)
+		md = metadata.MD{}
 	} else {
 		md = md.Copy()
-		md.Set(w3cTraceparentHeader, traceparentValue)
-	}
-	if propagateLegacyHeader {
-		md.Set(elasticTraceparentHeader, traceparentValue)
-	}
-	if tracestate := traceContext.State.String(); tracestate != "" {
-		md.Set(tracestateHeader, tracestate)
 	}
+	propagator.Inject(metadataCarrier(md), traceContext, injectOptions)
 	return metadata.NewOutgoingContext(ctx, md)
 }
 
@@ -259,8 +345,38 @@ func setSpanOutcome(span *apm.Span, err error) {
 }
 
 type clientOptions struct {
-	tracer *apm.Tracer
+	tracer             *apm.Tracer
+	streamMessageSpans bool
+	propagator         apmhttp.Propagator
 }
 
 // ClientOption sets options for client-side tracing.
 type ClientOption func(*clientOptions)
+
+// WithClientStreamMessageSpans returns a ClientOption which enables
+// reporting a span for each message sent or received on a client stream,
+// as a child of the stream's span.
+//
+// The spans are named after the method, with the suffix " SendMsg" or
+// " RecvMsg", and have the types "external.grpc.send" and
+// "external.grpc.receive" respectively. Each span measures the duration
+// of the SendMsg or RecvMsg call, and records the size of the encoded
+// message as the label "grpc_message_size". Note that for RecvMsg this
+// includes the time spent waiting for the server to send the message.
+func WithClientStreamMessageSpans() ClientOption {
+	return func(o *clientOptions) {
+		o.streamMessageSpans = true
+	}
+}
+
+// WithClientPropagator returns a ClientOption which sets p as the
+// propagator to use for injecting trace context into outgoing metadata.
+// By default, the propagator returned by apmhttp.DefaultPropagator is used.
+func WithClientPropagator(p apmhttp.Propagator) ClientOption {
+	if p == nil {
+		panic("p == nil")
+	}
+	return func(o *clientOptions) {
+		o.propagator = p
+	}
+}
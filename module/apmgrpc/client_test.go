@@ -31,9 +31,11 @@ import (
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
 	pb "google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/testing/protocmp"
 
+	"go.elastic.co/apm/module/apmgrpc/v2"
 	"go.elastic.co/apm/module/apmgrpc/v2/internal/testservice"
 	"go.elastic.co/apm/module/apmhttp/v2"
 	"go.elastic.co/apm/v2"
@@ -113,6 +115,10 @@ func testClientSpan(t *testing.T, traceparentHeaders ...string) {
 				Name: tcpAddr.String(),
 			},
 		},
+		Tags: model.IfaceMap{{
+			Key:   "grpc_response_metadata_content-type",
+			Value: "application/grpc",
+		}},
 	}, clientSpans[0].Context)
 
 	serverTracer.Flush(nil)
@@ -147,6 +153,88 @@ func testClientSpan(t *testing.T, traceparentHeaders ...string) {
 	assert.Equal(t, expectedCustom, serverTransactions[1].Context.Custom)
 }
 
+func TestClientSpanCaptureContext(t *testing.T) {
+	s, _, addr := newGreeterServer(t, apmtest.DiscardTracer)
+	defer s.GracefulStop()
+
+	conn, client := newGreeterClient(t, addr, apmgrpc.WithClientPropagator(
+		apmhttp.CompositePropagator{apmhttp.W3CPropagator{}, apmhttp.B3Propagator{}},
+	))
+	defer conn.Close()
+
+	clientTracer := apmtest.NewRecordingTracer()
+	defer clientTracer.Close()
+	clientTracer.SetCaptureBody(apm.CaptureBodyAll)
+
+	_, spans, _ := clientTracer.WithTransaction(func(ctx context.Context) {
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			"authorization", "secret",
+			"x-custom", "a", "x-custom", "b",
+			"x-b3-traceid", "0af7651916cd43dd8448eb211c80319c",
+			"uber-trace-id", "0af7651916cd43dd8448eb211c80319c:b7ad6b7169203331:0:1",
+		)
+		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "birita"})
+		require.NoError(t, err)
+	})
+	require.Len(t, spans, 1)
+
+	labels := make(map[string]interface{})
+	for _, item := range spans[0].Context.Tags {
+		labels[item.Key] = item.Value
+	}
+	assert.Equal(t, "[REDACTED]", labels["grpc_request_metadata_authorization"])
+	assert.Equal(t, "a, b", labels["grpc_request_metadata_x-custom"])
+	assert.Equal(t, "application/grpc", labels["grpc_response_metadata_content-type"])
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c:b7ad6b7169203331:0:1", labels["grpc_request_metadata_uber-trace-id"])
+	assert.JSONEq(t, `{"name":"birita"}`, labels["grpc_request_body"].(string))
+	assert.JSONEq(t, `{"message":"hello, birita"}`, labels["grpc_response_body"].(string))
+	for key := range labels {
+		assert.NotContains(t, key, "traceparent")
+		assert.NotContains(t, key, "x-b3")
+	}
+}
+
+func TestClientSpanCaptureHeadersDisabled(t *testing.T) {
+	s, _, addr := newGreeterServer(t, apmtest.DiscardTracer)
+	defer s.GracefulStop()
+
+	conn, client := newGreeterClient(t, addr)
+	defer conn.Close()
+
+	clientTracer := apmtest.NewRecordingTracer()
+	defer clientTracer.Close()
+	clientTracer.SetCaptureHeaders(false)
+
+	_, spans, _ := clientTracer.WithTransaction(func(ctx context.Context) {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-custom", "a")
+		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "birita"})
+		require.NoError(t, err)
+	})
+	require.Len(t, spans, 1)
+	assert.Empty(t, spans[0].Context.Tags)
+}
+
+func TestClientSpanCaptureBodyDisabled(t *testing.T) {
+	s, _, addr := newGreeterServer(t, apmtest.DiscardTracer)
+	defer s.GracefulStop()
+
+	conn, client := newGreeterClient(t, addr)
+	defer conn.Close()
+
+	clientTracer := apmtest.NewRecordingTracer()
+	defer clientTracer.Close()
+	clientTracer.SetCaptureBody(apm.CaptureBodyOff)
+
+	_, spans, _ := clientTracer.WithTransaction(func(ctx context.Context) {
+		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "birita"})
+		require.NoError(t, err)
+	})
+	require.Len(t, spans, 1)
+	for _, item := range spans[0].Context.Tags {
+		assert.NotContains(t, item.Key, "body")
+	}
+}
+
 func TestClientSpanDropped(t *testing.T) {
 	serverTracer := apmtest.NewRecordingTracer()
 	defer serverTracer.Close()
@@ -290,3 +378,95 @@ func TestStreamClientSpan(t *testing.T) {
 	assert.Equal(t, clientPayloads.Spans[0].ID, serverPayloads.Transactions[0].ParentID)
 	assert.Equal(t, clientPayloads.Spans[0].TraceID, serverPayloads.Transactions[0].TraceID)
 }
+
+func TestStreamClientMessageSpans(t *testing.T) {
+	clientTracer, clientTransport := transporttest.NewRecorderTracer()
+	defer clientTracer.Close()
+
+	s, _, addr := newAccumulatorServer(t, apmtest.DiscardTracer)
+	defer s.GracefulStop()
+
+	conn, client := newAccumulatorClient(t, addr, apmgrpc.WithClientStreamMessageSpans())
+	defer conn.Close()
+
+	clientTransaction := clientTracer.StartTransaction("name", "type")
+	ctx := apm.ContextWithTransaction(context.Background(), clientTransaction)
+
+	stream, err := client.Accumulate(ctx)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		err = stream.Send(&testservice.AccumulateRequest{Value: 123})
+		require.NoError(t, err)
+		_, err := stream.Recv()
+		require.NoError(t, err)
+	}
+	err = stream.CloseSend()
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	// The stream span is ended asynchronously,
+	// after the message spans have been ended.
+	var spans []model.Span
+	require.Eventually(t, func() bool {
+		clientTracer.Flush(nil)
+		spans = clientTransport.Payloads().Spans
+		return len(spans) == 5
+	}, 10*time.Second, 100*time.Millisecond)
+	clientTransaction.End()
+
+	streamSpan := spans[4]
+	assert.Equal(t, "/go.elastic.co.apm.module.apmgrpc.testservice.Accumulator/Accumulate", streamSpan.Name)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "grpc_stream_messages_received", Value: float64(2)},
+		{Key: "grpc_stream_messages_sent", Value: float64(2)},
+	}, streamSpan.Context.Tags)
+
+	for i, span := range spans[:4] {
+		assert.Equal(t, streamSpan.ID, span.ParentID)
+		assert.Equal(t, "external", span.Type)
+		assert.Equal(t, "grpc", span.Subtype)
+		assert.Nil(t, span.Context.Destination)
+		if i%2 == 0 {
+			assert.Equal(t, "/go.elastic.co.apm.module.apmgrpc.testservice.Accumulator/Accumulate SendMsg", span.Name)
+			assert.Equal(t, "send", span.Action)
+		} else {
+			assert.Equal(t, "/go.elastic.co.apm.module.apmgrpc.testservice.Accumulator/Accumulate RecvMsg", span.Name)
+			assert.Equal(t, "receive", span.Action)
+		}
+	}
+}
+
+func TestClientServerPropagator(t *testing.T) {
+	clientTracer, clientTransport := transporttest.NewRecorderTracer()
+	defer clientTracer.Close()
+	clientTracer.SetSampler(apm.NewRatioSampler(0))
+
+	serverTracer, serverTransport := transporttest.NewRecorderTracer()
+	defer serverTracer.Close()
+	s, _, addr := newAccumulatorServer(t, serverTracer, apmgrpc.WithServerPropagator(apmhttp.B3Propagator{}))
+	defer s.GracefulStop()
+
+	conn, client := newAccumulatorClient(t, addr, apmgrpc.WithClientPropagator(apmhttp.B3Propagator{SingleHeader: true}))
+	defer conn.Close()
+
+	clientTransaction := clientTracer.StartTransaction("name", "type")
+	ctx := apm.ContextWithTransaction(context.Background(), clientTransaction)
+	stream, err := client.Accumulate(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+	clientTransaction.End()
+
+	clientTracer.Flush(nil)
+	clientTransactions := clientTransport.Payloads().Transactions
+	require.Len(t, clientTransactions, 1)
+
+	serverTracer.Flush(nil)
+	serverTransactions := serverTransport.Payloads().Transactions
+	require.Len(t, serverTransactions, 1)
+	assert.Equal(t, clientTransactions[0].TraceID, serverTransactions[0].TraceID)
+	assert.Equal(t, clientTransactions[0].ID, serverTransactions[0].ParentID)
+	assert.False(t, *serverTransactions[0].Sampled)
+}
@@ -0,0 +1,34 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgrpc // import "go.elastic.co/apm/module/apmgrpc/v2"
+
+import (
+	"google.golang.org/grpc/metadata"
+)
+
+// metadataCarrier is an apmhttp.Carrier for gRPC metadata,
+// whose keys are lower-cased.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) []string {
+	return metadata.MD(c).Get(key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
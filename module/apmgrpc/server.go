@@ -23,6 +23,8 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -70,7 +72,7 @@ func NewUnaryServerInterceptor(o ...ServerOption) grpc.UnaryServerInterceptor {
 		if !opts.tracer.Recording() || opts.requestIgnorer(info) {
 			return handler(ctx, req)
 		}
-		tx, ctx := startTransaction(ctx, opts.tracer, info.FullMethod)
+		tx, ctx := startTransaction(ctx, opts.tracer, opts.propagator, info.FullMethod)
 		defer tx.End()
 
 		// TODO(axw) define span context schema for RPC,
@@ -93,7 +95,16 @@ func NewUnaryServerInterceptor(o ...ServerOption) grpc.UnaryServerInterceptor {
 			setTransactionResult(tx, err)
 		}()
 
+		captureBody := tx.ShouldCaptureBody()
+		if captureBody {
+			tx.Context.SetRequestBody(marshalMessage(req))
+		}
 		resp, err = handler(ctx, req)
+		if captureBody && err == nil {
+			if body := marshalMessage(resp); body != "" {
+				tx.Context.SetCustom(responseBodyKey, body)
+			}
+		}
 		return resp, err
 	}
 }
@@ -108,6 +119,13 @@ func NewUnaryServerInterceptor(o ...ServerOption) grpc.UnaryServerInterceptor {
 // By default, the interceptor will trace with apm.DefaultTracer(), and will
 // not recover any panics. Use WithTracer to specify an alternative tracer,
 // and WithRecovery to enable panic recovery.
+//
+// The number of messages sent and received on the stream are recorded as
+// the transaction labels "grpc_stream_messages_sent" and
+// "grpc_stream_messages_received". Use WithServerStreamMessageSpans to
+// additionally report a span for each message, and
+// WithServerStreamMessageTransactions to report a transaction for each
+// received message instead of one for the entire stream.
 func NewStreamServerInterceptor(o ...ServerOption) grpc.StreamServerInterceptor {
 	opts := serverOptions{
 		tracer:        apm.DefaultTracer(),
@@ -127,21 +145,32 @@ func NewStreamServerInterceptor(o ...ServerOption) grpc.StreamServerInterceptor
 		if !opts.tracer.Recording() || opts.streamIgnorer(info) {
 			return handler(srv, stream)
 		}
-		ctx := stream.Context()
-		tx, ctx := startTransaction(ctx, opts.tracer, info.FullMethod)
-		defer tx.End()
-
 		wrapped := wrapServerStream(stream)
-		wrapped.wrappedContext = ctx
+		wrapped.method = info.FullMethod
+		wrapped.messageSpans = opts.streamMessageSpans
+
+		var tx *apm.Transaction
+		if opts.streamMessageTransactions {
+			wrapped.tracer = opts.tracer
+			wrapped.propagator = opts.propagator
+		} else {
+			tx, wrapped.wrappedContext = startTransaction(stream.Context(), opts.tracer, opts.propagator, info.FullMethod)
+			defer tx.End()
+		}
 
 		// TODO(axw) define span context schema for RPC,
 		// including at least the peer address.
 
 		defer func() {
+			if wrapped.tracer != nil {
+				tx = wrapped.messageTransaction()
+			}
 			r := recover()
 			if r != nil {
 				e := opts.tracer.Recovered(r)
-				e.SetTransaction(tx)
+				if tx != nil {
+					e.SetTransaction(tx)
+				}
 				e.Context.SetFramework("grpc", grpc.Version)
 				e.Handled = opts.recover
 				e.Send()
@@ -151,21 +180,31 @@ func NewStreamServerInterceptor(o ...ServerOption) grpc.StreamServerInterceptor
 					panic(r)
 				}
 			}
+			if wrapped.tracer != nil {
+				wrapped.endMessageTransaction(err)
+				return
+			}
+			tx.Context.SetLabel(messagesSentLabel, wrapped.counts.sent.Load())
+			tx.Context.SetLabel(messagesReceivedLabel, wrapped.counts.received.Load())
 			setTransactionResult(tx, err)
 		}()
 		return handler(srv, wrapped)
 	}
 }
 
-func startTransaction(ctx context.Context, tracer *apm.Tracer, name string) (*apm.Transaction, context.Context) {
+func startTransaction(
+	ctx context.Context,
+	tracer *apm.Tracer,
+	propagator apmhttp.Propagator,
+	name string,
+) (*apm.Transaction, context.Context) {
 	var opts apm.TransactionOptions
 	md, ok := metadata.FromIncomingContext(ctx)
 	if ok {
-		traceContext, ok := getIncomingMetadataTraceContext(md, w3cTraceparentHeader)
-		if !ok {
-			traceContext, _ = getIncomingMetadataTraceContext(md, elasticTraceparentHeader)
+		if propagator == nil {
+			propagator = apmhttp.DefaultPropagator()
 		}
-		opts.TraceContext = traceContext
+		opts.TraceContext, _ = propagator.Extract(metadataCarrier(md))
 	}
 	tx := tracer.StartTransactionOptions(name, "request", opts)
 	tx.Context.SetFramework("grpc", grpc.Version)
@@ -201,17 +240,6 @@ func startTransaction(ctx context.Context, tracer *apm.Tracer, name string) (*ap
 	return tx, apm.ContextWithTransaction(ctx, tx)
 }
 
-func getIncomingMetadataTraceContext(md metadata.MD, header string) (apm.TraceContext, bool) {
-	if values := md.Get(header); len(values) == 1 {
-		traceContext, err := apmhttp.ParseTraceparentHeader(values[0])
-		if err == nil {
-			traceContext.State, _ = apmhttp.ParseTracestateHeader(md.Get(tracestateHeader)...)
-			return traceContext, true
-		}
-	}
-	return apm.TraceContext{}, false
-}
-
 func setTransactionResult(tx *apm.Transaction, err error) {
 	statusCode := statusCodeFromError(err)
 	tx.Result = statusCode.String()
@@ -247,10 +275,13 @@ func statusCodeFromError(err error) codes.Code {
 }
 
 type serverOptions struct {
-	tracer         *apm.Tracer
-	recover        bool
-	requestIgnorer RequestIgnorerFunc
-	streamIgnorer  StreamIgnorerFunc
+	tracer                    *apm.Tracer
+	recover                   bool
+	requestIgnorer            RequestIgnorerFunc
+	streamIgnorer             StreamIgnorerFunc
+	streamMessageSpans        bool
+	streamMessageTransactions bool
+	propagator                apmhttp.Propagator
 }
 
 // ServerOption sets options for server-side tracing.
@@ -312,18 +343,154 @@ func WithServerStreamIgnorer(s StreamIgnorerFunc) ServerOption {
 	}
 }
 
-// wrappedServerStream is a thin wrapper around grpc.ServerStream that allows modifying context.
+// WithServerStreamMessageSpans returns a ServerOption which enables
+// reporting a span for each message sent or received on a server stream.
+//
+// The spans are named after the method, with the suffix " SendMsg" or
+// " RecvMsg", and have the types "app.grpc.send" and "app.grpc.receive"
+// respectively. Each span measures the duration of the SendMsg or RecvMsg
+// call, and records the size of the encoded message as the label
+// "grpc_message_size". Note that for RecvMsg this includes the time spent
+// waiting for the client to send the message.
+//
+// When WithServerStreamMessageTransactions is also used, spans are only
+// reported for sent messages.
+func WithServerStreamMessageSpans() ServerOption {
+	return func(o *serverOptions) {
+		o.streamMessageSpans = true
+	}
+}
+
+// WithServerStreamMessageTransactions returns a ServerOption which causes
+// the stream server interceptor to report a transaction for each message
+// received on a stream, rather than one transaction for the entire stream.
+// This is useful for long-lived streams, whose transactions would otherwise
+// not be reported until the stream ends.
+//
+// A message's transaction starts when RecvMsg returns the message, and ends
+// when RecvMsg is next called, or when the stream handler returns. While the
+// transaction is active, it is available in the context returned by the
+// stream's Context method. The encoded size of the message is recorded as
+// the transaction label "grpc_message_size".
+func WithServerStreamMessageTransactions() ServerOption {
+	return func(o *serverOptions) {
+		o.streamMessageTransactions = true
+	}
+}
+
+// WithServerPropagator returns a ServerOption which sets p as the
+// propagator to use for extracting trace context from incoming metadata.
+// By default, the propagator returned by apmhttp.DefaultPropagator is used.
+func WithServerPropagator(p apmhttp.Propagator) ServerOption {
+	if p == nil {
+		panic("p == nil")
+	}
+	return func(o *serverOptions) {
+		o.propagator = p
+	}
+}
+
+// wrappedServerStream is a thin wrapper around grpc.ServerStream that allows
+// modifying context, and traces the messages sent and received.
 type wrappedServerStream struct {
 	grpc.ServerStream
-	// wrappedContext is the wrapper's own Context. You can assign it.
+
+	// method is the full name of the stream's method.
+	method string
+
+	// messageSpans records whether spans should be
+	// reported for each message sent and received.
+	messageSpans bool
+
+	// counts records the number of messages sent and received.
+	counts streamMessageCounts
+
+	// tracer is non-nil if a transaction should be
+	// reported for each message received, and propagator
+	// is used for extracting the transactions' trace context.
+	tracer     *apm.Tracer
+	propagator apmhttp.Propagator
+
+	mu sync.RWMutex
+	// wrappedContext is the wrapper's own Context. You can assign it
+	// before the stream is passed to the handler; afterwards, it must
+	// only be modified with mu held.
 	wrappedContext context.Context
+	// messageTx holds the transaction for the most recently received
+	// message, if the tracer is non-nil.
+	messageTx *apm.Transaction
 }
 
 // Context returns the wrapper's WrappedContext, overwriting the nested grpc.ServerStream.Context()
 func (w *wrappedServerStream) Context() context.Context {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 	return w.wrappedContext
 }
 
+// SendMsg sends m, counting the message and reporting
+// a span for it if message spans are enabled.
+func (w *wrappedServerStream) SendMsg(m interface{}) error {
+	start := time.Now()
+	err := w.ServerStream.SendMsg(m)
+	w.counts.recordSend(err)
+	if w.messageSpans {
+		reportMessageSpan(w.Context(), w.method+" SendMsg", "app.grpc.send", start, m, err)
+	}
+	return err
+}
+
+// RecvMsg receives a message into m, counting the message and either
+// starting a transaction for it, or reporting a span for it, depending
+// on the configuration.
+func (w *wrappedServerStream) RecvMsg(m interface{}) error {
+	if w.tracer != nil {
+		w.endMessageTransaction(nil)
+	}
+	start := time.Now()
+	err := w.ServerStream.RecvMsg(m)
+	w.counts.recordRecv(err)
+	if w.tracer != nil {
+		if err == nil {
+			w.startMessageTransaction(m)
+		}
+	} else if w.messageSpans {
+		reportMessageSpan(w.Context(), w.method+" RecvMsg", "app.grpc.receive", start, m, err)
+	}
+	return err
+}
+
+func (w *wrappedServerStream) startMessageTransaction(m interface{}) {
+	tx, ctx := startTransaction(w.ServerStream.Context(), w.tracer, w.propagator, w.method)
+	if size, ok := messageSize(m); ok {
+		tx.Context.SetLabel(messageSizeLabel, size)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messageTx = tx
+	w.wrappedContext = ctx
+}
+
+func (w *wrappedServerStream) messageTransaction() *apm.Transaction {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.messageTx
+}
+
+// endMessageTransaction ends the transaction for the most recently
+// received message, if any, setting its result according to err.
+func (w *wrappedServerStream) endMessageTransaction(err error) {
+	w.mu.Lock()
+	tx := w.messageTx
+	w.messageTx = nil
+	w.wrappedContext = w.ServerStream.Context()
+	w.mu.Unlock()
+	if tx != nil {
+		setTransactionResult(tx, err)
+		tx.End()
+	}
+}
+
 // wrapServerStream returns a ServerStream that has the ability to overwrite context.
 func wrapServerStream(stream grpc.ServerStream) *wrappedServerStream {
 	return &wrappedServerStream{ServerStream: stream, wrappedContext: stream.Context()}
@@ -258,6 +258,60 @@ func TestServerIgnorer(t *testing.T) {
 	assert.Empty(t, transport.Payloads())
 }
 
+func TestServerCaptureBody(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureBody(apm.CaptureBodyAll)
+
+	s, _, addr := newGreeterServer(t, tracer)
+	defer s.GracefulStop()
+
+	conn, client := newGreeterClient(t, addr)
+	defer conn.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "secret")
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "birita"})
+	require.NoError(t, err)
+
+	tracer.Flush(nil)
+	transactions := transport.Payloads().Transactions
+	require.Len(t, transactions, 1)
+	request := transactions[0].Context.Request
+	require.NotNil(t, request.Body)
+	assert.JSONEq(t, `{"name":"birita"}`, request.Body.Raw)
+	assert.Contains(t, request.Headers, model.Header{Key: "authorization", Values: []string{"[REDACTED]"}})
+
+	var responseBody string
+	for _, item := range transactions[0].Context.Custom {
+		if item.Key == "grpc_response_body" {
+			responseBody, _ = item.Value.(string)
+		}
+	}
+	assert.JSONEq(t, `{"message":"hello, birita"}`, responseBody)
+}
+
+func TestServerCaptureBodyDisabled(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureHeaders(false)
+
+	s, _, addr := newGreeterServer(t, tracer)
+	defer s.GracefulStop()
+
+	conn, client := newGreeterClient(t, addr)
+	defer conn.Close()
+
+	_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "birita"})
+	require.NoError(t, err)
+
+	tracer.Flush(nil)
+	transactions := transport.Payloads().Transactions
+	require.Len(t, transactions, 1)
+	assert.Nil(t, transactions[0].Context.Request.Body)
+	assert.Empty(t, transactions[0].Context.Request.Headers)
+	assert.Empty(t, transactions[0].Context.Custom)
+}
+
 func TestServerStream(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -300,6 +354,96 @@ func TestServerStream(t *testing.T) {
 	require.Equal(t, expectedTraceID, actualTraceID)
 }
 
+func TestServerStreamMessageSpans(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	s, _, addr := newAccumulatorServer(t, tracer, apmgrpc.WithServerStreamMessageSpans())
+	defer s.GracefulStop()
+
+	conn, client := newAccumulatorClient(t, addr)
+	defer conn.Close()
+	accumulate(t, client, 3)
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "grpc_stream_messages_received", Value: float64(3)},
+		{Key: "grpc_stream_messages_sent", Value: float64(3)},
+	}, payloads.Transactions[0].Context.Tags)
+
+	// The final RecvMsg call, which returns io.EOF,
+	// is not reported as a span.
+	require.Len(t, payloads.Spans, 6)
+	for i, span := range payloads.Spans {
+		assert.Equal(t, payloads.Transactions[0].ID, span.ParentID)
+		assert.Equal(t, "app", span.Type)
+		assert.Equal(t, "grpc", span.Subtype)
+		assert.Equal(t, "success", span.Outcome)
+		require.Len(t, span.Context.Tags, 1)
+		assert.Equal(t, "grpc_message_size", span.Context.Tags[0].Key)
+		if i%2 == 0 {
+			assert.Equal(t, "/go.elastic.co.apm.module.apmgrpc.testservice.Accumulator/Accumulate RecvMsg", span.Name)
+			assert.Equal(t, "receive", span.Action)
+		} else {
+			assert.Equal(t, "/go.elastic.co.apm.module.apmgrpc.testservice.Accumulator/Accumulate SendMsg", span.Name)
+			assert.Equal(t, "send", span.Action)
+		}
+	}
+}
+
+func TestServerStreamMessageTransactions(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	s, _, addr := newAccumulatorServer(t, tracer,
+		apmgrpc.WithServerStreamMessageTransactions(),
+		apmgrpc.WithServerStreamMessageSpans(),
+	)
+	defer s.GracefulStop()
+
+	conn, client := newAccumulatorClient(t, addr)
+	defer conn.Close()
+	accumulate(t, client, 3)
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 3)
+	require.Len(t, payloads.Spans, 3)
+	for i, tx := range payloads.Transactions {
+		assert.Equal(t, "/go.elastic.co.apm.module.apmgrpc.testservice.Accumulator/Accumulate", tx.Name)
+		assert.Equal(t, "request", tx.Type)
+		assert.Equal(t, "OK", tx.Result)
+		assert.Equal(t, model.IfaceMap{{Key: "grpc_message_size", Value: float64(2)}}, tx.Context.Tags)
+
+		// Only sent messages are reported as spans,
+		// as children of the received message's transaction.
+		span := payloads.Spans[i]
+		assert.Equal(t, tx.ID, span.ParentID)
+		assert.Equal(t, "/go.elastic.co.apm.module.apmgrpc.testservice.Accumulator/Accumulate SendMsg", span.Name)
+	}
+}
+
+// accumulate sends n values on an Accumulate stream, receiving
+// a reply for each one, and then closes the stream.
+func accumulate(t *testing.T, client testservice.AccumulatorClient, n int) {
+	accumulator, err := client.Accumulate(context.Background())
+	require.NoError(t, err)
+	for i := 1; i <= n; i++ {
+		err = accumulator.Send(&testservice.AccumulateRequest{Value: int64(i)})
+		require.NoError(t, err)
+		_, err := accumulator.Recv()
+		require.NoError(t, err)
+	}
+	err = accumulator.CloseSend()
+	require.NoError(t, err)
+
+	// Wait for the server to close, ending its transaction.
+	_, err = accumulator.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
 func TestServerTLS(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -380,10 +524,10 @@ func newGreeterServerTLS(t *testing.T, tracer *apm.Tracer, tlsConfig *tls.Config
 	return s, server, lis.Addr()
 }
 
-func newGreeterClient(t *testing.T, addr net.Addr) (*grpc.ClientConn, pb.GreeterClient) {
+func newGreeterClient(t *testing.T, addr net.Addr, opts ...apmgrpc.ClientOption) (*grpc.ClientConn, pb.GreeterClient) {
 	conn, err := grpc.Dial(
 		addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(apmgrpc.NewUnaryClientInterceptor()),
+		grpc.WithUnaryInterceptor(apmgrpc.NewUnaryClientInterceptor(opts...)),
 		grpc.WithUserAgent("apmgrpc_test"),
 	)
 	require.NoError(t, err)
@@ -424,10 +568,10 @@ func newAccumulatorServer(t *testing.T, tracer *apm.Tracer, opts ...apmgrpc.Serv
 	return s, accumulator, lis.Addr()
 }
 
-func newAccumulatorClient(t *testing.T, addr net.Addr) (*grpc.ClientConn, testservice.AccumulatorClient) {
+func newAccumulatorClient(t *testing.T, addr net.Addr, opts ...apmgrpc.ClientOption) (*grpc.ClientConn, testservice.AccumulatorClient) {
 	conn, err := grpc.Dial(
 		addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithStreamInterceptor(apmgrpc.NewStreamClientInterceptor()),
+		grpc.WithStreamInterceptor(apmgrpc.NewStreamClientInterceptor(opts...)),
 	)
 	require.NoError(t, err)
 	return conn, testservice.NewAccumulatorClient(conn)
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgrpc // import "go.elastic.co/apm/module/apmgrpc/v2"
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"go.elastic.co/apm/v2"
+)
+
+const (
+	messagesSentLabel     = "grpc_stream_messages_sent"
+	messagesReceivedLabel = "grpc_stream_messages_received"
+	messageSizeLabel      = "grpc_message_size"
+)
+
+// streamMessageCounts records the number of messages
+// successfully sent and received on a stream.
+type streamMessageCounts struct {
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func (c *streamMessageCounts) recordSend(err error) {
+	if err == nil {
+		c.sent.Add(1)
+	}
+}
+
+func (c *streamMessageCounts) recordRecv(err error) {
+	if err == nil {
+		c.received.Add(1)
+	}
+}
+
+// reportMessageSpan reports a span for a stream message sent or received
+// in the call started at the given time, as a child of the transaction or
+// span in ctx. Spans are not reported for RecvMsg calls which return io.EOF,
+// as they do not represent a message.
+func reportMessageSpan(ctx context.Context, name, spanType string, start time.Time, m interface{}, err error) {
+	if err == io.EOF {
+		return
+	}
+	span, _ := apm.StartSpanOptions(ctx, name, spanType, apm.SpanOptions{Start: start})
+	defer span.End()
+	if span.Dropped() {
+		return
+	}
+	if err != nil {
+		span.Outcome = "failure"
+		return
+	}
+	span.Outcome = "success"
+	if size, ok := messageSize(m); ok {
+		span.Context.SetLabel(messageSizeLabel, size)
+	}
+}
+
+// messageSize returns the encoded size of m, if it is a protobuf message.
+func messageSize(m interface{}) (int, bool) {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return 0, false
+	}
+	return proto.Size(msg), true
+}
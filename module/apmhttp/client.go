@@ -73,6 +73,9 @@ type roundTripper struct {
 	requestIgnorer RequestIgnorerFunc
 	traceRequests  bool
 	spanType       string
+	recordTimings  bool
+	clientTimings  *ClientTimings
+	propagator     Propagator
 }
 
 // RoundTrip delegates to r.r, emitting a span if req's context
@@ -96,11 +99,25 @@ func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 	req = &reqCopy
 
-	propagateLegacyHeader := tx.ShouldPropagateLegacyHeader()
+	var timings *requestTimings
+	if r.recordTimings {
+		ctx, timings = withRequestTimings(ctx)
+		req = RequestWithContext(ctx, req)
+	}
+
+	propagator := r.propagator
+	if propagator == nil {
+		propagator = DefaultPropagator()
+	}
+	injectOptions := InjectOptions{PropagateLegacyHeader: tx.ShouldPropagateLegacyHeader()}
 	traceContext := tx.TraceContext()
 	if !traceContext.Options.Recorded() {
-		SetHeaders(req, traceContext, propagateLegacyHeader)
-		return r.r.RoundTrip(req)
+		propagator.Inject(HeaderCarrier(req.Header), traceContext, injectOptions)
+		resp, err := r.r.RoundTrip(req)
+		if timings != nil {
+			timings.finish(nil, r.clientTimings, req.URL.Host)
+		}
+		return resp, err
 	}
 
 	name := r.requestName(req)
@@ -119,8 +136,11 @@ func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		span = nil
 	}
 
-	SetHeaders(req, traceContext, propagateLegacyHeader)
+	propagator.Inject(HeaderCarrier(req.Header), traceContext, injectOptions)
 	resp, err := r.r.RoundTrip(req)
+	if timings != nil {
+		timings.finish(span, r.clientTimings, req.URL.Host)
+	}
 	if span != nil {
 		if err != nil {
 			if rt != nil {
@@ -136,15 +156,13 @@ func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 // SetHeaders sets traceparent and tracestate headers on an http request.
+//
+// SetHeaders always uses W3CPropagator. To inject trace context using
+// another propagator, call its Inject method with HeaderCarrier(req.Header).
 func SetHeaders(req *http.Request, traceContext apm.TraceContext, propagateLegacyHeader bool) {
-	headerValue := FormatTraceparentHeader(traceContext)
-	if propagateLegacyHeader {
-		req.Header[ElasticTraceparentHeader] = []string{headerValue}
-	}
-	req.Header[W3CTraceparentHeader] = []string{headerValue}
-	if tracestate := traceContext.State.String(); tracestate != "" {
-		req.Header[TracestateHeader] = []string{tracestate}
-	}
+	W3CPropagator{}.Inject(HeaderCarrier(req.Header), traceContext, InjectOptions{
+		PropagateLegacyHeader: propagateLegacyHeader,
+	})
 }
 
 // CloseIdleConnections calls r.r.CloseIdleConnections if the method exists.
@@ -214,6 +232,18 @@ func WithClientRequestName(r RequestNameFunc) ClientOption {
 	})
 }
 
+// WithClientPropagator returns a ClientOption which sets p as the
+// propagator to use for injecting trace context into client requests.
+// By default, the propagator returned by DefaultPropagator is used.
+func WithClientPropagator(p Propagator) ClientOption {
+	if p == nil {
+		panic("p == nil")
+	}
+	return ClientOption(func(rt *roundTripper) {
+		rt.propagator = p
+	})
+}
+
 // WithClientSpanType sets the span type for HTTP client requests.
 //
 // Defaults to "external.http".
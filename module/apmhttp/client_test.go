@@ -335,6 +335,77 @@ func TestWithClientTrace(t *testing.T) {
 	assert.Equal(t, "Response", spans[2].Name)
 }
 
+func TestWithClientTimings(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	timings := apmhttp.NewClientTimings()
+	tracer.RegisterMetricsGatherer(timings)
+
+	client := apmhttp.WrapClient(server.Client(), apmhttp.WithClientTimings(timings))
+	tx := tracer.StartTransaction("name", "type")
+	ctx := apm.ContextWithTransaction(context.Background(), tx)
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	tx.End()
+	tracer.Flush(nil)
+
+	spans := tracer.Payloads().Spans
+	require.Len(t, spans, 2)
+	labelKeys := func(span model.Span) []string {
+		var keys []string
+		for _, label := range span.Context.Tags {
+			keys = append(keys, label.Key)
+		}
+		return keys
+	}
+	// The first request establishes a connection,
+	// which is reused by the second request.
+	assert.Equal(t, []string{
+		"http_connect_duration_us",
+		"http_first_byte_duration_us",
+		"http_tls_duration_us",
+	}, labelKeys(spans[0]))
+	assert.Equal(t, []string{"http_first_byte_duration_us"}, labelKeys(spans[1]))
+
+	tracer.SendMetrics(nil)
+	var samples map[string]model.Metric
+	for _, m := range tracer.Payloads().Metrics {
+		if len(m.Labels) == 1 && m.Labels[0].Key == "host" {
+			assert.Equal(t, serverURL.Host, m.Labels[0].Value)
+			samples = m.Samples
+		}
+	}
+	require.Len(t, samples, 3)
+	for _, name := range []string{
+		"http.client.connect.duration.us",
+		"http.client.tls.duration.us",
+		"http.client.first_byte.duration.us",
+	} {
+		require.Contains(t, samples, name)
+		assert.Equal(t, "histogram", samples[name].Type)
+		var total uint64
+		for _, count := range samples[name].Counts {
+			total += count
+		}
+		if name == "http.client.first_byte.duration.us" {
+			assert.Equal(t, uint64(2), total)
+		} else {
+			assert.Equal(t, uint64(1), total)
+		}
+	}
+}
+
 func TestClientOutcome(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.Handle("/2xx", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -0,0 +1,210 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp // import "go.elastic.co/apm/module/apmhttp/v2"
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.elastic.co/apm/v2"
+)
+
+const (
+	clientTimingsDNS       = "http.client.dns.duration.us"
+	clientTimingsConnect   = "http.client.connect.duration.us"
+	clientTimingsTLS       = "http.client.tls.duration.us"
+	clientTimingsFirstByte = "http.client.first_byte.duration.us"
+)
+
+// clientTimingsBuckets holds the upper bounds of the histogram
+// buckets used by ClientTimings, in microseconds.
+var clientTimingsBuckets = []float64{
+	100, 250, 500,
+	1e3, 2.5e3, 5e3,
+	10e3, 25e3, 50e3,
+	100e3, 250e3, 500e3,
+	1e6, 2.5e6, 5e6, 10e6,
+}
+
+// WithClientTimings returns a ClientOption for recording connection-level
+// timings of HTTP client requests: DNS lookup, connection establishment,
+// TLS handshake, and the time waiting for the first response byte after
+// the request has been written.
+//
+// Unlike WithClientTrace, no additional spans are created. Instead, the
+// timings are recorded as labels on the request's span:
+// "http_dns_duration_us", "http_connect_duration_us",
+// "http_tls_duration_us", and "http_first_byte_duration_us".
+// Timings for phases which did not occur, for example due to connection
+// reuse, are omitted.
+//
+// If t is non-nil, the timings will additionally be aggregated into
+// histogram metrics per destination host. The ClientTimings must be
+// registered with the tracer for these metrics to be reported.
+func WithClientTimings(t *ClientTimings) ClientOption {
+	return func(rt *roundTripper) {
+		rt.recordTimings = true
+		rt.clientTimings = t
+	}
+}
+
+// ClientTimings aggregates connection-level timings of HTTP client requests
+// into histogram metrics, labeled by destination host. ClientTimings
+// implements apm.MetricsGatherer, and should be registered with a tracer
+// using Tracer.RegisterMetricsGatherer:
+//
+//	timings := apmhttp.NewClientTimings()
+//	apm.DefaultTracer().RegisterMetricsGatherer(timings)
+//	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientTimings(timings))
+//
+// Histograms are reset each time metrics are gathered. At most 1000
+// destination hosts are recorded in each metrics interval.
+type ClientTimings struct {
+	// mu is held for reading while recording timings,
+	// and for writing while replacing registry.
+	mu       sync.RWMutex
+	registry *apm.MetricsRegistry
+}
+
+// NewClientTimings returns a new ClientTimings.
+func NewClientTimings() *ClientTimings {
+	return &ClientTimings{registry: apm.NewMetricsRegistry()}
+}
+
+// GatherMetrics gathers the aggregated client timing histograms into m.
+func (t *ClientTimings) GatherMetrics(ctx context.Context, m *apm.Metrics) error {
+	// Replace the registry so the histograms, and the
+	// limit on the number of hosts, are reset.
+	t.mu.Lock()
+	registry := t.registry
+	t.registry = apm.NewMetricsRegistry()
+	t.mu.Unlock()
+	return registry.GatherMetrics(ctx, m)
+}
+
+func (t *ClientTimings) record(host string, r *requestTimings) {
+	labels := []apm.MetricLabel{{Name: "host", Value: host}}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	t.recordHistogram(clientTimingsDNS, labels, r.dns)
+	t.recordHistogram(clientTimingsConnect, labels, r.connect)
+	t.recordHistogram(clientTimingsTLS, labels, r.tls)
+	t.recordHistogram(clientTimingsFirstByte, labels, r.firstByte)
+}
+
+func (t *ClientTimings) recordHistogram(name string, labels []apm.MetricLabel, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	us := float64(d) / float64(time.Microsecond)
+	t.registry.Histogram(name, clientTimingsBuckets).With(labels...).Record(us)
+}
+
+// requestTimings records the connection-level timings of a single request.
+type requestTimings struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+
+	dns, connect, tls, firstByte time.Duration
+}
+
+func withRequestTimings(ctx context.Context) (context.Context, *requestTimings) {
+	var r requestTimings
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if !r.dnsStart.IsZero() {
+				r.dns = time.Since(r.dnsStart)
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			// Multiple connection attempts may be made in parallel,
+			// e.g. for dual-stack hosts. Measure from the first.
+			if r.connectStart.IsZero() {
+				r.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err == nil && r.connect == 0 && !r.connectStart.IsZero() {
+				r.connect = time.Since(r.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err == nil && !r.tlsStart.IsZero() {
+				r.tls = time.Since(r.tlsStart)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if !r.wroteRequest.IsZero() {
+				r.firstByte = time.Since(r.wroteRequest)
+			}
+		},
+	}), &r
+}
+
+// finish records the request timings as labels on span, if non-nil,
+// and aggregates them into t, if non-nil.
+func (r *requestTimings) finish(span *apm.Span, t *ClientTimings, host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if span != nil {
+		setTimingLabel(span, "http_dns_duration_us", r.dns)
+		setTimingLabel(span, "http_connect_duration_us", r.connect)
+		setTimingLabel(span, "http_tls_duration_us", r.tls)
+		setTimingLabel(span, "http_first_byte_duration_us", r.firstByte)
+	}
+	if t != nil {
+		t.record(host, r)
+	}
+}
+
+func setTimingLabel(span *apm.Span, key string, d time.Duration) {
+	if d > 0 {
+		span.Context.SetLabel(key, d.Microseconds())
+	}
+}
@@ -28,6 +28,11 @@ import (
 // Wrap returns an http.Handler wrapping h, reporting each request as
 // a transaction to Elastic APM.
 //
+// By default, transactions are named after the request URL path. If h is
+// an http.ServeMux, or a handler which calls one, the transaction will be
+// renamed after the matched pattern once h returns. To name transactions
+// after the matched pattern from the start, use WrapMux.
+//
 // By default, the returned Handler will use apm.DefaultTracer().
 // Use WithTracer to specify an alternative tracer.
 //
@@ -39,13 +44,30 @@ func Wrap(h http.Handler, o ...ServerOption) http.Handler {
 		panic("h == nil")
 	}
 	handler := &handler{
-		handler:     h,
-		tracer:      apm.DefaultTracer(),
-		requestName: ServerRequestName,
+		handler: h,
+		tracer:  apm.DefaultTracer(),
 	}
 	for _, o := range o {
 		o(handler)
 	}
+	if handler.requestName == nil {
+		tracer := handler.tracer
+		if mux := handler.mux; mux != nil {
+			handler.requestName = func(req *http.Request) string {
+				_, pattern := mux.Handler(req)
+				return ServerTransactionName(tracer, req, ServeMuxPatternRoute(pattern))
+			}
+		} else {
+			handler.requestName = func(req *http.Request) string {
+				route := req.URL.Path
+				if req.Pattern != "" {
+					route = ServeMuxPatternRoute(req.Pattern)
+				}
+				return ServerTransactionName(tracer, req, route)
+			}
+			handler.renameFromPattern = true
+		}
+	}
 	if handler.requestIgnorer == nil {
 		handler.requestIgnorer = NewDynamicServerRequestIgnorer(handler.tracer)
 	}
@@ -55,6 +77,20 @@ func Wrap(h http.Handler, o ...ServerOption) http.Handler {
 	return handler
 }
 
+// WrapMux returns an http.Handler wrapping mux, reporting each request as
+// a transaction to Elastic APM, named after the mux pattern matching the
+// request, such as "GET /items/{id}". Requests that do not match any of
+// the mux's patterns are reported as "unknown route".
+//
+// WrapMux accepts the same options as Wrap. If WithServerRequestName is
+// specified, it overrides naming by the mux pattern.
+func WrapMux(mux *http.ServeMux, o ...ServerOption) http.Handler {
+	if mux == nil {
+		panic("mux == nil")
+	}
+	return Wrap(mux, append([]ServerOption{func(h *handler) { h.mux = mux }}, o...)...)
+}
+
 // handler wraps an http.Handler, reporting a new transaction for each request.
 //
 // The http.Request's context will be updated with the transaction.
@@ -65,6 +101,16 @@ type handler struct {
 	panicPropagation bool
 	requestName      RequestNameFunc
 	requestIgnorer   RequestIgnorerFunc
+	propagator       Propagator
+
+	// mux holds the http.ServeMux wrapped by WrapMux, if any,
+	// for naming transactions after the matched pattern.
+	mux *http.ServeMux
+
+	// renameFromPattern controls whether the transaction is
+	// renamed after the ServeMux pattern matched by the wrapped
+	// handler, if any, once the handler returns.
+	renameFromPattern bool
 }
 
 // ServeHTTP delegates to h.Handler, tracing the transaction with
@@ -74,10 +120,19 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		h.handler.ServeHTTP(w, req)
 		return
 	}
-	tx, body, req := StartTransactionWithBody(h.tracer, h.requestName(req), req)
+	propagator := h.propagator
+	if propagator == nil {
+		propagator = DefaultPropagator()
+	}
+	name := h.requestName(req)
+	tx, req := startTransaction(h.tracer, name, req, propagator)
+	body := h.tracer.CaptureHTTPRequestBody(req)
+	if body != nil {
+		req = RequestWithContext(apm.ContextWithBodyCapturer(req.Context(), body), req)
+	}
 	defer tx.End()
 
-	w, resp := WrapResponseWriter(w)
+	w, resp := wrapResponseWriter(w, h.tracer.CaptureHTTPResponseBody())
 
 	defer func() {
 		if v := recover(); v != nil {
@@ -93,8 +148,19 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			}
 			h.recovery(w, req, resp, body, tx, v)
 		}
-		SetTransactionContext(tx, req, resp, body)
+		// The handler may have ended the transaction early,
+		// for example when upgrading the connection to the
+		// WebSocket protocol.
+		if !tx.Ended() {
+			if h.renameFromPattern && req.Pattern != "" && tx.Name == name {
+				// The wrapped handler is, or includes, an http.ServeMux
+				// which matched the request to a pattern.
+				tx.Name = ServerTransactionName(h.tracer, req, ServeMuxPatternRoute(req.Pattern))
+			}
+			SetTransactionContext(tx, req, resp, body)
+		}
 		body.Discard()
+		resp.Body.Discard()
 	}()
 	h.handler.ServeHTTP(w, req)
 	if resp.StatusCode == 0 {
@@ -103,20 +169,19 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 // StartTransaction returns a new Transaction with name,
-// created with tracer, and taking trace context from req.
+// created with tracer, and taking trace context from req
+// using DefaultPropagator.
 //
 // If the transaction is not ignored, the request will be
 // returned with the transaction added to its context.
 //
 // DEPRECATED. Use StartTransactionWithBody instead.
 func StartTransaction(tracer *apm.Tracer, name string, req *http.Request) (*apm.Transaction, *http.Request) {
-	traceContext, ok := getRequestTraceparent(req, W3CTraceparentHeader)
-	if !ok {
-		traceContext, ok = getRequestTraceparent(req, ElasticTraceparentHeader)
-	}
-	if ok {
-		traceContext.State, _ = ParseTracestateHeader(req.Header[TracestateHeader]...)
-	}
+	return startTransaction(tracer, name, req, DefaultPropagator())
+}
+
+func startTransaction(tracer *apm.Tracer, name string, req *http.Request, propagator Propagator) (*apm.Transaction, *http.Request) {
+	traceContext, _ := propagator.Extract(HeaderCarrier(req.Header))
 	tx := tracer.StartTransactionOptions(name, "request", apm.TransactionOptions{TraceContext: traceContext})
 	ctx := apm.ContextWithTransaction(req.Context(), tx)
 	req = RequestWithContext(ctx, req)
@@ -124,7 +189,8 @@ func StartTransaction(tracer *apm.Tracer, name string, req *http.Request) (*apm.
 }
 
 // StartTransactionWithBody returns a new Transaction with name,
-// created with tracer, and taking trace context from req.
+// created with tracer, and taking trace context from req using
+// DefaultPropagator.
 //
 // If the transaction is not ignored, the request and the request body
 // capturer will be returned with the transaction added to its context.
@@ -137,15 +203,6 @@ func StartTransactionWithBody(tracer *apm.Tracer, name string, req *http.Request
 	return tx, bc, req
 }
 
-func getRequestTraceparent(req *http.Request, header string) (apm.TraceContext, bool) {
-	if values := req.Header[header]; len(values) == 1 && values[0] != "" {
-		if c, err := ParseTraceparentHeader(values[0]); err == nil {
-			return c, true
-		}
-	}
-	return apm.TraceContext{}, false
-}
-
 // SetTransactionContext sets tx.Result and, if the transaction is being
 // sampled, sets tx.Context with information from req, resp, and body.
 func SetTransactionContext(tx *apm.Transaction, req *http.Request, resp *Response, body *apm.BodyCapturer) {
@@ -163,6 +220,7 @@ func SetContext(ctx *apm.Context, req *http.Request, resp *Response, body *apm.B
 	ctx.SetHTTPRequestBody(body)
 	ctx.SetHTTPStatusCode(resp.StatusCode)
 	ctx.SetHTTPResponseHeaders(resp.Headers)
+	ctx.SetHTTPResponseBody(resp.Body, resp.StatusCode, resp.Headers.Get("Content-Type"))
 }
 
 // WrapResponseWriter wraps an http.ResponseWriter and returns the wrapped
@@ -175,16 +233,28 @@ func SetContext(ctx *apm.Context, req *http.Request, resp *Response, body *apm.B
 // The returned http.ResponseWriter implements http.Pusher, http.Hijacker,
 // and io.ReaderFrom if and only if the provided http.ResponseWriter does.
 func WrapResponseWriter(w http.ResponseWriter) (http.ResponseWriter, *Response) {
+	return wrapResponseWriter(w, nil)
+}
+
+// wrapResponseWriter is like WrapResponseWriter, additionally recording
+// the response body written into body, if it is non-nil.
+func wrapResponseWriter(w http.ResponseWriter, body *apm.ResponseBodyCapturer) (http.ResponseWriter, *Response) {
 	rw := responseWriter{
 		ResponseWriter: w,
 		resp: Response{
 			Headers: w.Header(),
+			Body:    body,
 		},
 	}
 
 	h, _ := w.(http.Hijacker)
 	p, _ := w.(http.Pusher)
-	rf, _ := w.(io.ReaderFrom)
+	var rf io.ReaderFrom
+	if body == nil {
+		// io.ReaderFrom would bypass Write, so it is
+		// not exposed when capturing the response body.
+		rf, _ = w.(io.ReaderFrom)
+	}
 
 	switch {
 	case h != nil && p != nil:
@@ -234,6 +304,10 @@ type Response struct {
 
 	// Headers holds the headers set in the ResponseWriter.
 	Headers http.Header
+
+	// Body, if non-nil, records the response body written
+	// to the ResponseWriter.
+	Body *apm.ResponseBodyCapturer
 }
 
 type responseWriter struct {
@@ -256,9 +330,12 @@ func (w *responseWriter) WriteHeader(statusCode int) {
 
 // Write calls through to the embedded ResponseWriter, setting
 // w.resp.StatusCode to http.StatusOK if WriteHeader has not already
-// been called.
+// been called, and recording the written data in w.resp.Body.
 func (w *responseWriter) Write(data []byte) (int, error) {
 	n, err := w.ResponseWriter.Write(data)
+	if n > 0 {
+		w.resp.Body.Write(data[:n])
+	}
 	if w.resp.StatusCode == 0 {
 		w.resp.StatusCode = http.StatusOK
 	}
@@ -358,6 +435,9 @@ type RequestNameFunc func(*http.Request) string
 
 // WithServerRequestName returns a ServerOption which sets r as the function
 // to use to obtain the transaction name for the given server request.
+//
+// By default, ServerTransactionName is used with the request URL path,
+// honouring the tracer's transaction naming configuration.
 func WithServerRequestName(r RequestNameFunc) ServerOption {
 	if r == nil {
 		panic("r == nil")
@@ -383,6 +463,18 @@ func WithServerRequestIgnorer(r RequestIgnorerFunc) ServerOption {
 	}
 }
 
+// WithServerPropagator returns a ServerOption which sets p as the
+// propagator to use for extracting trace context from server requests.
+// By default, the propagator returned by DefaultPropagator is used.
+func WithServerPropagator(p Propagator) ServerOption {
+	if p == nil {
+		panic("p == nil")
+	}
+	return func(h *handler) {
+		h.propagator = p
+	}
+}
+
 // RequestWithContext is equivalent to req.WithContext, except that the URL
 // pointer is copied, rather than the contents.
 func RequestWithContext(ctx context.Context, req *http.Request) *http.Request {
@@ -26,6 +26,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -305,6 +306,63 @@ func TestHandlerCaptureBodyErrorIgnored(t *testing.T) {
 	assert.Nil(t, e.Context.Request.Body) // only capturing for transactions
 }
 
+func TestHandlerCaptureResponseBody(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.SetCaptureResponseBody(apm.CaptureBodyTransactions)
+	// Field names are only sanitized when redaction rules are configured.
+	require.NoError(t, tracer.SetRedactionRules(apm.RedactBearerTokens))
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			contentType, statusCode, _ := strings.Cut(req.URL.Query().Get("r"), ":")
+			w.Header().Set("Content-Type", contentType)
+			code, _ := strconv.Atoi(statusCode)
+			w.WriteHeader(code)
+			io.WriteString(w, `{"error":"invalid login","password":"hunter2"}`)
+		}),
+		apmhttp.WithTracer(tracer),
+	)
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	for _, r := range []string{
+		"application/json; charset=utf-8:500",
+		"application/json:200",
+		"image/png:500",
+	} {
+		resp, err := http.Get(server.URL + "/?r=" + url.QueryEscape(r))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads().Transactions
+	require.Len(t, transactions, 3)
+	assert.Equal(t, `{"error":"invalid login","password":"[REDACTED]"}`, responseBody(transactions[0].Context))
+	assert.Empty(t, responseBody(transactions[1].Context)) // only 4xx and 5xx by default
+	assert.Empty(t, responseBody(transactions[2].Context)) // content type not matched
+}
+
+func TestHandlerCaptureResponseBodyError(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.SetCaptureResponseBody(apm.CaptureBodyErrors)
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "unavailable")
+			panic("boom")
+		}),
+		apmhttp.WithTracer(tracer),
+	)
+	e := testPostError(h, tracer, transport, strings.NewReader("foo"))
+	assert.Equal(t, "unavailable", responseBody(e.Context))
+	assert.Empty(t, responseBody(transport.Payloads().Transactions[0].Context)) // only capturing for errors
+}
+
 func testPostTransaction(h http.Handler, tracer *apm.Tracer, transport *transporttest.RecorderTransport, body io.Reader) model.Transaction {
 	server := httptest.NewServer(h)
 	defer server.Close()
@@ -329,6 +387,127 @@ func testPostError(h http.Handler, tracer *apm.Tracer, transport *transporttest.
 	return transport.Payloads().Errors[0]
 }
 
+func TestHandlerTransactionNaming(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(http.NotFoundHandler(), apmhttp.WithTracer(tracer))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	get := func(path string) string {
+		transport.ResetPayloads()
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		tracer.Flush(nil)
+		transactions := transport.Payloads().Transactions
+		require.Len(t, transactions, 1)
+		return transactions[0].Name
+	}
+	assert.Equal(t, "GET /user/123/cart", get("/user/123/cart"))
+
+	tracer.SetTransactionNameGroups("/user/*/cart")
+	assert.Equal(t, "GET /user/*/cart", get("/user/123/cart"))
+	assert.Equal(t, "GET /user/123", get("/user/123"))
+
+	tracer.SetTransactionNameIncludeMethod(false)
+	assert.Equal(t, "/user/*/cart", get("/user/123/cart"))
+}
+
+func TestServeMuxPatternRoute(t *testing.T) {
+	for pattern, route := range map[string]string{
+		"/items/{id}":               "/items/{id}",
+		"GET /items/{id}":           "/items/{id}",
+		"example.com/hosts/{id}":    "/hosts/{id}",
+		"POST\texample.com/{id...}": "/{id...}",
+	} {
+		assert.Equal(t, route, apmhttp.ServeMuxPatternRoute(pattern), pattern)
+	}
+}
+
+func TestHandlerServeMuxPattern(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, req *http.Request) {})
+	mux.HandleFunc("example.com/hosts/{id}", func(w http.ResponseWriter, req *http.Request) {})
+	mux.Handle("/renamed/{id}", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		apm.TransactionFromContext(req.Context()).Name = "renamed"
+	}))
+	mux.Handle("/inner/{id}", apmhttp.Wrap(http.NotFoundHandler(), apmhttp.WithTracer(tracer)))
+	server := httptest.NewServer(apmhttp.Wrap(mux, apmhttp.WithTracer(tracer)))
+	defer server.Close()
+
+	for _, url := range []string{
+		server.URL + "/items/123",
+		server.URL + "/hosts/123",
+		server.URL + "/renamed/123",
+		server.URL + "/unmatched/123",
+	} {
+		resp, err := http.Get(url)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	req, _ := http.NewRequest("GET", server.URL+"/hosts/123", nil)
+	req.Host = "example.com"
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	tracer.Flush(nil)
+
+	var names []string
+	for _, tx := range transport.Payloads().Transactions {
+		names = append(names, tx.Name)
+	}
+	assert.Equal(t, []string{
+		"GET /items/{id}",
+		"GET /hosts/123",
+		"renamed",
+		"GET /unmatched/123",
+		"GET /hosts/{id}",
+	}, names)
+
+	// A handler wrapped within the mux is named
+	// after the pattern from the start.
+	transport.ResetPayloads()
+	resp, err = http.Get(server.URL + "/inner/123")
+	require.NoError(t, err)
+	resp.Body.Close()
+	tracer.Flush(nil)
+	names = names[:0]
+	for _, tx := range transport.Payloads().Transactions {
+		names = append(names, tx.Name)
+	}
+	assert.Equal(t, []string{"GET /inner/{id}", "GET /inner/{id}"}, names)
+}
+
+func TestWrapMux(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, req *http.Request) {
+		tx := apm.TransactionFromContext(req.Context())
+		assert.Equal(t, "GET /items/{id}", tx.Name)
+	})
+	server := httptest.NewServer(apmhttp.WrapMux(mux, apmhttp.WithTracer(tracer)))
+	defer server.Close()
+
+	for _, path := range []string{"/items/123", "/unmatched"} {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads().Transactions
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "GET /items/{id}", transactions[0].Name)
+	assert.Equal(t, "GET unknown route", transactions[1].Name)
+}
+
 func TestHandlerRecovery(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -599,3 +778,18 @@ func recoveryMiddleware(code int) func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// responseBody returns the captured response body
+// recorded in the custom context, if any.
+func responseBody(c *model.Context) string {
+	if c == nil {
+		return ""
+	}
+	for _, item := range c.Custom {
+		if item.Key == "response_body" {
+			body, _ := item.Value.(string)
+			return body
+		}
+	}
+	return ""
+}
@@ -0,0 +1,485 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp // import "go.elastic.co/apm/module/apmhttp/v2"
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"go.elastic.co/apm/v2"
+)
+
+const (
+	// B3Header is the B3 single header for trace propagation,
+	// used by Zipkin and Envoy.
+	B3Header = "B3"
+
+	// B3TraceIDHeader, B3SpanIDHeader, B3ParentSpanIDHeader, B3SampledHeader
+	// and B3FlagsHeader are the B3 multiple headers for trace propagation.
+	B3TraceIDHeader      = "X-B3-Traceid"
+	B3SpanIDHeader       = "X-B3-Spanid"
+	B3ParentSpanIDHeader = "X-B3-Parentspanid"
+	B3SampledHeader      = "X-B3-Sampled"
+	B3FlagsHeader        = "X-B3-Flags"
+
+	// JaegerTraceHeader is the Jaeger header for trace propagation.
+	JaegerTraceHeader = "Uber-Trace-Id"
+
+	// XRayTraceHeader is the AWS X-Ray header for trace propagation,
+	// which is also added to requests by AWS Application Load Balancers.
+	XRayTraceHeader = "X-Amzn-Trace-Id"
+)
+
+var defaultPropagator atomic.Pointer[Propagator]
+
+// DefaultPropagator returns the Propagator used by instrumentation modules,
+// such as apmhttp, apmgrpc, apmfasthttp, and apmawssdkgo, unless another
+// propagator is specified in the module's options.
+//
+// The default propagator is W3CPropagator, unless another propagator has
+// been set by calling SetDefaultPropagator.
+func DefaultPropagator() Propagator {
+	if p := defaultPropagator.Load(); p != nil {
+		return *p
+	}
+	return W3CPropagator{}
+}
+
+// SetDefaultPropagator sets the propagator returned by DefaultPropagator.
+// Calling SetDefaultPropagator(nil) restores the default, W3CPropagator.
+//
+// To accept trace context from multiple formats, use a CompositePropagator:
+//
+//	apmhttp.SetDefaultPropagator(apmhttp.CompositePropagator{
+//		apmhttp.W3CPropagator{},
+//		apmhttp.B3Propagator{},
+//	})
+func SetDefaultPropagator(p Propagator) {
+	if p == nil {
+		defaultPropagator.Store(nil)
+		return
+	}
+	defaultPropagator.Store(&p)
+}
+
+// Propagator extracts trace context from, and injects trace context
+// into, a Carrier such as HTTP headers or message attributes.
+type Propagator interface {
+	// Extract returns the trace context extracted from carrier, and
+	// a boolean reporting whether any trace context was found.
+	Extract(carrier Carrier) (apm.TraceContext, bool)
+
+	// Inject injects traceContext into carrier.
+	Inject(carrier Carrier, traceContext apm.TraceContext, opts InjectOptions)
+
+	// Fields returns the keys that the propagator extracts from, and
+	// injects into, carriers. Instrumentation may use these to avoid
+	// recording trace context as request metadata.
+	Fields() []string
+}
+
+// InjectOptions holds options for Propagator.Inject.
+type InjectOptions struct {
+	// PropagateLegacyHeader indicates that the legacy Elastic-Apm-Traceparent
+	// header should be injected, as reported by the transaction's
+	// ShouldPropagateLegacyHeader method.
+	PropagateLegacyHeader bool
+}
+
+// Carrier holds key/value pairs for trace propagation, such as HTTP
+// headers. Keys are compared case-insensitively by the carriers
+// provided by the instrumentation modules.
+type Carrier interface {
+	// Get returns the values associated with key, if any.
+	Get(key string) []string
+
+	// Set sets the value associated with key, replacing any
+	// existing values.
+	Set(key, value string)
+}
+
+// HeaderCarrier is a Carrier for HTTP headers.
+type HeaderCarrier http.Header
+
+// Get returns the values of the header with the given key.
+func (c HeaderCarrier) Get(key string) []string {
+	return http.Header(c).Values(key)
+}
+
+// Set sets the value of the header with the given key.
+func (c HeaderCarrier) Set(key, value string) {
+	http.Header(c).Set(key, value)
+}
+
+// CompositePropagator is a Propagator which combines multiple propagators.
+//
+// Trace context is extracted using the first propagator which finds trace
+// context in the carrier, so propagators should be listed in order of
+// preference. Trace context is injected using all of the propagators.
+type CompositePropagator []Propagator
+
+// Extract returns the trace context extracted by the first propagator
+// which finds trace context in carrier.
+func (c CompositePropagator) Extract(carrier Carrier) (apm.TraceContext, bool) {
+	for _, p := range c {
+		if traceContext, ok := p.Extract(carrier); ok {
+			return traceContext, true
+		}
+	}
+	return apm.TraceContext{}, false
+}
+
+// Inject injects traceContext into carrier using each of the propagators.
+func (c CompositePropagator) Inject(carrier Carrier, traceContext apm.TraceContext, opts InjectOptions) {
+	for _, p := range c {
+		p.Inject(carrier, traceContext, opts)
+	}
+}
+
+// Fields returns the keys used by each of the propagators.
+func (c CompositePropagator) Fields() []string {
+	var fields []string
+	for _, p := range c {
+		fields = append(fields, p.Fields()...)
+	}
+	return fields
+}
+
+// W3CPropagator is a Propagator for the W3C Trace Context traceparent and
+// tracestate headers, and the legacy Elastic-Apm-Traceparent header.
+type W3CPropagator struct{}
+
+// Extract extracts trace context from the traceparent header or, if that
+// is missing or invalid, the Elastic-Apm-Traceparent header, along with
+// the tracestate header.
+func (W3CPropagator) Extract(carrier Carrier) (apm.TraceContext, bool) {
+	traceContext, ok := extractTraceparent(carrier, W3CTraceparentHeader)
+	if !ok {
+		traceContext, ok = extractTraceparent(carrier, ElasticTraceparentHeader)
+	}
+	if ok {
+		traceContext.State, _ = ParseTracestateHeader(carrier.Get(TracestateHeader)...)
+	}
+	return traceContext, ok
+}
+
+func extractTraceparent(carrier Carrier, header string) (apm.TraceContext, bool) {
+	if values := carrier.Get(header); len(values) == 1 && values[0] != "" {
+		if c, err := ParseTraceparentHeader(values[0]); err == nil {
+			return c, true
+		}
+	}
+	return apm.TraceContext{}, false
+}
+
+// Inject injects the traceparent and tracestate headers, and the
+// Elastic-Apm-Traceparent header if opts.PropagateLegacyHeader is true.
+func (W3CPropagator) Inject(carrier Carrier, traceContext apm.TraceContext, opts InjectOptions) {
+	headerValue := FormatTraceparentHeader(traceContext)
+	if opts.PropagateLegacyHeader {
+		carrier.Set(ElasticTraceparentHeader, headerValue)
+	}
+	carrier.Set(W3CTraceparentHeader, headerValue)
+	if tracestate := traceContext.State.String(); tracestate != "" {
+		carrier.Set(TracestateHeader, tracestate)
+	}
+}
+
+// Fields returns the traceparent, tracestate and Elastic-Apm-Traceparent
+// header names.
+func (W3CPropagator) Fields() []string {
+	return []string{W3CTraceparentHeader, TracestateHeader, ElasticTraceparentHeader}
+}
+
+// B3Propagator is a Propagator for the B3 headers used by Zipkin:
+//
+//	https://github.com/openzipkin/b3-propagation
+//
+// Trace context is extracted from either the single b3 header, or the
+// multiple X-B3-* headers. If the sampling decision is deferred, by
+// omitting the sampling state, the trace context is extracted without
+// the sampled flag, and so the transaction is not sampled. A single b3
+// header holding only the sampling state "0" is extracted as an unsampled
+// trace context with a new trace ID and no parent.
+type B3Propagator struct {
+	// SingleHeader controls whether trace context is injected using
+	// the single b3 header, rather than the multiple X-B3-* headers.
+	SingleHeader bool
+}
+
+// Extract extracts trace context from the b3 header or, if that is
+// missing, the X-B3-* headers.
+func (B3Propagator) Extract(carrier Carrier) (apm.TraceContext, bool) {
+	if value := firstValue(carrier, B3Header); value != "" {
+		if value == "0" {
+			// The sampling decision is propagated
+			// without trace or span IDs.
+			var traceContext apm.TraceContext
+			binary.LittleEndian.PutUint64(traceContext.Trace[:8], rand.Uint64())
+			binary.LittleEndian.PutUint64(traceContext.Trace[8:], rand.Uint64())
+			return traceContext, true
+		}
+		traceContext, err := parseB3Header(value)
+		return traceContext, err == nil
+	}
+	var traceContext apm.TraceContext
+	if err := decodeHexID(traceContext.Trace[:], firstValue(carrier, B3TraceIDHeader)); err != nil {
+		return apm.TraceContext{}, false
+	}
+	if err := decodeHexID(traceContext.Span[:], firstValue(carrier, B3SpanIDHeader)); err != nil {
+		return apm.TraceContext{}, false
+	}
+	// Debug implies sampled. If the sampling decision is
+	// deferred, the trace context is left unsampled.
+	sampled := firstValue(carrier, B3FlagsHeader) == "1"
+	switch firstValue(carrier, B3SampledHeader) {
+	case "1", "true":
+		sampled = true
+	}
+	traceContext.Options = traceContext.Options.WithRecorded(sampled)
+	return traceContext, true
+}
+
+// parseB3Header parses a b3 single header value, of the form
+// {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}, where the
+// sampling state and parent span ID are optional.
+func parseB3Header(h string) (apm.TraceContext, error) {
+	var out apm.TraceContext
+	parts := strings.Split(h, "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return out, errors.Errorf("invalid b3 header %q", h)
+	}
+	if err := decodeHexID(out.Trace[:], parts[0]); err != nil {
+		return out, errors.Wrap(err, "invalid trace ID")
+	}
+	if err := decodeHexID(out.Span[:], parts[1]); err != nil {
+		return out, errors.Wrap(err, "invalid span ID")
+	}
+	// If the sampling state is omitted, the sampling
+	// decision is deferred and the trace context is
+	// left unsampled. "d" (debug) implies sampled.
+	var sampled bool
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "0":
+		case "1", "d":
+			sampled = true
+		default:
+			return out, errors.Errorf("invalid b3 sampling state %q", parts[2])
+		}
+	}
+	out.Options = out.Options.WithRecorded(sampled)
+	return out, nil
+}
+
+// Inject injects the b3 header if p.SingleHeader is true,
+// and otherwise the X-B3-* headers.
+func (p B3Propagator) Inject(carrier Carrier, traceContext apm.TraceContext, opts InjectOptions) {
+	sampled := "0"
+	if traceContext.Options.Recorded() {
+		sampled = "1"
+	}
+	traceID := hex.EncodeToString(traceContext.Trace[:])
+	spanID := hex.EncodeToString(traceContext.Span[:])
+	if p.SingleHeader {
+		carrier.Set(B3Header, traceID+"-"+spanID+"-"+sampled)
+		return
+	}
+	carrier.Set(B3TraceIDHeader, traceID)
+	carrier.Set(B3SpanIDHeader, spanID)
+	carrier.Set(B3SampledHeader, sampled)
+}
+
+// Fields returns the b3 and X-B3-* header names.
+func (B3Propagator) Fields() []string {
+	return []string{
+		B3Header, B3TraceIDHeader, B3SpanIDHeader,
+		B3ParentSpanIDHeader, B3SampledHeader, B3FlagsHeader,
+	}
+}
+
+// JaegerPropagator is a Propagator for the Jaeger uber-trace-id header:
+//
+//	https://www.jaegertracing.io/docs/1.21/client-libraries/#propagation-format
+type JaegerPropagator struct{}
+
+// Extract extracts trace context from the uber-trace-id header.
+func (JaegerPropagator) Extract(carrier Carrier) (apm.TraceContext, bool) {
+	value := firstValue(carrier, JaegerTraceHeader)
+	if value == "" {
+		return apm.TraceContext{}, false
+	}
+	traceContext, err := parseJaegerHeader(value)
+	return traceContext, err == nil
+}
+
+// parseJaegerHeader parses an uber-trace-id header value, of the form
+// {trace-id}:{span-id}:{parent-span-id}:{flags}.
+func parseJaegerHeader(h string) (apm.TraceContext, error) {
+	var out apm.TraceContext
+	if strings.Contains(h, "%") {
+		unescaped, err := url.QueryUnescape(h)
+		if err != nil {
+			return out, err
+		}
+		h = unescaped
+	}
+	parts := strings.Split(h, ":")
+	if len(parts) != 4 {
+		return out, errors.Errorf("invalid uber-trace-id header %q", h)
+	}
+	if err := decodeHexID(out.Trace[:], parts[0]); err != nil {
+		return out, errors.Wrap(err, "invalid trace ID")
+	}
+	if err := decodeHexID(out.Span[:], parts[1]); err != nil {
+		return out, errors.Wrap(err, "invalid span ID")
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return out, errors.Wrap(err, "invalid flags")
+	}
+	// Bit 1 indicates that the trace is sampled, and
+	// bit 2 indicates that the trace is a debug trace,
+	// which must be sampled.
+	out.Options = out.Options.WithRecorded(flags&0x3 != 0)
+	return out, nil
+}
+
+// Inject injects the uber-trace-id header.
+func (JaegerPropagator) Inject(carrier Carrier, traceContext apm.TraceContext, opts InjectOptions) {
+	flags := "0"
+	if traceContext.Options.Recorded() {
+		flags = "1"
+	}
+	carrier.Set(JaegerTraceHeader, hex.EncodeToString(traceContext.Trace[:])+":"+
+		hex.EncodeToString(traceContext.Span[:])+":0:"+flags)
+}
+
+// Fields returns the uber-trace-id header name.
+func (JaegerPropagator) Fields() []string {
+	return []string{JaegerTraceHeader}
+}
+
+// XRayPropagator is a Propagator for the AWS X-Ray X-Amzn-Trace-Id header:
+//
+//	https://docs.aws.amazon.com/xray/latest/devguide/xray-concepts.html#xray-concepts-tracingheader
+//
+// The header may have only a root trace ID, without a parent ID, as when
+// added by an AWS Application Load Balancer. If the sampling decision is
+// missing or deferred ("Sampled=?"), the trace ID is kept and the decision
+// is left to the tracer's sampler.
+type XRayPropagator struct{}
+
+// Extract extracts trace context from the X-Amzn-Trace-Id header.
+func (XRayPropagator) Extract(carrier Carrier) (apm.TraceContext, bool) {
+	value := firstValue(carrier, XRayTraceHeader)
+	if value == "" {
+		return apm.TraceContext{}, false
+	}
+	traceContext, err := parseXRayHeader(value)
+	return traceContext, err == nil
+}
+
+// parseXRayHeader parses an X-Amzn-Trace-Id header value, of the form
+// Root=1-{8 hex digits}-{24 hex digits};Parent={16 hex digits};Sampled={0|1}.
+func parseXRayHeader(h string) (apm.TraceContext, error) {
+	var out apm.TraceContext
+	var haveRoot bool
+	sampled, deferred := false, true
+	for _, field := range strings.Split(h, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch key {
+		case "Root":
+			parts := strings.Split(value, "-")
+			if len(parts) != 3 || parts[0] != "1" || len(parts[1]) != 8 || len(parts[2]) != 24 {
+				return out, errors.Errorf("invalid X-Ray root trace ID %q", value)
+			}
+			if err := decodeHexID(out.Trace[:], parts[1]+parts[2]); err != nil {
+				return out, errors.Wrap(err, "invalid trace ID")
+			}
+			haveRoot = true
+		case "Parent":
+			if err := decodeHexID(out.Span[:], value); err != nil {
+				return out, errors.Wrap(err, "invalid parent ID")
+			}
+		case "Sampled":
+			switch value {
+			case "0", "1":
+				sampled, deferred = value == "1", false
+			}
+		}
+	}
+	if !haveRoot {
+		return out, errors.Errorf("missing root trace ID in X-Amzn-Trace-Id header %q", h)
+	}
+	out.Options = out.Options.WithRecorded(sampled).WithSamplingDeferred(deferred)
+	return out, nil
+}
+
+// Inject injects the X-Amzn-Trace-Id header.
+func (XRayPropagator) Inject(carrier Carrier, traceContext apm.TraceContext, opts InjectOptions) {
+	sampled := "0"
+	if traceContext.Options.Recorded() {
+		sampled = "1"
+	}
+	traceID := hex.EncodeToString(traceContext.Trace[:])
+	carrier.Set(XRayTraceHeader, "Root=1-"+traceID[:8]+"-"+traceID[8:]+
+		";Parent="+hex.EncodeToString(traceContext.Span[:])+
+		";Sampled="+sampled)
+}
+
+// Fields returns the X-Amzn-Trace-Id header name.
+func (XRayPropagator) Fields() []string {
+	return []string{XRayTraceHeader}
+}
+
+func firstValue(carrier Carrier, key string) string {
+	if values := carrier.Get(key); len(values) != 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// decodeHexID decodes the hex-encoded ID s into dst, left-padding
+// it with zeroes if it is shorter than dst, as with 64-bit trace IDs.
+// The decoded ID must not be all zeroes.
+func decodeHexID(dst []byte, s string) error {
+	if s == "" || len(s) > hex.EncodedLen(len(dst)) {
+		return errors.Errorf("invalid ID %q", s)
+	}
+	if n := hex.EncodedLen(len(dst)) - len(s); n > 0 {
+		s = strings.Repeat("0", n) + s
+	}
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return err
+	}
+	for _, b := range dst {
+		if b != 0 {
+			return nil
+		}
+	}
+	return errors.Errorf("invalid ID %q, must not be all zeroes", s)
+}
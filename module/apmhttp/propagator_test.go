@@ -0,0 +1,358 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/apmtest"
+)
+
+var (
+	testTraceID = apm.TraceID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c}
+	testSpanID  = apm.SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31}
+)
+
+func TestPropagatorsExtract(t *testing.T) {
+	sampled := apm.TraceContext{Trace: testTraceID, Span: testSpanID, Options: apm.TraceOptions(0).WithRecorded(true)}
+	unsampled := apm.TraceContext{Trace: testTraceID, Span: testSpanID}
+	shortTraceID := apm.TraceContext{
+		Trace:   apm.TraceID{8: 0x84, 9: 0x48, 10: 0xeb, 11: 0x21, 12: 0x1c, 13: 0x80, 14: 0x31, 15: 0x9c},
+		Span:    testSpanID,
+		Options: apm.TraceOptions(0).WithRecorded(true),
+	}
+
+	for _, test := range []struct {
+		name       string
+		propagator apmhttp.Propagator
+		header     http.Header
+		expected   apm.TraceContext
+		ok         bool
+	}{{
+		name:       "b3-single",
+		propagator: apmhttp.B3Propagator{},
+		header:     http.Header{"B3": {"0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-1-0000000000000001"}},
+		expected:   sampled,
+		ok:         true,
+	}, {
+		name:       "b3-single-unsampled",
+		propagator: apmhttp.B3Propagator{},
+		header:     http.Header{"B3": {"0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-0"}},
+		expected:   unsampled,
+		ok:         true,
+	}, {
+		name:       "b3-single-deferred-64bit",
+		propagator: apmhttp.B3Propagator{},
+		header:     http.Header{"B3": {"8448eb211c80319c-b7ad6b7169203331"}},
+		expected:   apm.TraceContext{Trace: shortTraceID.Trace, Span: testSpanID},
+		ok:         true,
+	}, {
+		name:       "b3-single-debug",
+		propagator: apmhttp.B3Propagator{},
+		header:     http.Header{"B3": {"0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-d"}},
+		expected:   sampled,
+		ok:         true,
+	}, {
+		name:       "b3-single-sampling-only-invalid",
+		propagator: apmhttp.B3Propagator{},
+		header:     http.Header{"B3": {"1"}},
+	}, {
+		name:       "b3-multi",
+		propagator: apmhttp.B3Propagator{},
+		header: http.Header{
+			"X-B3-Traceid": {"0af7651916cd43dd8448eb211c80319c"},
+			"X-B3-Spanid":  {"b7ad6b7169203331"},
+			"X-B3-Sampled": {"0"},
+		},
+		expected: unsampled,
+		ok:       true,
+	}, {
+		name:       "b3-multi-sampled",
+		propagator: apmhttp.B3Propagator{},
+		header: http.Header{
+			"X-B3-Traceid": {"0af7651916cd43dd8448eb211c80319c"},
+			"X-B3-Spanid":  {"b7ad6b7169203331"},
+			"X-B3-Sampled": {"true"},
+		},
+		expected: sampled,
+		ok:       true,
+	}, {
+		name:       "b3-multi-deferred",
+		propagator: apmhttp.B3Propagator{},
+		header: http.Header{
+			"X-B3-Traceid": {"0af7651916cd43dd8448eb211c80319c"},
+			"X-B3-Spanid":  {"b7ad6b7169203331"},
+		},
+		expected: unsampled,
+		ok:       true,
+	}, {
+		name:       "b3-multi-debug",
+		propagator: apmhttp.B3Propagator{},
+		header: http.Header{
+			"X-B3-Traceid": {"0af7651916cd43dd8448eb211c80319c"},
+			"X-B3-Spanid":  {"b7ad6b7169203331"},
+			"X-B3-Flags":   {"1"},
+		},
+		expected: sampled,
+		ok:       true,
+	}, {
+		name:       "b3-multi-invalid",
+		propagator: apmhttp.B3Propagator{},
+		header: http.Header{
+			"X-B3-Traceid": {"00000000000000000000000000000000"},
+			"X-B3-Spanid":  {"b7ad6b7169203331"},
+		},
+	}, {
+		name:       "jaeger",
+		propagator: apmhttp.JaegerPropagator{},
+		header:     http.Header{"Uber-Trace-Id": {"0af7651916cd43dd8448eb211c80319c:b7ad6b7169203331:0:1"}},
+		expected:   sampled,
+		ok:         true,
+	}, {
+		name:       "jaeger-urlencoded-64bit",
+		propagator: apmhttp.JaegerPropagator{},
+		header:     http.Header{"Uber-Trace-Id": {"8448eb211c80319c%3Ab7ad6b7169203331%3A0%3A3"}},
+		expected:   shortTraceID,
+		ok:         true,
+	}, {
+		name:       "jaeger-unsampled",
+		propagator: apmhttp.JaegerPropagator{},
+		header:     http.Header{"Uber-Trace-Id": {"0af7651916cd43dd8448eb211c80319c:b7ad6b7169203331:0:0"}},
+		expected:   unsampled,
+		ok:         true,
+	}, {
+		name:       "jaeger-invalid",
+		propagator: apmhttp.JaegerPropagator{},
+		header:     http.Header{"Uber-Trace-Id": {"0af7651916cd43dd8448eb211c80319c:b7ad6b7169203331"}},
+	}, {
+		name:       "xray",
+		propagator: apmhttp.XRayPropagator{},
+		header:     http.Header{"X-Amzn-Trace-Id": {"Root=1-0af76519-16cd43dd8448eb211c80319c;Parent=b7ad6b7169203331;Sampled=0"}},
+		expected:   unsampled,
+		ok:         true,
+	}, {
+		name:       "xray-root-only",
+		propagator: apmhttp.XRayPropagator{},
+		header:     http.Header{"X-Amzn-Trace-Id": {"Self=1-67891234-12456789abcdef012345678;Root=1-0af76519-16cd43dd8448eb211c80319c"}},
+		expected:   apm.TraceContext{Trace: testTraceID, Options: apm.TraceOptions(0).WithSamplingDeferred(true)},
+		ok:         true,
+	}, {
+		name:       "xray-sampling-deferred",
+		propagator: apmhttp.XRayPropagator{},
+		header:     http.Header{"X-Amzn-Trace-Id": {"Root=1-0af76519-16cd43dd8448eb211c80319c;Parent=b7ad6b7169203331;Sampled=?"}},
+		expected:   apm.TraceContext{Trace: testTraceID, Span: testSpanID, Options: apm.TraceOptions(0).WithSamplingDeferred(true)},
+		ok:         true,
+	}, {
+		name:       "xray-invalid",
+		propagator: apmhttp.XRayPropagator{},
+		header:     http.Header{"X-Amzn-Trace-Id": {"Root=1-0af76519"}},
+	}, {
+		name: "composite",
+		propagator: apmhttp.CompositePropagator{
+			apmhttp.W3CPropagator{},
+			apmhttp.B3Propagator{},
+			apmhttp.XRayPropagator{},
+		},
+		header: http.Header{
+			"B3":              {"0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-1"},
+			"X-Amzn-Trace-Id": {"Root=1-11111111-111111111111111111111111"},
+		},
+		expected: sampled,
+		ok:       true,
+	}, {
+		name: "composite-none",
+		propagator: apmhttp.CompositePropagator{
+			apmhttp.W3CPropagator{},
+			apmhttp.B3Propagator{},
+		},
+		header: http.Header{},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			traceContext, ok := test.propagator.Extract(apmhttp.HeaderCarrier(test.header))
+			assert.Equal(t, test.ok, ok)
+			if test.ok {
+				assert.Equal(t, test.expected, traceContext)
+			}
+		})
+	}
+}
+
+func TestB3PropagatorExtractSamplingOnly(t *testing.T) {
+	traceContext, ok := apmhttp.B3Propagator{}.Extract(apmhttp.HeaderCarrier(http.Header{"B3": {"0"}}))
+	require.True(t, ok)
+	assert.NoError(t, traceContext.Trace.Validate())
+	assert.Zero(t, traceContext.Span)
+	assert.False(t, traceContext.Options.Recorded())
+
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	handler := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+		apmhttp.WithTracer(tracer.Tracer),
+		apmhttp.WithServerPropagator(apmhttp.B3Propagator{}),
+	)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("B3", "0")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.NotNil(t, payloads.Transactions[0].Sampled)
+	assert.False(t, *payloads.Transactions[0].Sampled)
+	assert.Zero(t, payloads.Transactions[0].ParentID)
+}
+
+func TestPropagatorsInject(t *testing.T) {
+	traceContext := apm.TraceContext{
+		Trace:   testTraceID,
+		Span:    testSpanID,
+		Options: apm.TraceOptions(0).WithRecorded(true),
+	}
+	for _, test := range []struct {
+		name       string
+		propagator apmhttp.Propagator
+		expected   http.Header
+	}{{
+		name:       "w3c",
+		propagator: apmhttp.W3CPropagator{},
+		expected: http.Header{
+			"Traceparent":             {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+			"Elastic-Apm-Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		},
+	}, {
+		name:       "b3-single",
+		propagator: apmhttp.B3Propagator{SingleHeader: true},
+		expected:   http.Header{"B3": {"0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-1"}},
+	}, {
+		name:       "b3-multi",
+		propagator: apmhttp.B3Propagator{},
+		expected: http.Header{
+			"X-B3-Traceid": {"0af7651916cd43dd8448eb211c80319c"},
+			"X-B3-Spanid":  {"b7ad6b7169203331"},
+			"X-B3-Sampled": {"1"},
+		},
+	}, {
+		name:       "jaeger",
+		propagator: apmhttp.JaegerPropagator{},
+		expected:   http.Header{"Uber-Trace-Id": {"0af7651916cd43dd8448eb211c80319c:b7ad6b7169203331:0:1"}},
+	}, {
+		name:       "xray",
+		propagator: apmhttp.XRayPropagator{},
+		expected:   http.Header{"X-Amzn-Trace-Id": {"Root=1-0af76519-16cd43dd8448eb211c80319c;Parent=b7ad6b7169203331;Sampled=1"}},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			header := make(http.Header)
+			test.propagator.Inject(apmhttp.HeaderCarrier(header), traceContext, apmhttp.InjectOptions{
+				PropagateLegacyHeader: true,
+			})
+			assert.Equal(t, test.expected, header)
+
+			// Every injected header is reported by Fields.
+			fields := make(map[string]bool)
+			for _, field := range test.propagator.Fields() {
+				fields[http.CanonicalHeaderKey(field)] = true
+			}
+			for key := range header {
+				assert.True(t, fields[key], key)
+			}
+
+			// The injected trace context can be extracted.
+			extracted, ok := test.propagator.Extract(apmhttp.HeaderCarrier(header))
+			require.True(t, ok)
+			assert.Equal(t, traceContext, extracted)
+		})
+	}
+}
+
+func TestPropagatorHandlerClient(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	propagator := apmhttp.CompositePropagator{apmhttp.W3CPropagator{}, apmhttp.B3Propagator{SingleHeader: true}}
+	var serverHeader http.Header
+	server := httptest.NewServer(apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			serverHeader = req.Header
+		}),
+		apmhttp.WithTracer(tracer.Tracer),
+		apmhttp.WithServerPropagator(apmhttp.B3Propagator{}),
+	))
+	defer server.Close()
+
+	client := apmhttp.WrapClient(server.Client(), apmhttp.WithClientPropagator(propagator))
+	tx := tracer.StartTransaction("name", "type")
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(req.WithContext(apm.ContextWithTransaction(req.Context(), tx)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	assert.NotEmpty(t, serverHeader.Get("Traceparent"))
+	assert.NotEmpty(t, serverHeader.Get("B3"))
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	require.Len(t, payloads.Spans, 1)
+	serverTx := payloads.Transactions[0]
+	assert.Equal(t, payloads.Spans[0].TraceID, serverTx.TraceID)
+	assert.Equal(t, payloads.Spans[0].ID, serverTx.ParentID)
+}
+
+func TestXRayPropagatorRootOnly(t *testing.T) {
+	// An AWS Application Load Balancer adds a header with only a root
+	// trace ID, leaving the sampling decision to the tracer's sampler.
+	apmhttp.SetDefaultPropagator(apmhttp.XRayPropagator{})
+	defer apmhttp.SetDefaultPropagator(nil)
+	for _, sampleRate := range []float64{0, 1} {
+		tracer := apmtest.NewRecordingTracer()
+		defer tracer.Close()
+		tracer.SetSampler(apm.NewRatioSampler(sampleRate))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Amzn-Trace-Id", "Root=1-0af76519-16cd43dd8448eb211c80319c")
+		tx, _ := apmhttp.StartTransaction(tracer.Tracer, "name", req)
+		assert.Equal(t, testTraceID, tx.TraceContext().Trace)
+		assert.Equal(t, sampleRate == 1, tx.Sampled())
+		assert.False(t, tx.TraceContext().Options.SamplingDeferred())
+		tx.End()
+	}
+}
+
+func TestDefaultPropagator(t *testing.T) {
+	assert.Equal(t, apmhttp.W3CPropagator{}, apmhttp.DefaultPropagator())
+	apmhttp.SetDefaultPropagator(apmhttp.XRayPropagator{})
+	defer apmhttp.SetDefaultPropagator(nil)
+	assert.Equal(t, apmhttp.XRayPropagator{}, apmhttp.DefaultPropagator())
+
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Amzn-Trace-Id", "Root=1-0af76519-16cd43dd8448eb211c80319c;Parent=b7ad6b7169203331;Sampled=1")
+	tx, _ := apmhttp.StartTransaction(tracer.Tracer, "name", req)
+	assert.Equal(t, testTraceID, tx.TraceContext().Trace)
+	tx.End()
+}
@@ -19,6 +19,9 @@ package apmhttp // import "go.elastic.co/apm/module/apmhttp/v2"
 
 import (
 	"net/http"
+	"strings"
+
+	"go.elastic.co/apm/v2"
 )
 
 // UnknownRouteRequestName returns the transaction name for the server request, req,
@@ -33,6 +36,29 @@ func ServerRequestName(req *http.Request) string {
 	return req.Method + " " + req.URL.Path
 }
 
+// ServerTransactionName returns the transaction name for the server request,
+// req, matched to route, according to the tracer's transaction naming
+// configuration. If route is empty, the route is considered unknown.
+//
+// See apm.Tracer.HTTPTransactionName for details.
+func ServerTransactionName(tracer *apm.Tracer, req *http.Request, route string) string {
+	return tracer.HTTPTransactionName(req.Method, route, req.URL.Path)
+}
+
+// ServeMuxPatternRoute returns the path of the http.ServeMux pattern,
+// excluding any method and host, such as "/items/{id}" for the pattern
+// "GET example.com/items/{id}". The pattern which matched a request is
+// recorded in the request's Pattern field.
+func ServeMuxPatternRoute(pattern string) string {
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i:], " \t")
+	}
+	if i := strings.IndexByte(pattern, '/'); i > 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
+
 // ClientRequestName returns the span name for the client request, req.
 func ClientRequestName(req *http.Request) string {
 	return req.Method + " " + req.URL.Host
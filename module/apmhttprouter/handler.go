@@ -42,7 +42,7 @@ func Wrap(h httprouter.Handle, route string, o ...Option) httprouter.Handle {
 			h(w, req, p)
 			return
 		}
-		tx, body, req := apmhttp.StartTransactionWithBody(opts.tracer, req.Method+" "+route, req)
+		tx, body, req := apmhttp.StartTransactionWithBody(opts.tracer, apmhttp.ServerTransactionName(opts.tracer, req, route), req)
 		defer tx.End()
 
 		w, resp := apmhttp.WrapResponseWriter(w)
@@ -88,7 +88,9 @@ func wrapHandlerUnknownRoute(h http.Handler, o ...Option) http.Handler {
 		h,
 		apmhttp.WithTracer(opts.tracer),
 		apmhttp.WithRecovery(opts.recovery),
-		apmhttp.WithServerRequestName(apmhttp.UnknownRouteRequestName),
+		apmhttp.WithServerRequestName(func(req *http.Request) string {
+			return apmhttp.ServerTransactionName(opts.tracer, req, "")
+		}),
 		apmhttp.WithServerRequestIgnorer(opts.requestIgnorer),
 	)
 }
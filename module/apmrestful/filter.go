@@ -58,12 +58,7 @@ func (f *filter) filter(req *restful.Request, resp *restful.Response, chain *res
 		return
 	}
 
-	var name string
-	if routePath := massageRoutePath(req.SelectedRoutePath()); routePath != "" {
-		name = req.Request.Method + " " + massageRoutePath(req.SelectedRoutePath())
-	} else {
-		name = apmhttp.UnknownRouteRequestName(req.Request)
-	}
+	name := apmhttp.ServerTransactionName(f.tracer, req.Request, massageRoutePath(req.SelectedRoutePath()))
 	tx, body, httpRequest := apmhttp.StartTransactionWithBody(f.tracer, name, req.Request)
 	defer tx.End()
 	req.Request = httpRequest
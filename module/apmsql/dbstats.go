@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmsql // import "go.elastic.co/apm/module/apmsql/v2"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/sqlutil"
+)
+
+// DBStatsGatherer is an apm.MetricsGatherer which reports the connection
+// pool statistics of a *sql.DB, as returned by sql.DB.Stats.
+//
+// The metrics are labeled with the driver name and, if specified with
+// WithDBStatsDatabase, the database name, so that multiple pools can be
+// distinguished.
+type DBStatsGatherer struct {
+	db                *sql.DB
+	labels            []apm.MetricLabel
+	driverName        string
+	acquireSpanType   string
+	connWaitThreshold time.Duration
+}
+
+// NewDBStatsGatherer returns a new DBStatsGatherer for db. The result
+// should be registered with a tracer using Tracer.RegisterMetricsGatherer:
+//
+//	g := apmsql.NewDBStatsGatherer(db, apmsql.WithDBStatsDatabase("orders"))
+//	deregister := apm.DefaultTracer().RegisterMetricsGatherer(g)
+//	defer deregister()
+func NewDBStatsGatherer(db *sql.DB, opts ...DBStatsOption) *DBStatsGatherer {
+	var cfg dbStatsConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.driverName == "" {
+		cfg.driverName = dbDriverName(db)
+	}
+	g := &DBStatsGatherer{
+		db:                db,
+		driverName:        cfg.driverName,
+		acquireSpanType:   fmt.Sprintf("db.%s.acquire", cfg.driverName),
+		connWaitThreshold: cfg.connWaitThreshold,
+	}
+	// Labels must be sorted lexicographically.
+	if cfg.databaseName != "" {
+		g.labels = append(g.labels, apm.MetricLabel{Name: "database", Value: cfg.databaseName})
+	}
+	g.labels = append(g.labels, apm.MetricLabel{Name: "driver", Value: cfg.driverName})
+	return g
+}
+
+// GatherMetrics gathers the connection pool statistics into m.
+func (g *DBStatsGatherer) GatherMetrics(ctx context.Context, m *apm.Metrics) error {
+	stats := g.db.Stats()
+	m.Add("db.sql.connections.max_open", g.labels, float64(stats.MaxOpenConnections))
+	m.Add("db.sql.connections.open", g.labels, float64(stats.OpenConnections))
+	m.Add("db.sql.connections.in_use", g.labels, float64(stats.InUse))
+	m.Add("db.sql.connections.idle", g.labels, float64(stats.Idle))
+	m.Add("db.sql.connections.wait.count", g.labels, float64(stats.WaitCount))
+	m.Add("db.sql.connections.wait.duration.us", g.labels, float64(stats.WaitDuration/time.Microsecond))
+	m.Add("db.sql.connections.max_idle_closed", g.labels, float64(stats.MaxIdleClosed))
+	m.Add("db.sql.connections.max_idle_time_closed", g.labels, float64(stats.MaxIdleTimeClosed))
+	m.Add("db.sql.connections.max_lifetime_closed", g.labels, float64(stats.MaxLifetimeClosed))
+	return nil
+}
+
+// Conn returns a single connection from the pool, as in sql.DB.Conn.
+//
+// If the gatherer was created with WithConnWaitSpanThreshold, and
+// acquiring the connection took at least that long, then a span
+// covering the acquisition will be reported for the transaction
+// in ctx. This can be used to identify requests which are delayed
+// due to connection pool exhaustion.
+func (g *DBStatsGatherer) Conn(ctx context.Context) (*sql.Conn, error) {
+	if g.connWaitThreshold <= 0 {
+		return g.db.Conn(ctx)
+	}
+	tx := apm.TransactionFromContext(ctx)
+	if tx == nil {
+		return g.db.Conn(ctx)
+	}
+	start := time.Now()
+	conn, err := g.db.Conn(ctx)
+	if duration := time.Since(start); duration >= g.connWaitThreshold {
+		span, _ := apm.StartSpanOptions(ctx, "acquire connection", g.acquireSpanType, apm.SpanOptions{
+			Start: start,
+		})
+		span.Duration = duration
+		if err != nil {
+			span.Outcome = "failure"
+		}
+		span.End()
+	}
+	return conn, err
+}
+
+// DBStatsOption is an option that can be supplied to NewDBStatsGatherer.
+type DBStatsOption func(*dbStatsConfig)
+
+type dbStatsConfig struct {
+	driverName        string
+	databaseName      string
+	connWaitThreshold time.Duration
+}
+
+// WithDBStatsDriverName returns a DBStatsOption which sets the driver
+// name used to label metrics. If WithDBStatsDriverName is not supplied,
+// the driver name will be inferred from the database's driver.
+func WithDBStatsDriverName(name string) DBStatsOption {
+	return func(cfg *dbStatsConfig) {
+		cfg.driverName = name
+	}
+}
+
+// WithDBStatsDatabase returns a DBStatsOption which sets the database
+// name used to label metrics. By default, metrics are not labeled with
+// a database name.
+func WithDBStatsDatabase(name string) DBStatsOption {
+	return func(cfg *dbStatsConfig) {
+		cfg.databaseName = name
+	}
+}
+
+// WithConnWaitSpanThreshold returns a DBStatsOption which enables the
+// reporting of spans by DBStatsGatherer.Conn, for connection acquisitions
+// that take at least the specified duration. By default, no such spans
+// are reported.
+func WithConnWaitSpanThreshold(d time.Duration) DBStatsOption {
+	return func(cfg *dbStatsConfig) {
+		cfg.connWaitThreshold = d
+	}
+}
+
+func dbDriverName(db *sql.DB) string {
+	if d, ok := db.Driver().(*tracingDriver); ok {
+		return d.driverName
+	}
+	return sqlutil.DriverName(db.Driver())
+}
@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmsql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/module/apmsql/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+)
+
+func TestDBStatsGatherer(t *testing.T) {
+	db, err := apmsql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(2)
+
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.RegisterMetricsGatherer(apmsql.NewDBStatsGatherer(db, apmsql.WithDBStatsDatabase("main")))
+	tracer.SendMetrics(nil)
+
+	var metrics *model.Metrics
+	for _, m := range tracer.Payloads().Metrics {
+		if len(m.Labels) > 0 {
+			metrics = &m
+			break
+		}
+	}
+	require.NotNil(t, metrics)
+	assert.Equal(t, model.StringMap{
+		{Key: "database", Value: "main"},
+		{Key: "driver", Value: "sqlite3"},
+	}, metrics.Labels)
+	assert.Equal(t, map[string]model.Metric{
+		"db.sql.connections.max_open":             {Value: 2},
+		"db.sql.connections.open":                 {Value: 1},
+		"db.sql.connections.in_use":               {Value: 1},
+		"db.sql.connections.idle":                 {Value: 0},
+		"db.sql.connections.wait.count":           {Value: 0},
+		"db.sql.connections.wait.duration.us":     {Value: 0},
+		"db.sql.connections.max_idle_closed":      {Value: 0},
+		"db.sql.connections.max_idle_time_closed": {Value: 0},
+		"db.sql.connections.max_lifetime_closed":  {Value: 0},
+	}, metrics.Samples)
+}
+
+func TestDBStatsGathererConnWaitSpan(t *testing.T) {
+	db, err := apmsql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	db.Ping() // connect
+
+	g := apmsql.NewDBStatsGatherer(db, apmsql.WithConnWaitSpanThreshold(10*time.Millisecond))
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		// Acquiring the first connection should not wait.
+		conn, err := g.Conn(ctx)
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			conn.Close()
+		}()
+		conn, err = g.Conn(ctx)
+		require.NoError(t, err)
+		conn.Close()
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, "acquire connection", spans[0].Name)
+	assert.Equal(t, "db", spans[0].Type)
+	assert.Equal(t, "sqlite3", spans[0].Subtype)
+	assert.Equal(t, "acquire", spans[0].Action)
+	assert.GreaterOrEqual(t, spans[0].Duration, 10.0)
+}
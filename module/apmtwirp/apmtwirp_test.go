@@ -0,0 +1,165 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmtwirp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twitchtv/twirp"
+	"github.com/twitchtv/twirp/example"
+
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/module/apmtwirp/v2"
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/apmtest"
+	"go.elastic.co/apm/v2/model"
+)
+
+const makeHatMethod = "/twitch.twirp.example.Haberdasher/MakeHat"
+
+type haberdasher struct{}
+
+func (haberdasher) MakeHat(ctx context.Context, size *example.Size) (*example.Hat, error) {
+	if apm.TransactionFromContext(ctx) == nil {
+		return nil, twirp.InternalError("no transaction in context")
+	}
+	switch {
+	case size.Inches < 0:
+		return nil, twirp.InvalidArgumentError("inches", "must be positive")
+	case size.Inches == 0:
+		return nil, twirp.NewError(twirp.Unavailable, "out of hats")
+	}
+	return &example.Hat{Size: size.Inches, Color: "blue", Name: "bowler"}, nil
+}
+
+func newServer(t *testing.T, tracer *apm.Tracer, wrap bool) *httptest.Server {
+	var handler http.Handler = example.NewHaberdasherServer(
+		haberdasher{},
+		twirp.WithServerHooks(apmtwirp.NewServerHooks(apmtwirp.WithTracer(tracer))),
+	)
+	if wrap {
+		handler = apmhttp.Wrap(handler, apmhttp.WithTracer(tracer))
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientServer(t *testing.T) {
+	serverTracer := apmtest.NewRecordingTracer()
+	defer serverTracer.Close()
+	server := newServer(t, serverTracer.Tracer, true)
+
+	client := example.NewHaberdasherProtobufClient(
+		server.URL, server.Client(),
+		twirp.WithClientInterceptors(apmtwirp.NewClientInterceptor()),
+	)
+	clientTracer := apmtest.NewRecordingTracer()
+	defer clientTracer.Close()
+	tx, spans, _ := clientTracer.WithTransaction(func(ctx context.Context) {
+		hat, err := client.MakeHat(ctx, &example.Size{Inches: 7})
+		require.NoError(t, err)
+		assert.Equal(t, "bowler", hat.Name)
+	})
+
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, makeHatMethod, span.Name)
+	assert.Equal(t, "external", span.Type)
+	assert.Equal(t, "twirp", span.Subtype)
+	assert.Equal(t, "success", span.Outcome)
+	assert.Equal(t, tx.ID, span.ParentID)
+	assert.Equal(t, &model.ServiceTargetSpanContext{
+		Type: "twirp",
+		Name: "twitch.twirp.example.Haberdasher",
+	}, span.Context.Service.Target)
+
+	serverTracer.Flush(nil)
+	transactions := serverTracer.Payloads().Transactions
+	require.Len(t, transactions, 1)
+	serverTx := transactions[0]
+	assert.Equal(t, makeHatMethod, serverTx.Name)
+	assert.Equal(t, "request", serverTx.Type)
+	assert.Equal(t, "HTTP 2xx", serverTx.Result)
+	assert.Equal(t, "success", serverTx.Outcome)
+	assert.Equal(t, tx.TraceID, serverTx.TraceID)
+	assert.Equal(t, span.ID, serverTx.ParentID)
+	assert.Equal(t, "twirp", serverTx.Context.Service.Framework.Name)
+}
+
+func TestClientServerError(t *testing.T) {
+	serverTracer := apmtest.NewRecordingTracer()
+	defer serverTracer.Close()
+	server := newServer(t, serverTracer.Tracer, true)
+
+	client := example.NewHaberdasherJSONClient(
+		server.URL, server.Client(),
+		twirp.WithClientInterceptors(apmtwirp.NewClientInterceptor()),
+	)
+	clientTracer := apmtest.NewRecordingTracer()
+	defer clientTracer.Close()
+	_, spans, _ := clientTracer.WithTransaction(func(ctx context.Context) {
+		_, err := client.MakeHat(ctx, &example.Size{Inches: 0})
+		assert.Error(t, err)
+		_, err = client.MakeHat(ctx, &example.Size{Inches: -1})
+		assert.Error(t, err)
+	})
+
+	require.Len(t, spans, 2)
+	for i, code := range []string{"unavailable", "invalid_argument"} {
+		assert.Equal(t, "failure", spans[i].Outcome)
+		assert.Equal(t, model.IfaceMap{{Key: "twirp_error_code", Value: code}}, spans[i].Context.Tags)
+	}
+
+	serverTracer.Flush(nil)
+	transactions := serverTracer.Payloads().Transactions
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "HTTP 5xx", transactions[0].Result)
+	assert.Equal(t, "failure", transactions[0].Outcome)
+	assert.Equal(t, "HTTP 4xx", transactions[1].Result)
+	assert.Equal(t, "success", transactions[1].Outcome)
+	assert.Equal(t, model.IfaceMap{{Key: "twirp_error_code", Value: "invalid_argument"}}, transactions[1].Context.Tags)
+}
+
+func TestServerHooksTransaction(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	server := newServer(t, tracer.Tracer, false)
+
+	client := example.NewHaberdasherProtobufClient(server.URL, server.Client())
+	_, err := client.MakeHat(context.Background(), &example.Size{Inches: 7})
+	require.NoError(t, err)
+	_, err = client.MakeHat(context.Background(), &example.Size{Inches: 0})
+	require.Error(t, err)
+
+	tracer.Flush(nil)
+	transactions := tracer.Payloads().Transactions
+	require.Len(t, transactions, 2)
+	assert.Equal(t, makeHatMethod, transactions[0].Name)
+	assert.Equal(t, "request", transactions[0].Type)
+	assert.Equal(t, "HTTP 2xx", transactions[0].Result)
+	assert.Equal(t, "success", transactions[0].Outcome)
+	assert.Equal(t, makeHatMethod, transactions[1].Name)
+	assert.Equal(t, "HTTP 5xx", transactions[1].Result)
+	assert.Equal(t, "failure", transactions[1].Outcome)
+}
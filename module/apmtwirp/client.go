@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmtwirp // import "go.elastic.co/apm/module/apmtwirp/v2"
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/twitchtv/twirp"
+
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+)
+
+// NewClientInterceptor returns a twirp.Interceptor that traces Twirp
+// client requests with the given options, for passing to the generated
+// client constructor with twirp.WithClientInterceptors.
+//
+// The interceptor will trace spans with the "external.twirp" type for
+// each request made with a context containing a sampled apm.Transaction,
+// named after the RPC method. The trace context is propagated in the
+// request headers.
+//
+// Any error returned by the request sets the span outcome to "failure",
+// and the code of a Twirp error is recorded in the "twirp_error_code" label.
+func NewClientInterceptor(o ...ClientOption) twirp.Interceptor {
+	opts := clientOptions{}
+	for _, o := range o {
+		o(&opts)
+	}
+	return func(next twirp.Method) twirp.Method {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tx := apm.TransactionFromContext(ctx)
+			if tx == nil {
+				return next(ctx, req)
+			}
+			propagator := opts.propagator
+			if propagator == nil {
+				propagator = apmhttp.DefaultPropagator()
+			}
+
+			var span *apm.Span
+			traceContext := tx.TraceContext()
+			if traceContext.Options.Recorded() {
+				service, _ := twirp.ServiceName(ctx)
+				if pkg, _ := twirp.PackageName(ctx); pkg != "" {
+					service = pkg + "." + service
+				}
+				span = tx.StartExitSpan(methodName(ctx), "external.twirp", apm.SpanFromContext(ctx))
+				if !span.Dropped() {
+					traceContext = span.TraceContext()
+					ctx = apm.ContextWithSpan(ctx, span)
+					span.Context.SetServiceTarget(apm.ServiceTargetSpanContext{
+						Name: service,
+					})
+				}
+				defer span.End()
+			}
+
+			header, _ := twirp.HTTPRequestHeaders(ctx)
+			header = header.Clone()
+			if header == nil {
+				header = make(http.Header)
+			}
+			propagator.Inject(apmhttp.HeaderCarrier(header), traceContext, apmhttp.InjectOptions{
+				PropagateLegacyHeader: tx.ShouldPropagateLegacyHeader(),
+			})
+			if headerCtx, err := twirp.WithHTTPRequestHeaders(ctx, header); err == nil {
+				ctx = headerCtx
+			}
+
+			resp, err := next(ctx, req)
+			if span != nil && span.Outcome == "" {
+				span.Outcome = "success"
+				if err != nil {
+					span.Outcome = "failure"
+					var twerr twirp.Error
+					if errors.As(err, &twerr) && !span.Dropped() {
+						span.Context.SetLabel("twirp_error_code", string(twerr.Code()))
+					}
+				}
+			}
+			return resp, err
+		}
+	}
+}
+
+type clientOptions struct {
+	propagator apmhttp.Propagator
+}
+
+// ClientOption sets options for client-side tracing.
+type ClientOption func(*clientOptions)
+
+// WithClientPropagator returns a ClientOption which sets p as the
+// propagator used for injecting trace context in request headers.
+// By default, apmhttp.DefaultPropagator() is used.
+func WithClientPropagator(p apmhttp.Propagator) ClientOption {
+	if p == nil {
+		panic("p == nil")
+	}
+	return func(o *clientOptions) {
+		o.propagator = p
+	}
+}
@@ -0,0 +1,156 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmtwirp // import "go.elastic.co/apm/module/apmtwirp/v2"
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/twitchtv/twirp"
+
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/stacktrace"
+)
+
+func init() {
+	stacktrace.RegisterLibraryPackage("github.com/twitchtv/twirp")
+}
+
+type transactionKey struct{}
+
+// NewServerHooks returns a *twirp.ServerHooks that traces Twirp server
+// requests with the given options, for passing to the generated server
+// constructor with twirp.WithServerHooks.
+//
+// The transaction in the request context, such as one started by wrapping
+// the server with apmhttp.Wrap, is renamed after the RPC method, such as
+// "/twitch.twirp.example.Haberdasher/MakeHat". Wrapping the server with
+// apmhttp.Wrap is recommended, as this enables trace context propagation
+// and records the HTTP request details. If the request context holds no
+// transaction, the hooks start a transaction with the "request" type,
+// and end it once the response has been sent.
+//
+// Twirp error codes which are not subject to client interpretation, such
+// as "internal" and "unavailable", set the transaction outcome to "failure".
+// The code of any error is recorded in the "twirp_error_code" label.
+//
+// By default, the hooks will trace with apm.DefaultTracer(). Use
+// WithTracer to specify an alternative tracer.
+func NewServerHooks(o ...ServerOption) *twirp.ServerHooks {
+	opts := serverOptions{
+		tracer: apm.DefaultTracer(),
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+	return &twirp.ServerHooks{
+		RequestReceived: func(ctx context.Context) (context.Context, error) {
+			if apm.TransactionFromContext(ctx) != nil || !opts.tracer.Recording() {
+				return ctx, nil
+			}
+			tx := opts.tracer.StartTransaction(methodName(ctx), "request")
+			ctx = context.WithValue(ctx, transactionKey{}, tx)
+			return apm.ContextWithTransaction(ctx, tx), nil
+		},
+		RequestRouted: func(ctx context.Context) (context.Context, error) {
+			if tx := apm.TransactionFromContext(ctx); tx != nil {
+				tx.Name = methodName(ctx)
+				tx.Context.SetFramework("twirp", "")
+			}
+			return ctx, nil
+		},
+		Error: func(ctx context.Context, err twirp.Error) context.Context {
+			tx := apm.TransactionFromContext(ctx)
+			if tx == nil {
+				return ctx
+			}
+			if tx.Outcome == "" {
+				tx.Outcome = serverOutcome(err.Code())
+			}
+			if tx.Sampled() {
+				tx.Context.SetLabel("twirp_error_code", string(err.Code()))
+			}
+			return ctx
+		},
+		ResponseSent: func(ctx context.Context) {
+			tx, ok := ctx.Value(transactionKey{}).(*apm.Transaction)
+			if !ok {
+				return
+			}
+			if code, ok := twirp.StatusCode(ctx); ok {
+				if statusCode, err := strconv.Atoi(code); err == nil {
+					tx.Result = apmhttp.StatusCodeResult(statusCode)
+				}
+			}
+			if tx.Outcome == "" {
+				tx.Outcome = "success"
+			}
+			tx.End()
+		},
+	}
+}
+
+// serverOutcome returns the transaction outcome for a Twirp error code.
+//
+// For servers, the transaction outcome is generally "success", except
+// for codes which are not subject to client interpretation.
+func serverOutcome(code twirp.ErrorCode) string {
+	switch code {
+	case twirp.Unknown,
+		twirp.DeadlineExceeded,
+		twirp.ResourceExhausted,
+		twirp.FailedPrecondition,
+		twirp.Aborted,
+		twirp.Internal,
+		twirp.Unavailable,
+		twirp.DataLoss:
+		return "failure"
+	}
+	return "success"
+}
+
+// methodName returns the full name of the RPC method in ctx,
+// such as "/twitch.twirp.example.Haberdasher/MakeHat".
+func methodName(ctx context.Context) string {
+	pkg, _ := twirp.PackageName(ctx)
+	service, _ := twirp.ServiceName(ctx)
+	method, _ := twirp.MethodName(ctx)
+	if pkg != "" {
+		service = pkg + "." + service
+	}
+	return "/" + service + "/" + method
+}
+
+type serverOptions struct {
+	tracer *apm.Tracer
+}
+
+// ServerOption sets options for server-side tracing.
+type ServerOption func(*serverOptions)
+
+// WithTracer returns a ServerOption which sets t as the tracer
+// to use for tracing server requests.
+func WithTracer(t *apm.Tracer) ServerOption {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(o *serverOptions) {
+		o.tracer = t
+	}
+}
@@ -0,0 +1,527 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm // import "go.elastic.co/apm/v2"
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"go.elastic.co/apm/v2/internal/wildcard"
+	"go.elastic.co/apm/v2/model"
+)
+
+var (
+	// RedactCreditCardNumbers is a RedactionRule which redacts
+	// sequences of 13 to 19 digits, optionally separated by spaces
+	// or dashes, which pass the Luhn checksum.
+	RedactCreditCardNumbers = RedactionRule{
+		Pattern:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		name:     "credit_card_number",
+		validate: luhnValid,
+	}
+
+	// RedactBearerTokens is a RedactionRule which redacts bearer
+	// tokens, such as those in "Authorization: Bearer <token>".
+	RedactBearerTokens = RedactionRule{
+		Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`),
+		name:    "bearer_token",
+	}
+)
+
+// RedactionRule defines values to be redacted from captured data, in
+// addition to those redacted by ELASTIC_APM_SANITIZE_FIELD_NAMES.
+//
+// Exactly one of JSONPath or Pattern must be set.
+type RedactionRule struct {
+	// JSONPath, if non-empty, identifies values to redact from captured
+	// JSON request and response bodies. JSONPath must begin with "$",
+	// followed by any number of object keys (".name") or array indices
+	// ("[0]"); "*" or "[*]" matches any object key or array index.
+	// For example, "$.customer.cards[*].number".
+	//
+	// If the path identifies an object or array, the entire object or
+	// array is redacted.
+	JSONPath string
+
+	// Pattern, if non-nil, is matched against captured request and
+	// response bodies, URL query values, database statements, and
+	// string values in custom context. Matching text is redacted.
+	Pattern *regexp.Regexp
+
+	// name holds the name of a built-in rule, used for
+	// parsing and formatting configuration.
+	name string
+
+	// validate, if non-nil, is called with each match of Pattern,
+	// and the match is only redacted if validate returns true.
+	validate func(string) bool
+}
+
+func (r RedactionRule) String() string {
+	switch {
+	case r.name != "":
+		return r.name
+	case r.JSONPath != "":
+		return r.JSONPath
+	case r.Pattern != nil:
+		return r.Pattern.String()
+	}
+	return ""
+}
+
+// redactor redacts values matching a set of RedactionRules.
+//
+// A nil *redactor is valid, and redacts nothing.
+type redactor struct {
+	rules     []RedactionRule
+	jsonPaths [][]string
+	patterns  []RedactionRule
+}
+
+func newRedactor(rules []RedactionRule) (*redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	r := &redactor{rules: rules}
+	for _, rule := range rules {
+		switch {
+		case rule.JSONPath != "" && rule.Pattern != nil:
+			return nil, errors.Errorf("redaction rule must not set both JSONPath and Pattern")
+		case rule.JSONPath != "":
+			path, err := parseJSONPath(rule.JSONPath)
+			if err != nil {
+				return nil, err
+			}
+			r.jsonPaths = append(r.jsonPaths, path)
+		case rule.Pattern != nil:
+			r.patterns = append(r.patterns, rule)
+		default:
+			return nil, errors.Errorf("redaction rule must set either JSONPath or Pattern")
+		}
+	}
+	return r, nil
+}
+
+func (r *redactor) String() string {
+	if r == nil {
+		return ""
+	}
+	values := make([]string, len(r.rules))
+	for i, rule := range r.rules {
+		values[i] = rule.String()
+	}
+	return strings.Join(values, ", ")
+}
+
+// redactString returns s with text matching any of the
+// redactor's patterns replaced with "[REDACTED]".
+func (r *redactor) redactString(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, rule := range r.patterns {
+		s = rule.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if rule.validate != nil && !rule.validate(match) {
+				return match
+			}
+			return redacted
+		})
+	}
+	return s
+}
+
+// matchJSONPath reports whether path matches any of the
+// redactor's JSON paths.
+func (r *redactor) matchJSONPath(path []string) bool {
+	if r == nil {
+		return false
+	}
+outer:
+	for _, p := range r.jsonPaths {
+		if len(p) != len(path) {
+			continue
+		}
+		for i, segment := range p {
+			if segment != "*" && segment != path[i] {
+				continue outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// parseJSONPath parses a JSON path of the form "$.a.b[0].c",
+// returning its segments.
+func parseJSONPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.Errorf("invalid JSON path %q: must begin with '$'", path)
+	}
+	var segments []string
+	for rest := path[1:]; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, errors.Errorf("invalid JSON path %q: empty key", path)
+			}
+			segments = append(segments, rest[1:end+1])
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, errors.Errorf("invalid JSON path %q: unterminated '['", path)
+			}
+			index := rest[1:end]
+			if index != "*" {
+				if _, err := strconv.Atoi(index); err != nil {
+					return nil, errors.Errorf("invalid JSON path %q: invalid index %q", path, index)
+				}
+			}
+			segments = append(segments, index)
+			rest = rest[end+1:]
+		default:
+			return nil, errors.Errorf("invalid JSON path %q: unexpected %q", path, rest[0])
+		}
+	}
+	return segments, nil
+}
+
+// parseRedactionRules parses a comma-separated list of redaction
+// rules: JSON paths, and the names of built-in rules.
+func parseRedactionRules(value string) ([]RedactionRule, error) {
+	var rules []RedactionRule
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+			continue
+		case strings.HasPrefix(field, "$"):
+			rules = append(rules, RedactionRule{JSONPath: field})
+		case field == RedactCreditCardNumbers.name:
+			rules = append(rules, RedactCreditCardNumbers)
+		case field == RedactBearerTokens.name:
+			rules = append(rules, RedactBearerTokens)
+		default:
+			return nil, errors.Errorf("invalid redaction rule %q", field)
+		}
+	}
+	return rules, nil
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return sum%10 == 0
+}
+
+// sanitizeBody returns body with the values of JSON object fields whose
+// keys match any of the given wildcard patterns, and values identified by
+// the redactor's JSON paths, redacted. Text matching the redactor's
+// patterns is redacted regardless of whether body is JSON.
+//
+// The body is not required to be valid JSON, so it may be truncated.
+func sanitizeBody(body string, matchers wildcard.Matchers, r *redactor) string {
+	trimmed := strings.TrimSpace(body)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return r.redactString(body)
+	}
+	s := jsonSanitizer{matchers: matchers, redactor: r}
+	return s.sanitize(body)
+}
+
+// jsonSanitizer redacts values from JSON text.
+type jsonSanitizer struct {
+	matchers wildcard.Matchers
+	redactor *redactor
+
+	b       strings.Builder
+	stack   []jsonContainer
+	path    []string
+	changed bool
+}
+
+type jsonContainer struct {
+	object  bool
+	wantKey bool
+	key     string
+	index   int
+}
+
+func (s *jsonSanitizer) sanitize(in string) string {
+	s.b.Grow(len(in))
+	for i := 0; i < len(in); {
+		c := in[i]
+		switch c {
+		case '{', '[':
+			if s.redactValue() {
+				s.writeRedacted()
+				i = skipJSONContainer(in, i)
+				continue
+			}
+			s.stack = append(s.stack, jsonContainer{object: c == '{', wantKey: c == '{'})
+			s.b.WriteByte(c)
+			i++
+		case '}', ']':
+			if len(s.stack) != 0 {
+				s.stack = s.stack[:len(s.stack)-1]
+			}
+			s.b.WriteByte(c)
+			i++
+		case ',':
+			if n := len(s.stack); n != 0 {
+				top := &s.stack[n-1]
+				if top.object {
+					top.wantKey = true
+				} else {
+					top.index++
+				}
+			}
+			s.b.WriteByte(c)
+			i++
+		case ' ', '\t', '\r', '\n', ':':
+			s.b.WriteByte(c)
+			i++
+		case '"':
+			end := skipJSONString(in, i)
+			raw := in[i:end]
+			if n := len(s.stack); n != 0 && s.stack[n-1].object && s.stack[n-1].wantKey {
+				top := &s.stack[n-1]
+				top.key = unquoteJSONKey(raw)
+				top.wantKey = false
+				s.b.WriteString(raw)
+			} else if s.redactValue() {
+				s.writeRedacted()
+			} else if redactedRaw := s.redactor.redactString(raw); redactedRaw != raw {
+				s.b.WriteString(redactedRaw)
+				s.changed = true
+			} else {
+				s.b.WriteString(raw)
+			}
+			i = end
+		default:
+			// Number, true, false, null, or invalid JSON.
+			end := i + 1
+			for end < len(in) && !strings.ContainsRune(",:{}[]\" \t\r\n", rune(in[end])) {
+				end++
+			}
+			raw := in[i:end]
+			if s.redactValue() || s.redactor.redactString(raw) != raw {
+				s.writeRedacted()
+			} else {
+				s.b.WriteString(raw)
+			}
+			i = end
+		}
+	}
+	if !s.changed {
+		return in
+	}
+	return s.b.String()
+}
+
+// redactValue reports whether the value at the current position should
+// be redacted, due to its key matching s.matchers, or its path matching
+// one of the redactor's JSON paths.
+func (s *jsonSanitizer) redactValue() bool {
+	n := len(s.stack)
+	if n != 0 && s.stack[n-1].object && s.matchers.MatchAny(s.stack[n-1].key) {
+		return true
+	}
+	if s.redactor == nil || len(s.redactor.jsonPaths) == 0 {
+		return false
+	}
+	s.path = s.path[:0]
+	for _, c := range s.stack {
+		if c.object {
+			s.path = append(s.path, c.key)
+		} else {
+			s.path = append(s.path, strconv.Itoa(c.index))
+		}
+	}
+	return s.redactor.matchJSONPath(s.path)
+}
+
+func (s *jsonSanitizer) writeRedacted() {
+	s.b.WriteString(`"` + redacted + `"`)
+	s.changed = true
+}
+
+// skipJSONString returns the index following the JSON string starting
+// at in[i], or len(in) if the string is unterminated.
+func skipJSONString(in string, i int) int {
+	for i++; i < len(in); i++ {
+		switch in[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(in)
+}
+
+// skipJSONContainer returns the index following the JSON object or array
+// starting at in[i], or len(in) if the object or array is unterminated.
+func skipJSONContainer(in string, i int) int {
+	var depth int
+	for i < len(in) {
+		switch in[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '"':
+			i = skipJSONString(in, i)
+			continue
+		}
+		i++
+	}
+	return len(in)
+}
+
+func unquoteJSONKey(raw string) string {
+	var key string
+	if err := json.Unmarshal([]byte(raw), &key); err != nil {
+		return strings.Trim(raw, `"`)
+	}
+	return key
+}
+
+// sanitizeQuery returns the URL query string with the values of parameters
+// whose names match any of the given wildcard patterns, or whose values
+// match any of the redactor's patterns, replaced with "[REDACTED]".
+func sanitizeQuery(query string, matchers wildcard.Matchers, r *redactor) string {
+	var b strings.Builder
+	var changed bool
+	for i, param := range strings.Split(query, "&") {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		key, value, hasValue := strings.Cut(param, "=")
+		if hasValue && value != "" {
+			name, err := url.QueryUnescape(key)
+			if err != nil {
+				name = key
+			}
+			unescaped, err := url.QueryUnescape(value)
+			if err != nil {
+				unescaped = value
+			}
+			if matchers.MatchAny(name) || r.redactString(unescaped) != unescaped {
+				b.WriteString(key + "=" + redacted)
+				changed = true
+				continue
+			}
+		}
+		b.WriteString(param)
+	}
+	if !changed {
+		return query
+	}
+	return b.String()
+}
+
+// sanitizeCustom redacts custom context values whose keys match any of
+// the given wildcard patterns, and text in string values matching any
+// of the redactor's patterns. Maps and slices are copied before they
+// are modified.
+func sanitizeCustom(custom model.IfaceMap, matchers wildcard.Matchers, r *redactor) {
+	for i := range custom {
+		item := &custom[i]
+		if matchers.MatchAny(item.Key) {
+			item.Value = redacted
+			continue
+		}
+		item.Value, _ = sanitizeCustomValue(item.Value, matchers, r)
+	}
+}
+
+// sanitizeCustomValue returns v with its sensitive values redacted,
+// and a boolean indicating whether any values were redacted.
+func sanitizeCustomValue(v interface{}, matchers wildcard.Matchers, r *redactor) (interface{}, bool) {
+	switch v := v.(type) {
+	case string:
+		sanitized := r.redactString(v)
+		return sanitized, sanitized != v
+	case map[string]interface{}:
+		var out map[string]interface{}
+		for k, value := range v {
+			sanitized, changed := interface{}(redacted), true
+			if !matchers.MatchAny(k) {
+				sanitized, changed = sanitizeCustomValue(value, matchers, r)
+			}
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = make(map[string]interface{}, len(v))
+				for k, value := range v {
+					out[k] = value
+				}
+			}
+			out[k] = sanitized
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	case []interface{}:
+		var out []interface{}
+		for i, value := range v {
+			sanitized, changed := sanitizeCustomValue(value, matchers, r)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = append([]interface{}(nil), v...)
+			}
+			out[i] = sanitized
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	}
+	return v, false
+}
@@ -0,0 +1,212 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/transport/transporttest"
+)
+
+func TestRedactionRulesRequest(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureBody(apm.CaptureBodyTransactions)
+	require.NoError(t, tracer.SetRedactionRules(
+		apm.RedactCreditCardNumbers,
+		apm.RedactBearerTokens,
+		apm.RedactionRule{JSONPath: "$.customer.ssn"},
+		apm.RedactionRule{JSONPath: "$.orders[*].address"},
+		apm.RedactionRule{Pattern: regexp.MustCompile(`ORD-\d+`)},
+	))
+
+	body := `{"customer": {"name": "Jane", "ssn": "123-45-6789", "password": "hunter2"},` +
+		` "orders": [{"id": "ORD-123", "address": {"city": "Perth"}, "card": "4111 1111 1111 1111"}],` +
+		` "note": "Bearer abc.def", "total": 4111111111111111, "count": 1234567890123}`
+	req, _ := http.NewRequest("POST", "http://server.testing/orders?q=books&api_token=abc&note=4111-1111-1111-1111", strings.NewReader(body))
+	bc := tracer.CaptureHTTPRequestBody(req)
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetHTTPRequest(req)
+	tx.Context.SetHTTPRequestBody(bc)
+	tx.End()
+	tracer.Flush(nil)
+
+	request := transport.Payloads().Transactions[0].Context.Request
+	assert.Equal(t, "q=books&api_token=[REDACTED]&note=[REDACTED]", request.URL.Search)
+	assert.Equal(t, `{"customer": {"name": "Jane", "ssn": "[REDACTED]", "password": "[REDACTED]"},`+
+		` "orders": [{"id": "[REDACTED]", "address": "[REDACTED]", "card": "[REDACTED]"}],`+
+		` "note": "[REDACTED]", "total": "[REDACTED]", "count": 1234567890123}`, request.Body.Raw)
+}
+
+func TestRedactionRulesNonJSONBody(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureBody(apm.CaptureBodyTransactions)
+	require.NoError(t, tracer.SetRedactionRules(apm.RedactBearerTokens))
+
+	req, _ := http.NewRequest("POST", "http://server.testing/", strings.NewReader("token: Bearer abc123=="))
+	bc := tracer.CaptureHTTPRequestBody(req)
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetHTTPRequest(req)
+	tx.Context.SetHTTPRequestBody(bc)
+	tx.End()
+	tracer.Flush(nil)
+
+	assert.Equal(t, "token: [REDACTED]", transport.Payloads().Transactions[0].Context.Request.Body.Raw)
+}
+
+func TestRedactionRulesUnset(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureBody(apm.CaptureBodyTransactions)
+
+	// Without redaction rules, sanitize_field_names only applies to
+	// headers, cookies and form fields.
+	body := `{"password": "hunter2", "name": "Jane"}`
+	req, _ := http.NewRequest("POST", "http://server.testing/?api_token=abc", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "secret")
+	bc := tracer.CaptureHTTPRequestBody(req)
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetHTTPRequest(req)
+	tx.Context.SetHTTPRequestBody(bc)
+	tx.Context.SetCustom("cardinality", 5)
+	tx.End()
+	tracer.Flush(nil)
+
+	context := transport.Payloads().Transactions[0].Context
+	assert.Equal(t, "api_token=abc", context.Request.URL.Search)
+	assert.Equal(t, body, context.Request.Body.Raw)
+	assert.Equal(t, []string{"[REDACTED]"}, context.Request.Headers[0].Values)
+	require.Len(t, context.Custom, 1)
+	assert.Equal(t, "cardinality", context.Custom[0].Key)
+	assert.Equal(t, float64(5), context.Custom[0].Value)
+}
+
+func TestRedactionRulesCustomContext(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	require.NoError(t, tracer.SetRedactionRules(apm.RedactCreditCardNumbers))
+
+	payment := map[string]interface{}{
+		"card":   "4111111111111111",
+		"amount": 10,
+		"items":  []interface{}{"book", "card 4111111111111111"},
+	}
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetCustom("payment", payment)
+	tx.Context.SetCustom("session_id", "abc")
+	tx.Context.SetCustom("comment", "paid with 4111 1111 1111 1111, not 4111 1111 1111 1112")
+	tx.End()
+	tracer.Flush(nil)
+
+	custom := transport.Payloads().Transactions[0].Context.Custom
+	require.Len(t, custom, 3) // sorted by key
+	assert.Equal(t, "paid with [REDACTED], not 4111 1111 1111 1112", custom[0].Value)
+	assert.Equal(t, map[string]interface{}{
+		"card":   "[REDACTED]",
+		"amount": float64(10),
+		"items":  []interface{}{"book", "card [REDACTED]"},
+	}, custom[1].Value)
+	assert.Equal(t, "[REDACTED]", custom[2].Value)
+
+	// The original values are not modified.
+	assert.Equal(t, "4111111111111111", payment["card"])
+	assert.Equal(t, "card 4111111111111111", payment["items"].([]interface{})[1])
+}
+
+func TestRedactionRulesDatabaseStatement(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	require.NoError(t, tracer.SetRedactionRules(apm.RedactCreditCardNumbers))
+
+	tx := tracer.StartTransaction("name", "type")
+	span := tx.StartSpan("SELECT FROM cards", "db.mysql.query", nil)
+	span.Context.SetDatabase(apm.DatabaseSpanContext{
+		Type:      "sql",
+		Statement: "SELECT * FROM cards WHERE number = '4111111111111111'",
+	})
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	spans := transport.Payloads().Spans
+	require.Len(t, spans, 1)
+	assert.Equal(t, "SELECT * FROM cards WHERE number = '[REDACTED]'", spans[0].Context.Database.Statement)
+}
+
+func TestRedactionRulesSpanURL(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	req, _ := http.NewRequest("GET", "http://server.testing/orders?q=books&api_token=abc", nil)
+	sendSpan := func() string {
+		tx := tracer.StartTransaction("name", "type")
+		span := tx.StartSpan("GET server.testing", "external.http", nil)
+		span.Context.SetHTTPRequest(req)
+		span.End()
+		tx.End()
+		tracer.Flush(nil)
+		spans := transport.Payloads().Spans
+		transport.ResetPayloads()
+		require.Len(t, spans, 1)
+		return spans[0].Context.HTTP.URL.RawQuery
+	}
+
+	// Without redaction rules, the query is not sanitized.
+	assert.Equal(t, "q=books&api_token=abc", sendSpan())
+
+	require.NoError(t, tracer.SetRedactionRules(apm.RedactBearerTokens))
+	assert.Equal(t, "q=books&api_token=[REDACTED]", sendSpan())
+	assert.Equal(t, "q=books&api_token=abc", req.URL.RawQuery)
+}
+
+func TestRedactionRulesEnv(t *testing.T) {
+	t.Setenv("ELASTIC_APM_REDACTION_RULES", "$.user.ssn, credit_card_number, bearer_token")
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	assert.Equal(t, "$.user.ssn, credit_card_number, bearer_token", effectiveConfig(tracer)["redaction_rules"].Value)
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetCustom("token", "Bearer abc")
+	tx.End()
+	tracer.Flush(nil)
+	assert.Equal(t, "[REDACTED]", transport.Payloads().Transactions[0].Context.Custom[0].Value)
+}
+
+func TestSetRedactionRulesInvalid(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	assert.EqualError(t, tracer.SetRedactionRules(apm.RedactionRule{}), "redaction rule must set either JSONPath or Pattern")
+	assert.EqualError(t, tracer.SetRedactionRules(apm.RedactionRule{JSONPath: "user.ssn"}), `invalid JSON path "user.ssn": must begin with '$'`)
+	assert.EqualError(t, tracer.SetRedactionRules(apm.RedactionRule{JSONPath: "$.items[x]"}), `invalid JSON path "$.items[x]": invalid index "x"`)
+	assert.EqualError(t, tracer.SetRedactionRules(apm.RedactionRule{
+		JSONPath: "$.a",
+		Pattern:  regexp.MustCompile("a"),
+	}), "redaction rule must not set both JSONPath and Pattern")
+}
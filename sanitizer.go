@@ -29,7 +29,11 @@ var redactedValues = []string{redacted}
 // sanitizeRequest sanitizes HTTP request data, redacting the
 // values of cookies, headers and forms whose corresponding keys
 // match any of the given wildcard patterns.
-func sanitizeRequest(r *model.Request, matchers wildcard.Matchers) {
+//
+// If redactor is non-nil, query parameters and JSON body fields
+// whose keys match the patterns, and values matching the redactor's
+// rules, are also redacted.
+func sanitizeRequest(r *model.Request, matchers wildcard.Matchers, redactor *redactor) {
 	for _, c := range r.Cookies {
 		if !matchers.MatchAny(c.Name) {
 			continue
@@ -45,6 +49,15 @@ func sanitizeRequest(r *model.Request, matchers wildcard.Matchers) {
 			r.Body.Form[key] = redactedValues
 		}
 	}
+	if redactor == nil {
+		return
+	}
+	if r.URL.Search != "" {
+		r.URL.Search = sanitizeQuery(r.URL.Search, matchers, redactor)
+	}
+	if r.Body != nil && r.Body.Raw != "" {
+		r.Body.Raw = sanitizeBody(r.Body.Raw, matchers, redactor)
+	}
 }
 
 // sanitizeResponse sanitizes HTTP response data, redacting
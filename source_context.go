@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm // import "go.elastic.co/apm/v2"
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.elastic.co/apm/v2/model"
+	"go.elastic.co/apm/v2/stacktrace"
+)
+
+const (
+	// sourceContextCacheSize is the maximum number of
+	// source files held in a sourceContextCache.
+	sourceContextCacheSize = 100
+
+	// sourceContextMaxFileSize is the maximum size of source files
+	// read for source context. Larger files are ignored.
+	sourceContextMaxFileSize = 1 << 20
+)
+
+// sourceContextCache reads and caches the lines of source files, for
+// setting the source context of stack frames.
+//
+// sourceContextCache is not safe for concurrent use. It is used only
+// by the tracer's background goroutine, through modelWriter.
+type sourceContextCache struct {
+	// files holds the lines of each cached file, keyed by the stack
+	// frame file path. A nil value indicates the file could not be
+	// read, and should not be read again.
+	files map[string][]string
+
+	// order holds the keys of files in the order they were
+	// added, for evicting the least recently added file.
+	order []string
+}
+
+// setContext sets the source context of frame to the given number of
+// lines, centered on the frame's line, reading the file from fsys or,
+// if fsys is nil or does not contain the file, from disk.
+func (c *sourceContextCache) setContext(frame *model.StacktraceFrame, in stacktrace.Frame, lines int, fsys fs.FS) {
+	if lines <= 0 || in.File == "" || in.Line <= 0 {
+		return
+	}
+	fileLines := c.fileLines(in.File, fsys)
+	if in.Line > len(fileLines) {
+		return
+	}
+	pre := (lines - 1) / 2
+	post := lines - 1 - pre
+	index := in.Line - 1
+	start := index - pre
+	if start < 0 {
+		start = 0
+	}
+	end := index + post + 1
+	if end > len(fileLines) {
+		end = len(fileLines)
+	}
+	frame.ContextLine = fileLines[index]
+	if start < index {
+		frame.PreContext = fileLines[start:index]
+	}
+	if index+1 < end {
+		frame.PostContext = fileLines[index+1 : end]
+	}
+}
+
+func (c *sourceContextCache) fileLines(file string, fsys fs.FS) []string {
+	if lines, ok := c.files[file]; ok {
+		return lines
+	}
+	if c.files == nil {
+		c.files = make(map[string][]string)
+	}
+	if len(c.order) >= sourceContextCacheSize {
+		delete(c.files, c.order[0])
+		c.order = c.order[1:]
+	}
+
+	var lines []string
+	if data, err := readSourceFile(file, fsys); err == nil {
+		lines = strings.Split(string(data), "\n")
+		for i, line := range lines {
+			lines[i] = truncateString(strings.TrimSuffix(line, "\r"))
+		}
+	}
+	c.files[file] = lines
+	c.order = append(c.order, file)
+	return lines
+}
+
+// readSourceFile reads the source file from fsys, if it is non-nil and
+// contains the file, and otherwise from disk if the file path is absolute.
+func readSourceFile(file string, fsys fs.FS) ([]byte, error) {
+	if fsys != nil {
+		// Remove leading directories until the file is found,
+		// so fsys may be rooted at any ancestor directory.
+		name := strings.TrimLeft(filepath.ToSlash(file), "/")
+		if vol := filepath.VolumeName(file); vol != "" {
+			name = strings.TrimLeft(strings.TrimPrefix(name, filepath.ToSlash(vol)), "/")
+		}
+		for name != "" {
+			if fs.ValidPath(name) {
+				data, err := readFileLimited(func() (fs.File, error) { return fsys.Open(name) })
+				if err == nil {
+					return data, nil
+				} else if !errors.Is(err, fs.ErrNotExist) {
+					return nil, err
+				}
+			}
+			slash := strings.IndexRune(name, '/')
+			if slash == -1 {
+				break
+			}
+			name = name[slash+1:]
+		}
+	}
+	if !filepath.IsAbs(file) {
+		return nil, fs.ErrNotExist
+	}
+	return readFileLimited(func() (fs.File, error) { return os.Open(file) })
+}
+
+func readFileLimited(open func() (fs.File, error)) ([]byte, error) {
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, sourceContextMaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > sourceContextMaxFileSize {
+		return nil, errors.New("source file too large")
+	}
+	return data, nil
+}
@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/model"
+	"go.elastic.co/apm/v2/transport/transporttest"
+)
+
+func TestSourceLinesErrorAppFrames(t *testing.T) {
+	t.Setenv("ELASTIC_APM_SOURCE_LINES_ERROR_APP_FRAMES", "3")
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.NewError(errors.New("boom")).Send()
+	tracer.Flush(nil)
+
+	errors := recorder.Payloads().Errors
+	require.Len(t, errors, 1)
+	frames := errors[0].Exception.Stacktrace
+	require.NotEmpty(t, frames)
+
+	source, err := os.ReadFile("source_context_test.go")
+	require.NoError(t, err)
+	lines := strings.Split(string(source), "\n")
+
+	frame := frames[0]
+	assert.Equal(t, "source_context_test.go", frame.File)
+	assert.Equal(t, "TestSourceLinesErrorAppFrames", frame.Function)
+	assert.Equal(t, "\ttracer.NewError(errors.New(\"boom\")).Send()", frame.ContextLine)
+	assert.Equal(t, lines[frame.Line-2:frame.Line-1], frame.PreContext)
+	assert.Equal(t, lines[frame.Line:frame.Line+1], frame.PostContext)
+
+	// Library frames have no source context.
+	for _, frame := range frames[1:] {
+		require.True(t, frame.LibraryFrame)
+		assert.Zero(t, frame.ContextLine)
+	}
+}
+
+func TestSourceLinesDisabled(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSpanStackTraceMinDuration(0)
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("name", "type", nil).End()
+	tx.End()
+	tracer.NewError(errors.New("boom")).Send()
+	tracer.Flush(nil)
+
+	payloads := recorder.Payloads()
+	require.Len(t, payloads.Errors, 1)
+	require.Len(t, payloads.Spans, 1)
+	for _, frames := range [][]model.StacktraceFrame{
+		payloads.Errors[0].Exception.Stacktrace,
+		payloads.Spans[0].Stacktrace,
+	} {
+		require.NotEmpty(t, frames)
+		for _, frame := range frames {
+			assert.Zero(t, frame.ContextLine)
+			assert.Nil(t, frame.PreContext)
+			assert.Nil(t, frame.PostContext)
+		}
+	}
+}
+
+func TestSourceLinesSpanAppFramesSourceFS(t *testing.T) {
+	t.Setenv("ELASTIC_APM_SOURCE_LINES_SPAN_APP_FRAMES", "5")
+
+	// The source file is located in SourceFS by removing leading
+	// directories from the stack frame's absolute file path.
+	var content strings.Builder
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	sourceFS := fstest.MapFS{
+		"source_context_test.go": &fstest.MapFile{Data: []byte(content.String())},
+	}
+	var recorder transporttest.RecorderTransport
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{
+		ServiceName: "transporttest",
+		Transport:   &recorder,
+		SourceFS:    sourceFS,
+	})
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.SetSpanStackTraceMinDuration(0)
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("name", "type", nil).End()
+	tx.End()
+	tracer.Flush(nil)
+
+	spans := recorder.Payloads().Spans
+	require.Len(t, spans, 1)
+	var frame model.StacktraceFrame
+	for _, f := range spans[0].Stacktrace {
+		if f.Function == "TestSourceLinesSpanAppFramesSourceFS" {
+			frame = f
+		}
+	}
+	require.NotZero(t, frame.Line)
+	assert.Equal(t, fmt.Sprintf("line %d", frame.Line), frame.ContextLine)
+	assert.Equal(t, []string{
+		fmt.Sprintf("line %d", frame.Line-2),
+		fmt.Sprintf("line %d", frame.Line-1),
+	}, frame.PreContext)
+	assert.Equal(t, []string{
+		fmt.Sprintf("line %d", frame.Line+1),
+		fmt.Sprintf("line %d", frame.Line+2),
+	}, frame.PostContext)
+}
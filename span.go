@@ -148,6 +148,8 @@ func (tx *Transaction) StartSpanOptions(name, spanType string, opts SpanOptions)
 		span.stackTraceLimit = tx.stackTraceLimit
 		span.compressedSpan.options = tx.compressedSpan.options
 		span.exitSpanMinDuration = tx.exitSpanMinDuration
+		span.Context.sanitizedFieldNames = tx.Context.sanitizedFieldNames
+		span.Context.redactor = tx.Context.redactor
 		tx.spansCreated++
 	}
 
@@ -201,6 +203,8 @@ func (t *Tracer) StartSpan(name, spanType string, transactionID SpanID, opts Spa
 	span.stackTraceLimit = instrumentationConfig.stackTraceLimit
 	span.compressedSpan.options = instrumentationConfig.compressionOptions
 	span.exitSpanMinDuration = instrumentationConfig.exitSpanMinDuration
+	span.Context.sanitizedFieldNames = instrumentationConfig.sanitizedFieldNames
+	span.Context.redactor = instrumentationConfig.redactor
 	if opts.ExitSpan {
 		span.exit = true
 	}
@@ -430,6 +434,17 @@ func (s *Span) End() {
 			}
 		}
 	}
+	if s.exit {
+		// Record the duration of exit spans even if they are dropped
+		// or unsampled, so the duration histograms are accurate.
+		tracer := s.tracer
+		if tracer == nil && s.tx != nil {
+			tracer = s.tx.tracer
+		}
+		if tracer != nil {
+			tracer.durationHistograms.recordSpan(s.SpanData)
+		}
+	}
 	switch {
 	case s.stackStackTraceMinDuration < 0:
 		// If s.stackFramesMinDuration < 0, we never set stacktrace.
@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"go.elastic.co/apm/v2/internal/apmhttputil"
+	"go.elastic.co/apm/v2/internal/wildcard"
 	"go.elastic.co/apm/v2/model"
 )
 
@@ -40,6 +41,8 @@ type SpanContext struct {
 	database             model.DatabaseSpanContext
 	http                 model.HTTPSpanContext
 	otel                 *model.OTel
+	sanitizedFieldNames  wildcard.Matchers
+	redactor             *redactor
 
 	// If SetDestinationService has been called, we do not auto-set its
 	// resource value on span end.
@@ -121,6 +124,14 @@ func (c *SpanContext) build() *model.SpanContext {
 	default:
 		return nil
 	}
+	if c.redactor != nil {
+		if c.model.Database != nil {
+			c.database.Statement = c.redactor.redactString(c.database.Statement)
+		}
+		if c.model.HTTP != nil && c.http.URL != nil && c.http.URL.RawQuery != "" {
+			c.http.URL.RawQuery = sanitizeQuery(c.http.URL.RawQuery, c.sanitizedFieldNames, c.redactor)
+		}
+	}
 	return &c.model
 }
 
@@ -188,7 +199,9 @@ func (c *SpanContext) SetDatabaseRowsAffected(n int64) {
 // SetHTTPRequest sets the details of the HTTP request in the context.
 //
 // This function relates to client requests. If the request URL contains
-// user info, it will be removed and excluded from the stored URL.
+// user info, it will be removed and excluded from the stored URL. If
+// redaction rules are configured, sensitive query parameters will be
+// redacted when the span is reported.
 //
 // SetHTTPRequest makes implicit calls to SetDestinationAddress and
 // SetDestinationService, using details from req.URL.
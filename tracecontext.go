@@ -61,6 +61,11 @@ var (
 
 const (
 	traceOptionsRecordedFlag = 0x01
+
+	// traceOptionsSamplingDeferredFlag is not a W3C trace flag; it is
+	// used only for trace context extracted from incoming requests,
+	// and is cleared when starting a transaction.
+	traceOptionsSamplingDeferredFlag = 0x80
 )
 
 // TraceContext holds trace context for an incoming or outgoing request.
@@ -161,6 +166,23 @@ func (o TraceOptions) WithRecorded(recorded bool) TraceOptions {
 	return o & (0xFF ^ traceOptionsRecordedFlag)
 }
 
+// SamplingDeferred reports whether the sampling decision for the trace
+// has been deferred to the receiver, in which case the "recorded" flag
+// is ignored and the tracer's sampler decides whether to record a
+// transaction continuing the trace.
+func (o TraceOptions) SamplingDeferred() bool {
+	return (o & traceOptionsSamplingDeferredFlag) == traceOptionsSamplingDeferredFlag
+}
+
+// WithSamplingDeferred changes the "sampling deferred" flag, and returns
+// the new options without modifying the original value.
+func (o TraceOptions) WithSamplingDeferred(deferred bool) TraceOptions {
+	if deferred {
+		return o | traceOptionsSamplingDeferredFlag
+	}
+	return o & (0xFF ^ traceOptionsSamplingDeferredFlag)
+}
+
 // TraceState holds vendor-specific state for a trace.
 type TraceState struct {
 	head *TraceStateEntry
@@ -22,6 +22,7 @@ import (
 	"compress/zlib"
 	"context"
 	"io"
+	"io/fs"
 	"log"
 	"math/rand"
 	"strings"
@@ -131,6 +132,42 @@ type TracerOptions struct {
 	//   MajorServerVersion(ctx context.Context, refreshStale bool) uint32
 	Transport transport.Transport
 
+	// ConfigFile holds the path to a YAML or JSON configuration file.
+	//
+	// If ConfigFile is empty, the path will be defined using the
+	// ELASTIC_APM_CONFIG_FILE environment variable, if set. The file
+	// holds an object mapping configuration setting names to values,
+	// e.g. "service_name" or "transaction_sample_rate". Environment
+	// variables take precedence over the settings in the file.
+	//
+	// The file's settings apply only to the tracer created with these
+	// options. Settings which are read once for the whole process, such
+	// as hostname, log_file and log_level, are not read from the file.
+	ConfigFile string
+
+	// ConfigFileWatchInterval holds the interval at which the configuration
+	// file will be polled for changes. Changes to settings which may be
+	// updated at runtime will be applied in the same way as central config,
+	// which takes precedence over the file.
+	//
+	// If ConfigFileWatchInterval is zero, the interval will be defined using
+	// the ELASTIC_APM_CONFIG_FILE_WATCH_INTERVAL environment variable, or if
+	// that is not set, the file will not be watched.
+	ConfigFileWatchInterval time.Duration
+
+	// SourceFS holds a file system from which to read source code, for
+	// recording the source lines surrounding application stack frames.
+	// Source lines are only recorded if enabled with the environment
+	// variables ELASTIC_APM_SOURCE_LINES_ERROR_APP_FRAMES and
+	// ELASTIC_APM_SOURCE_LINES_SPAN_APP_FRAMES.
+	//
+	// Source files are located in SourceFS by successively removing
+	// leading directories from the stack frame's file path until a file
+	// is found, so SourceFS may be, for example, an embed.FS holding the
+	// module's source files. If SourceFS is nil, or the file is not found
+	// in SourceFS, source files will be read from disk.
+	SourceFS fs.FS
+
 	requestDuration           time.Duration
 	metricsInterval           time.Duration
 	maxSpans                  int
@@ -139,6 +176,7 @@ type TracerOptions struct {
 	metricsBufferSize         int
 	sampler                   Sampler
 	sanitizedFieldNames       wildcard.Matchers
+	redactor                  *redactor
 	disabledMetrics           wildcard.Matchers
 	ignoreTransactionURLs     wildcard.Matchers
 	continuationStrategy      string
@@ -146,10 +184,15 @@ type TracerOptions struct {
 	captureBody               CaptureBodyMode
 	spanStackTraceMinDuration time.Duration
 	stackTraceLimit           int
+	sourceLinesErrorAppFrames int
+	sourceLinesSpanAppFrames  int
+	errorMessageNormalization bool
 	active                    bool
 	recording                 bool
 	configWatcher             apmconfig.Watcher
+	configFileWatcher         *configFileWatcher
 	breakdownMetrics          bool
+	durationHistograms        bool
 	propagateLegacyHeader     bool
 	profileSender             profileSender
 	versionGetter             majorVersionGetter
@@ -159,6 +202,16 @@ type TracerOptions struct {
 	exitSpanMinDuration       time.Duration
 	compressionOptions        compressionOptions
 	globalLabels              model.StringMap
+	serviceNodeName           string
+	configEnv                 configutil.Env
+
+	usePathAsTransactionName     bool
+	transactionNameGroups        wildcard.Matchers
+	transactionNameIncludeMethod bool
+
+	captureResponseBody             CaptureBodyMode
+	captureResponseBodyContentTypes wildcard.Matchers
+	captureResponseBodyStatusCodes  statusCodeMatchers
 }
 
 // initDefaults updates opts with default values.
@@ -172,121 +225,180 @@ func (opts *TracerOptions) initDefaults(continueOnError bool) error {
 		return true
 	}
 
-	requestDuration, err := initialRequestDuration()
+	// The configuration file must be loaded first,
+	// as it provides defaults for environment variables.
+	configFile, fileConfig, err := initialConfigFile(opts.ConfigFile)
+	failed(err)
+	env := configutil.NewEnv(fileConfig)
+
+	configFileWatchInterval, err := initialConfigFileWatchInterval(env)
+	if failed(err) {
+		configFileWatchInterval = 0
+	}
+	if opts.ConfigFileWatchInterval != 0 {
+		configFileWatchInterval = opts.ConfigFileWatchInterval
+	}
+
+	requestDuration, err := initialRequestDuration(env)
 	if failed(err) {
 		requestDuration = defaultAPIRequestTime
 	}
 
-	metricsInterval, err := initialMetricsInterval()
+	metricsInterval, err := initialMetricsInterval(env)
 	if err != nil {
 		metricsInterval = defaultMetricsInterval
 		errs = append(errs, err)
 	}
 
-	requestSize, err := initialAPIRequestSize()
+	requestSize, err := initialAPIRequestSize(env)
 	if err != nil {
 		requestSize = int(defaultAPIRequestSize)
 		errs = append(errs, err)
 	}
 
-	bufferSize, err := initialAPIBufferSize()
+	bufferSize, err := initialAPIBufferSize(env)
 	if err != nil {
 		bufferSize = int(defaultAPIBufferSize)
 		errs = append(errs, err)
 	}
 
-	metricsBufferSize, err := initialMetricsBufferSize()
+	metricsBufferSize, err := initialMetricsBufferSize(env)
 	if err != nil {
 		metricsBufferSize = int(defaultMetricsBufferSize)
 		errs = append(errs, err)
 	}
 
-	maxSpans, err := initialMaxSpans()
+	maxSpans, err := initialMaxSpans(env)
 	if failed(err) {
 		maxSpans = defaultMaxSpans
 	}
 
-	spanCompressionEnabled, err := initialSpanCompressionEnabled()
+	spanCompressionEnabled, err := initialSpanCompressionEnabled(env)
 	if failed(err) {
 		spanCompressionEnabled = defaultSpanCompressionEnabled
 	}
 
-	spanCompressionExactMatchMaxDuration, err := initialSpanCompressionExactMatchMaxDuration()
+	spanCompressionExactMatchMaxDuration, err := initialSpanCompressionExactMatchMaxDuration(env)
 	if failed(err) {
 		spanCompressionExactMatchMaxDuration = defaultSpanCompressionExactMatchMaxDuration
 	}
 
-	spanCompressionSameKindMaxDuration, err := initialSpanCompressionSameKindMaxDuration()
+	spanCompressionSameKindMaxDuration, err := initialSpanCompressionSameKindMaxDuration(env)
 	if failed(err) {
 		spanCompressionSameKindMaxDuration = defaultSpanCompressionSameKindMaxDuration
 	}
 
-	sampler, err := initialSampler()
+	sampler, err := initialSampler(env)
 	if failed(err) {
 		sampler = nil
 	}
 
-	captureHeaders, err := initialCaptureHeaders()
+	captureHeaders, err := initialCaptureHeaders(env)
 	if failed(err) {
 		captureHeaders = defaultCaptureHeaders
 	}
 
-	captureBody, err := initialCaptureBody()
+	captureBody, err := initialCaptureBody(env)
 	if failed(err) {
 		captureBody = CaptureBodyOff
 	}
 
-	spanStackTraceMinDuration, err := initialSpanStackTraceMinDuration()
+	captureResponseBody, err := initialCaptureResponseBody(env)
+	if failed(err) {
+		captureResponseBody = CaptureBodyOff
+	}
+
+	redactionRules, err := initialRedactor(env)
+	if failed(err) {
+		redactionRules = nil
+	}
+
+	captureResponseBodyStatusCodes, err := initialCaptureResponseBodyStatusCodes(env)
+	if failed(err) {
+		captureResponseBodyStatusCodes, _ = parseStatusCodeMatchers(defaultCaptureResponseBodyStatusCodes)
+	}
+
+	spanStackTraceMinDuration, err := initialSpanStackTraceMinDuration(env)
 	if failed(err) {
 		spanStackTraceMinDuration = defaultSpanStackTraceMinDuration
 	}
 
-	stackTraceLimit, err := initialStackTraceLimit()
+	stackTraceLimit, err := initialStackTraceLimit(env)
 	if failed(err) {
 		stackTraceLimit = defaultStackTraceLimit
 	}
 
-	active, err := initialActive()
+	sourceLinesErrorAppFrames, err := initialSourceLines(env, envSourceLinesErrorAppFrames)
+	if failed(err) {
+		sourceLinesErrorAppFrames = 0
+	}
+
+	sourceLinesSpanAppFrames, err := initialSourceLines(env, envSourceLinesSpanAppFrames)
+	if failed(err) {
+		sourceLinesSpanAppFrames = 0
+	}
+
+	errorMessageNormalization, err := initialErrorMessageNormalization(env)
+	if failed(err) {
+		errorMessageNormalization = false
+	}
+
+	active, err := initialActive(env)
 	if failed(err) {
 		active = true
 	}
 
-	recording, err := initialRecording()
+	recording, err := initialRecording(env)
 	if failed(err) {
 		recording = true
 	}
 
-	centralConfigEnabled, err := initialCentralConfigEnabled()
+	centralConfigEnabled, err := initialCentralConfigEnabled(env)
 	if failed(err) {
 		centralConfigEnabled = true
 	}
 
-	breakdownMetricsEnabled, err := initialBreakdownMetricsEnabled()
+	breakdownMetricsEnabled, err := initialBreakdownMetricsEnabled(env)
 	if failed(err) {
 		breakdownMetricsEnabled = true
 	}
 
-	propagateLegacyHeader, err := initialUseElasticTraceparentHeader()
+	durationHistogramsEnabled, err := initialDurationHistogramsEnabled(env)
+	if failed(err) {
+		durationHistogramsEnabled = false
+	}
+
+	propagateLegacyHeader, err := initialUseElasticTraceparentHeader(env)
 	if failed(err) {
 		propagateLegacyHeader = true
 	}
 
-	cpuProfileInterval, cpuProfileDuration, err := initialCPUProfileIntervalDuration()
+	usePathAsTransactionName, err := initialUsePathAsTransactionName(env)
+	if failed(err) {
+		usePathAsTransactionName = false
+	}
+
+	transactionNameIncludeMethod, err := initialTransactionNameIncludeMethod(env)
+	if failed(err) {
+		transactionNameIncludeMethod = true
+	}
+
+	cpuProfileInterval, cpuProfileDuration, err := initialCPUProfileIntervalDuration(env)
 	if failed(err) {
 		cpuProfileInterval = 0
 		cpuProfileDuration = 0
 	}
-	heapProfileInterval, err := initialHeapProfileInterval()
+	heapProfileInterval, err := initialHeapProfileInterval(env)
 	if failed(err) {
 		heapProfileInterval = 0
 	}
 
-	exitSpanMinDuration, err := initialExitSpanMinDuration()
+	exitSpanMinDuration, err := initialExitSpanMinDuration(env)
 	if failed(err) {
 		exitSpanMinDuration = defaultExitSpanMinDuration
 	}
 
-	continuationStrategy, err := initContinuationStrategy()
+	continuationStrategy, err := initContinuationStrategy(env)
 	if failed(err) {
 		continuationStrategy = defaultContinuationStrategy
 	}
@@ -298,7 +410,7 @@ func (opts *TracerOptions) initDefaults(continueOnError bool) error {
 		}
 	}
 
-	serviceName, serviceVersion, serviceEnvironment := initialService()
+	serviceName, serviceVersion, serviceEnvironment := initialService(env)
 	if opts.ServiceName == "" {
 		opts.ServiceName = serviceName
 	}
@@ -310,7 +422,7 @@ func (opts *TracerOptions) initDefaults(continueOnError bool) error {
 	}
 
 	if opts.Transport == nil {
-		initialTransport, err := initialTransport(opts.ServiceName, opts.ServiceVersion)
+		initialTransport, err := initialTransport(env, opts.ServiceName, opts.ServiceVersion)
 		if failed(err) {
 			active = false
 		} else {
@@ -325,7 +437,9 @@ func (opts *TracerOptions) initDefaults(continueOnError bool) error {
 		log.Printf("[apm]: %s", err)
 	}
 
-	opts.globalLabels = parseGlobalLabels()
+	opts.globalLabels = parseGlobalLabels(env)
+	opts.serviceNodeName = env.Getenv(envServiceNodeName)
+	opts.configEnv = env
 	opts.requestDuration = requestDuration
 	opts.metricsInterval = metricsInterval
 	opts.requestSize = requestSize
@@ -338,14 +452,25 @@ func (opts *TracerOptions) initDefaults(continueOnError bool) error {
 		sameKindMaxDuration:   spanCompressionSameKindMaxDuration,
 	}
 	opts.sampler = sampler
-	opts.sanitizedFieldNames = initialSanitizedFieldNames()
-	opts.disabledMetrics = initialDisabledMetrics()
-	opts.ignoreTransactionURLs = initialIgnoreTransactionURLs()
+	opts.sanitizedFieldNames = initialSanitizedFieldNames(env)
+	opts.redactor = redactionRules
+	opts.disabledMetrics = initialDisabledMetrics(env)
+	opts.ignoreTransactionURLs = initialIgnoreTransactionURLs(env)
+	opts.usePathAsTransactionName = usePathAsTransactionName
+	opts.transactionNameGroups = initialTransactionNameGroups(env)
+	opts.transactionNameIncludeMethod = transactionNameIncludeMethod
 	opts.breakdownMetrics = breakdownMetricsEnabled
+	opts.durationHistograms = durationHistogramsEnabled
 	opts.captureHeaders = captureHeaders
 	opts.captureBody = captureBody
+	opts.captureResponseBody = captureResponseBody
+	opts.captureResponseBodyContentTypes = initialCaptureResponseBodyContentTypes(env)
+	opts.captureResponseBodyStatusCodes = captureResponseBodyStatusCodes
 	opts.spanStackTraceMinDuration = spanStackTraceMinDuration
 	opts.stackTraceLimit = stackTraceLimit
+	opts.sourceLinesErrorAppFrames = sourceLinesErrorAppFrames
+	opts.sourceLinesSpanAppFrames = sourceLinesSpanAppFrames
+	opts.errorMessageNormalization = errorMessageNormalization
 	opts.active = active
 	opts.recording = recording
 	opts.propagateLegacyHeader = propagateLegacyHeader
@@ -356,6 +481,15 @@ func (opts *TracerOptions) initDefaults(continueOnError bool) error {
 			opts.configWatcher = cw
 		}
 	}
+	if fileConfig != nil && configFileWatchInterval > 0 {
+		opts.configFileWatcher = newConfigFileWatcher(configFile, fileConfig, configFileWatchInterval)
+		var cw apmconfig.Watcher = opts.configFileWatcher
+		if opts.configWatcher != nil {
+			// Central config takes precedence over the file.
+			cw = apmconfig.MergeWatchers(cw, opts.configWatcher)
+		}
+		opts.configWatcher = cw
+	}
 	if ps, ok := opts.Transport.(profileSender); ok {
 		opts.profileSender = ps
 		opts.cpuProfileInterval = cpuProfileInterval
@@ -417,6 +551,33 @@ type Tracer struct {
 	// using Tracer.instrumentationConfig() and Tracer.setInstrumentationConfig().
 	instrumentationConfigInternal *instrumentationConfig
 
+	// apiConfig records the environment variable names of
+	// config set by calling the Tracer's methods.
+	apiConfig sync.Map
+
+	// remoteConfig holds the most recently applied remote config.
+	remoteConfig atomic.Pointer[map[string]string]
+
+	// configFileWatcher, if non-nil, watches the configuration file.
+	configFileWatcher *configFileWatcher
+
+	// configEnv holds the environment variables and configuration
+	// file settings from which the tracer was configured.
+	configEnv configutil.Env
+
+	metricsRegistry *MetricsRegistry
+
+	// durationHistograms records transaction and
+	// exit span duration histograms, if enabled.
+	durationHistograms *durationHistograms
+
+	// kubernetesMetadata holds the discovered Kubernetes metadata,
+	// and must only be accessed by the tracer loop once started.
+	// Metadata discovered using the Kubernetes API is sent to the
+	// loop on kubernetesDiscovered.
+	kubernetesMetadata   kubernetesMetadata
+	kubernetesDiscovered chan kubernetesMetadata
+
 	errorDataPool       sync.Pool
 	spanDataPool        sync.Pool
 	transactionDataPool sync.Pool
@@ -451,6 +612,7 @@ func newTracer(opts TracerOptions) *Tracer {
 			opts.ServiceName,
 			opts.ServiceVersion,
 			opts.ServiceEnvironment,
+			opts.serviceNodeName,
 		),
 		process:           &currentProcess,
 		system:            &localSystem,
@@ -471,9 +633,14 @@ func newTracer(opts TracerOptions) *Tracer {
 		instrumentationConfigInternal: &instrumentationConfig{
 			local: make(map[string]func(*instrumentationConfigValues)),
 		},
-		globalLabels: opts.globalLabels,
+		globalLabels:      opts.globalLabels,
+		configFileWatcher: opts.configFileWatcher,
+		configEnv:         opts.configEnv,
+		metricsRegistry:   NewMetricsRegistry(),
 	}
 	t.breakdownMetrics.enabled = opts.breakdownMetrics
+	t.durationHistograms = newDurationHistograms()
+	t.durationHistograms.enabled = opts.durationHistograms
 	// Initialise local transaction config.
 	t.setLocalInstrumentationConfig(envRecording, func(cfg *instrumentationConfigValues) {
 		cfg.recording = opts.recording
@@ -481,6 +648,15 @@ func newTracer(opts TracerOptions) *Tracer {
 	t.setLocalInstrumentationConfig(envCaptureBody, func(cfg *instrumentationConfigValues) {
 		cfg.captureBody = opts.captureBody
 	})
+	t.setLocalInstrumentationConfig(envCaptureResponseBody, func(cfg *instrumentationConfigValues) {
+		cfg.captureResponseBody = opts.captureResponseBody
+	})
+	t.setLocalInstrumentationConfig(envCaptureResponseBodyContentTypes, func(cfg *instrumentationConfigValues) {
+		cfg.captureResponseBodyContentTypes = opts.captureResponseBodyContentTypes
+	})
+	t.setLocalInstrumentationConfig(envCaptureResponseBodyStatusCodes, func(cfg *instrumentationConfigValues) {
+		cfg.captureResponseBodyStatusCodes = opts.captureResponseBodyStatusCodes
+	})
 	t.setLocalInstrumentationConfig(envCaptureHeaders, func(cfg *instrumentationConfigValues) {
 		cfg.captureHeaders = opts.captureHeaders
 	})
@@ -511,9 +687,21 @@ func newTracer(opts TracerOptions) *Tracer {
 	t.setLocalInstrumentationConfig(envSanitizeFieldNames, func(cfg *instrumentationConfigValues) {
 		cfg.sanitizedFieldNames = opts.sanitizedFieldNames
 	})
+	t.setLocalInstrumentationConfig(envRedactionRules, func(cfg *instrumentationConfigValues) {
+		cfg.redactor = opts.redactor
+	})
 	t.setLocalInstrumentationConfig(envIgnoreURLs, func(cfg *instrumentationConfigValues) {
 		cfg.ignoreTransactionURLs = opts.ignoreTransactionURLs
 	})
+	t.setLocalInstrumentationConfig(envUsePathAsTransactionName, func(cfg *instrumentationConfigValues) {
+		cfg.usePathAsTransactionName = opts.usePathAsTransactionName
+	})
+	t.setLocalInstrumentationConfig(envTransactionNameGroups, func(cfg *instrumentationConfigValues) {
+		cfg.transactionNameGroups = opts.transactionNameGroups
+	})
+	t.setLocalInstrumentationConfig(envTransactionNameIncludeMethod, func(cfg *instrumentationConfigValues) {
+		cfg.transactionNameIncludeMethod = opts.transactionNameIncludeMethod
+	})
 	t.setLocalInstrumentationConfig(envExitSpanMinDuration, func(cfg *instrumentationConfigValues) {
 		cfg.exitSpanMinDuration = opts.exitSpanMinDuration
 	})
@@ -535,17 +723,36 @@ func newTracer(opts TracerOptions) *Tracer {
 		return t
 	}
 
+	t.discoverKubernetesMetadata()
 	go t.loop()
 	t.configCommands <- func(cfg *tracerConfig) {
 		cfg.recording = opts.recording
-		cfg.cpuProfileInterval = opts.cpuProfileInterval
-		cfg.cpuProfileDuration = opts.cpuProfileDuration
-		cfg.heapProfileInterval = opts.heapProfileInterval
-		cfg.metricsInterval = opts.metricsInterval
-		cfg.requestDuration = opts.requestDuration
-		cfg.requestSize = opts.requestSize
-		cfg.disabledMetrics = opts.disabledMetrics
-		cfg.metricsGatherers = []MetricsGatherer{newBuiltinMetricsGatherer(t)}
+		cfg.setLocal(envCPUProfileInterval, func(cfg *tracerConfig) {
+			cfg.cpuProfileInterval = opts.cpuProfileInterval
+		})
+		cfg.setLocal(envCPUProfileDuration, func(cfg *tracerConfig) {
+			cfg.cpuProfileDuration = opts.cpuProfileDuration
+		})
+		cfg.setLocal(envHeapProfileInterval, func(cfg *tracerConfig) {
+			cfg.heapProfileInterval = opts.heapProfileInterval
+		})
+		cfg.setLocal(envMetricsInterval, func(cfg *tracerConfig) {
+			cfg.metricsInterval = opts.metricsInterval
+		})
+		cfg.setLocal(envAPIRequestTime, func(cfg *tracerConfig) {
+			cfg.requestDuration = opts.requestDuration
+		})
+		cfg.setLocal(envAPIRequestSize, func(cfg *tracerConfig) {
+			cfg.requestSize = opts.requestSize
+		})
+		cfg.setLocal(envDisableMetrics, func(cfg *tracerConfig) {
+			cfg.disabledMetrics = opts.disabledMetrics
+		})
+		cfg.sourceLinesErrorAppFrames = opts.sourceLinesErrorAppFrames
+		cfg.sourceLinesSpanAppFrames = opts.sourceLinesSpanAppFrames
+		cfg.sourceFS = opts.SourceFS
+		cfg.errorMessageNormalization = opts.errorMessageNormalization
+		cfg.metricsGatherers = []MetricsGatherer{newBuiltinMetricsGatherer(t), t.metricsRegistry}
 		if logger := apmlog.DefaultLogger(); logger != nil {
 			cfg.logger = logger
 		}
@@ -569,6 +776,43 @@ type tracerConfig struct {
 	cpuProfileDuration  time.Duration
 	cpuProfileInterval  time.Duration
 	heapProfileInterval time.Duration
+
+	// sourceLinesErrorAppFrames and sourceLinesSpanAppFrames hold the
+	// number of source lines to record for application stack frames
+	// of errors and spans, and sourceFS holds the file system from
+	// which source files are read, if any.
+	sourceLinesErrorAppFrames int
+	sourceLinesSpanAppFrames  int
+	sourceFS                  fs.FS
+
+	// errorMessageNormalization controls whether error messages are
+	// normalized into parameterized messages, for grouping errors.
+	errorMessageNormalization bool
+
+	// eventProcessors holds the event processors added with
+	// Tracer.AddEventProcessor, in the order they were added.
+	eventProcessors []*struct{ EventProcessor }
+
+	// local holds functions for reverting to local config,
+	// keyed by environment variable name, for config that may
+	// be overridden by central config.
+	local map[string]tracerConfigCommand
+
+	// remote holds the environment variable names of config
+	// currently overridden by central config.
+	remote map[string]struct{}
+}
+
+// setLocal sets local config with the specified environment
+// variable key, applying it unless overridden by central config.
+func (cfg *tracerConfig) setLocal(envKey string, f tracerConfigCommand) {
+	if cfg.local == nil {
+		cfg.local = make(map[string]tracerConfigCommand)
+	}
+	cfg.local[envKey] = f
+	if _, ok := cfg.remote[envKey]; !ok {
+		f(cfg)
+	}
 }
 
 type tracerConfigCommand func(*tracerConfig)
@@ -628,17 +872,31 @@ func (t *Tracer) ShouldPropagateLegacyHeader() bool {
 // SetRequestDuration sets the maximum amount of time to keep a request open
 // to the APM server for streaming data before closing the stream and starting
 // a new request.
+//
+// Configuration via Kibana takes precedence over local configuration, so
+// if api_request_time has been configured via Kibana, this call will
+// not have any effect until/unless that configuration has been removed.
 func (t *Tracer) SetRequestDuration(d time.Duration) {
+	t.apiConfig.Store(envAPIRequestTime, struct{}{})
 	t.sendConfigCommand(func(cfg *tracerConfig) {
-		cfg.requestDuration = d
+		cfg.setLocal(envAPIRequestTime, func(cfg *tracerConfig) {
+			cfg.requestDuration = d
+		})
 	})
 }
 
 // SetMetricsInterval sets the metrics interval -- the amount of time in
 // between metrics samples being gathered.
+//
+// Configuration via Kibana takes precedence over local configuration, so
+// if metrics_interval has been configured via Kibana, this call will
+// not have any effect until/unless that configuration has been removed.
 func (t *Tracer) SetMetricsInterval(d time.Duration) {
+	t.apiConfig.Store(envMetricsInterval, struct{}{})
 	t.sendConfigCommand(func(cfg *tracerConfig) {
-		cfg.metricsInterval = d
+		cfg.setLocal(envMetricsInterval, func(cfg *tracerConfig) {
+			cfg.metricsInterval = d
+		})
 	})
 }
 
@@ -671,21 +929,76 @@ func (t *Tracer) SetSanitizedFieldNames(patterns ...string) error {
 			matchers[i] = configutil.ParseWildcardPattern(p)
 		}
 	}
-	t.setLocalInstrumentationConfig(envSanitizeFieldNames, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envSanitizeFieldNames, func(cfg *instrumentationConfigValues) {
 		cfg.sanitizedFieldNames = matchers
 	})
 	return nil
 }
 
+// SetRedactionRules sets the rules that will be used to redact sensitive
+// values from captured request and response bodies, URL query values,
+// database statements, and custom context. These rules are applied in
+// addition to those specified by SetSanitizedFieldNames.
+//
+// SetRedactionRules returns an error if any of the rules are invalid.
+func (t *Tracer) SetRedactionRules(rules ...RedactionRule) error {
+	r, err := newRedactor(rules)
+	if err != nil {
+		return err
+	}
+	t.setAPIInstrumentationConfig(envRedactionRules, func(cfg *instrumentationConfigValues) {
+		cfg.redactor = r
+	})
+	return nil
+}
+
 // SetIgnoreTransactionURLs sets the wildcard patterns that will be used to
 // ignore transactions with matching URLs.
 func (t *Tracer) SetIgnoreTransactionURLs(pattern string) error {
-	t.setLocalInstrumentationConfig(envIgnoreURLs, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envIgnoreURLs, func(cfg *instrumentationConfigValues) {
 		cfg.ignoreTransactionURLs = configutil.ParseWildcardPatterns(pattern)
 	})
 	return nil
 }
 
+// SetUsePathAsTransactionName sets whether HTTP server transactions
+// are named after the request URL path, rather than the matched route.
+//
+// See HTTPTransactionName for details.
+func (t *Tracer) SetUsePathAsTransactionName(v bool) {
+	t.setAPIInstrumentationConfig(envUsePathAsTransactionName, func(cfg *instrumentationConfigValues) {
+		cfg.usePathAsTransactionName = v
+	})
+}
+
+// SetTransactionNameGroups sets the wildcard patterns that will be used
+// to group HTTP server transaction names by URL path, such as
+// "/user/*/cart".
+//
+// See HTTPTransactionName for details.
+func (t *Tracer) SetTransactionNameGroups(pattern string) error {
+	t.setAPIInstrumentationConfig(envTransactionNameGroups, func(cfg *instrumentationConfigValues) {
+		cfg.transactionNameGroups = configutil.ParseWildcardPatterns(pattern)
+	})
+	return nil
+}
+
+// SetTransactionNameIncludeMethod sets whether HTTP server transaction
+// names are prefixed with the request method. The method is included
+// by default.
+func (t *Tracer) SetTransactionNameIncludeMethod(v bool) {
+	t.setAPIInstrumentationConfig(envTransactionNameIncludeMethod, func(cfg *instrumentationConfigValues) {
+		cfg.transactionNameIncludeMethod = v
+	})
+}
+
+// MetricsRegistry returns the tracer's MetricsRegistry, for recording
+// application-defined metrics. The registry's metrics are gathered
+// periodically along with the tracer's builtin metrics.
+func (t *Tracer) MetricsRegistry() *MetricsRegistry {
+	return t.metricsRegistry
+}
+
 // RegisterMetricsGatherer registers g for periodic (or forced) metrics
 // gathering by t.
 //
@@ -744,7 +1057,7 @@ func (t *Tracer) sendConfigCommand(cmd tracerConfigCommand) {
 //
 // SetRecording does not affect in-flight events.
 func (t *Tracer) SetRecording(r bool) {
-	t.setLocalInstrumentationConfig(envRecording, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envRecording, func(cfg *instrumentationConfigValues) {
 		// Update instrumentation config to disable transactions and errors.
 		cfg.recording = r
 	})
@@ -763,7 +1076,7 @@ func (t *Tracer) SetRecording(r bool) {
 // if sampling has been configured via Kibana, this call will not have any
 // effect until/unless that configuration has been removed.
 func (t *Tracer) SetSampler(s Sampler) {
-	t.setLocalInstrumentationConfig(envTransactionSampleRate, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envTransactionSampleRate, func(cfg *instrumentationConfigValues) {
 		cfg.sampler = s
 	})
 }
@@ -774,14 +1087,14 @@ func (t *Tracer) SetSampler(s Sampler) {
 // Passing in zero will disable all spans, while negative values will
 // permit an unlimited number of spans.
 func (t *Tracer) SetMaxSpans(n int) {
-	t.setLocalInstrumentationConfig(envMaxSpans, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envMaxSpans, func(cfg *instrumentationConfigValues) {
 		cfg.maxSpans = n
 	})
 }
 
 // SetSpanCompressionEnabled enables/disables the span compression feature.
 func (t *Tracer) SetSpanCompressionEnabled(v bool) {
-	t.setLocalInstrumentationConfig(envSpanCompressionEnabled, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envSpanCompressionEnabled, func(cfg *instrumentationConfigValues) {
 		cfg.compressionOptions.enabled = v
 	})
 }
@@ -789,7 +1102,7 @@ func (t *Tracer) SetSpanCompressionEnabled(v bool) {
 // SetSpanCompressionExactMatchMaxDuration sets the maximum duration for a span
 // to be compressed with `compression_strategy` == `exact_match`.
 func (t *Tracer) SetSpanCompressionExactMatchMaxDuration(v time.Duration) {
-	t.setLocalInstrumentationConfig(envSpanCompressionExactMatchMaxDuration, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envSpanCompressionExactMatchMaxDuration, func(cfg *instrumentationConfigValues) {
 		cfg.compressionOptions.exactMatchMaxDuration = v
 	})
 }
@@ -797,7 +1110,7 @@ func (t *Tracer) SetSpanCompressionExactMatchMaxDuration(v time.Duration) {
 // SetSpanCompressionSameKindMaxDuration sets the maximum duration for a span
 // to be compressed with `compression_strategy` == `same_kind`.
 func (t *Tracer) SetSpanCompressionSameKindMaxDuration(v time.Duration) {
-	t.setLocalInstrumentationConfig(envSpanCompressionSameKindMaxDuration, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envSpanCompressionSameKindMaxDuration, func(cfg *instrumentationConfigValues) {
 		cfg.compressionOptions.sameKindMaxDuration = v
 	})
 }
@@ -805,7 +1118,7 @@ func (t *Tracer) SetSpanCompressionSameKindMaxDuration(v time.Duration) {
 // SetSpanStackTraceMinDuration sets the minimum duration for a span after which
 // we will capture its stack frames.
 func (t *Tracer) SetSpanStackTraceMinDuration(d time.Duration) {
-	t.setLocalInstrumentationConfig(envMaxSpans, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envSpanStackTraceMinDuration, func(cfg *instrumentationConfigValues) {
 		cfg.spanStackTraceMinDuration = d
 	})
 }
@@ -813,36 +1126,92 @@ func (t *Tracer) SetSpanStackTraceMinDuration(d time.Duration) {
 // SetStackTraceLimit sets the the maximum number of stack frames to collect
 // for each stack trace. If limit is negative, then all frames will be collected.
 func (t *Tracer) SetStackTraceLimit(limit int) {
-	t.setLocalInstrumentationConfig(envMaxSpans, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envStackTraceLimit, func(cfg *instrumentationConfigValues) {
 		cfg.stackTraceLimit = limit
 	})
 }
 
+// SetErrorGroupingKeyFunc sets a function for computing the grouping key of
+// log errors, which is called when an error with a log message and without
+// a GroupingKey is sent. The function is not called for errors without a log
+// message, such as those created with NewError, as APM Server groups these
+// by their exception type and stack frames. The function may return an empty
+// string to leave the grouping to APM Server. If f is nil, errors are grouped
+// only by their GroupingKey field, if set.
+//
+// The function is called synchronously by Error.Send, and must not call
+// Send or modify the error other than through its return value.
+func (t *Tracer) SetErrorGroupingKeyFunc(f ErrorGroupingKeyFunc) {
+	t.updateInstrumentationConfig(func(cfg *instrumentationConfig) {
+		cfg.errorGroupingKey = f
+	})
+}
+
 // SetCaptureHeaders enables or disables capturing of HTTP headers.
 func (t *Tracer) SetCaptureHeaders(capture bool) {
-	t.setLocalInstrumentationConfig(envMaxSpans, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envCaptureHeaders, func(cfg *instrumentationConfigValues) {
 		cfg.captureHeaders = capture
 	})
 }
 
 // SetCaptureBody sets the HTTP request body capture mode.
 func (t *Tracer) SetCaptureBody(mode CaptureBodyMode) {
-	t.setLocalInstrumentationConfig(envMaxSpans, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envCaptureBody, func(cfg *instrumentationConfigValues) {
 		cfg.captureBody = mode
 	})
 }
 
+// SetCaptureResponseBody sets the HTTP response body capture mode.
+//
+// Response bodies are only captured for responses with a status code
+// and content type matching the configuration set by
+// SetCaptureResponseBodyStatusCodes and SetCaptureResponseBodyContentTypes.
+func (t *Tracer) SetCaptureResponseBody(mode CaptureBodyMode) {
+	t.setAPIInstrumentationConfig(envCaptureResponseBody, func(cfg *instrumentationConfigValues) {
+		cfg.captureResponseBody = mode
+	})
+}
+
+// SetCaptureResponseBodyContentTypes sets the wildcard patterns that will be
+// used to match the media type of HTTP responses whose bodies may be captured.
+func (t *Tracer) SetCaptureResponseBodyContentTypes(patterns ...string) {
+	var matchers wildcard.Matchers
+	if len(patterns) != 0 {
+		matchers = make(wildcard.Matchers, len(patterns))
+		for i, p := range patterns {
+			matchers[i] = configutil.ParseWildcardPattern(p)
+		}
+	}
+	t.setAPIInstrumentationConfig(envCaptureResponseBodyContentTypes, func(cfg *instrumentationConfigValues) {
+		cfg.captureResponseBodyContentTypes = matchers
+	})
+}
+
+// SetCaptureResponseBodyStatusCodes sets the HTTP status codes of responses
+// whose bodies may be captured. Each code may be either an exact status code,
+// such as "404", or a status code class, such as "5xx".
+func (t *Tracer) SetCaptureResponseBodyStatusCodes(codes ...string) error {
+	matchers, err := parseStatusCodeMatchers(strings.Join(codes, ","))
+	if err != nil {
+		return err
+	}
+	t.setAPIInstrumentationConfig(envCaptureResponseBodyStatusCodes, func(cfg *instrumentationConfigValues) {
+		cfg.captureResponseBodyStatusCodes = matchers
+	})
+	return nil
+}
+
 // SetExitSpanMinDuration sets the minimum duration for an exit span to not be
 // dropped.
 func (t *Tracer) SetExitSpanMinDuration(v time.Duration) {
-	t.setLocalInstrumentationConfig(envExitSpanMinDuration, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envExitSpanMinDuration, func(cfg *instrumentationConfigValues) {
 		cfg.exitSpanMinDuration = v
 	})
 }
 
 // SetContinuationStrategy sets the continuation strategy.
 func (t *Tracer) SetContinuationStrategy(v string) {
-	t.setLocalInstrumentationConfig(envContinuationStrategy, func(cfg *instrumentationConfigValues) {
+	t.setAPIInstrumentationConfig(envContinuationStrategy, func(cfg *instrumentationConfigValues) {
 		cfg.continuationStrategy = v
 	})
 }
@@ -1022,10 +1391,18 @@ func (t *Tracer) loop() {
 		case cmd := <-t.configCommands:
 			handleTracerConfigCommand(cmd)
 			continue
+		case kubernetes := <-t.kubernetesDiscovered:
+			// Report the discovered metadata from the next request.
+			t.kubernetesMetadata = kubernetes
+			t.kubernetesDiscovered = nil
+			metadata = nil
+			continue
 		case cw := <-t.configWatcher:
 			if configChanges != nil {
 				stopConfigWatcher()
-				t.updateRemoteConfig(cfg.logger, lastConfigChange, nil)
+				cmd := t.updateRemoteConfig(cfg.logger, lastConfigChange, nil)
+				handleTracerConfigCommand(cmd)
+				t.remoteConfig.Store(nil)
 				lastConfigChange = nil
 				configChanges = nil
 			}
@@ -1055,11 +1432,11 @@ func (t *Tracer) loop() {
 					cfg.logger.Errorf("config request failed: %s", change.Err)
 				}
 			} else {
-				t.updateRemoteConfig(cfg.logger, lastConfigChange, change.Attrs)
+				cmd := t.updateRemoteConfig(cfg.logger, lastConfigChange, change.Attrs)
 				lastConfigChange = change.Attrs
-				handleTracerConfigCommand(func(cfg *tracerConfig) {
-					cfg.recording = t.instrumentationConfig().recording
-				})
+				remoteConfig := change.Attrs
+				t.remoteConfig.Store(&remoteConfig)
+				handleTracerConfigCommand(cmd)
 			}
 			continue
 		case <-refreshVersionTicker.C:
@@ -1106,6 +1483,12 @@ func (t *Tracer) loop() {
 		case <-gatheredMetrics:
 			modelWriter.writeMetrics(&metrics)
 			gatheringMetrics = false
+			if sentMetrics != nil && metricsBuffer.Len() == 0 {
+				// All metrics were discarded by event processors,
+				// so there is nothing to send.
+				sentMetrics <- struct{}{}
+				sentMetrics = nil
+			}
 			flushRequest = true
 			if cfg.recording && cfg.metricsInterval > 0 {
 				metricsTimerStart = time.Now()
@@ -1334,9 +1717,53 @@ func (t *Tracer) metadataReader() io.Reader {
 	return bytes.NewReader(metadata.Bytes())
 }
 
+// discoverKubernetesMetadata reads Kubernetes metadata from the downward
+// API files, and starts querying the Kubernetes API in the background,
+// if configured. Querying the Kubernetes API can block, so the result
+// is sent to the tracer loop on t.kubernetesDiscovered, and reported in
+// the metadata of subsequent requests.
+func (t *Tracer) discoverKubernetesMetadata() {
+	var logger Logger
+	if l := apmlog.DefaultLogger(); l != nil {
+		logger = l
+	}
+	base := t.system.Kubernetes
+	pods := readKubernetesDownwardAPI(t.configEnv, logger)
+	t.kubernetesMetadata = makeKubernetesMetadata(t.configEnv, base, pods)
+
+	apiDiscovery, err := t.configEnv.ParseBoolEnv(envKubernetesAPIDiscovery, false)
+	if err != nil && logger != nil {
+		logger.Warningf("%s", err)
+	}
+	if !apiDiscovery {
+		return
+	}
+	t.kubernetesDiscovered = make(chan kubernetesMetadata, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		pod, err := getKubernetesAPIPod(ctx, base, pods)
+		if err != nil {
+			if logger != nil {
+				logger.Warningf("failed to get pod metadata from the Kubernetes API: %s", err)
+			}
+			return
+		}
+		t.kubernetesDiscovered <- makeKubernetesMetadata(t.configEnv, base, append(pods, pod))
+	}()
+}
+
 func (t *Tracer) encodeRequestMetadata(json *fastjson.Writer) {
+	system := t.system
+	globalLabels := t.globalLabels
+	if kubernetes := t.kubernetesMetadata; kubernetes.kubernetes != nil {
+		systemCopy := *system
+		systemCopy.Kubernetes = kubernetes.kubernetes
+		system = &systemCopy
+		globalLabels = mergeGlobalLabels(globalLabels, kubernetes.labels)
+	}
 	json.RawString(`{"system":`)
-	t.system.MarshalFastJSON(json)
+	system.MarshalFastJSON(json)
 	json.RawString(`,"process":`)
 	t.process.MarshalFastJSON(json)
 	json.RawString(`,"service":`)
@@ -1345,9 +1772,9 @@ func (t *Tracer) encodeRequestMetadata(json *fastjson.Writer) {
 		json.RawString(`,"cloud":`)
 		cloud.MarshalFastJSON(json)
 	}
-	if len(t.globalLabels) > 0 {
+	if len(globalLabels) > 0 {
 		json.RawString(`,"labels":`)
-		t.globalLabels.MarshalFastJSON(json)
+		globalLabels.MarshalFastJSON(json)
 	}
 	json.RawByte('}')
 }
@@ -1457,9 +1884,31 @@ type majorVersionGetter interface {
 	MajorServerVersion(ctx context.Context, refreshStale bool) uint32
 }
 
-func parseGlobalLabels() model.StringMap {
+// mergeGlobalLabels returns the global labels with the additional
+// labels appended, excluding any whose keys are already defined.
+func mergeGlobalLabels(labels, additional model.StringMap) model.StringMap {
+	if len(additional) == 0 {
+		return labels
+	}
+	merged := append(model.StringMap(nil), labels...)
+	for _, label := range additional {
+		var exists bool
+		for _, existing := range labels {
+			if existing.Key == label.Key {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			merged = append(merged, label)
+		}
+	}
+	return merged
+}
+
+func parseGlobalLabels(env configutil.Env) model.StringMap {
 	var labels model.StringMap
-	for _, kv := range configutil.ParseListEnv(envGlobalLabels, ",", nil) {
+	for _, kv := range env.ParseListEnv(envGlobalLabels, ",", nil) {
 		i := strings.IndexRune(kv, '=')
 		if i > 0 {
 			k, v := strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:])
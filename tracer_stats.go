@@ -28,6 +28,14 @@ type TracerStats struct {
 	TransactionsDropped uint64
 	SpansSent           uint64
 	SpansDropped        uint64
+
+	// TransactionsFiltered, SpansFiltered, ErrorsFiltered and
+	// MetricsetsFiltered hold the number of events discarded
+	// by event processors.
+	TransactionsFiltered uint64
+	SpansFiltered        uint64
+	ErrorsFiltered       uint64
+	MetricsetsFiltered   uint64
 }
 
 // TracerStatsErrors holds error statistics for a Tracer.
@@ -49,6 +57,10 @@ func (s *TracerStats) accumulate(rhs TracerStats) {
 	atomic.AddUint64(&s.SpansDropped, rhs.SpansDropped)
 	atomic.AddUint64(&s.TransactionsSent, rhs.TransactionsSent)
 	atomic.AddUint64(&s.TransactionsDropped, rhs.TransactionsDropped)
+	atomic.AddUint64(&s.TransactionsFiltered, rhs.TransactionsFiltered)
+	atomic.AddUint64(&s.SpansFiltered, rhs.SpansFiltered)
+	atomic.AddUint64(&s.ErrorsFiltered, rhs.ErrorsFiltered)
+	atomic.AddUint64(&s.MetricsetsFiltered, rhs.MetricsetsFiltered)
 }
 
 // copy returns a copy of the most recent tracer stats.
@@ -63,5 +75,10 @@ func (s *TracerStats) copy() TracerStats {
 		TransactionsDropped: atomic.LoadUint64(&s.TransactionsDropped),
 		SpansSent:           atomic.LoadUint64(&s.SpansSent),
 		SpansDropped:        atomic.LoadUint64(&s.SpansDropped),
+
+		TransactionsFiltered: atomic.LoadUint64(&s.TransactionsFiltered),
+		SpansFiltered:        atomic.LoadUint64(&s.SpansFiltered),
+		ErrorsFiltered:       atomic.LoadUint64(&s.ErrorsFiltered),
+		MetricsetsFiltered:   atomic.LoadUint64(&s.MetricsetsFiltered),
 	}
 }
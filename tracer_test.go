@@ -29,6 +29,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"sync"
@@ -517,6 +518,35 @@ func TestTracerKubernetesMetadata(t *testing.T) {
 			},
 		}, system.Kubernetes)
 	})
+
+	t.Run("downward-api", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte("shop"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "name"), []byte("frontend-1"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "uid"), []byte("8d0d4e5c"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "labels"), []byte(
+			"app=\"frontend\"\napp.kubernetes.io/version=\"1.2.3\"\ntier=\"web\"\nteam=\"checkout\"\n",
+		), 0644))
+
+		system, _, _, labels := getSubprocessMetadata(t,
+			"ELASTIC_APM_KUBERNETES_DOWNWARD_API_PATH="+dir,
+			"ELASTIC_APM_KUBERNETES_POD_LABELS=app*,tier",
+			"ELASTIC_APM_GLOBAL_LABELS=tier=backend",
+			"KUBERNETES_POD_NAME=luna", // environment variables take precedence
+		)
+		assert.Equal(t, &model.Kubernetes{
+			Namespace: "shop",
+			Pod: &model.KubernetesPod{
+				Name: "luna",
+				UID:  "8d0d4e5c",
+			},
+		}, system.Kubernetes)
+		assert.Equal(t, model.StringMap{
+			{Key: "app", Value: "frontend"},
+			{Key: "app_kubernetes_io/version", Value: "1.2.3"},
+			{Key: "tier", Value: "backend"}, // global labels take precedence
+		}, labels)
+	})
 }
 
 func TestTracerActive(t *testing.T) {
@@ -74,8 +74,10 @@ func (t *Tracer) StartTransactionOptions(name, transactionType string, opts Tran
 	tx.spanStackTraceMinDuration = instrumentationConfig.spanStackTraceMinDuration
 	tx.stackTraceLimit = instrumentationConfig.stackTraceLimit
 	tx.Context.captureHeaders = instrumentationConfig.captureHeaders
+	tx.Context.captureBody = instrumentationConfig.captureBody
 	tx.propagateLegacyHeader = instrumentationConfig.propagateLegacyHeader
 	tx.Context.sanitizedFieldNames = instrumentationConfig.sanitizedFieldNames
+	tx.Context.redactor = instrumentationConfig.redactor
 	tx.breakdownMetricsEnabled = t.breakdownMetrics.enabled
 
 	continuationStrategy := instrumentationConfig.continuationStrategy
@@ -99,10 +101,15 @@ func (t *Tracer) StartTransactionOptions(name, transactionType string, opts Tran
 		}
 	}
 
-	var root bool
+	var root, samplingDeferred bool
 	if opts.TraceContext.Trace.Validate() == nil && !shouldRestartTrace {
 		tx.traceContext.Trace = opts.TraceContext.Trace
 		tx.traceContext.Options = opts.TraceContext.Options
+		if samplingDeferred = opts.TraceContext.Options.SamplingDeferred(); samplingDeferred {
+			// The sampler decides whether to record the
+			// transaction, as for root transactions.
+			tx.traceContext.Options = 0
+		}
 		if opts.TraceContext.Span.Validate() == nil {
 			tx.parentID = opts.TraceContext.Span
 		}
@@ -127,7 +134,7 @@ func (t *Tracer) StartTransactionOptions(name, transactionType string, opts Tran
 		}
 	}
 
-	if root {
+	if root || samplingDeferred {
 		var result SampleResult
 		if instrumentationConfig.sampler != nil {
 			result = instrumentationConfig.sampler.Sample(SampleParams{
@@ -175,7 +182,9 @@ func (t *Tracer) StartTransactionOptions(name, transactionType string, opts Tran
 // TransactionOptions holds options for Tracer.StartTransactionOptions.
 type TransactionOptions struct {
 	// TraceContext holds the TraceContext for a new transaction. If this is
-	// zero, a new trace will be started.
+	// zero, a new trace will be started. If its Options report that sampling
+	// is deferred, the trace is continued and the tracer's sampler decides
+	// whether the transaction is recorded.
 	TraceContext TraceContext
 
 	// TransactionID holds the ID to assign to the transaction. If this is
@@ -237,6 +246,43 @@ func (tx *Transaction) ShouldPropagateLegacyHeader() bool {
 	return tx.propagateLegacyHeader
 }
 
+// ShouldCaptureHeaders reports whether instrumentation should capture
+// request and response headers, or equivalent metadata for protocols
+// other than HTTP, for the transaction and its spans.
+func (tx *Transaction) ShouldCaptureHeaders() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.ended() {
+		return false
+	}
+	return tx.Context.captureHeaders
+}
+
+// ShouldCaptureBody reports whether instrumentation should capture
+// request and response bodies, or equivalent messages for protocols
+// other than HTTP, for the transaction and its spans.
+func (tx *Transaction) ShouldCaptureBody() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.ended() {
+		return false
+	}
+	return tx.Context.captureBody&tx.Context.captureBodyMask != 0
+}
+
+// IsSanitizedFieldName reports whether the value of a field with the given
+// name, such as a header or metadata key, should be redacted according to
+// the configured sanitized field names. If the transaction has ended, then
+// IsSanitizedFieldName conservatively returns true.
+func (tx *Transaction) IsSanitizedFieldName(name string) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.ended() {
+		return true
+	}
+	return tx.Context.sanitizedFieldNames.MatchAny(name)
+}
+
 // EnsureParent returns the span ID for for tx's parent, generating a
 // parent span ID if one has not already been set and tx has not been
 // ended. If tx is nil or has been ended, a zero (invalid) SpanID is
@@ -288,6 +334,14 @@ func (tx *Transaction) ParentID() SpanID {
 	return tx.parentID
 }
 
+// Ended reports whether the transaction's End or Discard method has been
+// called. If Ended returns true, tx's TransactionData field is nil.
+func (tx *Transaction) Ended() bool {
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+	return tx.ended()
+}
+
 // Discard discards a previously started transaction.
 //
 // Calling Discard will set tx's TransactionData field to nil, so callers must
@@ -332,6 +386,7 @@ func (tx *Transaction) End() {
 				}
 			}
 		}
+		tx.tracer.durationHistograms.recordTransaction(tx.TransactionData)
 		// Hold the transaction data lock to check if the transaction has any
 		// compressed spans in its cache, if so, evict cache and end the span.
 		tx.TransactionData.mu.Lock()
@@ -0,0 +1,59 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.elastic.co/apm/v2/apmtest"
+)
+
+func TestHTTPTransactionName(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	assert.Equal(t, "GET /user/:id", tracer.HTTPTransactionName("GET", "/user/:id", "/user/123"))
+	assert.Equal(t, "GET unknown route", tracer.HTTPTransactionName("GET", "", "/user/123"))
+
+	tracer.SetUsePathAsTransactionName(true)
+	assert.Equal(t, "GET /user/123", tracer.HTTPTransactionName("GET", "/user/:id", "/user/123"))
+	assert.Equal(t, "GET /user/123", tracer.HTTPTransactionName("GET", "", "/user/123"))
+	assert.Equal(t, "GET unknown route", tracer.HTTPTransactionName("GET", "", ""))
+
+	tracer.SetTransactionNameGroups("/user/*/cart, /static/*")
+	assert.Equal(t, "GET /user/*/cart", tracer.HTTPTransactionName("GET", "/user/:id/cart", "/user/123/cart"))
+	assert.Equal(t, "GET /static/*", tracer.HTTPTransactionName("GET", "", "/static/css/main.css"))
+	assert.Equal(t, "GET /user/123", tracer.HTTPTransactionName("GET", "/user/:id", "/user/123"))
+
+	tracer.SetTransactionNameIncludeMethod(false)
+	assert.Equal(t, "/user/*/cart", tracer.HTTPTransactionName("GET", "/user/:id/cart", "/user/123/cart"))
+	assert.Equal(t, "/user/123", tracer.HTTPTransactionName("GET", "/user/:id", "/user/123"))
+}
+
+func TestHTTPTransactionNameEnv(t *testing.T) {
+	t.Setenv("ELASTIC_APM_USE_PATH_AS_TRANSACTION_NAME", "true")
+	t.Setenv("ELASTIC_APM_TRANSACTION_NAME_GROUPS", "/user/*")
+	t.Setenv("ELASTIC_APM_TRANSACTION_NAME_INCLUDE_METHOD", "false")
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	assert.Equal(t, "/user/*", tracer.HTTPTransactionName("GET", "/user/:id", "/user/123"))
+	assert.Equal(t, "/orders/1", tracer.HTTPTransactionName("GET", "/orders/:id", "/orders/1"))
+}
@@ -486,6 +486,34 @@ func TestTransactionSampleRateOmission(t *testing.T) {
 	}
 }
 
+func TestTransactionSamplingDeferred(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	for _, sampleRate := range []float64{0, 1} {
+		tracer.SetSampler(apm.NewRatioSampler(sampleRate))
+		tx := tracer.StartTransactionOptions("name", "type", apm.TransactionOptions{
+			TraceContext: apm.TraceContext{
+				Trace:   apm.TraceID{1},
+				Span:    apm.SpanID{1},
+				Options: apm.TraceOptions(0).WithRecorded(true).WithSamplingDeferred(true),
+			},
+		})
+		traceContext := tx.TraceContext()
+		assert.Equal(t, apm.TraceID{1}, traceContext.Trace)
+		assert.Equal(t, sampleRate == 1, traceContext.Options.Recorded())
+		assert.False(t, traceContext.Options.SamplingDeferred())
+		tx.End()
+	}
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	for _, tx := range payloads.Transactions {
+		assert.Equal(t, model.SpanID{1}, tx.ParentID)
+	}
+}
+
 func TestTransactionSpanLink(t *testing.T) {
 	tracer := apmtest.NewRecordingTracer()
 	defer tracer.Close()
@@ -534,12 +562,24 @@ func TestTransactionAddLink(t *testing.T) {
 	assert.Equal(t, expectedLinks, payloads.Transactions[0].Links)
 }
 
+func TestTransactionEnded(t *testing.T) {
+	tracer := apmtest.NewDiscardTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	assert.False(t, tx.Ended())
+	tx.End()
+	assert.True(t, tx.Ended())
+}
+
 func TestTransactionDiscard(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 
 	tx := tracer.StartTransaction("name", "type")
+	assert.False(t, tx.Ended())
 	tx.Discard()
+	assert.True(t, tx.Ended())
 	assert.Nil(t, tx.TransactionData)
 	tx.End() // ending after discarding should be a no-op
 
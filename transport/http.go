@@ -42,20 +42,13 @@ import (
 	"go.elastic.co/apm/v2/apmconfig"
 	"go.elastic.co/apm/v2/internal/apmversion"
 	"go.elastic.co/apm/v2/internal/configutil"
+	"go.elastic.co/apm/v2/internal/transportutil"
 )
 
 const (
 	intakePath  = "/intake/v2/events"
 	profilePath = "/intake/v2/profile"
 	configPath  = "/config/v1/agents"
-
-	envAPIKey        = "ELASTIC_APM_API_KEY"
-	envSecretToken   = "ELASTIC_APM_SECRET_TOKEN"
-	envServerURLs    = "ELASTIC_APM_SERVER_URLS"
-	envServerURL     = "ELASTIC_APM_SERVER_URL"
-	envServerTimeout = "ELASTIC_APM_SERVER_TIMEOUT"
-	envServerCert    = "ELASTIC_APM_SERVER_CERT"
-	envServerCACert  = "ELASTIC_APM_SERVER_CA_CERT_FILE"
 )
 
 var (
@@ -162,27 +155,27 @@ type HTTPTransport struct {
 // which can be used for streaming data to the APM Server.
 func NewHTTPTransport(opts HTTPTransportOptions) (*HTTPTransport, error) {
 	if opts.APIKey == "" {
-		opts.APIKey = os.Getenv(envAPIKey)
+		opts.APIKey = os.Getenv(transportutil.EnvAPIKey)
 	}
 	if len(opts.ServerURLs) == 0 {
-		serverURLs, err := initServerURLs()
+		serverURLs, err := transportutil.ServerURLs(configutil.Env{})
 		if err != nil {
 			return nil, err
 		}
 		opts.ServerURLs = serverURLs
 	}
 	if opts.TLSClientConfig == nil {
-		tlsClientConfig, err := newEnvTLSClientConfig()
+		tlsClientConfig, err := transportutil.TLSClientConfig(configutil.Env{})
 		if err != nil {
 			return nil, err
 		}
 		opts.TLSClientConfig = tlsClientConfig
 	}
 	if opts.SecretToken == "" && opts.APIKey == "" {
-		opts.SecretToken = os.Getenv(envSecretToken)
+		opts.SecretToken = os.Getenv(transportutil.EnvSecretToken)
 	}
 	if opts.ServerTimeout == 0 {
-		serverTimeout, err := configutil.ParseDurationEnv(envServerTimeout, defaultServerTimeout)
+		serverTimeout, err := configutil.ParseDurationEnv(transportutil.EnvServerTimeout, defaultServerTimeout)
 		if err != nil {
 			return nil, err
 		}
@@ -246,20 +239,6 @@ func newHTTPTransportOptions(opts HTTPTransportOptions) (*HTTPTransport, error)
 	return t, nil
 }
 
-func newEnvTLSClientConfig() (*tls.Config, error) {
-	verifyServerCert, err := checkVerifyServerCert()
-	if err != nil {
-		return nil, err
-	}
-	tlsClientConfig := &tls.Config{InsecureSkipVerify: !verifyServerCert}
-
-	err = addCertPath(tlsClientConfig)
-	if err != nil {
-		return nil, err
-	}
-	return tlsClientConfig, nil
-}
-
 // SetServerURL sets the APM Server URL (or URLs) for sending requests.
 // At least one URL must be specified, or the method will return an error.
 // The list will be randomly shuffled.
@@ -653,35 +632,6 @@ func (e *HTTPError) Error() string {
 	return msg
 }
 
-// initServerURLs parses ELASTIC_APM_SERVER_URLS if specified,
-// otherwise parses ELASTIC_APM_SERVER_URL if specified. If
-// neither are specified, then the default localhost URL is
-// returned.
-func initServerURLs() ([]*url.URL, error) {
-	key := envServerURLs
-	value := os.Getenv(key)
-	if value == "" {
-		key = envServerURL
-		value = os.Getenv(key)
-	}
-	var urls []*url.URL
-	for _, field := range strings.Split(value, ",") {
-		field = strings.TrimSpace(field)
-		if field == "" {
-			continue
-		}
-		u, err := url.Parse(field)
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to parse %s", key)
-		}
-		urls = append(urls, u)
-	}
-	if len(urls) == 0 {
-		urls = []*url.URL{defaultServerURL}
-	}
-	return urls, nil
-}
-
 func requestWithContext(ctx context.Context, req *http.Request) *http.Request {
 	url := req.URL
 	req.URL = nil
@@ -26,6 +26,7 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -36,6 +37,7 @@ import (
 	"go.elastic.co/apm/v2/internal/apmhostutil"
 	"go.elastic.co/apm/v2/internal/apmlog"
 	"go.elastic.co/apm/v2/internal/apmstrings"
+	"go.elastic.co/apm/v2/internal/configutil"
 	"go.elastic.co/apm/v2/model"
 )
 
@@ -92,7 +94,7 @@ func getCurrentProcess() model.Process {
 	}
 }
 
-func makeService(name, version, environment string) model.Service {
+func makeService(name, version, environment, nodeName string) model.Service {
 	service := model.Service{
 		Name:        truncateString(name),
 		Version:     truncateString(version),
@@ -102,9 +104,8 @@ func makeService(name, version, environment string) model.Service {
 		Runtime:     &goRuntime,
 	}
 
-	serviceNodeName := os.Getenv(envServiceNodeName)
-	if serviceNodeName != "" {
-		service.Node = &model.ServiceNode{ConfiguredName: truncateString(serviceNodeName)}
+	if nodeName != "" {
+		service.Node = &model.ServiceNode{ConfiguredName: truncateString(nodeName)}
 	}
 
 	return service
@@ -167,6 +168,138 @@ func getKubernetesMetadata() *model.Kubernetes {
 	return kubernetes
 }
 
+// kubernetesMetadata holds Kubernetes metadata discovered using the
+// downward API and Kubernetes API, along with labels derived from it.
+type kubernetesMetadata struct {
+	kubernetes *model.Kubernetes
+	labels     model.StringMap
+}
+
+// readKubernetesDownwardAPI returns the pod metadata read from the
+// downward API files, if ELASTIC_APM_KUBERNETES_DOWNWARD_API_PATH is
+// defined in env.
+func readKubernetesDownwardAPI(env configutil.Env, logger Logger) []*apmhostutil.KubernetesPod {
+	dir := env.Getenv(envKubernetesDownwardAPIPath)
+	if dir == "" {
+		return nil
+	}
+	pod, err := apmhostutil.ReadKubernetesDownwardAPI(dir)
+	if err != nil {
+		if logger != nil {
+			logger.Warningf("failed to read Kubernetes downward API files: %s", err)
+		}
+		return nil
+	}
+	return []*apmhostutil.KubernetesPod{pod}
+}
+
+// getKubernetesAPIPod queries the Kubernetes API for the metadata of
+// the pod identified by base and pods, falling back to the hostname
+// for the pod name.
+func getKubernetesAPIPod(
+	ctx context.Context, base *model.Kubernetes, pods []*apmhostutil.KubernetesPod,
+) (*apmhostutil.KubernetesPod, error) {
+	var namespace, name string
+	if base != nil {
+		namespace = base.Namespace
+		if base.Pod != nil {
+			name = base.Pod.Name
+		}
+	}
+	for _, pod := range pods {
+		if namespace == "" {
+			namespace = pod.Namespace
+		}
+		if name == "" {
+			name = pod.Name
+		}
+	}
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return apmhostutil.GetKubernetesPod(ctx, namespace, name)
+}
+
+// makeKubernetesMetadata returns the Kubernetes metadata in base,
+// supplemented with the discovered pod metadata, along with labels
+// derived from the discovered metadata. If no pods were discovered,
+// makeKubernetesMetadata returns the zero value.
+func makeKubernetesMetadata(
+	env configutil.Env, base *model.Kubernetes, pods []*apmhostutil.KubernetesPod,
+) kubernetesMetadata {
+	if len(pods) == 0 {
+		return kubernetesMetadata{}
+	}
+
+	// Discovered metadata supplements the metadata
+	// defined by environment variables and cgroups.
+	var kubernetes model.Kubernetes
+	var pod model.KubernetesPod
+	var node model.KubernetesNode
+	if base != nil {
+		kubernetes = *base
+		if base.Pod != nil {
+			pod = *base.Pod
+		}
+		if base.Node != nil {
+			node = *base.Node
+		}
+	}
+	var podLabels map[string]string
+	var owner *apmhostutil.KubernetesOwner
+	for _, discovered := range pods {
+		if kubernetes.Namespace == "" {
+			kubernetes.Namespace = truncateString(discovered.Namespace)
+		}
+		if pod.Name == "" {
+			pod.Name = truncateString(discovered.Name)
+		}
+		if pod.UID == "" {
+			pod.UID = truncateString(discovered.UID)
+		}
+		if node.Name == "" {
+			node.Name = truncateString(discovered.NodeName)
+		}
+		if discovered.Labels != nil {
+			podLabels = discovered.Labels
+		}
+		if discovered.Owner != nil {
+			owner = discovered.Owner
+		}
+	}
+	kubernetes.Pod, kubernetes.Node = nil, nil
+	if pod != (model.KubernetesPod{}) {
+		kubernetes.Pod = &pod
+	}
+	if node != (model.KubernetesNode{}) {
+		kubernetes.Node = &node
+	}
+
+	var labels model.StringMap
+	if owner != nil {
+		labels = append(labels, model.StringMapItem{
+			Key:   "kubernetes_" + strings.ToLower(owner.Kind) + "_name",
+			Value: truncateString(owner.Name),
+		})
+	}
+	if matchers := env.ParseWildcardPatternsEnv(envKubernetesPodLabels, nil); len(matchers) > 0 {
+		keys := make([]string, 0, len(podLabels))
+		for k := range podLabels {
+			if matchers.MatchAny(k) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			labels = append(labels, model.StringMapItem{
+				Key:   cleanLabelKey(k),
+				Value: truncateString(podLabels[k]),
+			})
+		}
+	}
+	return kubernetesMetadata{kubernetes: &kubernetes, labels: labels}
+}
+
 func getCloudMetadata() *model.Cloud {
 	// Querying cloud metadata can block, so we don't fetch it at
 	// package initialisation time. Instead, we defer until it is